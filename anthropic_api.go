@@ -0,0 +1,493 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"ch.at/providers"
+)
+
+// Anthropic Messages API facade. Requests are translated to the unified
+// format and routed like any other, so they can reach every deployment,
+// not just Claude; responses are translated back into Anthropic's shapes.
+
+// AnthropicRequest is a POST /v1/messages request body
+type AnthropicRequest struct {
+	Model         string             `json:"model"`
+	Messages      []AnthropicMessage `json:"messages"`
+	System        AnthropicContent   `json:"system,omitempty"`
+	MaxTokens     int                `json:"max_tokens"`
+	StopSequences []string           `json:"stop_sequences,omitempty"`
+	Temperature   float64            `json:"temperature,omitempty"`
+	TopP          float64            `json:"top_p,omitempty"`
+	Stream        bool               `json:"stream,omitempty"`
+	Tools         []AnthropicTool    `json:"tools,omitempty"`
+	ToolChoice    *AnthropicChoice   `json:"tool_choice,omitempty"`
+}
+
+// AnthropicMessage is one conversation turn
+type AnthropicMessage struct {
+	Role    string           `json:"role"`
+	Content AnthropicContent `json:"content"`
+}
+
+// AnthropicContent is message content, sent as a string or a block array.
+// Strings are decoded as a single text block.
+type AnthropicContent []AnthropicBlock
+
+func (c *AnthropicContent) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err == nil {
+		*c = AnthropicContent{{Type: "text", Text: text}}
+		return nil
+	}
+	var blocks []AnthropicBlock
+	if err := json.Unmarshal(data, &blocks); err != nil {
+		return fmt.Errorf("content must be a string or an array of content blocks")
+	}
+	*c = blocks
+	return nil
+}
+
+// text joins the content's text blocks
+func (c AnthropicContent) text() string {
+	var parts []string
+	for _, block := range c {
+		if block.Type == "text" {
+			parts = append(parts, block.Text)
+		}
+	}
+	return strings.Join(parts, "\n")
+}
+
+// AnthropicBlock is a content block: text, image, tool_use or tool_result
+type AnthropicBlock struct {
+	Type string `json:"type"`
+	Text string `json:"text,omitempty"`
+
+	// image
+	Source *AnthropicImageSource `json:"source,omitempty"`
+
+	// tool_use
+	ID    string          `json:"id,omitempty"`
+	Name  string          `json:"name,omitempty"`
+	Input json.RawMessage `json:"input,omitempty"`
+
+	// tool_result
+	ToolUseID string           `json:"tool_use_id,omitempty"`
+	Content   AnthropicContent `json:"content,omitempty"`
+	IsError   bool             `json:"is_error,omitempty"`
+}
+
+// AnthropicImageSource is an inline base64 image or an image URL
+type AnthropicImageSource struct {
+	Type      string `json:"type"` // "base64" or "url"
+	MediaType string `json:"media_type,omitempty"`
+	Data      string `json:"data,omitempty"`
+	URL       string `json:"url,omitempty"`
+}
+
+// AnthropicTool is a tool definition
+type AnthropicTool struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description,omitempty"`
+	InputSchema map[string]interface{} `json:"input_schema"`
+}
+
+// AnthropicChoice is tool_choice: auto, any, none, or a named tool
+type AnthropicChoice struct {
+	Type string `json:"type"`
+	Name string `json:"name,omitempty"`
+}
+
+// AnthropicResponse is a complete message response
+type AnthropicResponse struct {
+	ID           string           `json:"id"`
+	Type         string           `json:"type"`
+	Role         string           `json:"role"`
+	Model        string           `json:"model"`
+	Content      []AnthropicBlock `json:"content"`
+	StopReason   *string          `json:"stop_reason"`
+	StopSequence *string          `json:"stop_sequence"`
+	Usage        AnthropicUsage   `json:"usage"`
+}
+
+// AnthropicUsage reports token counts
+type AnthropicUsage struct {
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+}
+
+// unifiedMessages translates an Anthropic conversation to unified messages.
+// Tool results, which Anthropic sends inside user turns, become "tool"
+// messages placed ahead of the rest of the turn.
+func (req *AnthropicRequest) unifiedMessages() ([]providers.Message, error) {
+	var messages []providers.Message
+	if system := req.System.text(); system != "" {
+		messages = append(messages, providers.Message{Role: "system", Content: system})
+	}
+
+	for _, msg := range req.Messages {
+		if msg.Role != "user" && msg.Role != "assistant" {
+			return nil, fmt.Errorf("messages: role must be user or assistant, got %q", msg.Role)
+		}
+		turn := providers.Message{Role: msg.Role}
+		var text []string
+		hasImages := false
+
+		for _, block := range msg.Content {
+			switch block.Type {
+			case "text":
+				text = append(text, block.Text)
+				turn.Parts = append(turn.Parts, providers.ContentPart{Type: providers.ContentTypeText, Text: block.Text})
+			case "image":
+				if block.Source == nil {
+					return nil, fmt.Errorf("image block is missing its source")
+				}
+				url := block.Source.URL
+				if block.Source.Type == "base64" {
+					url = "data:" + block.Source.MediaType + ";base64," + block.Source.Data
+				}
+				if url == "" {
+					return nil, fmt.Errorf("image source must be base64 data or a url")
+				}
+				hasImages = true
+				turn.Parts = append(turn.Parts, providers.ContentPart{Type: providers.ContentTypeImage, ImageURL: &providers.ImageURL{URL: url}})
+			case "tool_use":
+				arguments := "{}"
+				if len(block.Input) > 0 {
+					arguments = string(block.Input)
+				}
+				turn.ToolCalls = append(turn.ToolCalls, providers.ToolCall{
+					ID:       block.ID,
+					Type:     "function",
+					Function: providers.FunctionCall{Name: block.Name, Arguments: arguments},
+				})
+			case "tool_result":
+				content := block.Content.text()
+				if block.IsError {
+					content = "Error: " + content
+				}
+				messages = append(messages, providers.Message{Role: "tool", ToolCallID: block.ToolUseID, Content: content})
+			default:
+				return nil, fmt.Errorf("unsupported content block type %q", block.Type)
+			}
+		}
+
+		turn.Content = strings.Join(text, "\n")
+		if !hasImages {
+			turn.Parts = nil
+		}
+		if turn.Content != "" || hasImages || len(turn.ToolCalls) > 0 {
+			messages = append(messages, turn)
+		}
+	}
+	return messages, nil
+}
+
+// routerParams translates sampling and tool settings
+func (req *AnthropicRequest) routerParams() *RouterParams {
+	params := &RouterParams{
+		MaxTokens:   req.MaxTokens,
+		Temperature: req.Temperature,
+		TopP:        req.TopP,
+		Stop:        req.StopSequences,
+	}
+	for _, tool := range req.Tools {
+		params.Tools = append(params.Tools, providers.Tool{
+			Type:     "function",
+			Function: providers.Function{Name: tool.Name, Description: tool.Description, Parameters: tool.InputSchema},
+		})
+	}
+	if req.ToolChoice != nil {
+		switch req.ToolChoice.Type {
+		case "any":
+			params.ToolChoice = "required"
+		case "none":
+			params.ToolChoice = "none"
+		case "tool":
+			params.ToolChoice = map[string]interface{}{
+				"type":     "function",
+				"function": map[string]interface{}{"name": req.ToolChoice.Name},
+			}
+		}
+	}
+	return params
+}
+
+// anthropicStopReason maps a unified finish reason to Anthropic's stop_reason
+func anthropicStopReason(finishReason string) string {
+	switch finishReason {
+	case "length":
+		return "max_tokens"
+	case "tool_calls":
+		return "tool_use"
+	}
+	return "end_turn"
+}
+
+// toolCallInput passes JSON-encoded tool call arguments through as an object,
+// for APIs that send arguments unencoded
+func toolCallInput(arguments string) json.RawMessage {
+	if !json.Valid([]byte(arguments)) || strings.TrimSpace(arguments) == "" {
+		return json.RawMessage("{}")
+	}
+	return json.RawMessage(arguments)
+}
+
+// anthropicError writes an error in Anthropic's envelope, with the error
+// type Anthropic uses for the status code
+func anthropicError(w http.ResponseWriter, apiErr *APIError) {
+	setRetryAfter(w, apiErr.RetryAfter)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(apiErr.Status)
+	json.NewEncoder(w).Encode(anthropicErrorBody(apiErr))
+}
+
+func anthropicErrorBody(apiErr *APIError) map[string]interface{} {
+	errType := "api_error"
+	switch apiErr.Status {
+	case http.StatusBadRequest, http.StatusMethodNotAllowed:
+		errType = "invalid_request_error"
+	case http.StatusUnauthorized:
+		errType = "authentication_error"
+	case http.StatusForbidden:
+		errType = "permission_error"
+	case http.StatusNotFound:
+		errType = "not_found_error"
+	case http.StatusTooManyRequests:
+		errType = "rate_limit_error"
+	case http.StatusServiceUnavailable:
+		errType = "overloaded_error"
+	}
+	return map[string]interface{}{
+		"type":  "error",
+		"error": map[string]string{"type": errType, "message": apiErr.Message},
+	}
+}
+
+// handleMessages handles POST /v1/messages
+func handleMessages(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, x-api-key, anthropic-version, anthropic-beta")
+	w.Header().Set("Access-Control-Max-Age", "86400")
+
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	if tenantFrom(r) == nil && !rateLimitAllow(r.RemoteAddr) {
+		anthropicError(w, rateLimited("Rate limit exceeded", time.Second))
+		return
+	}
+
+	if r.Method != "POST" {
+		w.Header().Set("Allow", "POST, OPTIONS")
+		anthropicError(w, newAPIError(http.StatusMethodNotAllowed, errTypeInvalidRequest, "method_not_allowed", "", "Method not allowed"))
+		return
+	}
+
+	var req AnthropicRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		anthropicError(w, invalidRequest("invalid_json", "", "Invalid JSON: "+err.Error()))
+		return
+	}
+	if req.Model == "" {
+		anthropicError(w, invalidRequest("missing_required_parameter", "model", "model: Field required"))
+		return
+	}
+	if len(req.Messages) == 0 {
+		anthropicError(w, invalidRequest("missing_required_parameter", "messages", "messages: at least one message is required"))
+		return
+	}
+	messages, err := req.unifiedMessages()
+	if err != nil {
+		anthropicError(w, invalidRequest("invalid_request", "messages", err.Error()))
+		return
+	}
+	if apiErr := checkModelAllowed(r, req.Model); apiErr != nil {
+		anthropicError(w, apiErr)
+		return
+	}
+	if modelRouter == nil {
+		anthropicError(w, newAPIError(http.StatusServiceUnavailable, errTypeServer, "", "", "Model router not initialized"))
+		return
+	}
+
+	messageID := "msg_" + generateRequestID()
+	params := req.routerParams()
+	params.Context = r.Context()
+	messages = applyContextPolicy(w, r, "API", req.Model, messages, params)
+
+	if req.Stream {
+		streamAnthropicMessage(w, r, &req, messages, params, messageID)
+		return
+	}
+
+	llmResp, err := LLMWithRouterConv(messages, req.Model, messageID, params, nil)
+	if err != nil {
+		anthropicError(w, apiErrorFor(err, req.Model))
+		return
+	}
+	recordTenantUsage(r, req.Model, llmResp)
+
+	content := []AnthropicBlock{}
+	if llmResp.Content != "" {
+		content = append(content, AnthropicBlock{Type: "text", Text: llmResp.Content})
+	}
+	for _, call := range llmResp.ToolCalls {
+		content = append(content, AnthropicBlock{
+			Type:  "tool_use",
+			ID:    call.ID,
+			Name:  call.Function.Name,
+			Input: toolCallInput(call.Function.Arguments),
+		})
+	}
+	stopReason := anthropicStopReason(llmResp.FinishReason)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(AnthropicResponse{
+		ID:         messageID,
+		Type:       "message",
+		Role:       "assistant",
+		Model:      req.Model,
+		Content:    content,
+		StopReason: &stopReason,
+		Usage:      AnthropicUsage{InputTokens: llmResp.InputTokens, OutputTokens: llmResp.OutputTokens},
+	})
+}
+
+// streamAnthropicMessage streams a response as Anthropic SSE events:
+// message_start, then content_block_start/delta/stop for each text or
+// tool_use block, then message_delta with the stop reason and usage, and
+// message_stop
+func streamAnthropicMessage(w http.ResponseWriter, r *http.Request, req *AnthropicRequest, messages []providers.Message, params *RouterParams, messageID string) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		anthropicError(w, newAPIError(http.StatusInternalServerError, errTypeServer, "", "", "Streaming not supported"))
+		return
+	}
+
+	writeEvent := func(event string, data interface{}) {
+		encoded, _ := json.Marshal(data)
+		fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, encoded)
+		flusher.Flush()
+	}
+
+	ch := make(chan providers.StreamChunk)
+	params.ChunkStream = ch
+	type result struct {
+		resp *LLMResponse
+		err  error
+	}
+	done := make(chan result, 1)
+	go func() {
+		resp, err := LLMWithRouterConv(messages, req.Model, messageID, params, nil)
+		done <- result{resp, err}
+	}()
+
+	// As with chat completions, the status line waits for the first output
+	// so that requests failing before it get a real error status
+	started := false
+	start := func() {
+		started = true
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+		writeEvent("message_start", map[string]interface{}{
+			"type": "message_start",
+			"message": AnthropicResponse{
+				ID:      messageID,
+				Type:    "message",
+				Role:    "assistant",
+				Model:   req.Model,
+				Content: []AnthropicBlock{},
+			},
+		})
+	}
+
+	// Text goes in one block; each tool call opens a block of its own
+	blockIndex := -1
+	blockOpen := false
+	textBlock := false
+	toolBlocks := make(map[int]int) // Tool call index to block index
+	closeBlock := func() {
+		if blockOpen {
+			writeEvent("content_block_stop", map[string]interface{}{"type": "content_block_stop", "index": blockIndex})
+			blockOpen = false
+		}
+	}
+	openBlock := func(block interface{}) {
+		closeBlock()
+		blockIndex++
+		blockOpen = true
+		writeEvent("content_block_start", map[string]interface{}{
+			"type":          "content_block_start",
+			"index":         blockIndex,
+			"content_block": block,
+		})
+	}
+
+	for chunk := range ch {
+		if chunk.Data == "" && len(chunk.ToolCalls) == 0 {
+			continue
+		}
+		if !started {
+			start()
+		}
+		if chunk.Data != "" {
+			if !blockOpen || !textBlock {
+				openBlock(map[string]string{"type": "text", "text": ""})
+				textBlock = true
+			}
+			writeEvent("content_block_delta", map[string]interface{}{
+				"type":  "content_block_delta",
+				"index": blockIndex,
+				"delta": map[string]string{"type": "text_delta", "text": chunk.Data},
+			})
+		}
+		for _, delta := range chunk.ToolCalls {
+			index, seen := toolBlocks[delta.Index]
+			if !seen {
+				openBlock(AnthropicBlock{Type: "tool_use", ID: delta.ID, Name: delta.Name, Input: json.RawMessage("{}")})
+				textBlock = false
+				index = blockIndex
+				toolBlocks[delta.Index] = index
+			}
+			if delta.Arguments != "" {
+				writeEvent("content_block_delta", map[string]interface{}{
+					"type":  "content_block_delta",
+					"index": index,
+					"delta": map[string]string{"type": "input_json_delta", "partial_json": delta.Arguments},
+				})
+			}
+		}
+	}
+
+	res := <-done
+	if res.err != nil {
+		if !started {
+			anthropicError(w, apiErrorFor(res.err, req.Model))
+			return
+		}
+		writeEvent("error", anthropicErrorBody(apiErrorFor(res.err, req.Model)))
+		return
+	}
+	recordTenantUsage(r, req.Model, res.resp)
+
+	if !started {
+		start()
+	}
+	closeBlock()
+	writeEvent("message_delta", map[string]interface{}{
+		"type":  "message_delta",
+		"delta": map[string]interface{}{"stop_reason": anthropicStopReason(res.resp.FinishReason), "stop_sequence": nil},
+		"usage": AnthropicUsage{InputTokens: res.resp.InputTokens, OutputTokens: res.resp.OutputTokens},
+	})
+	writeEvent("message_stop", map[string]string{"type": "message_stop"})
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"ch.at/providers"
+	"ch.at/routing"
+)
+
+// Error types, as in OpenAI error responses
+const (
+	errTypeInvalidRequest = "invalid_request_error"
+	errTypeRateLimit      = "rate_limit_error"
+	errTypeUpstream       = "upstream_error"
+	errTypeServer         = "server_error"
+)
+
+// APIError is the body of an OpenAI-style error response:
+// {"error": {"message", "type", "code", "param"}}
+type APIError struct {
+	Message string                 `json:"message"`
+	Type    string                 `json:"type"`
+	Code    *string                `json:"code"`
+	Param   *string                `json:"param"`
+	Details map[string]interface{} `json:"details,omitempty"`
+
+	Status     int           `json:"-"`
+	RetryAfter time.Duration `json:"-"`
+}
+
+func (e *APIError) Error() string {
+	return e.Message
+}
+
+// newAPIError builds an error response; empty code and param are sent as null
+func newAPIError(status int, errType, code, param, message string) *APIError {
+	apiErr := &APIError{Message: message, Type: errType, Status: status}
+	if code != "" {
+		apiErr.Code = &code
+	}
+	if param != "" {
+		apiErr.Param = &param
+	}
+	return apiErr
+}
+
+// invalidRequest is a 400 for a request that fails validation
+func invalidRequest(code, param, message string) *APIError {
+	return newAPIError(http.StatusBadRequest, errTypeInvalidRequest, code, param, message)
+}
+
+// methodNotAllowed is a 405 listing the allowed methods
+func methodNotAllowed(w http.ResponseWriter, allow string) {
+	w.Header().Set("Allow", allow)
+	writeAPIError(w, newAPIError(http.StatusMethodNotAllowed, errTypeInvalidRequest, "method_not_allowed", "", "Method not allowed"))
+}
+
+// rateLimited is a 429 telling the client when to come back
+func rateLimited(message string, retryAfter time.Duration) *APIError {
+	apiErr := newAPIError(http.StatusTooManyRequests, errTypeRateLimit, "rate_limit_exceeded", "", message)
+	apiErr.RetryAfter = retryAfter
+	return apiErr
+}
+
+// apiErrorFor maps an error from the LLM path to a client-facing error.
+// Upstream details are kept out of 5xx messages; they go to the log instead.
+func apiErrorFor(err error, model string) *APIError {
+	var apiErr *APIError
+	var capErr *routing.CapabilityError
+	var windowErr *routing.ContextWindowError
+	var verr *providers.OutputValidationError
+
+	switch {
+	case errors.As(err, &apiErr):
+		return apiErr
+	case errors.Is(err, routing.ErrModelNotFound):
+		return newAPIError(http.StatusNotFound, errTypeInvalidRequest, "model_not_found", "model",
+			fmt.Sprintf("The model '%s' does not exist", model))
+	case errors.Is(err, routing.ErrNoDeployments):
+		apiErr := newAPIError(http.StatusServiceUnavailable, errTypeUpstream, "no_available_deployments", "",
+			fmt.Sprintf("No deployments of model '%s' are currently available", model))
+		apiErr.RetryAfter = 30 * time.Second
+		return apiErr
+	case errors.As(err, &capErr):
+		return invalidRequest("unsupported_capability", "model", capErr.Error())
+	case errors.As(err, &windowErr):
+		return invalidRequest("context_length_exceeded", "messages",
+			fmt.Sprintf("This model's maximum context length is %d tokens. However, you requested %d tokens. Please reduce the length of the messages or completion.",
+				windowErr.Largest, windowErr.Tokens))
+	case errors.As(err, &verr):
+		apiErr := newAPIError(http.StatusBadGateway, errTypeUpstream, "invalid_output", "response_format", verr.Error())
+		apiErr.Details = map[string]interface{}{"path": verr.Path, "reason": verr.Reason, "output": verr.Output}
+		return apiErr
+	}
+
+	pe, ok := providers.AsProviderError(err)
+	if !ok {
+		log.Printf("[API] Unclassified error for model %s: %v", model, err)
+		return newAPIError(http.StatusInternalServerError, errTypeServer, "", "", "The server had an error while processing your request")
+	}
+
+	switch pe.Type {
+	case providers.ErrRateLimited:
+		return rateLimited("The upstream provider is rate limiting requests, retry later", pe.RetryAfter)
+	case providers.ErrContextLengthExceeded:
+		return invalidRequest("context_length_exceeded", "messages", pe.Message)
+	case providers.ErrContentFiltered:
+		return invalidRequest("content_filter", "messages", pe.Message)
+	case providers.ErrBadRequest:
+		return invalidRequest("invalid_request", "", pe.Message)
+	case providers.ErrUnsupported:
+		return invalidRequest("unsupported_content", "messages", pe.Message)
+	}
+
+	log.Printf("[API] Upstream failure for model %s: %v", model, err)
+	switch pe.Type {
+	case providers.ErrTimeout:
+		return newAPIError(http.StatusBadGateway, errTypeUpstream, "upstream_timeout", "", "The upstream provider timed out")
+	case providers.ErrAuthFailed:
+		return newAPIError(http.StatusBadGateway, errTypeUpstream, "upstream_auth_failed", "", "The gateway could not authenticate with the upstream provider")
+	case providers.ErrNotFound:
+		return newAPIError(http.StatusBadGateway, errTypeUpstream, "upstream_model_not_found", "", "The upstream provider does not serve this model")
+	}
+	apiErr = newAPIError(http.StatusServiceUnavailable, errTypeUpstream, "upstream_unavailable", "", "All deployments for this model failed, retry later")
+	apiErr.RetryAfter = pe.RetryAfter
+	return apiErr
+}
+
+// setRetryAfter sets the Retry-After header in whole seconds, rounding up
+func setRetryAfter(w http.ResponseWriter, retryAfter time.Duration) {
+	if retryAfter <= 0 {
+		return
+	}
+	seconds := int((retryAfter + time.Second - 1) / time.Second)
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+}
+
+// writeAPIError writes an error response with its status code
+func writeAPIError(w http.ResponseWriter, apiErr *APIError) {
+	setRetryAfter(w, apiErr.RetryAfter)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(apiErr.Status)
+	json.NewEncoder(w).Encode(map[string]*APIError{"error": apiErr})
+}
+
+// writeSSEError reports an error on a stream whose status line has already
+// been sent, as an "error" event carrying the usual envelope
+func writeSSEError(w http.ResponseWriter, apiErr *APIError) {
+	data, _ := json.Marshal(map[string]*APIError{"error": apiErr})
+	fmt.Fprintf(w, "event: error\ndata: %s\n\n", data)
+}
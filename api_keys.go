@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"ch.at/models"
+	"ch.at/tenants"
+)
+
+// API key authentication for /v1/* endpoints. It is off unless
+// ENABLE_API_KEYS=true; with it on, requests without a key are rejected
+// unless ALLOW_ANONYMOUS=true. Anonymous requests keep the per-IP limit.
+var (
+	tenantStore    *tenants.Store
+	allowAnonymous = true
+)
+
+type tenantContextKey struct{}
+
+// InitAPIKeys opens the key store when API keys are enabled
+func InitAPIKeys() error {
+	if os.Getenv("ENABLE_API_KEYS") != "true" {
+		return nil
+	}
+	store, err := openTenantStore()
+	if err != nil {
+		return err
+	}
+	tenantStore = store
+	allowAnonymous = os.Getenv("ALLOW_ANONYMOUS") == "true"
+	log.Printf("[Auth] API keys enabled, anonymous access %s", map[bool]string{true: "allowed", false: "disabled"}[allowAnonymous])
+	return nil
+}
+
+// openTenantStore opens the key database at API_KEYS_DB, default api_keys.db
+func openTenantStore() (*tenants.Store, error) {
+	path := os.Getenv("API_KEYS_DB")
+	if path == "" {
+		path = "api_keys.db"
+	}
+	return tenants.Open(path)
+}
+
+// tenantFrom returns the tenant a request authenticated as, or nil
+func tenantFrom(r *http.Request) *tenants.Tenant {
+	tenant, _ := r.Context().Value(tenantContextKey{}).(*tenants.Tenant)
+	return tenant
+}
+
+// requestAPIKey reads a key from "Authorization: Bearer" or x-api-key
+func requestAPIKey(r *http.Request) string {
+	if auth := r.Header.Get("Authorization"); auth != "" {
+		if key, ok := strings.CutPrefix(auth, "Bearer "); ok {
+			return strings.TrimSpace(key)
+		}
+	}
+	return strings.TrimSpace(r.Header.Get("x-api-key"))
+}
+
+// withAPIKey authenticates a request and enforces its tenant's quotas
+// before calling next. With keys disabled it passes requests straight through,
+// so clients that always send a key keep working.
+func withAPIKey(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if tenantStore == nil || r.Method == "OPTIONS" {
+			next(w, r)
+			return
+		}
+
+		key := requestAPIKey(r)
+		if key == "" {
+			if allowAnonymous {
+				next(w, r)
+				return
+			}
+			writeAPIError(w, newAPIError(http.StatusUnauthorized, errTypeInvalidRequest, "missing_api_key", "",
+				"You didn't provide an API key. Send it as 'Authorization: Bearer YOUR_KEY'"))
+			return
+		}
+
+		tenant, err := tenantStore.Authenticate(key)
+		if errors.Is(err, tenants.ErrNotFound) {
+			writeAPIError(w, newAPIError(http.StatusUnauthorized, errTypeInvalidRequest, "invalid_api_key", "", "Incorrect API key provided"))
+			return
+		}
+		if err != nil {
+			log.Printf("[Auth] Key lookup failed: %v", err)
+			writeAPIError(w, newAPIError(http.StatusInternalServerError, errTypeServer, "", "", "The server had an error while processing your request"))
+			return
+		}
+
+		if apiErr := checkTenantQuota(tenant, time.Now()); apiErr != nil {
+			beacon("tenant_quota_exceeded", map[string]interface{}{
+				"tenant": tenant.ID,
+				"code":   *apiErr.Code,
+			})
+			writeAPIError(w, apiErr)
+			return
+		}
+
+		next(w, r.WithContext(context.WithValue(r.Context(), tenantContextKey{}, tenant)))
+	}
+}
+
+// checkTenantQuota applies the tenant's request rate, daily token and
+// monthly spend limits
+func checkTenantQuota(tenant *tenants.Tenant, now time.Time) *APIError {
+	if !tenantStore.AllowRequest(tenant) {
+		return rateLimited(fmt.Sprintf("Rate limit of %d requests per minute exceeded", tenant.RPM),
+			time.Minute/time.Duration(tenant.RPM))
+	}
+	return checkTenantUsage(tenant, now)
+}
+
+// checkTenantUsage applies the tenant's daily token and monthly spend
+// limits. Batch lines use it alone: they are paced by the batch workers,
+// not the request rate.
+func checkTenantUsage(tenant *tenants.Tenant, now time.Time) *APIError {
+	if tenant.TokensPerDay <= 0 && tenant.SpendCap <= 0 {
+		return nil
+	}
+
+	usage, err := tenantStore.Usage(tenant.ID, now)
+	if err != nil {
+		// Quotas fail open: a usage lookup failure shouldn't take the API down
+		log.Printf("[Auth] Usage lookup failed for tenant %s: %v", tenant.ID, err)
+		return nil
+	}
+	utc := now.UTC()
+	if tenant.TokensPerDay > 0 && usage.TokensToday >= tenant.TokensPerDay {
+		apiErr := rateLimited(fmt.Sprintf("Daily quota of %d tokens exceeded", tenant.TokensPerDay),
+			time.Date(utc.Year(), utc.Month(), utc.Day()+1, 0, 0, 0, 0, time.UTC).Sub(utc))
+		code := "tokens_quota_exceeded"
+		apiErr.Code = &code
+		return apiErr
+	}
+	if tenant.SpendCap > 0 && usage.SpendThisMonth >= tenant.SpendCap {
+		apiErr := rateLimited(fmt.Sprintf("Monthly spend cap of $%.2f reached", tenant.SpendCap),
+			time.Date(utc.Year(), utc.Month()+1, 1, 0, 0, 0, 0, time.UTC).Sub(utc))
+		code := "insufficient_quota"
+		apiErr.Code = &code
+		return apiErr
+	}
+	return nil
+}
+
+// checkModelAllowed rejects models outside the tenant's allowlist
+func checkModelAllowed(r *http.Request, model string) *APIError {
+	if tenant := tenantFrom(r); tenant != nil && !tenant.AllowsModel(model) {
+		return newAPIError(http.StatusForbidden, errTypeInvalidRequest, "model_not_allowed", "model",
+			fmt.Sprintf("Your API key does not have access to the model '%s'", model))
+	}
+	return nil
+}
+
+// recordTenantUsage charges a completed request to the caller's tenant
+func recordTenantUsage(r *http.Request, model string, resp *LLMResponse) {
+	chargeTenant(tenantFrom(r), model, resp)
+}
+
+// chargeTenant records a completed request's tokens and cost, priced from
+// the per-1k-token costs of the model that answered
+func chargeTenant(tenant *tenants.Tenant, model string, resp *LLMResponse) {
+	if tenant == nil || resp == nil || tenantStore == nil {
+		return
+	}
+	var cost float64
+	if m := servedModel(model, resp); m != nil {
+		cost = float64(resp.InputTokens)/1000*m.Capabilities.InputCost +
+			float64(resp.OutputTokens)/1000*m.Capabilities.OutputCost
+	}
+	if err := tenantStore.RecordUsage(tenant.ID, resp.InputTokens+resp.OutputTokens, cost, time.Now()); err != nil {
+		log.Printf("[Auth] Failed to record usage for tenant %s: %v", tenant.ID, err)
+	}
+}
+
+// servedModel returns the model behind the deployment that answered, which
+// differs from the requested name for tiers, aliases and fallbacks. Without a
+// deployment (the legacy path) it falls back to the requested model.
+func servedModel(model string, resp *LLMResponse) *models.Model {
+	if modelRegistry == nil {
+		return nil
+	}
+	if resp.Deployment != "" && deploymentRegistry != nil {
+		if d, ok := deploymentRegistry.Get(resp.Deployment); ok {
+			model = d.ModelID
+		}
+	}
+	m, _ := modelRegistry.Get(model)
+	return m
+}
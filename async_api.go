@@ -0,0 +1,396 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"ch.at/tenants"
+)
+
+// Async chat completions, the HTTP counterpart of DoNutSentry v2's
+// exec/status flow: POST /v1/async/chat/completions returns a job at once,
+// the completion runs in the background, and GET /v1/async/{id} reports its
+// status and result. A job may run for up to ASYNC_TIMEOUT (default 10m).
+// Finished jobs are kept for ASYNC_RESULT_TTL (default 1h), in memory only.
+// With a webhook_url the finished job is also POSTed to the client, signed
+// with webhook_secret when given.
+
+// Async job statuses
+const (
+	asyncInProgress = "in_progress"
+	asyncCompleted  = "completed"
+	asyncFailed     = "failed"
+)
+
+// Webhook delivery statuses
+const (
+	webhookPending   = "pending"
+	webhookDelivered = "delivered"
+	webhookFailed    = "failed"
+)
+
+// AsyncChatRequest is a chat completion request plus delivery options
+type AsyncChatRequest struct {
+	ChatRequest
+	WebhookURL    string `json:"webhook_url,omitempty"`
+	WebhookSecret string `json:"webhook_secret,omitempty"`
+}
+
+// AsyncJob is the state of an async request as returned to clients
+type AsyncJob struct {
+	ID          string        `json:"id"`
+	Object      string        `json:"object"`
+	Status      string        `json:"status"`
+	Model       string        `json:"model"`
+	CreatedAt   int64         `json:"created_at"`
+	CompletedAt *int64        `json:"completed_at"`
+	ExpiresAt   *int64        `json:"expires_at"` // Set once the job finishes
+	Result      *ChatResponse `json:"result"`
+	Error       *APIError     `json:"error"`
+	Webhook     *AsyncWebhook `json:"webhook,omitempty"`
+
+	tenant string
+	secret string
+}
+
+// AsyncWebhook reports the delivery of a job's result to its webhook
+type AsyncWebhook struct {
+	URL       string `json:"url"`
+	Status    string `json:"status"`
+	Attempts  int    `json:"attempts"`
+	LastError string `json:"last_error,omitempty"`
+}
+
+var (
+	asyncJobs   = make(map[string]*AsyncJob) // job ID -> job
+	asyncJobsMu sync.Mutex
+	asyncTTL    = time.Hour
+
+	// How long a job may run, fallbacks and retries included
+	asyncTimeout = 10 * time.Minute
+
+	// Webhook retries back off between attempts
+	webhookBackoff = []time.Duration{0, 5 * time.Second, 30 * time.Second}
+	webhookClient  *http.Client
+)
+
+// Initialize async cleanup routine
+func init() {
+	if ttl, err := time.ParseDuration(os.Getenv("ASYNC_RESULT_TTL")); err == nil && ttl > 0 {
+		asyncTTL = ttl
+	}
+	if timeout, err := time.ParseDuration(os.Getenv("ASYNC_TIMEOUT")); err == nil && timeout > 0 {
+		asyncTimeout = timeout
+	}
+	webhookClient = newWebhookClient(os.Getenv("ASYNC_WEBHOOK_ALLOW_PRIVATE") == "true")
+	go asyncJobCleanup()
+}
+
+// newWebhookClient builds the client for webhook deliveries. Unless
+// allowPrivate is set it refuses to connect to loopback, private and
+// link-local addresses, checked after DNS resolution, so client-supplied
+// URLs can't reach services inside the gateway's network.
+func newWebhookClient(allowPrivate bool) *http.Client {
+	dialer := &net.Dialer{Timeout: 5 * time.Second}
+	if !allowPrivate {
+		dialer.Control = func(network, address string, c syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			ip := net.ParseIP(host)
+			if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+				ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() {
+				return fmt.Errorf("webhook address %s is not public", host)
+			}
+			return nil
+		}
+	}
+	return &http.Client{
+		Timeout:   10 * time.Second,
+		Transport: &http.Transport{DialContext: dialer.DialContext},
+		// Redirects could lead anywhere; a webhook must answer directly
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// snapshot copies a job for encoding outside asyncJobsMu, which the
+// caller holds
+func (job *AsyncJob) snapshot() AsyncJob {
+	copied := *job
+	if job.Webhook != nil {
+		webhook := *job.Webhook
+		copied.Webhook = &webhook
+	}
+	return copied
+}
+
+// handleAsyncChatCompletions handles POST /v1/async/chat/completions
+func handleAsyncChatCompletions(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if tenantFrom(r) == nil && !rateLimitAllow(r.RemoteAddr) {
+		writeAPIError(w, rateLimited("Rate limit exceeded", time.Second))
+		return
+	}
+	if r.Method != "POST" {
+		methodNotAllowed(w, "POST, OPTIONS")
+		return
+	}
+
+	var req AsyncChatRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeAPIError(w, invalidRequest("invalid_json", "", "Invalid JSON: "+err.Error()))
+		return
+	}
+	if apiErr := req.normalize(); apiErr != nil {
+		writeAPIError(w, apiErr)
+		return
+	}
+	if req.Stream {
+		writeAPIError(w, invalidRequest("invalid_value", "stream", "Async requests can't stream; poll the job or use a webhook"))
+		return
+	}
+	if req.WebhookURL != "" {
+		if u, err := url.Parse(req.WebhookURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			writeAPIError(w, invalidRequest("invalid_value", "webhook_url", "webhook_url must be an absolute http or https URL"))
+			return
+		}
+	}
+	if apiErr := checkModelAllowed(r, req.Model); apiErr != nil {
+		writeAPIError(w, apiErr)
+		return
+	}
+	if modelRouter == nil {
+		writeAPIError(w, newAPIError(http.StatusServiceUnavailable, errTypeServer, "", "", "Model router not initialized"))
+		return
+	}
+
+	job := &AsyncJob{
+		ID:        "async_" + generateRequestID(),
+		Object:    "async.job",
+		Status:    asyncInProgress,
+		Model:     req.Model,
+		CreatedAt: time.Now().Unix(),
+		tenant:    callerTenantID(r),
+		secret:    req.WebhookSecret,
+	}
+	if req.WebhookURL != "" {
+		job.Webhook = &AsyncWebhook{URL: req.WebhookURL, Status: webhookPending}
+	}
+
+	asyncJobsMu.Lock()
+	asyncJobs[job.ID] = job
+	snapshot := job.snapshot()
+	asyncJobsMu.Unlock()
+
+	beacon("async_job_created", map[string]interface{}{
+		"job_id":  job.ID,
+		"model":   req.Model,
+		"webhook": job.Webhook != nil,
+	})
+
+	// The job outlives this request, so it gets the tenant rather than r
+	go runAsyncJob(job, req.ChatRequest, tenantFrom(r))
+
+	w.Header().Set("Location", "/v1/async/"+job.ID)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(snapshot)
+}
+
+// runAsyncJob generates the completion for a job, then delivers it
+func runAsyncJob(job *AsyncJob, req ChatRequest, tenant *tenants.Tenant) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("[Async] PANIC in job %s: %v", job.ID, r)
+			finishAsyncJob(job, nil, newAPIError(http.StatusInternalServerError, errTypeServer, "", "", "The server had an error while processing your request"))
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), asyncTimeout)
+	defer cancel()
+	params := req.routerParams()
+	params.Context = ctx
+	messages, _ := fitContext(ctx, req.Messages, req.Model, params, getServiceContextPolicy("API"))
+
+	start := time.Now()
+	llmResp, err := LLMWithRouterConv(messages, req.Model, job.ID, params, nil)
+	if err != nil {
+		log.Printf("[Async] Job %s failed after %v: %v", job.ID, time.Since(start), err)
+		finishAsyncJob(job, nil, apiErrorFor(err, req.Model))
+		return
+	}
+	chargeTenant(tenant, req.Model, llmResp)
+	result := chatCompletion(req.Model, llmResp)
+	finishAsyncJob(job, &result, nil)
+}
+
+// finishAsyncJob records a job's outcome, starts its TTL and delivers it
+// to the webhook if there is one
+func finishAsyncJob(job *AsyncJob, result *ChatResponse, apiErr *APIError) {
+	now := time.Now()
+	completed := now.Unix()
+	expires := now.Add(asyncTTL).Unix()
+
+	asyncJobsMu.Lock()
+	job.Status = asyncCompleted
+	if apiErr != nil {
+		job.Status = asyncFailed
+	}
+	job.Result = result
+	job.Error = apiErr
+	job.CompletedAt = &completed
+	job.ExpiresAt = &expires
+	status, hasWebhook := job.Status, job.Webhook != nil
+	asyncJobsMu.Unlock()
+
+	beacon("async_job_finished", map[string]interface{}{
+		"job_id":      job.ID,
+		"status":      status,
+		"duration_ms": (completed - job.CreatedAt) * 1000,
+	})
+	if hasWebhook {
+		deliverWebhook(job)
+	}
+}
+
+// deliverWebhook POSTs a finished job to its webhook, retrying on failure.
+// Any 2xx response counts as delivered. With a secret, the body's
+// HMAC-SHA256 is sent as "X-Signature: sha256=<hex>".
+func deliverWebhook(job *AsyncJob) {
+	asyncJobsMu.Lock()
+	target := job.Webhook.URL
+	body, _ := json.Marshal(job)
+	asyncJobsMu.Unlock()
+
+	var lastErr string
+	for attempt, wait := range webhookBackoff {
+		time.Sleep(wait)
+
+		err := postWebhook(target, body, job.secret)
+		asyncJobsMu.Lock()
+		job.Webhook.Attempts = attempt + 1
+		if err == nil {
+			job.Webhook.Status = webhookDelivered
+			job.Webhook.LastError = ""
+			asyncJobsMu.Unlock()
+			return
+		}
+		lastErr = err.Error()
+		job.Webhook.LastError = lastErr
+		asyncJobsMu.Unlock()
+	}
+
+	asyncJobsMu.Lock()
+	job.Webhook.Status = webhookFailed
+	asyncJobsMu.Unlock()
+	log.Printf("[Async] Webhook for job %s failed after %d attempts: %s", job.ID, len(webhookBackoff), lastErr)
+}
+
+func postWebhook(target string, body []byte, secret string) error {
+	req, err := http.NewRequest("POST", target, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if secret != "" {
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write(body)
+		req.Header.Set("X-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+// handleAsyncJob handles GET /v1/async/{id}
+func handleAsyncJob(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if tenantFrom(r) == nil && !rateLimitAllow(r.RemoteAddr) {
+		writeAPIError(w, rateLimited("Rate limit exceeded", time.Second))
+		return
+	}
+	if r.Method != "GET" {
+		methodNotAllowed(w, "GET, OPTIONS")
+		return
+	}
+
+	id := strings.TrimPrefix(r.URL.Path, "/v1/async/")
+	asyncJobsMu.Lock()
+	job, ok := asyncJobs[id]
+	var snapshot AsyncJob
+	if ok {
+		snapshot = job.snapshot()
+	}
+	asyncJobsMu.Unlock()
+
+	// Other tenants' jobs look the same as expired ones
+	if !ok || snapshot.tenant != callerTenantID(r) {
+		writeAPIError(w, newAPIError(http.StatusNotFound, errTypeInvalidRequest, "job_not_found", "id",
+			fmt.Sprintf("No such job: '%s'. Results are kept for %v after completion", id, asyncTTL)))
+		return
+	}
+	writeJSON(w, snapshot)
+}
+
+// asyncJobCleanup drops jobs whose results have outlived the TTL
+func asyncJobCleanup() {
+	ticker := time.NewTicker(1 * time.Minute)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		now := time.Now().Unix()
+		expired := 0
+		asyncJobsMu.Lock()
+		for id, job := range asyncJobs {
+			// Keep the job while its webhook is still being retried
+			if job.ExpiresAt != nil && *job.ExpiresAt <= now &&
+				(job.Webhook == nil || job.Webhook.Status != webhookPending) {
+				delete(asyncJobs, id)
+				expired++
+			}
+		}
+		asyncJobsMu.Unlock()
+
+		if expired > 0 && debugMode {
+			log.Printf("[Async Cleanup] Deleted %d expired jobs", expired)
+		}
+	}
+}
@@ -0,0 +1,171 @@
+// Package batches runs OpenAI-style batch jobs: a JSONL file of requests
+// is uploaded, processed in the background, and its results are written
+// to output and error JSONL files. Files, jobs and per-request results are
+// kept in SQLite so jobs survive a restart.
+package batches
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// Batch statuses, as in the OpenAI Batch API
+const (
+	StatusValidating = "validating"
+	StatusFailed     = "failed"
+	StatusInProgress = "in_progress"
+	StatusFinalizing = "finalizing"
+	StatusCompleted  = "completed"
+	StatusExpired    = "expired"
+	StatusCancelling = "cancelling"
+	StatusCancelled  = "cancelled"
+)
+
+// File purposes
+const (
+	PurposeBatch       = "batch"
+	PurposeBatchOutput = "batch_output"
+)
+
+// MaxRequests is the most requests one batch may hold
+const MaxRequests = 50000
+
+// File is an uploaded input file or a generated result file
+type File struct {
+	ID        string `json:"id"`
+	Object    string `json:"object"`
+	Bytes     int    `json:"bytes"`
+	CreatedAt int64  `json:"created_at"`
+	Filename  string `json:"filename"`
+	Purpose   string `json:"purpose"`
+	Tenant    string `json:"-"` // Owning tenant, empty for anonymous uploads
+}
+
+// Batch is a batch job. Timestamps are Unix seconds.
+type Batch struct {
+	ID               string            `json:"id"`
+	Object           string            `json:"object"`
+	Endpoint         string            `json:"endpoint"`
+	Errors           *Errors           `json:"errors"`
+	InputFileID      string            `json:"input_file_id"`
+	CompletionWindow string            `json:"completion_window"`
+	Status           string            `json:"status"`
+	OutputFileID     *string           `json:"output_file_id"`
+	ErrorFileID      *string           `json:"error_file_id"`
+	CreatedAt        int64             `json:"created_at"`
+	InProgressAt     *int64            `json:"in_progress_at"`
+	ExpiresAt        int64             `json:"expires_at"`
+	FinalizingAt     *int64            `json:"finalizing_at"`
+	CompletedAt      *int64            `json:"completed_at"`
+	FailedAt         *int64            `json:"failed_at"`
+	ExpiredAt        *int64            `json:"expired_at"`
+	CancellingAt     *int64            `json:"cancelling_at"`
+	CancelledAt      *int64            `json:"cancelled_at"`
+	RequestCounts    RequestCounts     `json:"request_counts"`
+	Metadata         map[string]string `json:"metadata"`
+	Tenant           string            `json:"-"`
+}
+
+// Done reports whether the batch has reached a final status
+func (b *Batch) Done() bool {
+	switch b.Status {
+	case StatusFailed, StatusCompleted, StatusExpired, StatusCancelled:
+		return true
+	}
+	return false
+}
+
+// RequestCounts tallies a batch's requests
+type RequestCounts struct {
+	Total     int `json:"total"`
+	Completed int `json:"completed"`
+	Failed    int `json:"failed"`
+}
+
+// Errors lists the validation errors that failed a batch
+type Errors struct {
+	Object string  `json:"object"`
+	Data   []Error `json:"data"`
+}
+
+// Error is one validation error, pointing at its input line
+type Error struct {
+	Code    string  `json:"code"`
+	Message string  `json:"message"`
+	Param   *string `json:"param"`
+	Line    *int    `json:"line"`
+}
+
+// LineError builds a validation error for a 1-based input line
+func LineError(line int, code, message string) Error {
+	return Error{Code: code, Message: message, Line: &line}
+}
+
+// Request is one line of an input file
+type Request struct {
+	Line     int             `json:"-"` // 1-based line in the input file
+	CustomID string          `json:"custom_id"`
+	Method   string          `json:"method"`
+	URL      string          `json:"url"`
+	Body     json.RawMessage `json:"body"`
+}
+
+// Result is the HTTP response to one request
+type Result struct {
+	StatusCode int
+	Body       json.RawMessage
+}
+
+// ParseInput reads a JSONL input file. Every line must be a request for
+// endpoint with a unique custom_id; problems are returned per line.
+func ParseInput(content []byte, endpoint string) ([]Request, []Error) {
+	var requests []Request
+	var errs []Error
+	seen := make(map[string]bool)
+
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	scanner.Buffer(make([]byte, 64*1024), 10*1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := bytes.TrimSpace(scanner.Bytes())
+		if len(text) == 0 {
+			continue
+		}
+
+		var req Request
+		if err := json.Unmarshal(text, &req); err != nil {
+			errs = append(errs, LineError(line, "invalid_json_line", "This line is not parseable as valid JSON: "+err.Error()))
+			continue
+		}
+		req.Line = line
+		switch {
+		case req.CustomID == "":
+			errs = append(errs, LineError(line, "missing_required_parameter", "custom_id is required"))
+		case seen[req.CustomID]:
+			errs = append(errs, LineError(line, "duplicate_custom_id", fmt.Sprintf("The custom_id %q is used more than once", req.CustomID)))
+		case req.Method != "POST":
+			errs = append(errs, LineError(line, "invalid_method", "method must be POST"))
+		case req.URL != endpoint:
+			errs = append(errs, LineError(line, "mismatched_endpoint", fmt.Sprintf("url %q does not match the batch endpoint %s", req.URL, endpoint)))
+		case len(req.Body) == 0 || req.Body[0] != '{':
+			errs = append(errs, LineError(line, "invalid_request", "body must be a JSON object"))
+		default:
+			seen[req.CustomID] = true
+			requests = append(requests, req)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		errs = append(errs, LineError(line+1, "invalid_file", err.Error()))
+	}
+
+	if len(requests)+len(errs) == 0 {
+		errs = append(errs, Error{Code: "empty_file", Message: "The input file contains no requests"})
+	}
+	if len(requests) > MaxRequests {
+		errs = append(errs, Error{Code: "too_many_requests", Message: fmt.Sprintf("A batch may hold at most %d requests", MaxRequests)})
+	}
+	return requests, errs
+}
@@ -0,0 +1,300 @@
+package batches
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"sync"
+	"time"
+)
+
+// RunFunc executes one request of a batch. A returned error means the
+// request did not run, for example because the batch was cancelled while
+// it waited; it stays pending. Failed calls are reported as a Result with
+// an error status instead.
+type RunFunc func(ctx context.Context, batch *Batch, req Request) (Result, error)
+
+// errCancelled is the cancellation cause of a batch cancelled by its owner
+var errCancelled = errors.New("batch cancelled")
+
+// Processor runs batches in the background
+type Processor struct {
+	store   *Store
+	run     RunFunc
+	workers int // Concurrent requests per batch
+
+	mu     sync.Mutex
+	active map[string]context.CancelCauseFunc
+	wg     sync.WaitGroup
+}
+
+// NewProcessor creates a processor running up to workers requests of each
+// batch at a time. Limits per deployment are up to run, see Slots.
+func NewProcessor(store *Store, run RunFunc, workers int) *Processor {
+	if workers <= 0 {
+		workers = 1
+	}
+	return &Processor{store: store, run: run, workers: workers, active: make(map[string]context.CancelCauseFunc)}
+}
+
+// Resume restarts the batches that were running when the server stopped.
+// Requests that were in flight then are run again.
+func (p *Processor) Resume() error {
+	unfinished, err := p.store.unfinishedBatches()
+	if err != nil {
+		return err
+	}
+	for _, b := range unfinished {
+		if b.Status == StatusCancelling {
+			p.finalize(b.ID, StatusCancelled)
+			continue
+		}
+		log.Printf("[Batch] Resuming %s (%d/%d done)", b.ID, b.RequestCounts.Completed+b.RequestCounts.Failed, b.RequestCounts.Total)
+		p.Start(b)
+	}
+	return nil
+}
+
+// Start processes a batch in the background
+func (p *Processor) Start(b *Batch) {
+	ctx, cancel := context.WithCancelCause(context.Background())
+	ctx, cancelDeadline := context.WithDeadline(ctx, time.Unix(b.ExpiresAt, 0))
+
+	p.mu.Lock()
+	p.active[b.ID] = cancel
+	p.mu.Unlock()
+
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		defer cancelDeadline()
+		p.process(ctx, b)
+
+		// Finalizing under the lock keeps a concurrent Cancel from
+		// finalizing the batch a second time
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		delete(p.active, b.ID)
+		switch {
+		case errors.Is(context.Cause(ctx), errCancelled):
+			p.finalize(b.ID, StatusCancelled)
+		case errors.Is(ctx.Err(), context.DeadlineExceeded):
+			p.finalize(b.ID, StatusExpired)
+		default:
+			p.finalize(b.ID, StatusCompleted)
+		}
+		cancel(nil)
+	}()
+}
+
+// Cancel stops a batch. Requests already running finish and are kept in
+// the output; the rest are not run.
+func (p *Processor) Cancel(id string) (*Batch, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	b, err := p.store.Batch(id)
+	if err != nil {
+		return nil, err
+	}
+	if b.Done() || b.Status == StatusCancelling {
+		return b, nil
+	}
+
+	now := time.Now().Unix()
+	b.Status = StatusCancelling
+	b.CancellingAt = &now
+	if err := p.store.UpdateBatch(b); err != nil {
+		return nil, err
+	}
+
+	if cancel, running := p.active[id]; running {
+		cancel(errCancelled)
+		return b, nil
+	}
+	p.finalize(id, StatusCancelled)
+	return p.store.Batch(id)
+}
+
+// Wait blocks until every running batch has finished
+func (p *Processor) Wait() {
+	p.wg.Wait()
+}
+
+func (p *Processor) process(ctx context.Context, b *Batch) {
+	pending, err := p.store.pendingRequests(b.ID)
+	if err != nil {
+		log.Printf("[Batch] Failed to load requests of %s: %v", b.ID, err)
+		return
+	}
+
+	jobs := make(chan Request)
+	var wg sync.WaitGroup
+	for i := 0; i < p.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for req := range jobs {
+				result, err := p.run(ctx, b, req)
+				if err != nil {
+					continue
+				}
+				if err := p.store.finishRequest(b.ID, req.Line, result); err != nil {
+					log.Printf("[Batch] Failed to record %s line %d: %v", b.ID, req.Line, err)
+				}
+			}
+		}()
+	}
+
+feed:
+	for _, req := range pending {
+		select {
+		case jobs <- req:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(jobs)
+	wg.Wait()
+}
+
+// outputLine is one line of an output or error file
+type outputLine struct {
+	ID       string        `json:"id"`
+	CustomID string        `json:"custom_id"`
+	Response *lineResponse `json:"response"`
+	Error    *lineError    `json:"error"`
+}
+
+type lineResponse struct {
+	StatusCode int             `json:"status_code"`
+	RequestID  string          `json:"request_id"`
+	Body       json.RawMessage `json:"body"`
+}
+
+type lineError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// finalize writes the output and error files and moves the batch to its
+// final status. Successful responses go to the output file and failed
+// ones to the error file; on expiry, requests that never ran are added to
+// the error file as batch_expired.
+func (p *Processor) finalize(id string, status string) {
+	// Reload, since Cancel may have updated the batch meanwhile
+	b, err := p.store.Batch(id)
+	if err != nil {
+		log.Printf("[Batch] Failed to load %s: %v", id, err)
+		return
+	}
+
+	now := time.Now().Unix()
+	b.Status = StatusFinalizing
+	b.FinalizingAt = &now
+	if err := p.store.UpdateBatch(b); err != nil {
+		log.Printf("[Batch] Failed to update %s: %v", b.ID, err)
+	}
+
+	requests, err := p.store.requests(b.ID)
+	if err != nil {
+		log.Printf("[Batch] Failed to load results of %s: %v", b.ID, err)
+		status = StatusFailed
+	}
+
+	var output, errs bytes.Buffer
+	for _, req := range requests {
+		line := outputLine{ID: newID("batch_req_"), CustomID: req.CustomID}
+		target := &output
+		switch req.State {
+		case requestCompleted:
+			line.Response = &lineResponse{StatusCode: req.Result.StatusCode, RequestID: newID("req_"), Body: req.Result.Body}
+		case requestFailed:
+			line.Response = &lineResponse{StatusCode: req.Result.StatusCode, RequestID: newID("req_"), Body: req.Result.Body}
+			target = &errs
+		default:
+			if status != StatusExpired {
+				continue // Not run because the batch was cancelled
+			}
+			line.Error = &lineError{Code: "batch_expired", Message: "This request could not be executed before the completion window expired."}
+			target = &errs
+		}
+		encoded, _ := json.Marshal(line)
+		target.Write(append(encoded, '\n'))
+	}
+
+	if output.Len() > 0 {
+		if id, err := p.saveOutput(b, "output", output.Bytes()); err == nil {
+			b.OutputFileID = &id
+		}
+	}
+	if errs.Len() > 0 {
+		if id, err := p.saveOutput(b, "error", errs.Bytes()); err == nil {
+			b.ErrorFileID = &id
+		}
+	}
+
+	now = time.Now().Unix()
+	b.Status = status
+	switch status {
+	case StatusCompleted:
+		b.CompletedAt = &now
+	case StatusCancelled:
+		b.CancelledAt = &now
+	case StatusExpired:
+		b.ExpiredAt = &now
+	case StatusFailed:
+		b.FailedAt = &now
+	}
+	if err := p.store.UpdateBatch(b); err != nil {
+		log.Printf("[Batch] Failed to update %s: %v", b.ID, err)
+	}
+	log.Printf("[Batch] %s %s", b.ID, status)
+}
+
+func (p *Processor) saveOutput(b *Batch, kind string, content []byte) (string, error) {
+	f := &File{Purpose: PurposeBatchOutput, Filename: b.ID + "_" + kind + ".jsonl", Tenant: b.Tenant}
+	if err := p.store.SaveFile(f, content); err != nil {
+		log.Printf("[Batch] Failed to save %s file of %s: %v", kind, b.ID, err)
+		return "", err
+	}
+	return f.ID, nil
+}
+
+// Slots bounds how many requests run at once against each deployment,
+// across all batches
+type Slots struct {
+	limit int
+
+	mu   sync.Mutex
+	sems map[string]chan struct{}
+}
+
+// NewSlots allows limit concurrent requests per key
+func NewSlots(limit int) *Slots {
+	if limit <= 0 {
+		limit = 1
+	}
+	return &Slots{limit: limit, sems: make(map[string]chan struct{})}
+}
+
+// Acquire waits for a free slot for key and returns its release func
+func (s *Slots) Acquire(ctx context.Context, key string) (func(), error) {
+	s.mu.Lock()
+	sem, ok := s.sems[key]
+	if !ok {
+		sem = make(chan struct{}, s.limit)
+		s.sems[key] = sem
+	}
+	s.mu.Unlock()
+
+	select {
+	case sem <- struct{}{}:
+		var once sync.Once
+		return func() { once.Do(func() { <-sem }) }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
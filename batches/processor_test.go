@@ -0,0 +1,247 @@
+package batches
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func openTestStore(t *testing.T) *Store {
+	store, err := Open(filepath.Join(t.TempDir(), "batches.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+func inputFile(n int) []byte {
+	var lines []string
+	for i := 0; i < n; i++ {
+		lines = append(lines, fmt.Sprintf(`{"custom_id":"req-%d","method":"POST","url":"/v1/chat/completions","body":{"model":"m","messages":[{"role":"user","content":"%d"}]}}`, i, i))
+	}
+	return []byte(strings.Join(lines, "\n") + "\n")
+}
+
+func createBatch(t *testing.T, store *Store, content []byte) *Batch {
+	requests, errs := ParseInput(content, "/v1/chat/completions")
+	if len(errs) > 0 {
+		t.Fatalf("input errors: %+v", errs)
+	}
+	now := time.Now().Unix()
+	b := &Batch{
+		Endpoint:         "/v1/chat/completions",
+		InputFileID:      "file-test",
+		CompletionWindow: "24h",
+		Status:           StatusInProgress,
+		CreatedAt:        now,
+		InProgressAt:     &now,
+		ExpiresAt:        now + 86400,
+	}
+	if err := store.CreateBatch(b, requests); err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// outputLines reads a result file into custom_id -> status code
+func outputLines(t *testing.T, store *Store, id *string) map[string]int {
+	lines := map[string]int{}
+	if id == nil {
+		return lines
+	}
+	content, err := store.FileContent(*id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, text := range strings.Split(strings.TrimSpace(string(content)), "\n") {
+		var line outputLine
+		if err := json.Unmarshal([]byte(text), &line); err != nil {
+			t.Fatalf("bad output line %q: %v", text, err)
+		}
+		code := 0
+		if line.Response != nil {
+			code = line.Response.StatusCode
+		}
+		lines[line.CustomID] = code
+	}
+	return lines
+}
+
+func TestParseInput(t *testing.T) {
+	content := []byte(`{"custom_id":"a","method":"POST","url":"/v1/chat/completions","body":{}}
+not json
+
+{"custom_id":"a","method":"POST","url":"/v1/chat/completions","body":{}}
+{"custom_id":"b","method":"GET","url":"/v1/chat/completions","body":{}}
+{"custom_id":"c","method":"POST","url":"/v1/embeddings","body":{}}
+{"method":"POST","url":"/v1/chat/completions","body":{}}
+`)
+	requests, errs := ParseInput(content, "/v1/chat/completions")
+	if len(requests) != 1 || requests[0].CustomID != "a" || requests[0].Line != 1 {
+		t.Errorf("requests = %+v", requests)
+	}
+	want := map[int]string{2: "invalid_json_line", 4: "duplicate_custom_id", 5: "invalid_method", 6: "mismatched_endpoint", 7: "missing_required_parameter"}
+	if len(errs) != len(want) {
+		t.Fatalf("errors = %+v", errs)
+	}
+	for _, e := range errs {
+		if want[*e.Line] != e.Code {
+			t.Errorf("line %d: got %s, want %s", *e.Line, e.Code, want[*e.Line])
+		}
+	}
+
+	if _, errs := ParseInput(nil, "/v1/chat/completions"); len(errs) != 1 || errs[0].Code != "empty_file" {
+		t.Errorf("empty file errors = %+v", errs)
+	}
+}
+
+func TestProcessorRunsBatch(t *testing.T) {
+	store := openTestStore(t)
+	b := createBatch(t, store, inputFile(20))
+
+	// Every third request fails; no more than two run per deployment
+	slots := NewSlots(2)
+	var inFlight, maxInFlight int32
+	run := func(ctx context.Context, batch *Batch, req Request) (Result, error) {
+		release, err := slots.Acquire(ctx, "deployment-a")
+		if err != nil {
+			return Result{}, err
+		}
+		defer release()
+		n := atomic.AddInt32(&inFlight, 1)
+		for {
+			max := atomic.LoadInt32(&maxInFlight)
+			if n <= max || atomic.CompareAndSwapInt32(&maxInFlight, max, n) {
+				break
+			}
+		}
+		time.Sleep(2 * time.Millisecond)
+		atomic.AddInt32(&inFlight, -1)
+
+		if req.Line%3 == 0 {
+			return Result{StatusCode: 503, Body: json.RawMessage(`{"error":{"message":"unavailable"}}`)}, nil
+		}
+		return Result{StatusCode: 200, Body: json.RawMessage(`{"id":"chatcmpl-1"}`)}, nil
+	}
+
+	p := NewProcessor(store, run, 8)
+	p.Start(b)
+	p.Wait()
+
+	if maxInFlight > 2 {
+		t.Errorf("%d requests ran at once on one deployment, limit is 2", maxInFlight)
+	}
+	got, err := store.Batch(b.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Status != StatusCompleted || got.CompletedAt == nil {
+		t.Fatalf("status = %s", got.Status)
+	}
+	if got.RequestCounts != (RequestCounts{Total: 20, Completed: 14, Failed: 6}) {
+		t.Errorf("counts = %+v", got.RequestCounts)
+	}
+	if output := outputLines(t, store, got.OutputFileID); len(output) != 14 || output["req-0"] != 200 {
+		t.Errorf("output = %v", output)
+	}
+	if errs := outputLines(t, store, got.ErrorFileID); len(errs) != 6 || errs["req-2"] != 503 {
+		t.Errorf("errors = %v", errs)
+	}
+}
+
+func TestProcessorCancel(t *testing.T) {
+	store := openTestStore(t)
+	b := createBatch(t, store, inputFile(10))
+
+	started := make(chan struct{})
+	var once sync.Once
+	run := func(ctx context.Context, batch *Batch, req Request) (Result, error) {
+		if req.Line == 1 {
+			once.Do(func() { close(started) })
+			return Result{StatusCode: 200, Body: json.RawMessage(`{}`)}, nil
+		}
+		<-ctx.Done() // Waiting for a slot when the batch is cancelled
+		return Result{}, ctx.Err()
+	}
+
+	p := NewProcessor(store, run, 2)
+	p.Start(b)
+	<-started
+	cancelled, err := p.Cancel(b.ID)
+	if err != nil || cancelled.Status != StatusCancelling {
+		t.Fatalf("cancel: %+v, %v", cancelled, err)
+	}
+	p.Wait()
+
+	got, _ := store.Batch(b.ID)
+	if got.Status != StatusCancelled || got.CancellingAt == nil || got.CancelledAt == nil {
+		t.Fatalf("batch = %+v", got)
+	}
+	if output := outputLines(t, store, got.OutputFileID); len(output) != 1 {
+		t.Errorf("output = %v", output)
+	}
+	if got.ErrorFileID != nil {
+		t.Error("requests that never ran should not be reported as errors")
+	}
+}
+
+func TestProcessorResume(t *testing.T) {
+	store := openTestStore(t)
+	b := createBatch(t, store, inputFile(4))
+
+	// Two requests finished before a restart
+	store.finishRequest(b.ID, 1, Result{StatusCode: 200, Body: json.RawMessage(`{}`)})
+	store.finishRequest(b.ID, 2, Result{StatusCode: 200, Body: json.RawMessage(`{}`)})
+
+	var ran []int
+	var mu sync.Mutex
+	run := func(ctx context.Context, batch *Batch, req Request) (Result, error) {
+		mu.Lock()
+		ran = append(ran, req.Line)
+		mu.Unlock()
+		return Result{StatusCode: 200, Body: json.RawMessage(`{}`)}, nil
+	}
+	p := NewProcessor(store, run, 1)
+	if err := p.Resume(); err != nil {
+		t.Fatal(err)
+	}
+	p.Wait()
+
+	if len(ran) != 2 || ran[0] != 3 || ran[1] != 4 {
+		t.Errorf("ran lines %v, want [3 4]", ran)
+	}
+	got, _ := store.Batch(b.ID)
+	if got.Status != StatusCompleted || got.RequestCounts.Completed != 4 {
+		t.Errorf("batch = %s %+v", got.Status, got.RequestCounts)
+	}
+	if output := outputLines(t, store, got.OutputFileID); len(output) != 4 {
+		t.Errorf("output = %v", output)
+	}
+}
+
+func TestProcessorExpiry(t *testing.T) {
+	store := openTestStore(t)
+	b := createBatch(t, store, inputFile(3))
+	b.ExpiresAt = time.Now().Unix() - 1
+
+	p := NewProcessor(store, func(ctx context.Context, batch *Batch, req Request) (Result, error) {
+		return Result{}, ctx.Err()
+	}, 1)
+	p.Start(b)
+	p.Wait()
+
+	got, _ := store.Batch(b.ID)
+	if got.Status != StatusExpired {
+		t.Fatalf("status = %s", got.Status)
+	}
+	if errs := outputLines(t, store, got.ErrorFileID); len(errs) != 3 {
+		t.Errorf("expired requests in error file = %v", errs)
+	}
+}
@@ -0,0 +1,347 @@
+package batches
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// ErrNotFound is returned for unknown files and batches
+var ErrNotFound = errors.New("not found")
+
+// Request states in the batch_requests table
+const (
+	requestPending   = "pending"
+	requestCompleted = "completed"
+	requestFailed    = "failed"
+)
+
+// Store is the SQLite-backed file and batch store
+type Store struct {
+	db *sql.DB
+}
+
+const schema = `
+CREATE TABLE IF NOT EXISTS files (
+	id TEXT PRIMARY KEY,
+	tenant TEXT NOT NULL DEFAULT '',
+	purpose TEXT NOT NULL,
+	filename TEXT NOT NULL,
+	bytes INTEGER NOT NULL,
+	created_at INTEGER NOT NULL,
+	content BLOB NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS batches (
+	id TEXT PRIMARY KEY,
+	tenant TEXT NOT NULL DEFAULT '',
+	endpoint TEXT NOT NULL,
+	input_file_id TEXT NOT NULL,
+	completion_window TEXT NOT NULL,
+	status TEXT NOT NULL,
+	output_file_id TEXT,
+	error_file_id TEXT,
+	errors TEXT,
+	metadata TEXT,
+	created_at INTEGER NOT NULL,
+	in_progress_at INTEGER,
+	expires_at INTEGER NOT NULL,
+	finalizing_at INTEGER,
+	completed_at INTEGER,
+	failed_at INTEGER,
+	expired_at INTEGER,
+	cancelling_at INTEGER,
+	cancelled_at INTEGER,
+	request_total INTEGER NOT NULL DEFAULT 0,
+	request_completed INTEGER NOT NULL DEFAULT 0,
+	request_failed INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE TABLE IF NOT EXISTS batch_requests (
+	batch_id TEXT NOT NULL,
+	line INTEGER NOT NULL,
+	custom_id TEXT NOT NULL,
+	body TEXT NOT NULL,
+	state TEXT NOT NULL DEFAULT 'pending',
+	status_code INTEGER,
+	response TEXT,
+	PRIMARY KEY (batch_id, line)
+);
+
+CREATE INDEX IF NOT EXISTS idx_batches_tenant ON batches(tenant, created_at);
+CREATE INDEX IF NOT EXISTS idx_batches_status ON batches(status);
+`
+
+// Open opens or creates the store at path
+func Open(path string) (*Store, error) {
+	db, err := sql.Open("sqlite3", path+"?_busy_timeout=5000")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open batch database: %w", err)
+	}
+	// SQLite allows one writer; a single connection avoids lock errors
+	// between concurrent workers
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec(schema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create batch schema: %w", err)
+	}
+	return &Store{db: db}, nil
+}
+
+// Close closes the database
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// newID returns prefix followed by random hex
+func newID(prefix string) string {
+	b := make([]byte, 12)
+	rand.Read(b)
+	return prefix + hex.EncodeToString(b)
+}
+
+// SaveFile stores a new file and fills in its ID and size
+func (s *Store) SaveFile(f *File, content []byte) error {
+	f.ID = newID("file-")
+	f.Object = "file"
+	f.Bytes = len(content)
+	if f.CreatedAt == 0 {
+		f.CreatedAt = time.Now().Unix()
+	}
+	_, err := s.db.Exec(`INSERT INTO files (id, tenant, purpose, filename, bytes, created_at, content) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		f.ID, f.Tenant, f.Purpose, f.Filename, f.Bytes, f.CreatedAt, content)
+	return err
+}
+
+// File returns a file's metadata
+func (s *Store) File(id string) (*File, error) {
+	f := File{Object: "file"}
+	err := s.db.QueryRow(`SELECT id, tenant, purpose, filename, bytes, created_at FROM files WHERE id = ?`, id).
+		Scan(&f.ID, &f.Tenant, &f.Purpose, &f.Filename, &f.Bytes, &f.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return &f, err
+}
+
+// FileContent returns a file's content
+func (s *Store) FileContent(id string) ([]byte, error) {
+	var content []byte
+	err := s.db.QueryRow(`SELECT content FROM files WHERE id = ?`, id).Scan(&content)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return content, err
+}
+
+// CreateBatch stores a new batch and its requests. The batch's ID is filled in.
+func (s *Store) CreateBatch(b *Batch, requests []Request) error {
+	b.ID = newID("batch_")
+	b.Object = "batch"
+	b.RequestCounts = RequestCounts{Total: len(requests)}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`INSERT INTO batches (id, tenant, endpoint, input_file_id, completion_window, status, created_at, expires_at, request_total)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		b.ID, b.Tenant, b.Endpoint, b.InputFileID, b.CompletionWindow, b.Status, b.CreatedAt, b.ExpiresAt, len(requests)); err != nil {
+		return err
+	}
+	stmt, err := tx.Prepare(`INSERT INTO batch_requests (batch_id, line, custom_id, body) VALUES (?, ?, ?, ?)`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for _, req := range requests {
+		if _, err := stmt.Exec(b.ID, req.Line, req.CustomID, string(req.Body)); err != nil {
+			return err
+		}
+	}
+	if err := s.updateBatch(tx, b); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// UpdateBatch saves a batch's status, timestamps, files and errors.
+// Request counts are maintained by FinishRequest and are not written here.
+func (s *Store) UpdateBatch(b *Batch) error {
+	return s.updateBatch(s.db, b)
+}
+
+func (s *Store) updateBatch(db interface {
+	Exec(string, ...interface{}) (sql.Result, error)
+}, b *Batch) error {
+	errs, _ := json.Marshal(b.Errors)
+	metadata, _ := json.Marshal(b.Metadata)
+	_, err := db.Exec(`UPDATE batches SET status = ?, output_file_id = ?, error_file_id = ?, errors = ?, metadata = ?,
+		in_progress_at = ?, finalizing_at = ?, completed_at = ?, failed_at = ?, expired_at = ?, cancelling_at = ?, cancelled_at = ?
+		WHERE id = ?`,
+		b.Status, b.OutputFileID, b.ErrorFileID, string(errs), string(metadata),
+		b.InProgressAt, b.FinalizingAt, b.CompletedAt, b.FailedAt, b.ExpiredAt, b.CancellingAt, b.CancelledAt, b.ID)
+	return err
+}
+
+const batchColumns = `id, tenant, endpoint, input_file_id, completion_window, status, output_file_id, error_file_id, errors, metadata,
+	created_at, in_progress_at, expires_at, finalizing_at, completed_at, failed_at, expired_at, cancelling_at, cancelled_at,
+	request_total, request_completed, request_failed`
+
+func scanBatch(row interface{ Scan(...interface{}) error }) (*Batch, error) {
+	b := Batch{Object: "batch"}
+	var errs, metadata sql.NullString
+	if err := row.Scan(&b.ID, &b.Tenant, &b.Endpoint, &b.InputFileID, &b.CompletionWindow, &b.Status,
+		&b.OutputFileID, &b.ErrorFileID, &errs, &metadata,
+		&b.CreatedAt, &b.InProgressAt, &b.ExpiresAt, &b.FinalizingAt, &b.CompletedAt, &b.FailedAt, &b.ExpiredAt, &b.CancellingAt, &b.CancelledAt,
+		&b.RequestCounts.Total, &b.RequestCounts.Completed, &b.RequestCounts.Failed); err != nil {
+		return nil, err
+	}
+	if errs.Valid {
+		json.Unmarshal([]byte(errs.String), &b.Errors)
+	}
+	if metadata.Valid {
+		json.Unmarshal([]byte(metadata.String), &b.Metadata)
+	}
+	return &b, nil
+}
+
+// Batch returns a batch by ID
+func (s *Store) Batch(id string) (*Batch, error) {
+	b, err := scanBatch(s.db.QueryRow(`SELECT `+batchColumns+` FROM batches WHERE id = ?`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return b, err
+}
+
+// Batches lists a tenant's batches, newest first. after is the ID of the
+// last batch of the previous page, or empty for the first page.
+func (s *Store) Batches(tenant, after string, limit int) ([]*Batch, error) {
+	query := `SELECT ` + batchColumns + ` FROM batches WHERE tenant = ?`
+	args := []interface{}{tenant}
+	if after != "" {
+		query += ` AND rowid < (SELECT rowid FROM batches WHERE id = ?)`
+		args = append(args, after)
+	}
+	rows, err := s.db.Query(query+` ORDER BY rowid DESC LIMIT ?`, append(args, limit)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []*Batch
+	for rows.Next() {
+		b, err := scanBatch(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, b)
+	}
+	return list, rows.Err()
+}
+
+// unfinishedBatches returns batches a restart must pick up again
+func (s *Store) unfinishedBatches() ([]*Batch, error) {
+	rows, err := s.db.Query(`SELECT `+batchColumns+` FROM batches WHERE status IN (?, ?, ?, ?) ORDER BY rowid`,
+		StatusValidating, StatusInProgress, StatusFinalizing, StatusCancelling)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []*Batch
+	for rows.Next() {
+		b, err := scanBatch(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, b)
+	}
+	return list, rows.Err()
+}
+
+// pendingRequests returns the requests of a batch that have not run yet
+func (s *Store) pendingRequests(batchID string) ([]Request, error) {
+	rows, err := s.db.Query(`SELECT line, custom_id, body FROM batch_requests WHERE batch_id = ? AND state = ? ORDER BY line`,
+		batchID, requestPending)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []Request
+	for rows.Next() {
+		var req Request
+		var body string
+		if err := rows.Scan(&req.Line, &req.CustomID, &body); err != nil {
+			return nil, err
+		}
+		req.Body = json.RawMessage(body)
+		list = append(list, req)
+	}
+	return list, rows.Err()
+}
+
+// finishRequest records a request's result and updates the batch's counts
+func (s *Store) finishRequest(batchID string, line int, result Result) error {
+	state, counter := requestCompleted, "request_completed"
+	if result.StatusCode < 200 || result.StatusCode > 299 {
+		state, counter = requestFailed, "request_failed"
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	res, err := tx.Exec(`UPDATE batch_requests SET state = ?, status_code = ?, response = ? WHERE batch_id = ? AND line = ? AND state = ?`,
+		state, result.StatusCode, string(result.Body), batchID, line, requestPending)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil // Already recorded
+	}
+	if _, err := tx.Exec(`UPDATE batches SET `+counter+` = `+counter+` + 1 WHERE id = ?`, batchID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// finishedRequest is a request with its recorded result
+type finishedRequest struct {
+	Request
+	State  string
+	Result Result
+}
+
+// requests returns every request of a batch in input order
+func (s *Store) requests(batchID string) ([]finishedRequest, error) {
+	rows, err := s.db.Query(`SELECT line, custom_id, state, status_code, response FROM batch_requests WHERE batch_id = ? ORDER BY line`, batchID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []finishedRequest
+	for rows.Next() {
+		var req finishedRequest
+		var status sql.NullInt64
+		var response sql.NullString
+		if err := rows.Scan(&req.Line, &req.CustomID, &req.State, &status, &response); err != nil {
+			return nil, err
+		}
+		req.Result = Result{StatusCode: int(status.Int64), Body: json.RawMessage(response.String)}
+		list = append(list, req)
+	}
+	return list, rows.Err()
+}
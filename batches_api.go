@@ -0,0 +1,392 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"ch.at/batches"
+	"ch.at/tenants"
+)
+
+// OpenAI-style Batch API: upload a JSONL file to /v1/files, create a batch
+// from it at /v1/batches, poll it, and download its output and error files.
+// Batches run in the background with BATCH_WORKERS requests in flight per
+// batch and at most BATCH_CONCURRENCY_PER_DEPLOYMENT requests per deployment
+// across all batches. Jobs are stored in BATCH_DB, default batches.db.
+var (
+	batchStore     *batches.Store
+	batchProcessor *batches.Processor
+	batchSlots     *batches.Slots
+)
+
+// batchEndpoint is the only endpoint batches can target so far
+const batchEndpoint = "/v1/chat/completions"
+
+// maxBatchFileBytes caps uploads; files are kept in SQLite
+const maxBatchFileBytes = 100 << 20
+
+// InitBatches opens the batch store and resumes unfinished batches
+func InitBatches() error {
+	path := os.Getenv("BATCH_DB")
+	if path == "" {
+		path = "batches.db"
+	}
+	store, err := batches.Open(path)
+	if err != nil {
+		return err
+	}
+
+	batchStore = store
+	batchSlots = batches.NewSlots(envInt("BATCH_CONCURRENCY_PER_DEPLOYMENT", 4))
+	batchProcessor = batches.NewProcessor(store, runBatchRequest, envInt("BATCH_WORKERS", 16))
+	return batchProcessor.Resume()
+}
+
+// envInt reads a positive integer setting, falling back to def
+func envInt(name string, def int) int {
+	if n, err := strconv.Atoi(os.Getenv(name)); err == nil && n > 0 {
+		return n
+	}
+	return def
+}
+
+// runBatchRequest runs one chat completion line of a batch through the
+// router, waiting for a slot on each deployment it tries. Cancelling or
+// expiring the batch aborts the request upstream.
+func runBatchRequest(ctx context.Context, batch *batches.Batch, line batches.Request) (batches.Result, error) {
+	failed := func(apiErr *APIError) (batches.Result, error) {
+		body, _ := json.Marshal(map[string]*APIError{"error": apiErr})
+		return batches.Result{StatusCode: apiErr.Status, Body: body}, nil
+	}
+
+	var req ChatRequest
+	if err := json.Unmarshal(line.Body, &req); err != nil {
+		return failed(invalidRequest("invalid_json", "", "Invalid JSON: "+err.Error()))
+	}
+	if apiErr := req.normalize(); apiErr != nil {
+		return failed(apiErr)
+	}
+	var tenant *tenants.Tenant
+	if batch.Tenant != "" && tenantStore != nil {
+		t, err := tenantStore.Tenant(batch.Tenant)
+		if err != nil {
+			return failed(newAPIError(http.StatusUnauthorized, errTypeInvalidRequest, "invalid_api_key", "", "The tenant that created this batch no longer exists"))
+		}
+		if !t.AllowsModel(req.Model) {
+			return failed(newAPIError(http.StatusForbidden, errTypeInvalidRequest, "model_not_allowed", "model",
+				fmt.Sprintf("Your API key does not have access to the model '%s'", req.Model)))
+		}
+		// Quotas are checked per line: a single batch can be far larger
+		// than the tenant's daily tokens or remaining spend
+		if apiErr := checkTenantUsage(t, time.Now()); apiErr != nil {
+			return failed(apiErr)
+		}
+		tenant = t
+	}
+	if modelRouter == nil {
+		return failed(newAPIError(http.StatusServiceUnavailable, errTypeServer, "", "", "Model router not initialized"))
+	}
+
+	params := req.routerParams()
+	params.Context = ctx
+	params.Admit = func(deploymentID string) (func(), error) {
+		return batchSlots.Acquire(ctx, deploymentID)
+	}
+	messages, _ := fitContext(ctx, req.Messages, req.Model, params, getServiceContextPolicy("API"))
+	llmResp, err := LLMWithRouterConv(messages, req.Model, batch.ID, params, nil)
+	if err != nil {
+		if ctx.Err() != nil && errors.Is(err, ctx.Err()) {
+			return batches.Result{}, err // Cancelled or expired; stays pending
+		}
+		return failed(apiErrorFor(err, req.Model))
+	}
+	chargeTenant(tenant, req.Model, llmResp)
+
+	body, _ := json.Marshal(chatCompletion(req.Model, llmResp))
+	return batches.Result{StatusCode: http.StatusOK, Body: body}, nil
+}
+
+// callerTenantID identifies who owns files and batches; anonymous callers share ""
+func callerTenantID(r *http.Request) string {
+	if tenant := tenantFrom(r); tenant != nil {
+		return tenant.ID
+	}
+	return ""
+}
+
+// batchPreamble applies the checks shared by the file and batch endpoints
+func batchPreamble(w http.ResponseWriter, r *http.Request, allow string) bool {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", allow)
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return false
+	}
+	if tenantFrom(r) == nil && !rateLimitAllow(r.RemoteAddr) {
+		writeAPIError(w, rateLimited("Rate limit exceeded", time.Second))
+		return false
+	}
+	if batchStore == nil {
+		writeAPIError(w, newAPIError(http.StatusServiceUnavailable, errTypeServer, "", "", "Batch processing is not available"))
+		return false
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func fileNotFound(id string) *APIError {
+	return newAPIError(http.StatusNotFound, errTypeInvalidRequest, "file_not_found", "file_id", fmt.Sprintf("No such file: '%s'", id))
+}
+
+// handleFiles handles POST /v1/files, a multipart upload with "purpose"
+// and "file" fields. Only batch input files are accepted.
+func handleFiles(w http.ResponseWriter, r *http.Request) {
+	if !batchPreamble(w, r, "POST, OPTIONS") {
+		return
+	}
+	if r.Method != "POST" {
+		methodNotAllowed(w, "POST, OPTIONS")
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxBatchFileBytes)
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		writeAPIError(w, invalidRequest("invalid_request", "file", "Expected a multipart upload of at most 100 MB: "+err.Error()))
+		return
+	}
+	if purpose := r.FormValue("purpose"); purpose != batches.PurposeBatch {
+		writeAPIError(w, invalidRequest("invalid_purpose", "purpose", fmt.Sprintf("purpose must be '%s'", batches.PurposeBatch)))
+		return
+	}
+	upload, header, err := r.FormFile("file")
+	if err != nil {
+		writeAPIError(w, invalidRequest("missing_required_parameter", "file", "file is required"))
+		return
+	}
+	defer upload.Close()
+	content, err := io.ReadAll(upload)
+	if err != nil {
+		writeAPIError(w, invalidRequest("invalid_request", "file", "Failed to read file: "+err.Error()))
+		return
+	}
+
+	file := &batches.File{Purpose: batches.PurposeBatch, Filename: header.Filename, Tenant: callerTenantID(r)}
+	if err := batchStore.SaveFile(file, content); err != nil {
+		log.Printf("[Batch] Failed to save upload: %v", err)
+		writeAPIError(w, newAPIError(http.StatusInternalServerError, errTypeServer, "", "", "Failed to store file"))
+		return
+	}
+	writeJSON(w, file)
+}
+
+// handleFile handles GET /v1/files/{id} and GET /v1/files/{id}/content
+func handleFile(w http.ResponseWriter, r *http.Request) {
+	if !batchPreamble(w, r, "GET, OPTIONS") {
+		return
+	}
+	if r.Method != "GET" {
+		methodNotAllowed(w, "GET, OPTIONS")
+		return
+	}
+
+	id, content := strings.CutSuffix(strings.TrimPrefix(r.URL.Path, "/v1/files/"), "/content")
+	file, err := batchStore.File(id)
+	if err != nil || file.Tenant != callerTenantID(r) {
+		writeAPIError(w, fileNotFound(id))
+		return
+	}
+	if !content {
+		writeJSON(w, file)
+		return
+	}
+
+	data, err := batchStore.FileContent(id)
+	if err != nil {
+		writeAPIError(w, fileNotFound(id))
+		return
+	}
+	w.Header().Set("Content-Type", "application/jsonl")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", file.Filename))
+	w.Write(data)
+}
+
+// handleBatches handles POST /v1/batches (create) and GET /v1/batches (list)
+func handleBatches(w http.ResponseWriter, r *http.Request) {
+	if !batchPreamble(w, r, "GET, POST, OPTIONS") {
+		return
+	}
+	switch r.Method {
+	case "GET":
+		listBatches(w, r)
+	case "POST":
+		createBatch(w, r)
+	default:
+		methodNotAllowed(w, "GET, POST, OPTIONS")
+	}
+}
+
+func createBatch(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		InputFileID      string            `json:"input_file_id"`
+		Endpoint         string            `json:"endpoint"`
+		CompletionWindow string            `json:"completion_window"`
+		Metadata         map[string]string `json:"metadata"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeAPIError(w, invalidRequest("invalid_json", "", "Invalid JSON: "+err.Error()))
+		return
+	}
+	if req.Endpoint != batchEndpoint {
+		writeAPIError(w, invalidRequest("invalid_value", "endpoint", fmt.Sprintf("endpoint must be '%s'", batchEndpoint)))
+		return
+	}
+	if req.CompletionWindow != "24h" {
+		writeAPIError(w, invalidRequest("invalid_value", "completion_window", "completion_window must be '24h'"))
+		return
+	}
+	tenantID := callerTenantID(r)
+	file, err := batchStore.File(req.InputFileID)
+	if err != nil || file.Tenant != tenantID || file.Purpose != batches.PurposeBatch {
+		writeAPIError(w, fileNotFound(req.InputFileID))
+		return
+	}
+	content, err := batchStore.FileContent(file.ID)
+	if err != nil {
+		writeAPIError(w, fileNotFound(req.InputFileID))
+		return
+	}
+
+	// The whole file is validated up front; any bad line fails the batch
+	requests, errs := batches.ParseInput(content, req.Endpoint)
+	if tenant := tenantFrom(r); tenant != nil {
+		for _, line := range requests {
+			var body struct {
+				Model string `json:"model"`
+			}
+			json.Unmarshal(line.Body, &body)
+			if body.Model != "" && !tenant.AllowsModel(body.Model) {
+				errs = append(errs, batches.LineError(line.Line, "model_not_allowed",
+					fmt.Sprintf("Your API key does not have access to the model '%s'", body.Model)))
+			}
+		}
+	}
+
+	now := time.Now()
+	created := now.Unix()
+	batch := &batches.Batch{
+		Endpoint:         req.Endpoint,
+		InputFileID:      file.ID,
+		CompletionWindow: req.CompletionWindow,
+		Status:           batches.StatusInProgress,
+		CreatedAt:        created,
+		InProgressAt:     &created,
+		ExpiresAt:        now.Add(24 * time.Hour).Unix(),
+		Metadata:         req.Metadata,
+		Tenant:           tenantID,
+	}
+	if len(errs) > 0 {
+		batch.Status = batches.StatusFailed
+		batch.InProgressAt = nil
+		batch.FailedAt = &created
+		batch.Errors = &batches.Errors{Object: "list", Data: errs}
+		requests = nil
+	}
+	if err := batchStore.CreateBatch(batch, requests); err != nil {
+		log.Printf("[Batch] Failed to create batch: %v", err)
+		writeAPIError(w, newAPIError(http.StatusInternalServerError, errTypeServer, "", "", "Failed to create batch"))
+		return
+	}
+
+	beacon("batch_created", map[string]interface{}{
+		"batch_id": batch.ID,
+		"requests": len(requests),
+		"status":   batch.Status,
+	})
+	if batch.Status == batches.StatusInProgress {
+		batchProcessor.Start(batch)
+	}
+	writeJSON(w, batch)
+}
+
+func listBatches(w http.ResponseWriter, r *http.Request) {
+	limit := 20
+	if n, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && n > 0 && n <= 100 {
+		limit = n
+	}
+	// One extra row tells whether there is another page
+	list, err := batchStore.Batches(callerTenantID(r), r.URL.Query().Get("after"), limit+1)
+	if err != nil {
+		log.Printf("[Batch] Failed to list batches: %v", err)
+		writeAPIError(w, newAPIError(http.StatusInternalServerError, errTypeServer, "", "", "Failed to list batches"))
+		return
+	}
+	hasMore := len(list) > limit
+	if hasMore {
+		list = list[:limit]
+	}
+
+	response := map[string]interface{}{
+		"object":   "list",
+		"data":     list,
+		"has_more": hasMore,
+		"first_id": nil,
+		"last_id":  nil,
+	}
+	if len(list) > 0 {
+		response["first_id"] = list[0].ID
+		response["last_id"] = list[len(list)-1].ID
+	} else {
+		response["data"] = []*batches.Batch{}
+	}
+	writeJSON(w, response)
+}
+
+// handleBatch handles GET /v1/batches/{id} and POST /v1/batches/{id}/cancel
+func handleBatch(w http.ResponseWriter, r *http.Request) {
+	if !batchPreamble(w, r, "GET, POST, OPTIONS") {
+		return
+	}
+
+	id, cancel := strings.CutSuffix(strings.TrimPrefix(r.URL.Path, "/v1/batches/"), "/cancel")
+	batch, err := batchStore.Batch(id)
+	if err != nil || batch.Tenant != callerTenantID(r) {
+		writeAPIError(w, newAPIError(http.StatusNotFound, errTypeInvalidRequest, "batch_not_found", "batch_id", fmt.Sprintf("No such batch: '%s'", id)))
+		return
+	}
+
+	switch {
+	case cancel && r.Method == "POST":
+		if batch.Done() {
+			writeAPIError(w, newAPIError(http.StatusConflict, errTypeInvalidRequest, "batch_not_cancellable", "",
+				fmt.Sprintf("Cannot cancel a batch with status '%s'", batch.Status)))
+			return
+		}
+		if batch, err = batchProcessor.Cancel(id); err != nil {
+			log.Printf("[Batch] Failed to cancel %s: %v", id, err)
+			writeAPIError(w, newAPIError(http.StatusInternalServerError, errTypeServer, "", "", "Failed to cancel batch"))
+			return
+		}
+		writeJSON(w, batch)
+	case !cancel && r.Method == "GET":
+		writeJSON(w, batch)
+	case cancel:
+		methodNotAllowed(w, "POST, OPTIONS")
+	default:
+		methodNotAllowed(w, "GET, OPTIONS")
+	}
+}
@@ -12,6 +12,11 @@ import (
 var debugMode bool
 
 func main() {
+	// Subcommands run instead of the servers
+	if len(os.Args) > 1 && os.Args[1] == "keys" {
+		os.Exit(runKeysCommand(os.Args[2:]))
+	}
+
 	// Parse command line flags
 	flag.BoolVar(&debugMode, "debug", false, "Enable debug logging")
 	flag.Parse()
@@ -22,11 +27,22 @@ func main() {
 		log.Println("LLM interactions will not be logged")
 	}
 	
+	if err := InitAPIKeys(); err != nil {
+		log.Fatalf("API key store initialization failed: %v", err)
+	}
+
 	// Initialize model router (non-blocking, falls back to legacy if fails)
 	if err := InitializeModelRouter(); err != nil {
 		log.Printf("Model router initialization failed: %v", err)
 		log.Println("Using legacy LLM mode")
 	}
+	preloadTokenizers()
+	
+	// Batches resume once the router can serve them
+	if err := InitBatches(); err != nil {
+		log.Printf("WARNING: Batch store initialization failed: %v", err)
+		log.Println("The batch API will be unavailable")
+	}
 	
 	// Beacon application startup
 	beacon("chat_startup", map[string]interface{}{
@@ -37,6 +53,7 @@ func main() {
 		"high_port_mode": os.Getenv("HIGH_PORT_MODE") == "true",
 		"debug_mode": debugMode,
 		"router_enabled": modelRouter != nil,
+		"api_keys_enabled": tenantStore != nil,
 	})
 
 	// SSH Server
@@ -2,9 +2,12 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"flag"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"net/url"
 	"os"
@@ -87,21 +90,93 @@ func checkResponse(resp *http.Response, err error, passed, failed *int) {
 }
 
 
+// startMockServer starts the server binary with the mock deployment config
+// on high ports, so the tests run without API keys or network access, and
+// waits for it to report healthy
+func startMockServer(binary, configDir, baseURL string) (*exec.Cmd, error) {
+	cmd := exec.Command(binary)
+	cmd.Env = append(os.Environ(), "LLM_CONFIG_DIR="+configDir, "HIGH_PORT_MODE=true", "ENABLE_LLM_AUDIT=false")
+	cmd.Stdout = io.Discard
+	cmd.Stderr = io.Discard
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	deadline := time.Now().Add(15 * time.Second)
+	for time.Now().Before(deadline) {
+		if resp, err := http.Get(baseURL + "/health"); err == nil {
+			resp.Body.Close()
+			if resp.StatusCode == 200 {
+				return cmd, nil
+			}
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+	cmd.Process.Kill()
+	cmd.Wait()
+	return nil, fmt.Errorf("%s did not become healthy", binary)
+}
+
+// lookupTXT queries the server's DNS port directly, without going through
+// the system resolver or needing dig
+func lookupTXT(host, port, name string) ([]string, error) {
+	resolver := &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "udp", net.JoinHostPort(host, port))
+		},
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	return resolver.LookupTXT(ctx, name)
+}
+
 func main() {
-	if len(os.Args) < 2 {
+	mock := flag.Bool("mock", false, "start the server with the mock deployment config and test it on high ports")
+	server := flag.String("server", "./ch.at", "server binary started by -mock")
+	mockConfig := flag.String("mock-config", "./config/mock", "deployment config directory used by -mock")
+	flag.Usage = func() {
 		fmt.Println("Usage: selftest <base-url>")
+		fmt.Println("       selftest -mock [-server ./ch.at] [-mock-config ./config/mock]")
 		fmt.Println("Example: selftest http://localhost:8080")
-		os.Exit(1)
 	}
+	flag.Parse()
 
-	baseURL := strings.TrimSuffix(os.Args[1], "/")
-	
-	sshPort := "22"
+	var baseURL string
+	switch {
+	case *mock:
+		baseURL = "http://localhost:8080"
+	case flag.NArg() == 1:
+		baseURL = strings.TrimSuffix(flag.Arg(0), "/")
+	default:
+		flag.Usage()
+		os.Exit(1)
+	}
 	
-	// Extract hostname from URL for SSH/DNS tests
+	// Extract hostname from URL for SSH/DNS tests. The server on 8080 is
+	// in HIGH_PORT_MODE, which moves SSH and DNS too.
 	hostname := "localhost"
+	sshPort, dnsPort := "22", "53"
 	if u, err := url.Parse(baseURL); err == nil && u.Hostname() != "" {
 		hostname = u.Hostname()
+		if u.Port() == "8080" {
+			sshPort, dnsPort = "2222", "8053"
+		}
+	}
+
+	// Stops the mock server; os.Exit skips deferred calls
+	stopServer := func() {}
+	if *mock {
+		cmd, err := startMockServer(*server, *mockConfig, baseURL)
+		if err != nil {
+			fmt.Printf("Could not start the mock server: %v\n", err)
+			os.Exit(1)
+		}
+		stopServer = func() {
+			cmd.Process.Kill()
+			cmd.Wait()
+		}
 	}
 	
 	passed := 0
@@ -318,23 +393,23 @@ func main() {
 
 	// Test 7: DNS protocol
 	fmt.Print("Testing DNS protocol... ")
-	// Run dig command to query the DNS server
 	// For localhost, use the query directly without domain suffix
 	var queryDomain string
 	if hostname == "localhost" || hostname == "127.0.0.1" {
-		queryDomain = "repeat-verbatim-the-word-pass"
+		queryDomain = "repeat-verbatim-the-word-pass."
 	} else {
-		queryDomain = "repeat-verbatim-the-word-pass." + hostname
+		queryDomain = "repeat-verbatim-the-word-pass." + hostname + "."
+	}
+	dnsHost := hostname
+	if hostname == "localhost" {
+		dnsHost = "127.0.0.1"
 	}
-	cmd := exec.Command("dig", "+short", "@"+hostname, "-p", "53", queryDomain, "TXT")
-	output, err := cmd.Output()
+	records, err := lookupTXT(dnsHost, dnsPort, queryDomain)
 	if err != nil {
-		fmt.Printf("✗ (dig command failed: %v)\n", err)
+		fmt.Printf("✗ (DNS query failed: %v)\n", err)
 		failed++
 	} else {
-		outputStr := strings.TrimSpace(string(output))
-		// DNS TXT records come with quotes, remove them
-		outputStr = strings.Trim(outputStr, "\"")
+		outputStr := strings.TrimSpace(strings.Join(records, ""))
 		
 		// Check for response
 		if outputStr == "pass" {
@@ -377,6 +452,7 @@ func main() {
 
 	// Summary
 	fmt.Printf("\nTests passed: %d/%d\n", passed, passed+failed)
+	stopServer()
 	if failed > 0 {
 		os.Exit(1)
 	}
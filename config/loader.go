@@ -40,6 +40,9 @@ type DeploymentConfig struct {
 	Endpoint        EndpointConfig         `yaml:"endpoint"`
 	Parameters      map[string]interface{} `yaml:"parameters"`
 	Tags            map[string]string      `yaml:"tags"`
+
+	// Overrides routing.yaml's circuit_breaker settings for this deployment
+	CircuitBreaker *CircuitBreakerConfig `yaml:"circuit_breaker,omitempty"`
 }
 
 // EndpointConfig from YAML
@@ -59,15 +62,37 @@ type EndpointConfig struct {
 
 // AuthConfig from YAML
 type AuthConfig struct {
-	Type string `yaml:"type"`
+	Type   string `yaml:"type"`
+	APIKey string `yaml:"api_key,omitempty"` // Usually "${ENV_VAR}", expanded at load time
+
+	// Azure AD client credentials (auth type "azure_ad")
+	TenantID     string `yaml:"tenant_id,omitempty"`
+	ClientID     string `yaml:"client_id,omitempty"`
+	ClientSecret string `yaml:"client_secret,omitempty"`
+
+	// AWS credentials (auth type "aws_iam")
+	AccessKeyID     string `yaml:"access_key_id,omitempty"`
+	SecretAccessKey string `yaml:"secret_access_key,omitempty"`
+	SessionToken    string `yaml:"session_token,omitempty"`
+
+	// GCP service-account key file (auth type "gcp_oauth")
+	ServiceAccountFile string `yaml:"service_account_file,omitempty"`
+}
+
+// directProviderKeyEnv names the default API key variable for providers
+// that are called directly instead of through a OneAPI channel
+var directProviderKeyEnv = map[string]string{
+	string(models.ProviderAnthropic): "ANTHROPIC_API_KEY",
+	string(models.ProviderAzure):     "AZURE_OPENAI_API_KEY",
 }
 
 // RoutingConfig from YAML
 type RoutingConfig struct {
-	Strategy     string                 `yaml:"strategy"`
-	HealthCheck  HealthCheckConfig      `yaml:"health_check"`
-	Fallback     FallbackConfig         `yaml:"fallback"`
-	Metrics      MetricsConfig          `yaml:"metrics"`
+	Strategy       string               `yaml:"strategy"`
+	HealthCheck    HealthCheckConfig    `yaml:"health_check"`
+	CircuitBreaker CircuitBreakerConfig `yaml:"circuit_breaker"`
+	Fallback       FallbackConfig       `yaml:"fallback"`
+	Metrics        MetricsConfig        `yaml:"metrics"`
 }
 
 // HealthCheckConfig from YAML
@@ -79,6 +104,56 @@ type HealthCheckConfig struct {
 	CheckOnStartup      bool   `yaml:"check_on_startup"`
 }
 
+// CircuitBreakerConfig from YAML. Unset fields take the global value, or
+// for routing.yaml itself routing.DefaultCircuitBreakerConfig's.
+type CircuitBreakerConfig struct {
+	Enabled          *bool   `yaml:"enabled"`
+	ErrorThreshold   float64 `yaml:"error_threshold"`    // Error rate that opens the circuit
+	MinRequests      int     `yaml:"min_requests"`       // Requests in the window before the rate counts
+	Window           string  `yaml:"window"`             // Sliding window the error rate is measured over
+	SuccessThreshold int     `yaml:"success_threshold"`  // Half-open successes that close the circuit
+	Timeout          string  `yaml:"timeout"`            // Time open before going half-open
+	HalfOpenRequests int     `yaml:"half_open_requests"` // Half-open requests allowed in flight
+}
+
+// apply overrides base with the fields set in c. A window or timeout that
+// isn't a positive duration is an error rather than falling back silently.
+func (c *CircuitBreakerConfig) apply(base routing.CircuitBreakerConfig) (routing.CircuitBreakerConfig, error) {
+	if c == nil {
+		return base, nil
+	}
+	if c.Enabled != nil {
+		base.Enabled = *c.Enabled
+	}
+	if c.ErrorThreshold > 0 {
+		base.ErrorThreshold = c.ErrorThreshold
+	}
+	if c.MinRequests > 0 {
+		base.MinRequests = c.MinRequests
+	}
+	if c.Window != "" {
+		d, err := time.ParseDuration(c.Window)
+		if err != nil || d <= 0 {
+			return base, fmt.Errorf("invalid window %q: want a duration such as \"60s\"", c.Window)
+		}
+		base.Window = d
+	}
+	if c.SuccessThreshold > 0 {
+		base.SuccessThreshold = c.SuccessThreshold
+	}
+	if c.Timeout != "" {
+		d, err := time.ParseDuration(c.Timeout)
+		if err != nil || d <= 0 {
+			return base, fmt.Errorf("invalid timeout %q: want a duration such as \"30s\"", c.Timeout)
+		}
+		base.Timeout = d
+	}
+	if c.HalfOpenRequests > 0 {
+		base.HalfOpenRequests = c.HalfOpenRequests
+	}
+	return base, nil
+}
+
 // FallbackConfig from YAML
 type FallbackConfig struct {
 	Enabled          bool `yaml:"enabled"`
@@ -149,6 +224,14 @@ func expandEnvVars(config *Config) {
 		deployment.Endpoint.BaseURL = expandEnv(deployment.Endpoint.BaseURL)
 		deployment.Endpoint.Region = expandEnv(deployment.Endpoint.Region)
 		deployment.Endpoint.ProjectID = expandEnv(deployment.Endpoint.ProjectID)
+		deployment.Endpoint.Auth.APIKey = expandEnv(deployment.Endpoint.Auth.APIKey)
+		deployment.Endpoint.Auth.TenantID = expandEnv(deployment.Endpoint.Auth.TenantID)
+		deployment.Endpoint.Auth.ClientID = expandEnv(deployment.Endpoint.Auth.ClientID)
+		deployment.Endpoint.Auth.ClientSecret = expandEnv(deployment.Endpoint.Auth.ClientSecret)
+		deployment.Endpoint.Auth.AccessKeyID = expandEnv(deployment.Endpoint.Auth.AccessKeyID)
+		deployment.Endpoint.Auth.SecretAccessKey = expandEnv(deployment.Endpoint.Auth.SecretAccessKey)
+		deployment.Endpoint.Auth.SessionToken = expandEnv(deployment.Endpoint.Auth.SessionToken)
+		deployment.Endpoint.Auth.ServiceAccountFile = expandEnv(deployment.Endpoint.Auth.ServiceAccountFile)
 		config.Deployments[id] = deployment
 	}
 }
@@ -190,6 +273,11 @@ func BuildRouter(config *Config) (*routing.Router, *models.ModelRegistry, *model
 
 	// Create router
 	router := routing.NewRouter(strategy)
+	breakerDefaults, err := config.Routing.CircuitBreaker.apply(routing.DefaultCircuitBreakerConfig())
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("routing.yaml circuit_breaker: %w", err)
+	}
+	router.SetCircuitBreakerDefaults(breakerDefaults)
 
 	// Create registries
 	modelRegistry := models.NewModelRegistry()
@@ -234,8 +322,11 @@ func BuildRouter(config *Config) (*routing.Router, *models.ModelRegistry, *model
 		}
 
 		// Get API key from environment based on channel or model name
-		apiKey := ""
-		if authType == models.AuthAPIKey {
+		apiKey := deploymentConfig.Endpoint.Auth.APIKey
+		if envVar, direct := directProviderKeyEnv[deploymentConfig.Provider]; direct && apiKey == "" && authType == models.AuthAPIKey {
+			// Direct provider deployments don't go through a OneAPI channel
+			apiKey = os.Getenv(envVar)
+		} else if apiKey == "" && authType == models.AuthAPIKey {
 			// First check if there's a channel tag
 			channel := deploymentConfig.Tags["channel"]
 			modelName := deploymentConfig.ProviderModelID
@@ -326,9 +417,29 @@ func BuildRouter(config *Config) (*routing.Router, *models.ModelRegistry, *model
 			Tags:       deploymentConfig.Tags,
 			CreatedAt:  time.Now(),
 		}
+
+		switch authType {
+		case models.AuthAzureAD:
+			deployment.Endpoint.Auth.AzureCredentials = buildAzureAuth(deploymentConfig.Endpoint.Auth)
+		case models.AuthAWS:
+			deployment.Endpoint.Auth.AWSCredentials = buildAWSAuth(deploymentConfig.Endpoint.Auth, deploymentConfig.Endpoint.Region)
+		case models.AuthGCP:
+			gcpAuth, err := buildGCPAuth(deploymentConfig.Endpoint.Auth)
+			if err != nil {
+				fmt.Printf("[WARNING] Deployment %s: %v\n", id, err)
+			}
+			deployment.Endpoint.Auth.GCPCredentials = gcpAuth
+		}
 		
 		deploymentRegistry.Register(deployment)
 		router.RegisterDeployment(deployment)
+		if deploymentConfig.CircuitBreaker != nil {
+			breaker, err := deploymentConfig.CircuitBreaker.apply(breakerDefaults)
+			if err != nil {
+				return nil, nil, nil, fmt.Errorf("deployment %s circuit_breaker: %w", id, err)
+			}
+			router.ConfigureCircuitBreaker(id, breaker)
+		}
 	}
 
 	// Set up health checker if enabled
@@ -350,4 +461,65 @@ func BuildRouter(config *Config) (*routing.Router, *models.ModelRegistry, *model
 	}
 
 	return router, modelRegistry, deploymentRegistry, nil
-}
\ No newline at end of file
+}
+
+// buildAzureAuth resolves Azure AD client credentials, falling back to the
+// standard AZURE_TENANT_ID / AZURE_CLIENT_ID / AZURE_CLIENT_SECRET variables
+func buildAzureAuth(auth AuthConfig) *models.AzureAuth {
+	creds := &models.AzureAuth{
+		TenantID:     auth.TenantID,
+		ClientID:     auth.ClientID,
+		ClientSecret: auth.ClientSecret,
+	}
+	if creds.TenantID == "" {
+		creds.TenantID = os.Getenv("AZURE_TENANT_ID")
+	}
+	if creds.ClientID == "" {
+		creds.ClientID = os.Getenv("AZURE_CLIENT_ID")
+	}
+	if creds.ClientSecret == "" {
+		creds.ClientSecret = os.Getenv("AZURE_CLIENT_SECRET")
+	}
+	return creds
+}
+
+// buildAWSAuth resolves AWS credentials for SigV4 signing, falling back to the
+// standard AWS_ACCESS_KEY_ID / AWS_SECRET_ACCESS_KEY / AWS_SESSION_TOKEN / AWS_REGION variables
+func buildAWSAuth(auth AuthConfig, region string) *models.AWSAuth {
+	creds := &models.AWSAuth{
+		AccessKeyID:     auth.AccessKeyID,
+		SecretAccessKey: auth.SecretAccessKey,
+		SessionToken:    auth.SessionToken,
+		Region:          region,
+	}
+	if creds.AccessKeyID == "" && creds.SecretAccessKey == "" {
+		// Only take the session token along with env keys so they stay a matching set
+		creds.AccessKeyID = os.Getenv("AWS_ACCESS_KEY_ID")
+		creds.SecretAccessKey = os.Getenv("AWS_SECRET_ACCESS_KEY")
+		if creds.SessionToken == "" {
+			creds.SessionToken = os.Getenv("AWS_SESSION_TOKEN")
+		}
+	}
+	if creds.Region == "" {
+		creds.Region = os.Getenv("AWS_REGION")
+	}
+	return creds
+}
+
+// buildGCPAuth loads the service-account key file, falling back to
+// GOOGLE_APPLICATION_CREDENTIALS
+func buildGCPAuth(auth AuthConfig) (*models.GCPAuth, error) {
+	path := auth.ServiceAccountFile
+	if path == "" {
+		path = os.Getenv("GOOGLE_APPLICATION_CREDENTIALS")
+	}
+	if path == "" {
+		return &models.GCPAuth{}, fmt.Errorf("no service account file configured")
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return &models.GCPAuth{}, fmt.Errorf("failed to read service account file: %w", err)
+	}
+	return &models.GCPAuth{ServiceAccountJSON: string(data)}, nil
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"ch.at/providers"
+	"ch.at/routing"
+)
+
+// Context policies decide what happens to a conversation too long for
+// every deployment of the requested model:
+//
+//   - trim drops the oldest turns until the rest fits
+//   - summarize replaces the oldest turns with a summary of them, and
+//     trims instead when the summary can't be made
+//   - reject leaves the conversation alone, so the request fails with
+//     context_length_exceeded
+//
+// Turns are dropped whole: a turn is a user message and the replies and
+// tool results that follow it. System messages and the latest turn are
+// always kept.
+const (
+	ContextPolicyTrim      = "trim"
+	ContextPolicySummarize = "summarize"
+	ContextPolicyReject    = "reject"
+)
+
+// contextPolicyHeader reports the policy applied to a request
+const contextPolicyHeader = "X-Context-Policy"
+
+// summaryMaxTokens bounds a summary of dropped turns, and is reserved for
+// it when deciding how many turns to drop
+const summaryMaxTokens = 300
+
+// summaryTimeout bounds the summary request, which runs before the
+// request itself
+const summaryTimeout = 20 * time.Second
+
+// ContextFit describes how a conversation was fitted to a context window
+type ContextFit struct {
+	Policy  string
+	Action  string // "none", "trimmed", "summarized" or "rejected"
+	Dropped int    // Messages dropped or summarized
+	Tokens  int    // Prompt plus max_tokens, after fitting
+	Window  int    // Largest context window available, 0 if unknown
+}
+
+// String renders the fit for the X-Context-Policy header, e.g.
+// "trim; action=trimmed; dropped=4; tokens=7890; window=8192"
+func (f ContextFit) String() string {
+	s := fmt.Sprintf("%s; action=%s", f.Policy, f.Action)
+	if f.Dropped > 0 {
+		s += fmt.Sprintf("; dropped=%d", f.Dropped)
+	}
+	s += fmt.Sprintf("; tokens=%d", f.Tokens)
+	if f.Window > 0 {
+		s += fmt.Sprintf("; window=%d", f.Window)
+	}
+	return s
+}
+
+// getServiceContextPolicy returns the context policy for a service from
+// <SERVICE>_CONTEXT_POLICY. The API rejects by default, as its clients
+// manage their own history; other services trim.
+func getServiceContextPolicy(serviceName string) string {
+	switch policy := strings.ToLower(os.Getenv(serviceName + "_CONTEXT_POLICY")); policy {
+	case ContextPolicyTrim, ContextPolicySummarize, ContextPolicyReject:
+		return policy
+	case "":
+	default:
+		log.Printf("[Context] Unknown %s_CONTEXT_POLICY %q, using the default", serviceName, policy)
+	}
+	if serviceName == "API" {
+		return ContextPolicyReject
+	}
+	return ContextPolicyTrim
+}
+
+// routingContext returns the request context used to route req, so that
+// fitting sees the same deployments as routing
+func routingContext(req *providers.UnifiedRequest, params *RouterParams) *routing.RequestContext {
+	reqCtx := routing.NewRequestContext(fmt.Sprintf("req_%d", time.Now().UnixNano()), req)
+	reqCtx.RequiresJSON = params.ResponseFormat.WantsJSON()
+	reqCtx.ContextTokens = countMessageTokens(req.Messages, req.Model) + req.MaxTokens
+	return reqCtx
+}
+
+// fitContext fits messages to the largest context window of the model's
+// deployments, applying policy when they don't fit
+func fitContext(ctx context.Context, messages []providers.Message, model string, params *RouterParams, policy string) ([]providers.Message, ContextFit) {
+	if params == nil {
+		params = &RouterParams{}
+	}
+	if params.MaxTokens <= 0 {
+		params.MaxTokens = defaultMaxTokens
+	}
+	reqCtx := routingContext(&providers.UnifiedRequest{
+		Model:     model,
+		Messages:  messages,
+		MaxTokens: params.MaxTokens,
+		Tools:     params.Tools,
+	}, params)
+	fit := ContextFit{Policy: policy, Action: "none", Tokens: reqCtx.ContextTokens}
+	if modelRouter == nil {
+		return messages, fit
+	}
+	fit.Window = modelRouter.LargestContextWindow(model, reqCtx)
+	if fit.Window <= 0 || fit.Tokens <= fit.Window {
+		return messages, fit
+	}
+	if policy == ContextPolicyReject {
+		fit.Action = "rejected"
+		return messages, fit
+	}
+
+	budget := fit.Window
+	if policy == ContextPolicySummarize {
+		budget -= summaryMaxTokens
+	}
+	kept, dropped := dropOldestTurns(messages, model, params.MaxTokens, budget)
+	if len(dropped) == 0 {
+		// Only the system prompt and latest message are left, and they don't fit
+		fit.Action = "rejected"
+		return messages, fit
+	}
+
+	fit.Action = "trimmed"
+	fit.Dropped = len(dropped)
+	if policy == ContextPolicySummarize {
+		if summary, err := summarizeTurns(ctx, dropped); err != nil {
+			log.Printf("[Context] Summary of %d messages failed, trimming instead: %v", len(dropped), err)
+		} else {
+			fit.Action = "summarized"
+			kept = withSummary(kept, summary)
+		}
+	}
+	fit.Tokens = countMessageTokens(kept, model) + params.MaxTokens
+	log.Printf("[Context] %s: %s", model, fit)
+	return kept, fit
+}
+
+// dropOldestTurns drops whole turns from the start of the conversation
+// until it fits in budget tokens, returning the kept and dropped messages.
+// System messages and the latest turn are never dropped.
+func dropOldestTurns(messages []providers.Message, model string, maxTokens, budget int) (kept, dropped []providers.Message) {
+	var turns [][]int
+	for i, m := range messages {
+		switch {
+		case m.Role == "system":
+		case m.Role == "user" || len(turns) == 0:
+			turns = append(turns, []int{i})
+		default:
+			turns[len(turns)-1] = append(turns[len(turns)-1], i)
+		}
+	}
+
+	drop := make(map[int]bool)
+	tokens := countMessageTokens(messages, model) + maxTokens
+	for len(turns) > 1 && tokens > budget {
+		for _, i := range turns[0] {
+			drop[i] = true
+			tokens -= countMessageTokens(messages[i:i+1], model) - tokensPerReply
+		}
+		turns = turns[1:]
+	}
+
+	for i, m := range messages {
+		if drop[i] {
+			dropped = append(dropped, m)
+		} else {
+			kept = append(kept, m)
+		}
+	}
+	return kept, dropped
+}
+
+// summarizeTurns asks CONTEXT_SUMMARY_MODEL, or the fast tier, for a
+// summary of dropped turns
+func summarizeTurns(ctx context.Context, turns []providers.Message) (string, error) {
+	model := os.Getenv("CONTEXT_SUMMARY_MODEL")
+	if model == "" {
+		model = "tier:fast"
+	}
+
+	var transcript strings.Builder
+	for _, m := range turns {
+		fmt.Fprintf(&transcript, "%s: %s\n", m.Role, m.Content)
+	}
+	prompt := []providers.Message{
+		{Role: "system", Content: "Summarize the conversation below in a few sentences, keeping names, facts and decisions a reader would need to continue it. Reply with the summary only."},
+		{Role: "user", Content: transcript.String()},
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, summaryTimeout)
+	defer cancel()
+	resp, err := LLMWithRouter(prompt, model, &RouterParams{
+		MaxTokens:   summaryMaxTokens,
+		Temperature: 0.3,
+		Context:     ctx,
+	}, nil)
+	if err != nil {
+		return "", err
+	}
+	if strings.TrimSpace(resp.Content) == "" {
+		return "", fmt.Errorf("empty summary from %s", model)
+	}
+	return strings.TrimSpace(resp.Content), nil
+}
+
+// withSummary inserts a summary of earlier turns after the system messages
+func withSummary(messages []providers.Message, summary string) []providers.Message {
+	i := 0
+	for i < len(messages) && messages[i].Role == "system" {
+		i++
+	}
+	out := make([]providers.Message, 0, len(messages)+1)
+	out = append(out, messages[:i]...)
+	out = append(out, providers.Message{Role: "system", Content: "Summary of the earlier conversation: " + summary})
+	return append(out, messages[i:]...)
+}
+
+// trimHistory drops the oldest whole Q:/A: turns from a web history until
+// it is at most limit bytes
+func trimHistory(history string, limit int) string {
+	for len(history) > limit {
+		next := strings.Index(history, "\nQ: ")
+		if next < 0 {
+			return ""
+		}
+		history = history[next+1:]
+	}
+	return history
+}
+
+// applyContextPolicy fits an API request's messages with the service's
+// context policy and reports the outcome in the X-Context-Policy header
+func applyContextPolicy(w http.ResponseWriter, r *http.Request, service, model string, messages []providers.Message, params *RouterParams) []providers.Message {
+	messages, fit := fitContext(r.Context(), messages, model, params, getServiceContextPolicy(service))
+	w.Header().Set(contextPolicyHeader, fit.String())
+	return messages
+}
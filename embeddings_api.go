@@ -0,0 +1,217 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"time"
+
+	"ch.at/providers"
+	"ch.at/routing"
+)
+
+// maxEmbeddingInputs matches OpenAI's limit on inputs per request
+const maxEmbeddingInputs = 2048
+
+// EmbeddingsRequest is an OpenAI-compatible embeddings request
+type EmbeddingsRequest struct {
+	Model          string          `json:"model"`
+	Input          json.RawMessage `json:"input"` // A string or an array of strings
+	EncodingFormat string          `json:"encoding_format,omitempty"`
+	Dimensions     int             `json:"dimensions,omitempty"`
+	User           string          `json:"user,omitempty"`
+}
+
+// EmbeddingsResponse is an OpenAI-compatible embeddings response
+type EmbeddingsResponse struct {
+	Object string            `json:"object"`
+	Data   []EmbeddingObject `json:"data"`
+	Model  string            `json:"model"`
+	Usage  EmbeddingsUsage   `json:"usage"`
+}
+
+// EmbeddingObject is one input's vector. Embedding is a []float64, or a
+// base64 string of little-endian float32s when encoding_format is base64.
+type EmbeddingObject struct {
+	Object    string      `json:"object"`
+	Index     int         `json:"index"`
+	Embedding interface{} `json:"embedding"`
+}
+
+// EmbeddingsUsage counts input tokens; embeddings have no output tokens
+type EmbeddingsUsage struct {
+	PromptTokens int `json:"prompt_tokens"`
+	TotalTokens  int `json:"total_tokens"`
+}
+
+// handleEmbeddings handles POST /v1/embeddings. Requests are routed like
+// chat completions, but only to models with supports_embeddings set.
+func handleEmbeddings(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if tenantFrom(r) == nil && !rateLimitAllow(r.RemoteAddr) {
+		writeAPIError(w, rateLimited("Rate limit exceeded", time.Second))
+		return
+	}
+	if r.Method != "POST" {
+		methodNotAllowed(w, "POST, OPTIONS")
+		return
+	}
+
+	var req EmbeddingsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeAPIError(w, invalidRequest("invalid_json", "", "Invalid JSON: "+err.Error()))
+		return
+	}
+	if req.Model == "" {
+		writeAPIError(w, invalidRequest("missing_required_parameter", "model", "model is required"))
+		return
+	}
+	inputs, apiErr := parseEmbeddingInput(req.Input)
+	if apiErr != nil {
+		writeAPIError(w, apiErr)
+		return
+	}
+	if req.EncodingFormat != "" && req.EncodingFormat != "float" && req.EncodingFormat != "base64" {
+		writeAPIError(w, invalidRequest("invalid_value", "encoding_format", "encoding_format must be 'float' or 'base64'"))
+		return
+	}
+	if req.Dimensions < 0 {
+		writeAPIError(w, invalidRequest("invalid_value", "dimensions", "dimensions must be positive"))
+		return
+	}
+	if apiErr := checkEmbeddingDimensions(req.Model, req.Dimensions); apiErr != nil {
+		writeAPIError(w, apiErr)
+		return
+	}
+	if apiErr := checkModelAllowed(r, req.Model); apiErr != nil {
+		writeAPIError(w, apiErr)
+		return
+	}
+	if modelRouter == nil {
+		writeAPIError(w, newAPIError(http.StatusServiceUnavailable, errTypeServer, "", "", "Model router not initialized"))
+		return
+	}
+
+	start := time.Now()
+	reqCtx := &routing.RequestContext{
+		RequestID:          fmt.Sprintf("req_%d", time.Now().UnixNano()),
+		ModelID:            req.Model,
+		RequiresEmbeddings: true,
+	}
+	decision, err := modelRouter.RouteRequest(r.Context(), req.Model, reqCtx)
+	if err != nil {
+		writeAPIError(w, apiErrorFor(err, req.Model))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+	resp, err := modelRouter.ExecuteEmbedding(ctx, &providers.EmbeddingRequest{
+		Model:      req.Model,
+		Input:      inputs,
+		Dimensions: req.Dimensions,
+		User:       req.User,
+	}, decision)
+	if err != nil {
+		log.Printf("[Embeddings] Request for %s failed: %v", req.Model, err)
+		writeAPIError(w, apiErrorFor(err, req.Model))
+		return
+	}
+
+	// Not every upstream reports usage
+	promptTokens := resp.Usage.PromptTokens
+	if promptTokens == 0 {
+		for _, input := range inputs {
+			promptTokens += countTokens(input, req.Model)
+		}
+	}
+	recordTenantUsage(r, req.Model, &LLMResponse{InputTokens: promptTokens})
+
+	out := EmbeddingsResponse{
+		Object: "list",
+		Data:   make([]EmbeddingObject, len(resp.Data)),
+		Model:  req.Model,
+		Usage:  EmbeddingsUsage{PromptTokens: promptTokens, TotalTokens: promptTokens},
+	}
+	for i, e := range resp.Data {
+		out.Data[i] = EmbeddingObject{Object: "embedding", Index: e.Index, Embedding: e.Embedding}
+		if req.EncodingFormat == "base64" {
+			out.Data[i].Embedding = encodeEmbeddingBase64(e.Embedding)
+		}
+	}
+
+	beacon("embedding_request_complete", map[string]interface{}{
+		"model":         req.Model,
+		"deployment":    resp.Metadata["deployment_id"],
+		"inputs":        len(inputs),
+		"prompt_tokens": promptTokens,
+		"duration_ms":   time.Since(start).Milliseconds(),
+	})
+
+	writeJSON(w, out)
+}
+
+// parseEmbeddingInput accepts a string or an array of strings. Token
+// arrays aren't supported since deployments use different tokenizers.
+func parseEmbeddingInput(raw json.RawMessage) ([]string, *APIError) {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, invalidRequest("missing_required_parameter", "input", "input is required")
+	}
+
+	var inputs []string
+	var single string
+	if err := json.Unmarshal(raw, &single); err == nil {
+		inputs = []string{single}
+	} else if err := json.Unmarshal(raw, &inputs); err != nil {
+		return nil, invalidRequest("invalid_type", "input", "input must be a string or an array of strings; token arrays are not supported")
+	}
+
+	if len(inputs) == 0 {
+		return nil, invalidRequest("invalid_value", "input", "input must not be empty")
+	}
+	if len(inputs) > maxEmbeddingInputs {
+		return nil, invalidRequest("invalid_value", "input", fmt.Sprintf("input is limited to %d items", maxEmbeddingInputs))
+	}
+	for i, input := range inputs {
+		if input == "" {
+			return nil, invalidRequest("invalid_value", "input", fmt.Sprintf("input[%d] is empty", i))
+		}
+	}
+	return inputs, nil
+}
+
+// checkEmbeddingDimensions rejects a dimensions larger than the model's
+// native size, when the model declares one
+func checkEmbeddingDimensions(model string, dimensions int) *APIError {
+	if dimensions == 0 || modelRegistry == nil {
+		return nil
+	}
+	if m, ok := modelRegistry.Get(model); ok && m.Capabilities.Dimensions > 0 && dimensions > m.Capabilities.Dimensions {
+		return invalidRequest("invalid_value", "dimensions",
+			fmt.Sprintf("The model '%s' produces at most %d dimensions", model, m.Capabilities.Dimensions))
+	}
+	return nil
+}
+
+// encodeEmbeddingBase64 packs a vector as little-endian float32s, like OpenAI
+func encodeEmbeddingBase64(vector []float64) string {
+	buf := make([]byte, 4*len(vector))
+	for i, v := range vector {
+		binary.LittleEndian.PutUint32(buf[4*i:], math.Float32bits(float32(v)))
+	}
+	return base64.StdEncoding.EncodeToString(buf)
+}
@@ -13,6 +13,8 @@ import (
 	"strings"
 	"sync"
 	"time"
+
+	"ch.at/providers"
 )
 
 // Session tracking to prevent duplicate message processing
@@ -566,14 +568,30 @@ const htmlFooterTemplate = `</div>
 
 func StartHTTPServer(port int) error {
 	http.HandleFunc("/", handleRoot)
-	http.HandleFunc("/v1/chat/completions", handleChatCompletions)
+	http.HandleFunc("/v1/chat/completions", withAPIKey(handleChatCompletions))
+	http.HandleFunc("/v1/messages", withAPIKey(handleMessages))
+	http.HandleFunc("/v1/embeddings", withAPIKey(handleEmbeddings))
+	http.HandleFunc("/v1/tokenize", withAPIKey(handleTokenize))
+	http.HandleFunc("/v1/ws", withAPIKey(handleWebSocket))
+	http.HandleFunc("/v1/async/chat/completions", withAPIKey(handleAsyncChatCompletions))
+	http.HandleFunc("/v1/async/", withAPIKey(handleAsyncJob))
+	http.HandleFunc("/v1/files", withAPIKey(handleFiles))
+	http.HandleFunc("/v1/files/", withAPIKey(handleFile))
+	http.HandleFunc("/v1/batches", withAPIKey(handleBatches))
+	http.HandleFunc("/v1/batches/", withAPIKey(handleBatch))
+
+	// Ollama-compatible endpoints
+	http.HandleFunc("/api/chat", withAPIKey(handleOllamaChat))
+	http.HandleFunc("/api/generate", withAPIKey(handleOllamaGenerate))
+	http.HandleFunc("/api/tags", withAPIKey(handleOllamaTags))
+	http.HandleFunc("/api/version", handleOllamaVersion)
 	http.HandleFunc("/health", handleHealth)
 	
 	// Model management endpoints
-	http.HandleFunc("/v1/models", handleListModels)
-	http.HandleFunc("/v1/models/", handleGetModel)
-	http.HandleFunc("/v1/deployments", handleListDeployments)
-	http.HandleFunc("/v1/deployments/", handleGetDeployment)
+	http.HandleFunc("/v1/models", withAPIKey(handleListModels))
+	http.HandleFunc("/v1/models/", withAPIKey(handleGetModel))
+	http.HandleFunc("/v1/deployments", withAPIKey(handleListDeployments))
+	http.HandleFunc("/v1/deployments/", withAPIKey(handleGetDeployment))
 	http.HandleFunc("/routing_table", handleRoutingTable)
 	http.HandleFunc("/terms_of_service", handleTermsOfService)
 
@@ -614,17 +632,18 @@ func handleRoot(w http.ResponseWriter, r *http.Request) {
 		beacon("rate_limit_exceeded", map[string]interface{}{
 			"remote_addr": r.RemoteAddr,
 		})
-		http.Error(w, "Rate limit exceeded", http.StatusTooManyRequests)
+		writeAPIError(w, rateLimited("Rate limit exceeded", time.Second))
 		return
 	}
 
 	var query, history, prompt, tier, sessionID, seqStr string
 	content := ""
 	jsonResponse := ""
+	var jsonError *APIError // Set when jsonResponse is an error envelope
 
 	if r.Method == "POST" {
 		if err := r.ParseForm(); err != nil {
-			http.Error(w, "Failed to parse form", http.StatusBadRequest)
+			writeAPIError(w, invalidRequest("invalid_form", "", "Failed to parse form"))
 			return
 		}
 		query = r.FormValue("q")
@@ -638,15 +657,13 @@ func handleRoot(w http.ResponseWriter, r *http.Request) {
 			tier = "balanced"
 		}
 
-		// Limit history size to ensure compatibility
-		if len(history) > 65536 {
-			history = history[len(history)-65536:]
-		}
+		// Limit history size to ensure compatibility, dropping whole turns
+		history = trimHistory(history, 65536)
 
 		if query == "" {
 			body, err := io.ReadAll(io.LimitReader(r.Body, 65536)) // Limit body size
 			if err != nil {
-				http.Error(w, "Failed to read request body", http.StatusBadRequest)
+				writeAPIError(w, invalidRequest("invalid_body", "", "Failed to read request body"))
 				return
 			}
 			query = string(body)
@@ -682,8 +699,8 @@ func handleRoot(w http.ResponseWriter, r *http.Request) {
 		requestCount := ipRequestCounts[ipAddr]
 		if requestCount >= 50 { // Max 50 LLM calls per hour per IP
 			ipRequestMu.Unlock()
-			// Rate limit exceeded
-			http.Error(w, "Rate limit exceeded - too many requests. Please wait before trying again.", http.StatusTooManyRequests)
+			// Rate limit exceeded until the hourly reset
+			writeAPIError(w, rateLimited("Rate limit exceeded - too many requests. Please wait before trying again.", time.Until(lastResetTime.Add(time.Hour))))
 			return
 		}
 		ipRequestCounts[ipAddr]++
@@ -849,6 +866,25 @@ func handleRoot(w http.ResponseWriter, r *http.Request) {
 				return
 			}
 			
+			// Use the selected model from the form, or default
+			modelToUse := r.FormValue("model")
+			if modelToUse == "" {
+				// Fallback to environment default or llama-8b
+				modelToUse = os.Getenv("BASIC_OPENAI_MODEL")
+				if modelToUse == "" {
+					modelToUse = "llama-8b"
+				}
+			}
+
+			// Fit the conversation to the model before the page starts, so
+			// the outcome can go in a header
+			var llmMessages []providers.Message
+			for _, msg := range messages {
+				llmMessages = append(llmMessages, providers.Message{Role: msg["role"], Content: msg["content"]})
+			}
+			llmMessages, fit := fitContext(r.Context(), llmMessages, modelToUse, nil, getServiceContextPolicy("HTTP"))
+			w.Header().Set(contextPolicyHeader, fit.String())
+
 			// Not duplicate, continue with normal processing
 			w.Header().Set("Transfer-Encoding", "chunked")
 			w.Header().Set("X-Accel-Buffering", "no")
@@ -964,26 +1000,19 @@ func handleRoot(w http.ResponseWriter, r *http.Request) {
 				var resp *LLMResponse
 				var err error
 				
-				// Use the selected model from the form, or default
-				modelToUse := r.FormValue("model")
-				if modelToUse == "" {
-					// Fallback to environment default or llama-8b
-					modelToUse = os.Getenv("BASIC_OPENAI_MODEL")
-					if modelToUse == "" {
-						modelToUse = "llama-8b"
-					}
-				}
-				
 				// Build messages with HTML prompt prefix for assistant
 				// Need to add the HTML instruction to the first user message
-				if len(messages) > 0 {
-					messages[0]["content"] = htmlPromptPrefix + messages[0]["content"]
+				for i := range llmMessages {
+					if llmMessages[i].Role == "user" {
+						llmMessages[i].Content = htmlPromptPrefix + llmMessages[i].Content
+						break
+					}
 				}
 				
 				// Use router if available
 				if modelRouter != nil {
 					// Send full message array with conversation context!
-					resp, err = LLMWithRouter(messages, modelToUse, nil, ch)
+					resp, err = LLMWithRouter(llmMessages, modelToUse, nil, ch)
 				} else {
 					err = fmt.Errorf("model router not initialized")
 				}
@@ -1346,6 +1375,17 @@ func handleRoot(w http.ResponseWriter, r *http.Request) {
 			// No Q: A: format - just stream the response
 			// flusher.Flush()
 
+			// Use model from form, or BASIC_OPENAI_MODEL, or tier-based
+			modelToUse := r.FormValue("model")
+			if modelToUse == "" {
+				modelToUse = os.Getenv("BASIC_OPENAI_MODEL")
+				if modelToUse == "" {
+					modelToUse = tierToModel(tier)
+				}
+			}
+			// A lone prompt is never trimmed, but the outcome is still reported
+			applyContextPolicy(w, r, "HTTP", modelToUse, []providers.Message{{Role: "user", Content: prompt}}, nil)
+
 			ch := make(chan string)
 			var llmResp *LLMResponse
 			go func() {
@@ -1354,14 +1394,6 @@ func handleRoot(w http.ResponseWriter, r *http.Request) {
 				
 				// Router MUST be available - no fallback!
 				if modelRouter != nil {
-					// Use model from form, or BASIC_OPENAI_MODEL, or tier-based
-					modelToUse := r.FormValue("model")
-					if modelToUse == "" {
-						modelToUse = os.Getenv("BASIC_OPENAI_MODEL")
-						if modelToUse == "" {
-							modelToUse = tierToModel(tier)
-						}
-					}
 					resp, err = LLMWithRouter(prompt, modelToUse, nil, ch)
 				} else {
 					err = fmt.Errorf("model router not initialized")
@@ -1427,25 +1459,30 @@ func handleRoot(w http.ResponseWriter, r *http.Request) {
 		
 		var llmResp *LLMResponse
 		var err error
+		var modelToUse string
 		
 		// Router MUST be available - no fallback!
 		if modelRouter != nil {
 			// Use model from form, or BASIC_OPENAI_MODEL, or tier-based
-			modelToUse := r.FormValue("model")
+			modelToUse = r.FormValue("model")
 			if modelToUse == "" {
 				modelToUse = os.Getenv("BASIC_OPENAI_MODEL")
 				if modelToUse == "" {
 					modelToUse = tierToModel(tier)
 				}
 			}
+			// A lone prompt is never trimmed, but the outcome is still reported
+			applyContextPolicy(w, r, "HTTP", modelToUse, []providers.Message{{Role: "user", Content: promptToUse}}, nil)
 			llmResp, err = LLMWithRouter(promptToUse, modelToUse, nil, nil)
 		} else {
 			err = fmt.Errorf("model router not initialized")
 		}
 		if err != nil {
-			content = err.Error()
-			errJSON, _ := json.Marshal(map[string]string{"error": err.Error()})
+			apiErr := apiErrorFor(err, modelToUse)
+			content = apiErr.Message
+			errJSON, _ := json.Marshal(map[string]*APIError{"error": apiErr})
 			jsonResponse = string(errJSON)
+			jsonError = apiErr
 		} else {
 			// Update telemetry with LLM response data
 			telemetry.InputHash = llmResp.InputHash
@@ -1479,42 +1516,44 @@ func handleRoot(w http.ResponseWriter, r *http.Request) {
 
 		flusher, ok := w.(http.Flusher)
 		if !ok {
-			http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+			writeAPIError(w, newAPIError(http.StatusInternalServerError, errTypeServer, "", "", "Streaming not supported"))
 			return
 		}
 
+		// Use model from form, or BASIC_OPENAI_MODEL, or tier-based
+		modelToUse := r.FormValue("model")
+		if modelToUse == "" {
+			modelToUse = os.Getenv("BASIC_OPENAI_MODEL")
+			if modelToUse == "" {
+				modelToUse = tierToModel(tier)
+			}
+		}
+		// A lone prompt is never trimmed, but the outcome is still reported
+		applyContextPolicy(w, r, "HTTP", modelToUse, []providers.Message{{Role: "user", Content: prompt}}, nil)
+
 		ch := make(chan string)
+		done := make(chan struct{})
 		var llmResp *LLMResponse
+		var llmErr error
 		go func() {
-			var resp *LLMResponse
-			var err error
-			
+			defer close(done)
 			// Router MUST be available - no fallback!
-			if modelRouter != nil {
-				// Use model from form, or BASIC_OPENAI_MODEL, or tier-based
-				modelToUse := r.FormValue("model")
-				if modelToUse == "" {
-					modelToUse = os.Getenv("BASIC_OPENAI_MODEL")
-					if modelToUse == "" {
-						modelToUse = tierToModel(tier)
-					}
-				}
-				resp, err = LLMWithRouter(prompt, modelToUse, nil, ch)
-			} else {
-				err = fmt.Errorf("model router not initialized")
-			}
-			if err != nil {
-				fmt.Fprintf(w, "data: Error: %s\n\n", err.Error())
-				flusher.Flush()
-			} else {
-				llmResp = resp
+			if modelRouter == nil {
+				close(ch)
+				llmErr = fmt.Errorf("model router not initialized")
+				return
 			}
+			llmResp, llmErr = LLMWithRouter(prompt, modelToUse, nil, ch)
 		}()
 
 		for chunk := range ch {
 			fmt.Fprintf(w, "data: %s\n\n", chunk)
 			flusher.Flush()
 		}
+		<-done
+		if llmErr != nil {
+			writeSSEError(w, apiErrorFor(llmErr, modelToUse))
+		}
 		
 		// Update telemetry with LLM response data if available
 		if llmResp != nil {
@@ -1554,7 +1593,9 @@ func handleRoot(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if wantsJSON && jsonResponse != "" {
+	if wantsJSON && jsonError != nil {
+		writeAPIError(w, jsonError)
+	} else if wantsJSON && jsonResponse != "" {
 		w.Header().Set("Content-Type", "application/json; charset=utf-8")
 		fmt.Fprint(w, jsonResponse)
 	} else if wantsHTML && query == "" {
@@ -1792,20 +1833,37 @@ func handleRoot(w http.ResponseWriter, r *http.Request) {
 }
 
 type ChatRequest struct {
-	Model            string    `json:"model"`
-	Messages         []Message `json:"messages"`
-	Stream           bool      `json:"stream,omitempty"`
-	MaxTokens        int       `json:"max_tokens,omitempty"`
-	Temperature      float64   `json:"temperature,omitempty"`
-	TopP             float64   `json:"top_p,omitempty"`
-	Stop             []string  `json:"stop,omitempty"`
-	FrequencyPenalty float64   `json:"frequency_penalty,omitempty"`
-	PresencePenalty  float64   `json:"presence_penalty,omitempty"`
+	Model            string              `json:"model"`
+	Messages         []providers.Message `json:"messages"` // Content may be a string or an array of parts
+	Stream           bool                `json:"stream,omitempty"`
+	StreamOptions    *StreamOptions      `json:"stream_options,omitempty"`
+	MaxTokens        int                 `json:"max_tokens,omitempty"`
+	Temperature      float64             `json:"temperature,omitempty"`
+	TopP             float64             `json:"top_p,omitempty"`
+	Stop             []string            `json:"stop,omitempty"`
+	FrequencyPenalty float64             `json:"frequency_penalty,omitempty"`
+	PresencePenalty  float64             `json:"presence_penalty,omitempty"`
+
+	ResponseFormat *providers.ResponseFormat `json:"response_format,omitempty"`
+
+	Tools      []providers.Tool `json:"tools,omitempty"`
+	ToolChoice interface{}      `json:"tool_choice,omitempty"`
+
+	// Legacy function calling, folded into Tools and ToolChoice
+	Functions    []providers.Function `json:"functions,omitempty"`
+	FunctionCall interface{}          `json:"function_call,omitempty"`
 }
 
 type Message struct {
-	Role    string `json:"role"`
-	Content string `json:"content"`
+	Role       string               `json:"role"`
+	Content    string               `json:"content"`
+	Name       string               `json:"name,omitempty"`
+	ToolCalls  []providers.ToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string               `json:"tool_call_id,omitempty"`
+}
+
+type StreamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
 }
 
 type ChatResponse struct {
@@ -1814,6 +1872,7 @@ type ChatResponse struct {
 	Created int64    `json:"created"`
 	Model   string   `json:"model"`
 	Choices []Choice `json:"choices"`
+	Usage   *Usage   `json:"usage,omitempty"`
 }
 
 type Choice struct {
@@ -1822,6 +1881,108 @@ type Choice struct {
 	FinishReason string  `json:"finish_reason,omitempty"`
 }
 
+type Usage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+// ChatCompletionChunk is one streamed chat.completion.chunk event
+type ChatCompletionChunk struct {
+	ID      string        `json:"id"`
+	Object  string        `json:"object"`
+	Created int64         `json:"created"`
+	Model   string        `json:"model"`
+	Choices []ChunkChoice `json:"choices"`
+	Usage   *Usage        `json:"usage,omitempty"`
+}
+
+type ChunkChoice struct {
+	Index        int        `json:"index"`
+	Delta        ChunkDelta `json:"delta"`
+	FinishReason *string    `json:"finish_reason"` // null until the final chunk
+}
+
+type ChunkDelta struct {
+	Role      string                   `json:"role,omitempty"`
+	Content   *string                  `json:"content,omitempty"`
+	ToolCalls []map[string]interface{} `json:"tool_calls,omitempty"`
+}
+
+// usageOf reports an LLMResponse's token counts in the OpenAI shape
+func usageOf(resp *LLMResponse) *Usage {
+	return &Usage{
+		PromptTokens:     resp.InputTokens,
+		CompletionTokens: resp.OutputTokens,
+		TotalTokens:      resp.InputTokens + resp.OutputTokens,
+	}
+}
+
+// finishReasonOf defaults an unreported finish reason to "stop"
+func finishReasonOf(resp *LLMResponse) string {
+	if resp.FinishReason == "" {
+		return "stop"
+	}
+	return resp.FinishReason
+}
+
+// normalize validates a chat request and fills in defaults, folding the
+// legacy function calling fields into Tools and ToolChoice
+func (req *ChatRequest) normalize() *APIError {
+	if len(req.Messages) == 0 {
+		return invalidRequest("missing_required_parameter", "messages", "messages must contain at least one message")
+	}
+	if err := req.ResponseFormat.Validate(); err != nil {
+		return invalidRequest("invalid_response_format", "response_format", err.Error())
+	}
+	if req.Model == "" {
+		req.Model = "llama-8b" // Default model if not specified
+	}
+	for _, fn := range req.Functions {
+		req.Tools = append(req.Tools, providers.Tool{Type: "function", Function: fn})
+	}
+	req.Functions = nil
+	if req.ToolChoice == nil {
+		req.ToolChoice = req.FunctionCall
+	}
+	return nil
+}
+
+// routerParams builds the router parameters for a chat request
+func (req *ChatRequest) routerParams() *RouterParams {
+	return &RouterParams{
+		MaxTokens:        req.MaxTokens,
+		Temperature:      req.Temperature,
+		TopP:             req.TopP,
+		Stop:             req.Stop,
+		FrequencyPenalty: req.FrequencyPenalty,
+		PresencePenalty:  req.PresencePenalty,
+		Tools:            req.Tools,
+		ToolChoice:       req.ToolChoice,
+		ResponseFormat:   req.ResponseFormat,
+	}
+}
+
+// chatCompletion builds a non-streaming chat completion response
+func chatCompletion(model string, llmResp *LLMResponse) ChatResponse {
+	return ChatResponse{
+		ID:      "chatcmpl-" + generateRequestID(),
+		Object:  "chat.completion",
+		Created: time.Now().Unix(),
+		Model:   model,
+		Choices: []Choice{{
+			Index: 0,
+			Message: Message{
+				Role:      "assistant",
+				Content:   llmResp.Content,
+				ToolCalls: llmResp.ToolCalls,
+			},
+			FinishReason: finishReasonOf(llmResp),
+		}},
+		Usage: usageOf(llmResp),
+	}
+}
+
 func handleChatCompletions(w http.ResponseWriter, r *http.Request) {
 	// Handle chat completions
 	w.Header().Set("Access-Control-Allow-Origin", "*")
@@ -1834,37 +1995,47 @@ func handleChatCompletions(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if !rateLimitAllow(r.RemoteAddr) {
-		http.Error(w, "Rate limit exceeded", http.StatusTooManyRequests)
+	// Keyed requests are limited per tenant instead, in withAPIKey
+	if tenantFrom(r) == nil && !rateLimitAllow(r.RemoteAddr) {
+		writeAPIError(w, rateLimited("Rate limit exceeded", time.Second))
 		return
 	}
 
 	if r.Method != "POST" {
-		w.Header().Set("Allow", "POST, OPTIONS")
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		methodNotAllowed(w, "POST, OPTIONS")
 		return
 	}
 
 	var req ChatRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		// Failed to decode JSON
-		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		writeAPIError(w, invalidRequest("invalid_json", "", "Invalid JSON: "+err.Error()))
+		return
+	}
+	if apiErr := req.normalize(); apiErr != nil {
+		writeAPIError(w, apiErr)
+		return
+	}
+	if apiErr := checkModelAllowed(r, req.Model); apiErr != nil {
+		writeAPIError(w, apiErr)
 		return
 	}
 	// Process request
 
 	messages := make([]map[string]string, len(req.Messages))
 	var fullContent string
+	hasImages := false
 	for i, msg := range req.Messages {
 		messages[i] = map[string]string{
 			"role":    msg.Role,
 			"content": msg.Content,
 		}
 		fullContent += msg.Content + " "
+		hasImages = hasImages || msg.HasImages()
 	}
 	
-	// Use discriminator to analyze and potentially route to specialized modules
-	if discriminator != nil {
+	// Use discriminator to analyze and potentially route to specialized modules.
+	// Requests with tools, images or a JSON format expect the model itself to answer.
+	if discriminator != nil && len(req.Tools) == 0 && !hasImages && !req.ResponseFormat.WantsJSON() {
 		moduleResponse, err := discriminator.Process(fullContent, messages)
 		if err != nil {
 			// Module processing error
@@ -1895,88 +2066,150 @@ func handleChatCompletions(w http.ResponseWriter, r *http.Request) {
 
 	// Router MUST be available - no fallback!
 	if modelRouter == nil {
-		http.Error(w, "Model router not initialized", http.StatusServiceUnavailable)
+		writeAPIError(w, newAPIError(http.StatusServiceUnavailable, errTypeServer, "", "", "Model router not initialized"))
 		return
 	}
 	
-	if req.Model == "" {
-		req.Model = "llama-8b" // Default model if not specified
-	}
-	
-	// Build router parameters from request
-	routerParams := &RouterParams{
-		MaxTokens:        req.MaxTokens,
-		Temperature:      req.Temperature,
-		TopP:             req.TopP,
-		Stop:             req.Stop,
-		FrequencyPenalty: req.FrequencyPenalty,
-		PresencePenalty:  req.PresencePenalty,
-	}
-	
-	// Using router for model
-	llmFunc := func(input interface{}, stream chan<- string) (*LLMResponse, error) {
-		return LLMWithRouter(input, req.Model, routerParams, stream)
-	}
+	// Build router parameters from request. The upstream call is aborted
+	// when the client goes away.
+	routerParams := req.routerParams()
+	routerParams.Context = r.Context()
+	req.Messages = applyContextPolicy(w, r, "API", req.Model, req.Messages, routerParams)
 
 	if req.Stream {
-		w.Header().Set("Content-Type", "text/event-stream")
-		w.Header().Set("Cache-Control", "no-cache")
-		w.Header().Set("Connection", "keep-alive")
-
 		flusher, ok := w.(http.Flusher)
 		if !ok {
-			http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+			writeAPIError(w, newAPIError(http.StatusInternalServerError, errTypeServer, "", "", "Streaming not supported"))
 			return
 		}
 
-		ch := make(chan string)
-		go llmFunc(messages, ch)
-
-		for chunk := range ch {
-			resp := map[string]interface{}{
-				"id":      fmt.Sprintf("chatcmpl-%d", time.Now().Unix()),
-				"object":  "chat.completion.chunk",
-				"created": time.Now().Unix(),
-				"model":   req.Model,
-				"choices": []map[string]interface{}{{
-					"index": 0,
-					"delta": map[string]string{"content": chunk},
-				}},
-			}
-			data, err := json.Marshal(resp)
+		// Every chunk of a completion shares one ID and timestamp
+		completionID := "chatcmpl-" + generateRequestID()
+		created := time.Now().Unix()
+		writeChunk := func(choices []ChunkChoice, usage *Usage) bool {
+			data, err := json.Marshal(ChatCompletionChunk{
+				ID:      completionID,
+				Object:  "chat.completion.chunk",
+				Created: created,
+				Model:   req.Model,
+				Choices: choices,
+				Usage:   usage,
+			})
 			if err != nil {
 				fmt.Fprintf(w, "data: Failed to marshal response\n\n")
-				return
+				return false
 			}
 			fmt.Fprintf(w, "data: %s\n\n", data)
 			flusher.Flush()
+			return true
+		}
+
+		// Raw chunks carry tool call deltas as well as text
+		ch := make(chan providers.StreamChunk)
+		routerParams.ChunkStream = ch
+		type result struct {
+			resp *LLMResponse
+			err  error
+		}
+		done := make(chan result, 1)
+		go func() {
+			resp, err := LLMWithRouter(req.Messages, req.Model, routerParams, nil)
+			done <- result{resp, err}
+		}()
+		// If the handler returns before ch is closed, keep reading it so the
+		// sender isn't left blocked
+		defer func() {
+			go func() {
+				for range ch {
+				}
+			}()
+		}()
+
+		// The status line waits for the first chunk, so a request that fails
+		// before any output still gets a real error status
+		started := false
+		start := func() bool {
+			started = true
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.Header().Set("Cache-Control", "no-cache")
+			w.Header().Set("Connection", "keep-alive")
+			empty := ""
+			return writeChunk([]ChunkChoice{{Delta: ChunkDelta{Role: "assistant", Content: &empty}}}, nil)
+		}
+
+		for chunk := range ch {
+			// The finish reason goes in the final chunk, once the outcome is known
+			var delta ChunkDelta
+			if chunk.Data != "" {
+				content := chunk.Data
+				delta.Content = &content
+			}
+			if len(chunk.ToolCalls) > 0 {
+				delta.ToolCalls = toolCallDeltas(chunk.ToolCalls)
+			}
+			if delta.Content == nil && delta.ToolCalls == nil {
+				continue
+			}
+			if !started && !start() {
+				return
+			}
+			if !writeChunk([]ChunkChoice{{Delta: delta}}, nil) {
+				return
+			}
+		}
+
+		res := <-done
+		if res.err != nil && !started {
+			writeAPIError(w, apiErrorFor(res.err, req.Model))
+			return
+		}
+		if res.err != nil {
+			// Output had already started, so the error goes in the stream
+			writeSSEError(w, apiErrorFor(res.err, req.Model))
+		} else {
+			recordTenantUsage(r, req.Model, res.resp)
+			if !started && !start() {
+				return
+			}
+			finish := finishReasonOf(res.resp)
+			writeChunk([]ChunkChoice{{Delta: ChunkDelta{}, FinishReason: &finish}}, nil)
+			if req.StreamOptions != nil && req.StreamOptions.IncludeUsage {
+				writeChunk([]ChunkChoice{}, usageOf(res.resp))
+			}
 		}
 		fmt.Fprintf(w, "data: [DONE]\n\n")
 
 	} else {
-		llmResp, err := llmFunc(messages, nil)
+		llmResp, err := LLMWithRouter(req.Messages, req.Model, routerParams, nil)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			writeAPIError(w, apiErrorFor(err, req.Model))
 			return
 		}
-
-		chatResp := ChatResponse{
-			ID:      fmt.Sprintf("chatcmpl-%d", time.Now().Unix()),
-			Object:  "chat.completion",
-			Created: time.Now().Unix(),
-			Model:   req.Model,
-			Choices: []Choice{{
-				Index: 0,
-				Message: Message{
-					Role:    "assistant",
-					Content: llmResp.Content,
-				},
-			}},
-		}
+		recordTenantUsage(r, req.Model, llmResp)
 
 		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(chatResp)
+		json.NewEncoder(w).Encode(chatCompletion(req.Model, llmResp))
+	}
+}
+
+// toolCallDeltas renders streamed tool call fragments in the OpenAI delta shape
+func toolCallDeltas(deltas []providers.ToolCallDelta) []map[string]interface{} {
+	out := make([]map[string]interface{}, len(deltas))
+	for i, d := range deltas {
+		call := map[string]interface{}{
+			"index":    d.Index,
+			"function": map[string]string{"arguments": d.Arguments},
+		}
+		if d.ID != "" {
+			call["id"] = d.ID
+			call["type"] = "function"
+		}
+		if d.Name != "" {
+			call["function"].(map[string]string)["name"] = d.Name
+		}
+		out[i] = call
 	}
+	return out
 }
 
 // handleHealth provides a health check endpoint
@@ -2028,6 +2261,41 @@ func handleHealth(w http.ResponseWriter, r *http.Request) {
 			"method":      "POST",
 			"description": "OpenAI-compatible chat completions API",
 		},
+		"messages": map[string]string{
+			"url":         baseURL + "/v1/messages",
+			"method":      "POST",
+			"description": "Anthropic Messages-compatible API, routed to any model",
+		},
+		"embeddings": map[string]string{
+			"url":         baseURL + "/v1/embeddings",
+			"method":      "POST",
+			"description": "OpenAI-compatible embeddings API for models with supports_embeddings",
+		},
+		"tokenize": map[string]string{
+			"url":         baseURL + "/v1/tokenize",
+			"method":      "POST",
+			"description": "Count tokens of text or a chat prompt with a model's tokenizer",
+		},
+		"ollama_chat": map[string]string{
+			"url":         baseURL + "/api/chat",
+			"method":      "POST",
+			"description": "Ollama-compatible chat API (also /api/generate and /api/tags)",
+		},
+		"websocket": map[string]string{
+			"url":         strings.Replace(baseURL, "http", "ws", 1) + "/v1/ws",
+			"method":      "GET",
+			"description": "WebSocket chat with multiplexed conversations, streaming and cancel",
+		},
+		"async_chat_completions": map[string]string{
+			"url":         baseURL + "/v1/async/chat/completions",
+			"method":      "POST",
+			"description": "Submit a chat completion and poll /v1/async/{id} or receive it by webhook",
+		},
+		"batches": map[string]string{
+			"url":         baseURL + "/v1/batches",
+			"method":      "GET, POST",
+			"description": "OpenAI-compatible Batch API over JSONL files uploaded to /v1/files",
+		},
 		"models_list": map[string]string{
 			"url":         baseURL + "/v1/models",
 			"method":      "GET",
@@ -83,6 +83,18 @@ func InitializeModelRouter() error {
 		}
 	}
 	
+	// Report every circuit breaker state change
+	modelRouter.OnCircuitTransition(func(t routing.CircuitTransition) {
+		beacon("circuit_breaker_transition", map[string]interface{}{
+			"deployment": t.Deployment,
+			"from":       t.From.String(),
+			"to":         t.To.String(),
+			"reason":     t.Reason,
+			"error_rate": t.ErrorRate,
+			"requests":   t.Requests,
+		})
+	})
+
 	// Validate service configurations
 	if err := validateServiceConfigurations(); err != nil {
 		return fmt.Errorf("service configuration validation failed: %w", err)
@@ -304,14 +316,28 @@ func registerProviders(router *routing.Router) {
 	oneAPIProvider := providers.NewOneAPIProvider()
 	router.RegisterProvider(models.ProviderOneAPI, oneAPIProvider)
 
+	// Direct Anthropic Messages API (bypasses the gateway)
+	router.RegisterProvider(models.ProviderAnthropic, providers.NewAnthropicProvider())
+
+	// Azure OpenAI deployments (api-key or Azure AD client credentials)
+	router.RegisterProvider(models.ProviderAzure, providers.NewAzureProvider())
+
+	// AWS Bedrock Converse API with SigV4 signing
+	router.RegisterProvider(models.ProviderBedrock, providers.NewBedrockProvider())
+
+	// Google Vertex AI (Gemini and Claude) with service-account OAuth
+	router.RegisterProvider(models.ProviderVertex, providers.NewVertexProvider())
+
+	// Local inference servers (Ollama / llama.cpp) for offline use
+	router.RegisterProvider(models.ProviderLocal, providers.NewLocalProvider())
+
+	// Deterministic in-process mock for CI and demos (config/mock)
+	router.RegisterProvider(models.ProviderMock, providers.NewMockProvider())
+
 	// Register other providers as needed
 	// router.RegisterProvider(models.ProviderOpenAI, providers.NewOpenAIProvider())
-	// router.RegisterProvider(models.ProviderAzure, providers.NewAzureProvider())
-	// router.RegisterProvider(models.ProviderBedrock, providers.NewBedrockProvider())
-	// router.RegisterProvider(models.ProviderVertex, providers.NewVertexProvider())
-	// router.RegisterProvider(models.ProviderAnthropic, providers.NewAnthropicProvider())
 
-	log.Println("[registerProviders] Registered OneAPI provider")
+	log.Println("[registerProviders] Registered OneAPI, Anthropic, Azure, Bedrock, Vertex, Local and Mock providers")
 }
 
 // logInitSummary logs initialization summary
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"ch.at/tenants"
+)
+
+const keysUsage = `Usage: ch.at keys <command> [arguments]
+
+Commands:
+  tenant <id> [flags]   Create or update a tenant
+      -name string          Display name
+      -models a,b           Allowed model IDs or glob patterns (default: all)
+      -rpm n                Requests per minute (0 = unlimited)
+      -tokens-per-day n     Tokens per UTC day (0 = unlimited)
+      -spend-cap usd        Spend per calendar month in USD (0 = unlimited)
+  tenants               List tenants and their usage
+  create <tenant>       Issue a key; it is printed once and never stored
+  list [tenant]         List keys
+  revoke <key-id>       Revoke a key
+
+The database is API_KEYS_DB, default api_keys.db.
+`
+
+// runKeysCommand manages tenants and API keys from the command line
+func runKeysCommand(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, keysUsage)
+		return 2
+	}
+
+	store, err := openTenantStore()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer store.Close()
+
+	command, args := args[0], args[1:]
+	switch command {
+	case "tenant":
+		err = keysSaveTenant(store, args)
+	case "tenants":
+		err = keysListTenants(store)
+	case "create":
+		if len(args) != 1 {
+			return keysUsageError("create takes a tenant ID")
+		}
+		var key string
+		if key, err = store.CreateKey(args[0]); err == nil {
+			fmt.Println(key)
+		}
+	case "list":
+		tenantID := ""
+		if len(args) > 0 {
+			tenantID = args[0]
+		}
+		err = keysList(store, tenantID)
+	case "revoke":
+		if len(args) != 1 {
+			return keysUsageError("revoke takes a key ID")
+		}
+		id, perr := strconv.ParseInt(args[0], 10, 64)
+		if perr != nil {
+			return keysUsageError("key ID must be a number, see 'ch.at keys list'")
+		}
+		if err = store.RevokeKey(id); err == nil {
+			fmt.Printf("Revoked key %d\n", id)
+		}
+	default:
+		return keysUsageError("unknown command " + command)
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+func keysUsageError(message string) int {
+	fmt.Fprintf(os.Stderr, "%s\n\n%s", message, keysUsage)
+	return 2
+}
+
+func keysSaveTenant(store *tenants.Store, args []string) error {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return fmt.Errorf("tenant takes an ID before its flags")
+	}
+	tenant, err := store.Tenant(args[0])
+	if err == tenants.ErrNotFound {
+		tenant, err = &tenants.Tenant{ID: args[0]}, nil
+	}
+	if err != nil {
+		return err
+	}
+
+	fs := flag.NewFlagSet("tenant", flag.ContinueOnError)
+	fs.StringVar(&tenant.Name, "name", tenant.Name, "display name")
+	models := fs.String("models", strings.Join(tenant.AllowedModels, ","), "allowed models")
+	fs.IntVar(&tenant.RPM, "rpm", tenant.RPM, "requests per minute")
+	fs.Int64Var(&tenant.TokensPerDay, "tokens-per-day", tenant.TokensPerDay, "tokens per day")
+	fs.Float64Var(&tenant.SpendCap, "spend-cap", tenant.SpendCap, "monthly spend cap in USD")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	tenant.AllowedModels = nil
+	for _, model := range strings.Split(*models, ",") {
+		if model = strings.TrimSpace(model); model != "" {
+			tenant.AllowedModels = append(tenant.AllowedModels, model)
+		}
+	}
+	if err := store.SaveTenant(tenant); err != nil {
+		return err
+	}
+	fmt.Printf("Saved tenant %s\n", tenant.ID)
+	return nil
+}
+
+func keysListTenants(store *tenants.Store) error {
+	list, err := store.Tenants()
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tNAME\tMODELS\tRPM\tTOKENS TODAY\tSPEND THIS MONTH")
+	for _, t := range list {
+		usage, err := store.Usage(t.ID, time.Now())
+		if err != nil {
+			return err
+		}
+		models := "*"
+		if len(t.AllowedModels) > 0 {
+			models = strings.Join(t.AllowedModels, ",")
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d / %s\t$%.4f / %s\n", t.ID, t.Name, models,
+			limitString(int64(t.RPM)), usage.TokensToday, limitString(t.TokensPerDay),
+			usage.SpendThisMonth, map[bool]string{true: "unlimited", false: fmt.Sprintf("$%.2f", t.SpendCap)}[t.SpendCap <= 0])
+	}
+	return w.Flush()
+}
+
+func keysList(store *tenants.Store, tenantID string) error {
+	keys, err := store.Keys(tenantID)
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tTENANT\tKEY\tCREATED\tLAST USED\tSTATUS")
+	for _, k := range keys {
+		lastUsed, status := "never", "active"
+		if k.LastUsed != nil {
+			lastUsed = k.LastUsed.Format(time.RFC3339)
+		}
+		if k.RevokedAt != nil {
+			status = "revoked " + k.RevokedAt.Format(time.RFC3339)
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s...\t%s\t%s\t%s\n", k.ID, k.TenantID, k.Prefix,
+			k.CreatedAt.Format(time.RFC3339), lastUsed, status)
+	}
+	return w.Flush()
+}
+
+func limitString(n int64) string {
+	if n <= 0 {
+		return "unlimited"
+	}
+	return strconv.FormatInt(n, 10)
+}
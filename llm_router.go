@@ -21,8 +21,17 @@ type LLMResponse struct {
 	Model           string
 	FinishReason    string
 	ContentFiltered bool
+	Deployment      string               // Deployment that served the request, after any fallback
+	ToolCalls       []providers.ToolCall // Tool calls requested by the model, if any
 }
 
+// defaultMaxTokens is the completion budget when a request sets none
+const defaultMaxTokens = 500
+
+// defaultRequestTimeout bounds a non-streaming call, fallbacks included,
+// when the caller's context sets no deadline of its own
+const defaultRequestTimeout = 30 * time.Second
+
 // LLMWithRouter calls the language model using the new routing system
 // RouterParams contains all parameters for LLM routing
 type RouterParams struct {
@@ -32,6 +41,28 @@ type RouterParams struct {
 	Stop             []string
 	FrequencyPenalty float64
 	PresencePenalty  float64
+
+	// Tool calling, in the OpenAI request shape
+	Tools      []providers.Tool
+	ToolChoice interface{}
+
+	// ResponseFormat requests JSON output. Models without native JSON
+	// support are instructed instead and their output is validated.
+	ResponseFormat *providers.ResponseFormat
+
+	// ChunkStream receives raw stream chunks, including tool call deltas,
+	// for callers that need more than the text. It is closed when done.
+	ChunkStream chan<- providers.StreamChunk
+
+	// Admit, when set, is called with each deployment before the request
+	// is sent to it, fallbacks included, and may block to bound concurrency
+	// per deployment. The returned release func is called once that
+	// deployment is done with.
+	Admit func(deploymentID string) (release func(), err error)
+
+	// Context, when set, bounds the upstream call; cancelling it aborts
+	// the request to the provider
+	Context context.Context
 }
 
 func LLMWithRouter(input interface{}, requestedModel string, params *RouterParams, stream chan<- string) (*LLMResponse, error) {
@@ -42,6 +73,14 @@ func LLMWithRouter(input interface{}, requestedModel string, params *RouterParam
 func LLMWithRouterConv(input interface{}, requestedModel string, conversationID string, params *RouterParams, stream chan<- string) (*LLMResponse, error) {
 	log.Printf("[AUDIT] LLMWithRouterConv called with model=%s, convID=%s", requestedModel, conversationID)
 
+	// Streams are closed on every path, including failures before streaming starts
+	if stream != nil {
+		defer close(stream)
+	}
+	if params != nil && params.ChunkStream != nil {
+		defer close(params.ChunkStream)
+	}
+
 	// Build unified request
 	var messages []providers.Message
 	var fullInput string
@@ -60,6 +99,11 @@ func LLMWithRouterConv(input interface{}, requestedModel string, conversationID
 			})
 			fullInput += msg["role"] + ": " + msg["content"] + "\n"
 		}
+	case []providers.Message:
+		messages = v
+		for _, msg := range v {
+			fullInput += msg.Role + ": " + msg.Content + "\n"
+		}
 	default:
 		return nil, fmt.Errorf("invalid input type")
 	}
@@ -69,11 +113,16 @@ func LLMWithRouterConv(input interface{}, requestedModel string, conversationID
 		params = &RouterParams{}
 	}
 	if params.MaxTokens <= 0 {
-		params.MaxTokens = 500
+		params.MaxTokens = defaultMaxTokens
 	}
 	if params.Temperature <= 0 {
 		params.Temperature = 0.7
 	}
+	streaming := stream != nil || params.ChunkStream != nil
+	ctx := params.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
 	
 	// Using params
 	
@@ -85,17 +134,18 @@ func LLMWithRouterConv(input interface{}, requestedModel string, conversationID
 		MaxTokens:   params.MaxTokens,
 		TopP:        params.TopP,
 		Stop:        params.Stop,
-		Stream:      stream != nil,
+		Stream:      streaming,
+		Tools:       params.Tools,
+		ToolChoice:  params.ToolChoice,
 	}
 
-	// Create request context
-	reqCtx := &routing.RequestContext{
-		RequestID: fmt.Sprintf("req_%d", time.Now().UnixNano()),
-		ModelID:   requestedModel,
-	}
+	// Create request context. Deployments that lack a capability the
+	// request needs, or whose context window can't hold the prompt and
+	// completion, aren't routed to.
+	reqCtx := routingContext(unifiedReq, params)
 
 	// Get routing decision
-	decision, err := modelRouter.RouteRequest(context.Background(), requestedModel, reqCtx)
+	decision, err := modelRouter.RouteRequest(ctx, requestedModel, reqCtx)
 	if err != nil {
 		// NO FALLBACK! FAIL PROPERLY!
 		// Routing failed
@@ -114,10 +164,11 @@ func LLMWithRouterConv(input interface{}, requestedModel string, conversationID
 		)
 		
 		// RETURN THE ERROR - DON'T SILENTLY USE WRONG MODEL!
-		return nil, fmt.Errorf("model '%s' not found in routing system: %v", requestedModel, err)
+		return nil, fmt.Errorf("routing model '%s': %w", requestedModel, err)
 	}
 
 	// Selected deployment
+	decision.Admit = params.Admit
 
 	// Apply minimum_functional_tokens if configured for this deployment
 	if decision.Primary.Parameters != nil {
@@ -143,11 +194,31 @@ func LLMWithRouterConv(input interface{}, requestedModel string, conversationID
 		}
 	}
 
+	// Count the prompt with the tokenizer of the model actually routed to,
+	// which for tiers isn't known until now, and check it again, as
+	// minimum_functional_tokens may have raised max_tokens
+	promptTokens := countMessageTokens(unifiedReq.Messages, decision.Primary.ModelID)
+	if err := checkContextWindow(modelRouter.Capabilities(decision.Primary).ContextWindow, promptTokens, unifiedReq.MaxTokens); err != nil {
+		return nil, err
+	}
+
+	// Models without a native JSON mode are told the format in the prompt,
+	// and their output is checked before it is returned
+	validateJSON := false
+	if params.ResponseFormat.WantsJSON() {
+		if modelRouter.Capabilities(decision.Primary).SupportsJSON {
+			unifiedReq.ResponseFormat = params.ResponseFormat
+		} else {
+			validateJSON = true
+			unifiedReq.Messages = withFormatInstructions(unifiedReq.Messages, params.ResponseFormat)
+		}
+	}
+
 	// Create response object
 	response := &LLMResponse{
 		Model:       requestedModel,
 		InputHash:   generateSignature(fullInput),
-		InputTokens: countTokens(fullInput, requestedModel),
+		InputTokens: promptTokens,
 	}
 
 	// Beacon LLM request start
@@ -155,57 +226,51 @@ func LLMWithRouterConv(input interface{}, requestedModel string, conversationID
 		"model":        requestedModel,
 		"deployment":   decision.Primary.ID,
 		"provider":     string(decision.Primary.Provider),
-		"streaming":    stream != nil,
+		"streaming":    streaming,
 		"input_hash":   response.InputHash,
 		"input_tokens": response.InputTokens,
 	})
 
-	// Handle streaming if requested
-	if stream != nil {
-		defer close(stream)
-		err = handleStreamingWithRouter(unifiedReq, decision, stream, response)
-	} else {
-		// Execute non-streaming request
-		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-		defer cancel()
-
-		unifiedResp, err := modelRouter.ExecuteRequest(ctx, unifiedReq, decision)
+	// Handle streaming if requested. Output that must be validated cannot
+	// be streamed as it arrives, so it is fetched whole and replayed.
+	if streaming && !validateJSON {
+		err = handleStreamingWithRouter(ctx, unifiedReq, decision, stream, params.ChunkStream, response)
 		if err != nil {
 			beacon("llm_error", map[string]interface{}{
-				"type":       "routing_error",
+				"type":       "streaming_error",
+				"error_type": providerErrorType(err),
 				"error":      err.Error(),
 				"model":      requestedModel,
-				"deployment": decision.Primary.ID,
+				"deployment": response.Deployment,
+				"partial":    response.Content != "" || len(response.ToolCalls) > 0,
 			})
+		}
+	} else {
+		unifiedReq.Stream = false
+		if err = executeWithRouter(ctx, unifiedReq, decision, response); err != nil {
 			return nil, err
 		}
-
-		// Extract content from response
-		// Response received
-		if len(unifiedResp.Choices) > 0 {
-			response.Content = unifiedResp.Choices[0].Message.Content
-			// Content extracted
-			response.OutputHash = generateSignature(response.Content)
-			response.FinishReason = unifiedResp.Choices[0].FinishReason
-		} else {
-			// No choices in response
+		if validateJSON {
+			err = enforceResponseFormat(ctx, unifiedReq, decision, params.ResponseFormat, response)
 		}
-
-		// Use token counts from response if available
-		if unifiedResp.Usage.CompletionTokens > 0 {
-			response.OutputTokens = unifiedResp.Usage.CompletionTokens
-		} else {
-			response.OutputTokens = countTokens(response.Content, requestedModel)
+		if err == nil && streaming {
+			replayStream(response, stream, params.ChunkStream)
 		}
 	}
 
+	// Attribute the request to the deployment that actually served it
+	served := decision.Primary
+	if d, ok := deploymentRegistry.Get(response.Deployment); ok {
+		served = d
+	}
+
 	// Beacon LLM request complete
 	beacon("llm_request_complete", map[string]interface{}{
 		"model":            requestedModel,
-		"deployment":       decision.Primary.ID,
-		"provider":         string(decision.Primary.Provider),
-		"success":          true,
-		"streaming":        stream != nil,
+		"deployment":       served.ID,
+		"provider":         string(served.Provider),
+		"success":          err == nil,
+		"streaming":        streaming,
 		"input_hash":       response.InputHash,
 		"output_hash":      response.OutputHash,
 		"input_tokens":     response.InputTokens,
@@ -213,14 +278,15 @@ func LLMWithRouterConv(input interface{}, requestedModel string, conversationID
 		"total_tokens":     response.InputTokens + response.OutputTokens,
 		"finish_reason":    response.FinishReason,
 		"content_filtered": response.ContentFiltered,
+		"tool_calls":       len(response.ToolCalls),
 	})
 
 	// LOG TO AUDIT DATABASE
 	LogLLMInteraction(
 		conversationID,
 		requestedModel,
-		decision.Primary.ID,
-		string(decision.Primary.Provider),
+		served.ID,
+		string(served.Provider),
 		input,
 		response.Content,
 		response.InputTokens,
@@ -231,54 +297,209 @@ func LLMWithRouterConv(input interface{}, requestedModel string, conversationID
 	return response, err
 }
 
-// handleStreamingWithRouter handles streaming responses through the router
-func handleStreamingWithRouter(req *providers.UnifiedRequest, decision *routing.RoutingDecision, stream chan<- string, response *LLMResponse) error {
-	// Get provider for the deployment
-	provider, exists := modelRouter.Providers[decision.Primary.Provider]
-	if !exists {
-		return fmt.Errorf("provider not found: %s", decision.Primary.Provider)
+// handleStreamingWithRouter streams through the router's fallback chain.
+// Failover is transparent until the first token reaches the caller; after
+// that a failure ends the stream and is returned to the caller. Either
+// stream may be nil.
+func handleStreamingWithRouter(ctx context.Context, req *providers.UnifiedRequest, decision *routing.RoutingDecision, stream chan<- string, chunks chan<- providers.StreamChunk, response *LLMResponse) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var outputBuilder strings.Builder
+	var usage *providers.Usage
+	deployment, err := modelRouter.ExecuteStream(ctx, req, decision, func(chunk providers.StreamChunk) {
+		if chunks != nil {
+			chunks <- chunk
+		}
+		if chunk.Data != "" {
+			if stream != nil {
+				stream <- chunk.Data
+			}
+			outputBuilder.WriteString(chunk.Data)
+		}
+		response.ToolCalls = accumulateToolCalls(response.ToolCalls, chunk.ToolCalls)
+		if chunk.FinishReason != "" {
+			response.FinishReason = chunk.FinishReason
+		}
+		if chunk.Usage != nil {
+			usage = chunk.Usage
+		}
+	})
+	if deployment != nil {
+		response.Deployment = deployment.ID
 	}
 
-	// Translate request
-	ctx := context.Background()
-	providerReq, err := provider.TranslateRequest(ctx, req, decision.Primary)
+	// Update response with whatever content was streamed, even on failure
+	response.Content = outputBuilder.String()
+	response.OutputHash = generateSignature(response.Content)
+	if usage != nil && usage.PromptTokens > 0 {
+		response.InputTokens = usage.PromptTokens
+	}
+	if usage != nil && usage.CompletionTokens > 0 {
+		response.OutputTokens = usage.CompletionTokens
+	} else {
+		response.OutputTokens = countTokens(response.Content, decision.Primary.ModelID)
+	}
+
+	return err
+}
+
+// executeWithRouter runs a non-streaming request through the router's
+// fallback chain and fills in the response
+func executeWithRouter(ctx context.Context, req *providers.UnifiedRequest, decision *routing.RoutingDecision, response *LLMResponse) error {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, defaultRequestTimeout)
+		defer cancel()
+	}
+
+	unifiedResp, err := modelRouter.ExecuteRequest(ctx, req, decision)
 	if err != nil {
-		return fmt.Errorf("failed to translate request: %w", err)
+		beacon("llm_error", map[string]interface{}{
+			"type":       "routing_error",
+			"error_type": providerErrorType(err),
+			"error":      err.Error(),
+			"model":      req.Model,
+			"deployment": decision.Primary.ID,
+		})
+		return err
 	}
 
-	// Create stream channel for provider
-	providerStream := make(chan providers.StreamChunk)
-	
-	// Start streaming from provider
-	go func() {
-		err := provider.Stream(ctx, providerReq, providerStream)
-		if err != nil {
-			// Stream error
-		}
-	}()
+	if id, ok := unifiedResp.Metadata["deployment_id"].(string); ok {
+		response.Deployment = id
+	}
+	if len(unifiedResp.Choices) > 0 {
+		response.Content = unifiedResp.Choices[0].Message.Content
+		response.OutputHash = generateSignature(response.Content)
+		response.FinishReason = unifiedResp.Choices[0].FinishReason
+		response.ToolCalls = unifiedResp.Choices[0].Message.ToolCalls
+	}
 
-	// Process stream chunks
-	var outputBuilder strings.Builder
-	for chunk := range providerStream {
-		if chunk.Error != nil {
-			return chunk.Error
+	// Use token counts from response if available
+	if unifiedResp.Usage.PromptTokens > 0 {
+		response.InputTokens = unifiedResp.Usage.PromptTokens
+	}
+	if unifiedResp.Usage.CompletionTokens > 0 {
+		response.OutputTokens = unifiedResp.Usage.CompletionTokens
+	} else {
+		response.OutputTokens = countTokens(response.Content, decision.Primary.ModelID)
+	}
+	return nil
+}
+
+// withFormatInstructions adds response format instructions to the system
+// prompt, without modifying the caller's messages
+func withFormatInstructions(messages []providers.Message, format *providers.ResponseFormat) []providers.Message {
+	instructions := format.Instructions()
+	if len(messages) > 0 && messages[0].Role == "system" && len(messages[0].Parts) == 0 {
+		out := append([]providers.Message{}, messages...)
+		out[0].Content += "\n\n" + instructions
+		return out
+	}
+	return append([]providers.Message{{Role: "system", Content: instructions}}, messages...)
+}
+
+// enforceResponseFormat validates JSON output from a model without native
+// JSON support. Invalid output gets one repair attempt, with the validation
+// error fed back to the model, before the error is returned.
+func enforceResponseFormat(ctx context.Context, req *providers.UnifiedRequest, decision *routing.RoutingDecision, format *providers.ResponseFormat, response *LLMResponse) error {
+	if len(response.ToolCalls) > 0 {
+		// A tool call is not the final answer, the format applies to that
+		return nil
+	}
+
+	output, err := format.Check(response.Content)
+	if err != nil {
+		verr := err.(*providers.OutputValidationError)
+		beacon("llm_output_invalid", map[string]interface{}{
+			"model":      req.Model,
+			"deployment": response.Deployment,
+			"format":     format.Type,
+			"path":       verr.Path,
+			"reason":     verr.Reason,
+			"attempt":    1,
+		})
+
+		repair := *req
+		repair.Messages = append(append([]providers.Message{}, req.Messages...),
+			providers.Message{Role: "assistant", Content: response.Content},
+			providers.Message{Role: "user", Content: fmt.Sprintf(
+				"Your reply did not match the required format (%s at %s). Reply again with only the corrected JSON.", verr.Reason, verr.Path)},
+		)
+		// Both attempts are charged. The repair prompt is estimated in case
+		// the upstream doesn't report usage.
+		spentIn, spentOut := response.InputTokens, response.OutputTokens
+		response.InputTokens = countMessageTokens(repair.Messages, req.Model)
+		if err := executeWithRouter(ctx, &repair, decision, response); err != nil {
+			return err
 		}
-		
-		if chunk.Done {
-			break
+		response.InputTokens += spentIn
+		response.OutputTokens += spentOut
+
+		if output, err = format.Check(response.Content); err != nil {
+			verr = err.(*providers.OutputValidationError)
+			beacon("llm_output_invalid", map[string]interface{}{
+				"model":      req.Model,
+				"deployment": response.Deployment,
+				"format":     format.Type,
+				"path":       verr.Path,
+				"reason":     verr.Reason,
+				"attempt":    2,
+			})
+			return err
 		}
+	}
 
-		// Extract content from chunk (simplified - would need proper parsing)
-		stream <- chunk.Data
-		outputBuilder.WriteString(chunk.Data)
+	response.Content = output
+	response.OutputHash = generateSignature(output)
+	return nil
+}
+
+// replayStream sends a complete response to streaming callers
+func replayStream(response *LLMResponse, stream chan<- string, chunks chan<- providers.StreamChunk) {
+	if stream != nil && response.Content != "" {
+		stream <- response.Content
 	}
+	if chunks == nil {
+		return
+	}
+	if response.Content != "" {
+		chunks <- providers.StreamChunk{Data: response.Content}
+	}
+	if len(response.ToolCalls) > 0 {
+		deltas := make([]providers.ToolCallDelta, len(response.ToolCalls))
+		for i, call := range response.ToolCalls {
+			deltas[i] = providers.ToolCallDelta{Index: i, ID: call.ID, Name: call.Function.Name, Arguments: call.Function.Arguments}
+		}
+		chunks <- providers.StreamChunk{ToolCalls: deltas}
+	}
+	chunks <- providers.StreamChunk{FinishReason: response.FinishReason}
+}
 
-	// Update response with final content
-	response.Content = outputBuilder.String()
-	response.OutputHash = generateSignature(response.Content)
-	response.OutputTokens = countTokens(response.Content, req.Model)
+// accumulateToolCalls folds streamed tool call fragments into complete calls
+func accumulateToolCalls(calls []providers.ToolCall, deltas []providers.ToolCallDelta) []providers.ToolCall {
+	for _, delta := range deltas {
+		for len(calls) <= delta.Index {
+			calls = append(calls, providers.ToolCall{Type: "function"})
+		}
+		call := &calls[delta.Index]
+		if delta.ID != "" {
+			call.ID = delta.ID
+		}
+		if delta.Name != "" {
+			call.Function.Name = delta.Name
+		}
+		call.Function.Arguments += delta.Arguments
+	}
+	return calls
+}
 
-	return nil
+// providerErrorType returns the typed error class of err for beacons
+func providerErrorType(err error) string {
+	if pe, ok := providers.AsProviderError(err); ok {
+		return string(pe.Type)
+	}
+	return "unclassified"
 }
 
 // UpdateLLMFunction updates the global LLM function to use routing if available
@@ -2,6 +2,7 @@ package main
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"time"
 
@@ -35,6 +36,13 @@ type DeploymentResponse struct {
 	Status          models.DeploymentStatus  `json:"status"`
 	Metrics         models.DeploymentMetrics `json:"metrics"`
 	Tags            map[string]string        `json:"tags"`
+
+	// Capabilities the router applies to the deployment, with any
+	// overrides from its parameters
+	Capabilities *models.ModelCapabilities `json:"capabilities,omitempty"`
+
+	// Circuit breaker state, configuration and recent transitions
+	CircuitBreaker *routing.CircuitBreakerStatus `json:"circuit_breaker,omitempty"`
 }
 
 // handleListModels handles GET /v1/models
@@ -49,7 +57,7 @@ func handleListModels(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if r.Method != "GET" {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		methodNotAllowed(w, "GET, OPTIONS")
 		return
 	}
 
@@ -58,7 +66,12 @@ func handleListModels(w http.ResponseWriter, r *http.Request) {
 	
 	// Convert to API response format
 	modelResponses := make([]ModelResponse, 0, len(allModels))
+	tenant := tenantFrom(r)
 	for _, model := range allModels {
+		if tenant != nil && !tenant.AllowsModel(model.ID) {
+			continue
+		}
+
 		// Determine owned_by based on family
 		ownedBy := "organization"
 		switch model.Family {
@@ -103,21 +116,24 @@ func handleGetModel(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if r.Method != "GET" {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		methodNotAllowed(w, "GET, OPTIONS")
 		return
 	}
 
 	// Extract model ID from path
 	modelID := r.URL.Path[len("/v1/models/"):]
 	if modelID == "" {
-		http.Error(w, "Model ID required", http.StatusBadRequest)
+		writeAPIError(w, invalidRequest("missing_required_parameter", "model", "Model ID required"))
 		return
 	}
 
 	// Get model from registry
 	model, exists := modelRegistry.Get(modelID)
+	if tenant := tenantFrom(r); exists && tenant != nil && !tenant.AllowsModel(modelID) {
+		exists = false // Models outside the allowlist are not visible to the key
+	}
 	if !exists {
-		http.Error(w, "Model not found", http.StatusNotFound)
+		writeAPIError(w, newAPIError(http.StatusNotFound, errTypeInvalidRequest, "model_not_found", "model", fmt.Sprintf("The model '%s' does not exist", modelID)))
 		return
 	}
 
@@ -159,7 +175,7 @@ func handleListDeployments(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if r.Method != "GET" {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		methodNotAllowed(w, "GET, OPTIONS")
 		return
 	}
 
@@ -215,21 +231,21 @@ func handleGetDeployment(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if r.Method != "GET" {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		methodNotAllowed(w, "GET, OPTIONS")
 		return
 	}
 
 	// Extract deployment ID from path
 	deploymentID := r.URL.Path[len("/v1/deployments/"):]
 	if deploymentID == "" {
-		http.Error(w, "Deployment ID required", http.StatusBadRequest)
+		writeAPIError(w, invalidRequest("missing_required_parameter", "deployment", "Deployment ID required"))
 		return
 	}
 
 	// Get deployment from registry
 	deployment, exists := deploymentRegistry.Get(deploymentID)
 	if !exists {
-		http.Error(w, "Deployment not found", http.StatusNotFound)
+		writeAPIError(w, newAPIError(http.StatusNotFound, errTypeInvalidRequest, "deployment_not_found", "deployment", fmt.Sprintf("The deployment '%s' does not exist", deploymentID)))
 		return
 	}
 
@@ -242,6 +258,13 @@ func handleGetDeployment(w http.ResponseWriter, r *http.Request) {
 		Metrics:         deployment.Metrics,
 		Tags:            deployment.Tags,
 	}
+	if modelRouter != nil {
+		caps := modelRouter.Capabilities(deployment)
+		response.Capabilities = &caps
+		if status, ok := modelRouter.CircuitBreakerStatus(deployment.ID); ok {
+			response.CircuitBreaker = &status
+		}
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
@@ -259,7 +282,7 @@ func handleHealthCheck(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if r.Method != "GET" {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		methodNotAllowed(w, "GET, OPTIONS")
 		return
 	}
 
@@ -44,6 +44,7 @@ const (
 	ProviderVertex    ProviderType = "vertex"
 	ProviderAnthropic ProviderType = "anthropic"
 	ProviderLocal     ProviderType = "local"
+	ProviderMock      ProviderType = "mock" // In-process, deterministic (tests and demos)
 )
 
 // EndpointConfig contains provider-specific endpoint configuration
@@ -129,6 +130,7 @@ type DeploymentMetrics struct {
 	TotalRequests   int64 `json:"total_requests"`
 	SuccessRequests int64 `json:"success_requests"`
 	FailedRequests  int64 `json:"failed_requests"`
+	Retries         int64 `json:"retries"` // Extra attempts made after retryable errors
 
 	// Latency metrics (milliseconds)
 	AverageLatency float64 `json:"average_latency"`
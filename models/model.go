@@ -36,6 +36,10 @@ type ModelCapabilities struct {
 	SupportsStreaming bool `json:"supports_streaming" yaml:"supports_streaming"`
 	SupportsJSON      bool `json:"supports_json" yaml:"supports_json"`
 
+	// Embedding models serve /v1/embeddings instead of chat
+	SupportsEmbeddings bool `json:"supports_embeddings" yaml:"supports_embeddings"`
+	Dimensions         int  `json:"dimensions,omitempty" yaml:"dimensions"`
+
 	// Performance
 	TokensPerSecond float64 `json:"tokens_per_second" yaml:"tokens_per_second"`
 
@@ -0,0 +1,485 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"ch.at/providers"
+)
+
+// Ollama API facade, so Ollama clients can use any routed model. Requests
+// go through the router like chat completions; responses use Ollama's
+// shapes, streamed as NDJSON (one JSON object per line), which is
+// Ollama's default.
+
+// ollamaVersion is reported by /api/version; clients use it to check the
+// server speaks a recent enough API
+const ollamaVersion = "0.5.0"
+
+// OllamaOptions are the model options the router can honor
+type OllamaOptions struct {
+	Temperature float64  `json:"temperature,omitempty"`
+	TopP        float64  `json:"top_p,omitempty"`
+	NumPredict  int      `json:"num_predict,omitempty"`
+	Stop        []string `json:"stop,omitempty"`
+}
+
+// OllamaMessage is a chat message; images are bare base64
+type OllamaMessage struct {
+	Role      string           `json:"role"`
+	Content   string           `json:"content"`
+	Images    []string         `json:"images,omitempty"`
+	ToolCalls []OllamaToolCall `json:"tool_calls,omitempty"`
+}
+
+// OllamaToolCall is a tool call; arguments are an object, not a JSON string
+type OllamaToolCall struct {
+	Function struct {
+		Name      string          `json:"name"`
+		Arguments json.RawMessage `json:"arguments"`
+	} `json:"function"`
+}
+
+// OllamaChatRequest is a POST /api/chat request body
+type OllamaChatRequest struct {
+	Model    string           `json:"model"`
+	Messages []OllamaMessage  `json:"messages"`
+	Stream   *bool            `json:"stream,omitempty"` // Defaults to true
+	Format   json.RawMessage  `json:"format,omitempty"` // "json" or a JSON schema
+	Options  OllamaOptions    `json:"options,omitempty"`
+	Tools    []providers.Tool `json:"tools,omitempty"`
+}
+
+// OllamaGenerateRequest is a POST /api/generate request body
+type OllamaGenerateRequest struct {
+	Model   string          `json:"model"`
+	Prompt  string          `json:"prompt"`
+	System  string          `json:"system,omitempty"`
+	Images  []string        `json:"images,omitempty"`
+	Stream  *bool           `json:"stream,omitempty"`
+	Format  json.RawMessage `json:"format,omitempty"`
+	Options OllamaOptions   `json:"options,omitempty"`
+}
+
+// OllamaResponse is a response, or one line of a stream. Chat responses
+// carry Message and generate responses carry Response.
+type OllamaResponse struct {
+	Model              string         `json:"model"`
+	CreatedAt          string         `json:"created_at"`
+	Message            *OllamaMessage `json:"message,omitempty"`
+	Response           *string        `json:"response,omitempty"`
+	Done               bool           `json:"done"`
+	DoneReason         string         `json:"done_reason,omitempty"`
+	TotalDuration      int64          `json:"total_duration,omitempty"`
+	LoadDuration       int64          `json:"load_duration,omitempty"`
+	PromptEvalCount    int            `json:"prompt_eval_count,omitempty"`
+	PromptEvalDuration int64          `json:"prompt_eval_duration,omitempty"`
+	EvalCount          int            `json:"eval_count,omitempty"`
+	EvalDuration       int64          `json:"eval_duration,omitempty"`
+}
+
+// ollamaModelName strips the ":latest" tag Ollama clients add to bare names
+func ollamaModelName(name string) string {
+	return strings.TrimSuffix(name, ":latest")
+}
+
+// ollamaImagePart turns a bare base64 image into a data URL part, sniffing
+// its media type since Ollama does not send one
+func ollamaImagePart(data string) (providers.ContentPart, error) {
+	head := data
+	if len(head) > 64 {
+		head = head[:64]
+	}
+	decoded, err := base64.StdEncoding.DecodeString(head)
+	if err != nil && len(decoded) == 0 {
+		return providers.ContentPart{}, fmt.Errorf("images must be base64 encoded")
+	}
+	mediaType := http.DetectContentType(decoded)
+	if !strings.HasPrefix(mediaType, "image/") {
+		mediaType = "image/jpeg"
+	}
+	return providers.ContentPart{
+		Type:     providers.ContentTypeImage,
+		ImageURL: &providers.ImageURL{URL: "data:" + mediaType + ";base64," + data},
+	}, nil
+}
+
+// ollamaUnifiedMessage converts one message, attaching its images
+func ollamaUnifiedMessage(role, content string, images []string) (providers.Message, error) {
+	msg := providers.Message{Role: role, Content: content}
+	if len(images) == 0 {
+		return msg, nil
+	}
+	if content != "" {
+		msg.Parts = append(msg.Parts, providers.ContentPart{Type: providers.ContentTypeText, Text: content})
+	}
+	for _, image := range images {
+		part, err := ollamaImagePart(image)
+		if err != nil {
+			return msg, err
+		}
+		msg.Parts = append(msg.Parts, part)
+	}
+	return msg, nil
+}
+
+// unifiedMessages converts the chat history. Ollama has no tool call IDs,
+// so calls are given IDs here and tool results are matched to them in order.
+func (req *OllamaChatRequest) unifiedMessages() ([]providers.Message, error) {
+	var messages []providers.Message
+	var pending []string // IDs of calls awaiting a result
+	for i, m := range req.Messages {
+		msg, err := ollamaUnifiedMessage(m.Role, m.Content, m.Images)
+		if err != nil {
+			return nil, err
+		}
+		for j, call := range m.ToolCalls {
+			id := fmt.Sprintf("call_%d_%d", i, j)
+			arguments := "{}"
+			if len(call.Function.Arguments) > 0 {
+				arguments = string(call.Function.Arguments)
+			}
+			msg.ToolCalls = append(msg.ToolCalls, providers.ToolCall{
+				ID:       id,
+				Type:     "function",
+				Function: providers.FunctionCall{Name: call.Function.Name, Arguments: arguments},
+			})
+			pending = append(pending, id)
+		}
+		if m.Role == "tool" && len(pending) > 0 {
+			msg.ToolCallID, pending = pending[0], pending[1:]
+		}
+		messages = append(messages, msg)
+	}
+	return messages, nil
+}
+
+// ollamaFormat translates "format" to a response format
+func ollamaFormat(format json.RawMessage) (*providers.ResponseFormat, error) {
+	trimmed := strings.TrimSpace(string(format))
+	switch {
+	case trimmed == "" || trimmed == "null" || trimmed == `""`:
+		return nil, nil
+	case trimmed == `"json"`:
+		return &providers.ResponseFormat{Type: providers.ResponseFormatJSONObject}, nil
+	}
+	var schema map[string]interface{}
+	if err := json.Unmarshal(format, &schema); err != nil {
+		return nil, fmt.Errorf(`format must be "json" or a JSON schema object`)
+	}
+	return &providers.ResponseFormat{
+		Type:       providers.ResponseFormatJSONSchema,
+		JSONSchema: &providers.JSONSchema{Name: "response", Schema: schema},
+	}, nil
+}
+
+// ollamaParams builds router parameters from options and format
+func ollamaParams(options OllamaOptions, format json.RawMessage) (*RouterParams, error) {
+	responseFormat, err := ollamaFormat(format)
+	if err != nil {
+		return nil, err
+	}
+	return &RouterParams{
+		MaxTokens:      options.NumPredict,
+		Temperature:    options.Temperature,
+		TopP:           options.TopP,
+		Stop:           options.Stop,
+		ResponseFormat: responseFormat,
+	}, nil
+}
+
+// ollamaToolCalls converts tool calls back to Ollama's shape
+func ollamaToolCalls(calls []providers.ToolCall) []OllamaToolCall {
+	out := make([]OllamaToolCall, len(calls))
+	for i, call := range calls {
+		out[i].Function.Name = call.Function.Name
+		out[i].Function.Arguments = toolCallInput(call.Function.Arguments)
+	}
+	return out
+}
+
+// ollamaDoneReason maps a unified finish reason; Ollama only reports stop and length
+func ollamaDoneReason(finishReason string) string {
+	if finishReason == "length" {
+		return "length"
+	}
+	return "stop"
+}
+
+// ollamaError writes Ollama's {"error": "..."} body with the error's status
+func ollamaError(w http.ResponseWriter, apiErr *APIError) {
+	setRetryAfter(w, apiErr.RetryAfter)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(apiErr.Status)
+	json.NewEncoder(w).Encode(map[string]string{"error": apiErr.Message})
+}
+
+// ollamaPreamble applies the checks shared by the Ollama endpoints and
+// reports whether the request may proceed
+func ollamaPreamble(w http.ResponseWriter, r *http.Request, allow string) bool {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", allow)
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return false
+	}
+	if tenantFrom(r) == nil && !rateLimitAllow(r.RemoteAddr) {
+		ollamaError(w, rateLimited("Rate limit exceeded", time.Second))
+		return false
+	}
+	if !strings.Contains(allow, r.Method) {
+		w.Header().Set("Allow", allow)
+		ollamaError(w, newAPIError(http.StatusMethodNotAllowed, errTypeInvalidRequest, "method_not_allowed", "", "method not allowed"))
+		return false
+	}
+	return true
+}
+
+// handleOllamaChat handles POST /api/chat
+func handleOllamaChat(w http.ResponseWriter, r *http.Request) {
+	if !ollamaPreamble(w, r, "POST, OPTIONS") {
+		return
+	}
+
+	var req OllamaChatRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		ollamaError(w, invalidRequest("invalid_json", "", "invalid JSON: "+err.Error()))
+		return
+	}
+	messages, err := req.unifiedMessages()
+	if err != nil {
+		ollamaError(w, invalidRequest("invalid_request", "messages", err.Error()))
+		return
+	}
+	params, err := ollamaParams(req.Options, req.Format)
+	if err != nil {
+		ollamaError(w, invalidRequest("invalid_request", "format", err.Error()))
+		return
+	}
+	params.Tools = req.Tools
+
+	model := ollamaModelName(req.Model)
+	if len(messages) == 0 {
+		// Ollama answers an empty chat with an empty done response; clients
+		// use this to load a model ahead of time
+		writeOllamaJSON(w, OllamaResponse{
+			Model:      req.Model,
+			CreatedAt:  time.Now().UTC().Format(time.RFC3339Nano),
+			Message:    &OllamaMessage{Role: "assistant"},
+			Done:       true,
+			DoneReason: "load",
+		})
+		return
+	}
+
+	serveOllama(w, r, req.Model, model, messages, params, req.Stream == nil || *req.Stream, true)
+}
+
+// handleOllamaGenerate handles POST /api/generate
+func handleOllamaGenerate(w http.ResponseWriter, r *http.Request) {
+	if !ollamaPreamble(w, r, "POST, OPTIONS") {
+		return
+	}
+
+	var req OllamaGenerateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		ollamaError(w, invalidRequest("invalid_json", "", "invalid JSON: "+err.Error()))
+		return
+	}
+	params, err := ollamaParams(req.Options, req.Format)
+	if err != nil {
+		ollamaError(w, invalidRequest("invalid_request", "format", err.Error()))
+		return
+	}
+
+	if req.Prompt == "" && len(req.Images) == 0 {
+		empty := ""
+		writeOllamaJSON(w, OllamaResponse{
+			Model:      req.Model,
+			CreatedAt:  time.Now().UTC().Format(time.RFC3339Nano),
+			Response:   &empty,
+			Done:       true,
+			DoneReason: "load",
+		})
+		return
+	}
+
+	var messages []providers.Message
+	if req.System != "" {
+		messages = append(messages, providers.Message{Role: "system", Content: req.System})
+	}
+	prompt, err := ollamaUnifiedMessage("user", req.Prompt, req.Images)
+	if err != nil {
+		ollamaError(w, invalidRequest("invalid_request", "images", err.Error()))
+		return
+	}
+	messages = append(messages, prompt)
+
+	serveOllama(w, r, req.Model, ollamaModelName(req.Model), messages, params, req.Stream == nil || *req.Stream, false)
+}
+
+// serveOllama routes a request and writes the response as chat or
+// generate lines, streamed as NDJSON or as a single object
+func serveOllama(w http.ResponseWriter, r *http.Request, requested, model string, messages []providers.Message, params *RouterParams, stream, chat bool) {
+	if apiErr := checkModelAllowed(r, model); apiErr != nil {
+		ollamaError(w, apiErr)
+		return
+	}
+	if modelRouter == nil {
+		ollamaError(w, newAPIError(http.StatusServiceUnavailable, errTypeServer, "", "", "model router not initialized"))
+		return
+	}
+	params.Context = r.Context()
+	messages = applyContextPolicy(w, r, "API", model, messages, params)
+
+	start := time.Now()
+	line := func(content string, calls []providers.ToolCall) OllamaResponse {
+		resp := OllamaResponse{Model: requested, CreatedAt: time.Now().UTC().Format(time.RFC3339Nano)}
+		if chat {
+			resp.Message = &OllamaMessage{Role: "assistant", Content: content}
+			if len(calls) > 0 {
+				resp.Message.ToolCalls = ollamaToolCalls(calls)
+			}
+		} else {
+			resp.Response = &content
+		}
+		return resp
+	}
+	final := func(resp OllamaResponse, llmResp *LLMResponse, firstOutput time.Time) OllamaResponse {
+		resp.Done = true
+		resp.DoneReason = ollamaDoneReason(llmResp.FinishReason)
+		resp.TotalDuration = time.Since(start).Nanoseconds()
+		resp.PromptEvalCount = llmResp.InputTokens
+		resp.EvalCount = llmResp.OutputTokens
+		resp.EvalDuration = time.Since(firstOutput).Nanoseconds()
+		return resp
+	}
+
+	if !stream {
+		llmResp, err := LLMWithRouter(messages, model, params, nil)
+		if err != nil {
+			ollamaError(w, apiErrorFor(err, model))
+			return
+		}
+		recordTenantUsage(r, model, llmResp)
+		writeOllamaJSON(w, final(line(llmResp.Content, llmResp.ToolCalls), llmResp, start))
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		ollamaError(w, newAPIError(http.StatusInternalServerError, errTypeServer, "", "", "streaming not supported"))
+		return
+	}
+	encoder := json.NewEncoder(w)
+	writeLine := func(v interface{}) {
+		encoder.Encode(v)
+		flusher.Flush()
+	}
+
+	ch := make(chan providers.StreamChunk)
+	params.ChunkStream = ch
+	type result struct {
+		resp *LLMResponse
+		err  error
+	}
+	done := make(chan result, 1)
+	go func() {
+		resp, err := LLMWithRouter(messages, model, params, nil)
+		done <- result{resp, err}
+	}()
+
+	// The status line waits for the first output, as for chat completions
+	started := false
+	var firstOutput time.Time
+	begin := func() {
+		started = true
+		firstOutput = time.Now()
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.WriteHeader(http.StatusOK)
+	}
+
+	// Ollama sends tool calls whole, so they are sent once complete, below
+	for chunk := range ch {
+		if chunk.Data == "" {
+			continue
+		}
+		if !started {
+			begin()
+		}
+		writeLine(line(chunk.Data, nil))
+	}
+
+	res := <-done
+	if res.err != nil {
+		if !started {
+			ollamaError(w, apiErrorFor(res.err, model))
+			return
+		}
+		writeLine(map[string]string{"error": apiErrorFor(res.err, model).Message})
+		return
+	}
+	recordTenantUsage(r, model, res.resp)
+
+	if !started {
+		begin()
+	}
+	if len(res.resp.ToolCalls) > 0 && chat {
+		writeLine(line("", res.resp.ToolCalls))
+	}
+	writeLine(final(line("", nil), res.resp, firstOutput))
+}
+
+func writeOllamaJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// handleOllamaTags handles GET /api/tags, listing the registry's models
+func handleOllamaTags(w http.ResponseWriter, r *http.Request) {
+	if !ollamaPreamble(w, r, "GET, OPTIONS") {
+		return
+	}
+
+	tenant := tenantFrom(r)
+	models := []map[string]interface{}{}
+	if modelRegistry != nil {
+		for _, model := range modelRegistry.List() {
+			if tenant != nil && !tenant.AllowsModel(model.ID) {
+				continue
+			}
+			digest := sha256.Sum256([]byte(model.ID))
+			models = append(models, map[string]interface{}{
+				"name":        model.ID,
+				"model":       model.ID,
+				"modified_at": model.CreatedAt.UTC().Format(time.RFC3339Nano),
+				"size":        0, // Served remotely; nothing is stored locally
+				"digest":      hex.EncodeToString(digest[:]),
+				"details": map[string]interface{}{
+					"format":             "",
+					"family":             model.Family,
+					"families":           []string{model.Family},
+					"parameter_size":     "",
+					"quantization_level": "",
+				},
+			})
+		}
+	}
+	writeOllamaJSON(w, map[string]interface{}{"models": models})
+}
+
+// handleOllamaVersion handles GET /api/version
+func handleOllamaVersion(w http.ResponseWriter, r *http.Request) {
+	if !ollamaPreamble(w, r, "GET, OPTIONS") {
+		return
+	}
+	writeOllamaJSON(w, map[string]string{"version": ollamaVersion})
+}
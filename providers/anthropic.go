@@ -0,0 +1,538 @@
+package providers
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"ch.at/models"
+)
+
+const (
+	anthropicDefaultBaseURL   = "https://api.anthropic.com"
+	anthropicDefaultVersion   = "2023-06-01"
+	anthropicDefaultMaxTokens = 4096
+)
+
+// AnthropicProvider talks directly to the Anthropic Messages API (/v1/messages)
+type AnthropicProvider struct {
+	client *http.Client
+}
+
+// NewAnthropicProvider creates a new Anthropic provider
+func NewAnthropicProvider() *AnthropicProvider {
+	return &AnthropicProvider{
+		client: &http.Client{
+			Timeout: 60 * time.Second,
+		},
+	}
+}
+
+// TranslateRequest converts unified request to Anthropic Messages format
+func (a *AnthropicProvider) TranslateRequest(ctx context.Context, req *UnifiedRequest, deployment *models.Deployment) (*ProviderRequest, error) {
+	body := buildAnthropicBody(req)
+	body["model"] = deployment.ProviderModelID
+
+	baseURL := strings.TrimSuffix(deployment.Endpoint.BaseURL, "/")
+	if baseURL == "" {
+		baseURL = anthropicDefaultBaseURL
+	}
+
+	version := deployment.Endpoint.APIVersion
+	if version == "" {
+		version = anthropicDefaultVersion
+	}
+
+	headers := map[string]string{
+		"Content-Type":      "application/json",
+		"anthropic-version": version,
+	}
+	if deployment.Endpoint.Auth.APIKey != "" {
+		headers["x-api-key"] = deployment.Endpoint.Auth.APIKey
+	}
+	for k, v := range deployment.Endpoint.CustomHeaders {
+		headers[k] = v
+	}
+
+	return &ProviderRequest{
+		URL:     baseURL + "/v1/messages",
+		Method:  "POST",
+		Headers: headers,
+		Body:    body,
+		Timeout: deployment.Endpoint.Timeout,
+	}, nil
+}
+
+// Execute sends the request to Anthropic
+func (a *AnthropicProvider) Execute(ctx context.Context, req *ProviderRequest) (*ProviderResponse, error) {
+	return executeRequest(ctx, a.client, req)
+}
+
+// TranslateResponse converts an Anthropic message to unified format
+func (a *AnthropicProvider) TranslateResponse(ctx context.Context, resp *ProviderResponse, deployment *models.Deployment) (*UnifiedResponse, error) {
+	if resp.StatusCode != http.StatusOK {
+		return nil, newStatusError("anthropic", resp.StatusCode, resp.Headers, anthropicErrorMessage(resp.Body))
+	}
+
+	unifiedResp, err := parseAnthropicResponse(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	unifiedResp.Metadata["deployment_id"] = deployment.ID
+	unifiedResp.Metadata["provider"] = string(deployment.Provider)
+	unifiedResp.Metadata["provider_model"] = deployment.ProviderModelID
+
+	return unifiedResp, nil
+}
+
+// Stream handles Anthropic's SSE event stream
+func (a *AnthropicProvider) Stream(ctx context.Context, req *ProviderRequest, stream chan<- StreamChunk) error {
+	defer close(stream)
+
+	if body, ok := req.Body.(map[string]interface{}); ok {
+		body["stream"] = true
+	}
+
+	httpReq, err := newHTTPRequest(ctx, req)
+	if err != nil {
+		stream <- StreamChunk{Error: err}
+		return err
+	}
+
+	resp, err := a.client.Do(httpReq)
+	if err != nil {
+		err = newTransportError(err)
+		stream <- StreamChunk{Error: err}
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		raw, _ := io.ReadAll(resp.Body)
+		err := newStatusError("anthropic", resp.StatusCode, flattenHeaders(resp.Header), anthropicErrorMessage(raw))
+		stream <- StreamChunk{Error: err}
+		return err
+	}
+
+	return readAnthropicStream(resp.Body, stream)
+}
+
+// ValidateConfig validates Anthropic deployment configuration
+func (a *AnthropicProvider) ValidateConfig(deployment *models.Deployment) error {
+	if deployment.ProviderModelID == "" {
+		return fmt.Errorf("provider model ID is required")
+	}
+
+	if deployment.Endpoint.Auth.APIKey == "" {
+		return fmt.Errorf("API key is required but not provided")
+	}
+
+	return nil
+}
+
+// HealthCheck performs a minimal completion against the Messages API
+func (a *AnthropicProvider) HealthCheck(ctx context.Context, deployment *models.Deployment) error {
+	req := &UnifiedRequest{
+		Model: deployment.ProviderModelID,
+		Messages: []Message{
+			{Role: "user", Content: "Hi"},
+		},
+		MaxTokens:   10,
+		Temperature: 0,
+	}
+
+	providerReq, err := a.TranslateRequest(ctx, req, deployment)
+	if err != nil {
+		return fmt.Errorf("health check translation failed: %w", err)
+	}
+
+	healthCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	resp, err := a.Execute(healthCtx, providerReq)
+	if err != nil {
+		return fmt.Errorf("health check request failed: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("health check returned status %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+// GetInfo returns provider information
+func (a *AnthropicProvider) GetInfo() ProviderInfo {
+	return ProviderInfo{
+		Name:           "Anthropic Messages API",
+		Version:        anthropicDefaultVersion,
+		SupportsStream: true,
+		RequiresAuth:   true,
+		MaxRequestSize: 32 * 1024 * 1024, // 32MB
+		RateLimits: map[string]int{
+			"requests_per_minute": 50,
+			"tokens_per_minute":   40000,
+		},
+	}
+}
+
+// buildAnthropicBody builds the Messages API body without the model field.
+// Vertex AI reuses it for Claude models, which take the model from the URL.
+func buildAnthropicBody(req *UnifiedRequest) map[string]interface{} {
+	var systemParts []string
+	var messages []map[string]interface{}
+
+	for _, msg := range req.Messages {
+		if msg.Role == "system" {
+			systemParts = append(systemParts, msg.Content)
+			continue
+		}
+
+		role := msg.Role
+		if role != "assistant" {
+			role = "user"
+		}
+
+		// Plain text stays a string; images, tool calls and results need content blocks
+		var content interface{} = msg.Content
+		switch {
+		case msg.Role == "tool":
+			content = []interface{}{map[string]interface{}{
+				"type":        "tool_result",
+				"tool_use_id": msg.ToolCallID,
+				"content":     msg.Content,
+			}}
+		case len(msg.ToolCalls) > 0 || len(msg.Parts) > 0:
+			blocks := anthropicTextBlocks(msg.Content)
+			if len(msg.Parts) > 0 {
+				blocks = anthropicPartBlocks(msg.Parts)
+			}
+			for _, call := range msg.ToolCalls {
+				blocks = append(blocks, map[string]interface{}{
+					"type":  "tool_use",
+					"id":    call.ID,
+					"name":  call.Function.Name,
+					"input": toolArguments(call.Function.Arguments),
+				})
+			}
+			content = blocks
+		}
+
+		// Anthropic requires alternating roles, so merge consecutive turns
+		if n := len(messages); n > 0 && messages[n-1]["role"] == role {
+			prev, prevIsText := messages[n-1]["content"].(string)
+			text, isText := content.(string)
+			if prevIsText && isText {
+				messages[n-1]["content"] = prev + "\n\n" + text
+			} else {
+				messages[n-1]["content"] = append(anthropicBlocks(messages[n-1]["content"]), anthropicBlocks(content)...)
+			}
+			continue
+		}
+
+		messages = append(messages, map[string]interface{}{
+			"role":    role,
+			"content": content,
+		})
+	}
+
+	maxTokens := req.MaxTokens
+	if maxTokens <= 0 {
+		maxTokens = anthropicDefaultMaxTokens
+	}
+
+	body := map[string]interface{}{
+		"messages":   messages,
+		"max_tokens": maxTokens,
+		"stream":     req.Stream,
+	}
+
+	if len(systemParts) > 0 {
+		body["system"] = strings.Join(systemParts, "\n\n")
+	}
+	if req.Temperature > 0 {
+		body["temperature"] = req.Temperature
+	}
+	if req.TopP > 0 {
+		body["top_p"] = req.TopP
+	}
+	if len(req.Stop) > 0 {
+		body["stop_sequences"] = req.Stop
+	}
+	if req.User != "" {
+		body["metadata"] = map[string]string{"user_id": req.User}
+	}
+	if req.HasTools() {
+		var tools []map[string]interface{}
+		for _, fn := range toolFunctions(req) {
+			tools = append(tools, map[string]interface{}{
+				"name":         fn.Name,
+				"description":  fn.Description,
+				"input_schema": toolParameters(fn),
+			})
+		}
+		body["tools"] = tools
+
+		switch mode, name := toolChoice(req.ToolChoice); mode {
+		case toolChoiceNone:
+			body["tool_choice"] = map[string]string{"type": "none"}
+		case toolChoiceRequired:
+			body["tool_choice"] = map[string]string{"type": "any"}
+		case toolChoiceFunction:
+			body["tool_choice"] = map[string]string{"type": "tool", "name": name}
+		}
+	}
+
+	return body
+}
+
+// anthropicTextBlocks returns text as a content block list, empty for empty text
+func anthropicTextBlocks(text string) []interface{} {
+	if text == "" {
+		return []interface{}{}
+	}
+	return []interface{}{map[string]interface{}{"type": "text", "text": text}}
+}
+
+// anthropicPartBlocks converts multimodal parts to text and image blocks
+func anthropicPartBlocks(parts []ContentPart) []interface{} {
+	blocks := []interface{}{}
+	for _, part := range parts {
+		switch part.Type {
+		case ContentTypeText:
+			blocks = append(blocks, anthropicTextBlocks(part.Text)...)
+		case ContentTypeImage:
+			source := map[string]string{"type": "url", "url": part.ImageURL.URL}
+			if mediaType, data, ok := parseDataURL(part.ImageURL.URL); ok {
+				source = map[string]string{"type": "base64", "media_type": mediaType, "data": data}
+			}
+			blocks = append(blocks, map[string]interface{}{"type": "image", "source": source})
+		}
+	}
+	return blocks
+}
+
+// anthropicBlocks converts message content, a string or block list, to a block list
+func anthropicBlocks(content interface{}) []interface{} {
+	if blocks, ok := content.([]interface{}); ok {
+		return blocks
+	}
+	text, _ := content.(string)
+	return anthropicTextBlocks(text)
+}
+
+// anthropicMessage is the non-streaming Messages API response
+type anthropicMessage struct {
+	ID      string `json:"id"`
+	Model   string `json:"model"`
+	Content []struct {
+		Type  string          `json:"type"`
+		Text  string          `json:"text"`
+		ID    string          `json:"id"`    // tool_use blocks
+		Name  string          `json:"name"`  // tool_use blocks
+		Input json.RawMessage `json:"input"` // tool_use blocks
+	} `json:"content"`
+	StopReason string         `json:"stop_reason"`
+	Usage      anthropicUsage `json:"usage"`
+}
+
+// anthropicUsage is Anthropic's token accounting block
+type anthropicUsage struct {
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+}
+
+// parseAnthropicResponse converts a Messages API response body to unified format
+func parseAnthropicResponse(body []byte) (*UnifiedResponse, error) {
+	var msg anthropicMessage
+	if err := json.Unmarshal(body, &msg); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	var text strings.Builder
+	var toolCalls []ToolCall
+	for _, block := range msg.Content {
+		switch block.Type {
+		case "text":
+			text.WriteString(block.Text)
+		case "tool_use":
+			toolCalls = append(toolCalls, ToolCall{
+				ID:       block.ID,
+				Type:     "function",
+				Function: FunctionCall{Name: block.Name, Arguments: string(block.Input)},
+			})
+		}
+	}
+
+	return &UnifiedResponse{
+		ID:      msg.ID,
+		Object:  "chat.completion",
+		Created: time.Now().Unix(),
+		Model:   msg.Model,
+		Choices: []Choice{{
+			Index: 0,
+			Message: Message{
+				Role:      "assistant",
+				Content:   text.String(),
+				ToolCalls: toolCalls,
+			},
+			FinishReason: anthropicFinishReason(msg.StopReason),
+		}},
+		Usage: Usage{
+			PromptTokens:     msg.Usage.InputTokens,
+			CompletionTokens: msg.Usage.OutputTokens,
+			TotalTokens:      msg.Usage.InputTokens + msg.Usage.OutputTokens,
+		},
+		Metadata: make(map[string]interface{}),
+	}, nil
+}
+
+// anthropicStreamEvent covers the fields we read from every SSE event type
+type anthropicStreamEvent struct {
+	Type    string `json:"type"`
+	Message struct {
+		Usage anthropicUsage `json:"usage"`
+	} `json:"message"`
+	Index        int `json:"index"`
+	ContentBlock struct {
+		Type string `json:"type"`
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	} `json:"content_block"`
+	Delta struct {
+		Type        string `json:"type"`
+		Text        string `json:"text"`
+		PartialJSON string `json:"partial_json"`
+		StopReason  string `json:"stop_reason"`
+	} `json:"delta"`
+	Usage anthropicUsage `json:"usage"`
+	Error struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// readAnthropicStream turns Anthropic SSE events into stream chunks:
+// message_start carries input usage, content_block_delta carries text,
+// message_delta carries the stop reason and output usage. Tool calls open
+// with content_block_start and stream their arguments as input_json_delta.
+func readAnthropicStream(r io.Reader, stream chan<- StreamChunk) error {
+	var usage Usage
+	toolIndex := map[int]int{} // content block index -> tool call index
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		// The event type is repeated inside the data payload, so "event:" lines can be skipped
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+		data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+
+		var event anthropicStreamEvent
+		if err := json.Unmarshal([]byte(data), &event); err != nil {
+			// Skip malformed JSON
+			continue
+		}
+
+		switch event.Type {
+		case "message_start":
+			usage.PromptTokens = event.Message.Usage.InputTokens
+		case "content_block_start":
+			if event.ContentBlock.Type == "tool_use" {
+				index := len(toolIndex)
+				toolIndex[event.Index] = index
+				stream <- StreamChunk{ToolCalls: []ToolCallDelta{{Index: index, ID: event.ContentBlock.ID, Name: event.ContentBlock.Name}}}
+			}
+		case "content_block_delta":
+			switch {
+			case event.Delta.Type == "text_delta" && event.Delta.Text != "":
+				stream <- StreamChunk{Data: event.Delta.Text}
+			case event.Delta.Type == "input_json_delta" && event.Delta.PartialJSON != "":
+				stream <- StreamChunk{ToolCalls: []ToolCallDelta{{Index: toolIndex[event.Index], Arguments: event.Delta.PartialJSON}}}
+			}
+		case "message_delta":
+			usage.CompletionTokens = event.Usage.OutputTokens
+			usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+			final := usage
+			stream <- StreamChunk{
+				FinishReason: anthropicFinishReason(event.Delta.StopReason),
+				Usage:        &final,
+			}
+		case "message_stop":
+			stream <- StreamChunk{Done: true}
+			return nil
+		case "error":
+			err := newStreamError("anthropic", event.Error.Type, anthropicErrorStatus(event.Error.Type), event.Error.Message)
+			stream <- StreamChunk{Error: err}
+			return err
+		}
+	}
+
+	// A stream cut off before message_stop is an incomplete reply, not a finished one
+	var err error = &ProviderError{Type: ErrUpstreamUnavailable, Provider: "anthropic", Message: "stream ended before message_stop", Err: io.ErrUnexpectedEOF}
+	if scanErr := scanner.Err(); scanErr != nil {
+		err = newTransportError(scanErr)
+	}
+	stream <- StreamChunk{Error: err}
+	return err
+}
+
+// anthropicFinishReason maps Anthropic stop reasons to OpenAI finish reasons
+func anthropicFinishReason(stopReason string) string {
+	switch stopReason {
+	case "max_tokens":
+		return "length"
+	case "tool_use":
+		return "tool_calls"
+	case "end_turn", "stop_sequence":
+		return "stop"
+	default:
+		return stopReason
+	}
+}
+
+// anthropicErrorStatus maps an Anthropic error type to the HTTP status it is
+// documented with, for errors that arrive as stream events
+func anthropicErrorStatus(errType string) int {
+	switch errType {
+	case "invalid_request_error":
+		return http.StatusBadRequest
+	case "authentication_error":
+		return http.StatusUnauthorized
+	case "permission_error":
+		return http.StatusForbidden
+	case "not_found_error":
+		return http.StatusNotFound
+	case "request_too_large":
+		return http.StatusRequestEntityTooLarge
+	case "rate_limit_error":
+		return http.StatusTooManyRequests
+	case "overloaded_error":
+		return 529
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// anthropicErrorMessage extracts the message from an Anthropic error body
+func anthropicErrorMessage(body []byte) string {
+	var errResp struct {
+		Error struct {
+			Type    string `json:"type"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(body, &errResp); err == nil && errResp.Error.Message != "" {
+		return errResp.Error.Type + ": " + errResp.Error.Message
+	}
+	return string(body)
+}
@@ -0,0 +1,355 @@
+package providers_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"ch.at/models"
+	"ch.at/providers"
+)
+
+func newAnthropicDeployment(baseURL string) *models.Deployment {
+	return &models.Deployment{
+		ID:              "test-claude",
+		ModelID:         "claude-3.5-sonnet",
+		Provider:        models.ProviderAnthropic,
+		ProviderModelID: "claude-3-5-sonnet-20240620",
+		Endpoint: models.EndpointConfig{
+			BaseURL: baseURL,
+			Auth: models.AuthConfig{
+				Type:   models.AuthAPIKey,
+				APIKey: "sk-ant-test",
+			},
+		},
+	}
+}
+
+func TestAnthropicTranslateAndExecute(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/messages" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		if got := r.Header.Get("x-api-key"); got != "sk-ant-test" {
+			t.Errorf("x-api-key = %q", got)
+		}
+		if got := r.Header.Get("anthropic-version"); got != "2023-06-01" {
+			t.Errorf("anthropic-version = %q", got)
+		}
+
+		var body map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Fatalf("bad request body: %v", err)
+		}
+		if body["system"] != "Be terse." {
+			t.Errorf("system = %v", body["system"])
+		}
+		if body["max_tokens"] != float64(4096) {
+			t.Errorf("max_tokens default not applied: %v", body["max_tokens"])
+		}
+		messages := body["messages"].([]interface{})
+		if len(messages) != 1 {
+			t.Errorf("expected system message to be lifted out, got %d messages", len(messages))
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"id":"msg_1","model":"claude-3-5-sonnet-20240620","content":[{"type":"text","text":"hello"}],"stop_reason":"end_turn","usage":{"input_tokens":7,"output_tokens":2}}`)
+	}))
+	defer server.Close()
+
+	provider := providers.NewAnthropicProvider()
+	deployment := newAnthropicDeployment(server.URL)
+
+	req := &providers.UnifiedRequest{
+		Messages: []providers.Message{
+			{Role: "system", Content: "Be terse."},
+			{Role: "user", Content: "Hi"},
+		},
+	}
+
+	providerReq, err := provider.TranslateRequest(context.Background(), req, deployment)
+	if err != nil {
+		t.Fatalf("TranslateRequest: %v", err)
+	}
+	resp, err := provider.Execute(context.Background(), providerReq)
+	if err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	unified, err := provider.TranslateResponse(context.Background(), resp, deployment)
+	if err != nil {
+		t.Fatalf("TranslateResponse: %v", err)
+	}
+
+	if got := unified.Choices[0].Message.Content; got != "hello" {
+		t.Errorf("content = %q", got)
+	}
+	if got := unified.Choices[0].FinishReason; got != "stop" {
+		t.Errorf("finish_reason = %q", got)
+	}
+	if unified.Usage.TotalTokens != 9 {
+		t.Errorf("total tokens = %d", unified.Usage.TotalTokens)
+	}
+}
+
+func TestAnthropicStream(t *testing.T) {
+	events := []string{
+		`event: message_start
+data: {"type":"message_start","message":{"id":"msg_1","usage":{"input_tokens":5,"output_tokens":1}}}`,
+		`event: content_block_start
+data: {"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}`,
+		`event: ping
+data: {"type":"ping"}`,
+		`event: content_block_delta
+data: {"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Hel"}}`,
+		`event: content_block_delta
+data: {"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"lo"}}`,
+		`event: message_delta
+data: {"type":"message_delta","delta":{"stop_reason":"max_tokens"},"usage":{"output_tokens":2}}`,
+		`event: message_stop
+data: {"type":"message_stop"}`,
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		if body["stream"] != true {
+			t.Errorf("stream flag not set")
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, e := range events {
+			fmt.Fprintf(w, "%s\n\n", e)
+		}
+	}))
+	defer server.Close()
+
+	provider := providers.NewAnthropicProvider()
+	deployment := newAnthropicDeployment(server.URL)
+	req := &providers.UnifiedRequest{Messages: []providers.Message{{Role: "user", Content: "Hi"}}, Stream: true}
+
+	providerReq, err := provider.TranslateRequest(context.Background(), req, deployment)
+	if err != nil {
+		t.Fatalf("TranslateRequest: %v", err)
+	}
+
+	stream := make(chan providers.StreamChunk)
+	go provider.Stream(context.Background(), providerReq, stream)
+
+	var content, finish string
+	var usage *providers.Usage
+	done := false
+	for chunk := range stream {
+		if chunk.Error != nil {
+			t.Fatalf("chunk error: %v", chunk.Error)
+		}
+		if chunk.Done {
+			done = true
+			break
+		}
+		content += chunk.Data
+		if chunk.FinishReason != "" {
+			finish = chunk.FinishReason
+			usage = chunk.Usage
+		}
+	}
+
+	if !done {
+		t.Error("stream ended without a Done chunk")
+	}
+	if content != "Hello" {
+		t.Errorf("content = %q", content)
+	}
+	if finish != "length" {
+		t.Errorf("finish_reason = %q", finish)
+	}
+	if usage == nil || usage.PromptTokens != 5 || usage.CompletionTokens != 2 {
+		t.Errorf("usage = %+v", usage)
+	}
+}
+
+func TestAnthropicStreamTruncated(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "event: content_block_delta\ndata: {\"type\":\"content_block_delta\",\"index\":0,\"delta\":{\"type\":\"text_delta\",\"text\":\"Hel\"}}\n\n")
+	}))
+	defer server.Close()
+
+	provider := providers.NewAnthropicProvider()
+	req := &providers.UnifiedRequest{Messages: []providers.Message{{Role: "user", Content: "Hi"}}, Stream: true}
+	providerReq, _ := provider.TranslateRequest(context.Background(), req, newAnthropicDeployment(server.URL))
+
+	stream := make(chan providers.StreamChunk)
+	go provider.Stream(context.Background(), providerReq, stream)
+
+	var last providers.StreamChunk
+	for chunk := range stream {
+		if chunk.Done {
+			t.Fatal("truncated stream reported as done")
+		}
+		last = chunk
+	}
+	pe, ok := providers.AsProviderError(last.Error)
+	if !ok || pe.Type != providers.ErrUpstreamUnavailable {
+		t.Errorf("last chunk error = %v", last.Error)
+	}
+}
+
+func TestAnthropicErrorStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprint(w, `{"type":"error","error":{"type":"authentication_error","message":"invalid x-api-key"}}`)
+	}))
+	defer server.Close()
+
+	provider := providers.NewAnthropicProvider()
+	deployment := newAnthropicDeployment(server.URL)
+	req := &providers.UnifiedRequest{Messages: []providers.Message{{Role: "user", Content: "Hi"}}}
+
+	providerReq, _ := provider.TranslateRequest(context.Background(), req, deployment)
+	resp, err := provider.Execute(context.Background(), providerReq)
+	if err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	if _, err := provider.TranslateResponse(context.Background(), resp, deployment); err == nil {
+		t.Fatal("expected an error for a 401 response")
+	}
+}
+
+func TestAnthropicToolCalls(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Messages []struct {
+				Role    string          `json:"role"`
+				Content json.RawMessage `json:"content"`
+			} `json:"messages"`
+			Tools      []map[string]interface{} `json:"tools"`
+			ToolChoice map[string]interface{}   `json:"tool_choice"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Fatalf("bad request body: %v", err)
+		}
+		if len(body.Tools) != 1 || body.Tools[0]["name"] != "get_weather" || body.Tools[0]["input_schema"] == nil {
+			t.Errorf("tools = %v", body.Tools)
+		}
+		if body.ToolChoice["type"] != "tool" || body.ToolChoice["name"] != "get_weather" {
+			t.Errorf("tool_choice = %v", body.ToolChoice)
+		}
+		if len(body.Messages) != 3 {
+			t.Fatalf("expected 3 messages, got %d", len(body.Messages))
+		}
+		var use, result []map[string]interface{}
+		json.Unmarshal(body.Messages[1].Content, &use)
+		json.Unmarshal(body.Messages[2].Content, &result)
+		if len(use) != 1 || use[0]["type"] != "tool_use" || use[0]["id"] != "toolu_1" {
+			t.Errorf("assistant tool call = %v", use)
+		}
+		if len(result) != 1 || body.Messages[2].Role != "user" || result[0]["tool_use_id"] != "toolu_1" {
+			t.Errorf("tool result = %v", result)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"id":"msg_2","content":[{"type":"tool_use","id":"toolu_2","name":"get_weather","input":{"city":"Oslo"}}],"stop_reason":"tool_use","usage":{"input_tokens":20,"output_tokens":8}}`)
+	}))
+	defer server.Close()
+
+	provider := providers.NewAnthropicProvider()
+	deployment := newAnthropicDeployment(server.URL)
+	req := &providers.UnifiedRequest{
+		Messages: []providers.Message{
+			{Role: "user", Content: "Weather in Paris, then Oslo?"},
+			{Role: "assistant", ToolCalls: []providers.ToolCall{{ID: "toolu_1", Type: "function", Function: providers.FunctionCall{Name: "get_weather", Arguments: `{"city":"Paris"}`}}}},
+			{Role: "tool", ToolCallID: "toolu_1", Content: "18C and sunny"},
+		},
+		Tools:      []providers.Tool{{Type: "function", Function: providers.Function{Name: "get_weather", Description: "Current weather"}}},
+		ToolChoice: map[string]interface{}{"type": "function", "function": map[string]interface{}{"name": "get_weather"}},
+	}
+
+	providerReq, err := provider.TranslateRequest(context.Background(), req, deployment)
+	if err != nil {
+		t.Fatalf("TranslateRequest: %v", err)
+	}
+	resp, err := provider.Execute(context.Background(), providerReq)
+	if err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	unified, err := provider.TranslateResponse(context.Background(), resp, deployment)
+	if err != nil {
+		t.Fatalf("TranslateResponse: %v", err)
+	}
+
+	if got := unified.Choices[0].FinishReason; got != "tool_calls" {
+		t.Errorf("finish_reason = %q", got)
+	}
+	calls := unified.Choices[0].Message.ToolCalls
+	if len(calls) != 1 || calls[0].ID != "toolu_2" || calls[0].Function.Name != "get_weather" || calls[0].Function.Arguments != `{"city":"Oslo"}` {
+		t.Errorf("tool calls = %+v", calls)
+	}
+}
+
+func TestAnthropicStreamToolCall(t *testing.T) {
+	events := []string{
+		`event: message_start
+data: {"type":"message_start","message":{"id":"msg_1","usage":{"input_tokens":5,"output_tokens":1}}}`,
+		`event: content_block_start
+data: {"type":"content_block_start","index":0,"content_block":{"type":"tool_use","id":"toolu_1","name":"get_weather","input":{}}}`,
+		`event: content_block_delta
+data: {"type":"content_block_delta","index":0,"delta":{"type":"input_json_delta","partial_json":"{\"city\":"}}`,
+		`event: content_block_delta
+data: {"type":"content_block_delta","index":0,"delta":{"type":"input_json_delta","partial_json":"\"Paris\"}"}}`,
+		`event: message_delta
+data: {"type":"message_delta","delta":{"stop_reason":"tool_use"},"usage":{"output_tokens":9}}`,
+		`event: message_stop
+data: {"type":"message_stop"}`,
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, e := range events {
+			fmt.Fprintf(w, "%s\n\n", e)
+		}
+	}))
+	defer server.Close()
+
+	provider := providers.NewAnthropicProvider()
+	deployment := newAnthropicDeployment(server.URL)
+	req := &providers.UnifiedRequest{
+		Messages: []providers.Message{{Role: "user", Content: "Weather in Paris?"}},
+		Tools:    []providers.Tool{{Type: "function", Function: providers.Function{Name: "get_weather"}}},
+		Stream:   true,
+	}
+	providerReq, err := provider.TranslateRequest(context.Background(), req, deployment)
+	if err != nil {
+		t.Fatalf("TranslateRequest: %v", err)
+	}
+
+	stream := make(chan providers.StreamChunk)
+	go provider.Stream(context.Background(), providerReq, stream)
+
+	var id, name, arguments, finish string
+	for chunk := range stream {
+		if chunk.Error != nil {
+			t.Fatalf("chunk error: %v", chunk.Error)
+		}
+		for _, delta := range chunk.ToolCalls {
+			if delta.Index != 0 {
+				t.Errorf("delta index = %d", delta.Index)
+			}
+			if delta.ID != "" {
+				id, name = delta.ID, delta.Name
+			}
+			arguments += delta.Arguments
+		}
+		if chunk.FinishReason != "" {
+			finish = chunk.FinishReason
+		}
+	}
+
+	if id != "toolu_1" || name != "get_weather" || arguments != `{"city":"Paris"}` {
+		t.Errorf("tool call = %s %s %s", id, name, arguments)
+	}
+	if finish != "tool_calls" {
+		t.Errorf("finish_reason = %q", finish)
+	}
+}
@@ -0,0 +1,367 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"ch.at/models"
+)
+
+const (
+	azureDefaultAPIVersion    = "2024-06-01"
+	azureDefaultAuthorityHost = "https://login.microsoftonline.com"
+	azureCognitiveScope       = "https://cognitiveservices.azure.com/.default"
+
+	// Refresh Azure AD tokens this long before they actually expire
+	azureTokenRefreshSkew = 5 * time.Minute
+)
+
+// AzureProvider talks to Azure OpenAI deployments directly.
+// URLs are built from the deployment name and api-version, and requests are
+// authenticated with either an api-key header or an Azure AD bearer token.
+type AzureProvider struct {
+	client *http.Client
+
+	// AuthorityHost is the Azure AD endpoint used to mint client-credential
+	// tokens. Defaults to AZURE_AUTHORITY_HOST or the public cloud.
+	AuthorityHost string
+
+	mu     sync.Mutex
+	tokens map[string]azureToken // keyed by tenant/client
+}
+
+// azureToken is a cached Azure AD access token
+type azureToken struct {
+	value     string
+	expiresAt time.Time
+}
+
+// NewAzureProvider creates a new Azure OpenAI provider
+func NewAzureProvider() *AzureProvider {
+	authorityHost := os.Getenv("AZURE_AUTHORITY_HOST")
+	if authorityHost == "" {
+		authorityHost = azureDefaultAuthorityHost
+	}
+
+	return &AzureProvider{
+		client: &http.Client{
+			Timeout: 60 * time.Second,
+		},
+		AuthorityHost: authorityHost,
+		tokens:        make(map[string]azureToken),
+	}
+}
+
+// TranslateRequest converts unified request to an Azure OpenAI deployment call
+func (a *AzureProvider) TranslateRequest(ctx context.Context, req *UnifiedRequest, deployment *models.Deployment) (*ProviderRequest, error) {
+	headers, err := a.headers(ctx, deployment)
+	if err != nil {
+		return nil, err
+	}
+
+	// Azure selects the model from the deployment in the URL, not the body
+	return &ProviderRequest{
+		URL:     azureChatURL(deployment),
+		Method:  "POST",
+		Headers: headers,
+		Body:    buildOpenAIBody(req),
+		Timeout: deployment.Endpoint.Timeout,
+	}, nil
+}
+
+// TranslateEmbeddingRequest converts an embeddings request to an Azure OpenAI deployment call
+func (a *AzureProvider) TranslateEmbeddingRequest(ctx context.Context, req *EmbeddingRequest, deployment *models.Deployment) (*ProviderRequest, error) {
+	headers, err := a.headers(ctx, deployment)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ProviderRequest{
+		URL:     azureURL(deployment, "embeddings"),
+		Method:  "POST",
+		Headers: headers,
+		Body:    buildOpenAIEmbeddingBody(req),
+		Timeout: deployment.Endpoint.Timeout,
+	}, nil
+}
+
+// TranslateEmbeddingResponse converts an Azure OpenAI embeddings response to unified format
+func (a *AzureProvider) TranslateEmbeddingResponse(ctx context.Context, resp *ProviderResponse, deployment *models.Deployment) (*EmbeddingResponse, error) {
+	if resp.StatusCode != http.StatusOK {
+		return nil, newStatusError("azure", resp.StatusCode, resp.Headers, openAIErrorMessage(resp.Body))
+	}
+
+	embeddingResp, err := parseOpenAIEmbeddingResponse(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	setEmbeddingMetadata(embeddingResp, deployment)
+	embeddingResp.Metadata["azure_deployment"] = azureDeploymentName(deployment)
+	return embeddingResp, nil
+}
+
+// EmbeddingHealthCheck performs a health check on an Azure embedding deployment
+func (a *AzureProvider) EmbeddingHealthCheck(ctx context.Context, deployment *models.Deployment) error {
+	return checkEmbeddings(ctx, a, a, deployment)
+}
+
+// headers builds the request headers with an API key or Azure AD token
+func (a *AzureProvider) headers(ctx context.Context, deployment *models.Deployment) (map[string]string, error) {
+	headers := map[string]string{
+		"Content-Type": "application/json",
+	}
+
+	switch deployment.Endpoint.Auth.Type {
+	case models.AuthAzureAD:
+		token, err := a.getToken(ctx, deployment.Endpoint.Auth.AzureCredentials)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get Azure AD token: %w", err)
+		}
+		headers["Authorization"] = "Bearer " + token
+	default:
+		if deployment.Endpoint.Auth.APIKey != "" {
+			headers["api-key"] = deployment.Endpoint.Auth.APIKey
+		}
+	}
+
+	for k, v := range deployment.Endpoint.CustomHeaders {
+		headers[k] = v
+	}
+	return headers, nil
+}
+
+// Execute sends the request to Azure OpenAI
+func (a *AzureProvider) Execute(ctx context.Context, req *ProviderRequest) (*ProviderResponse, error) {
+	return executeRequest(ctx, a.client, req)
+}
+
+// TranslateResponse converts Azure OpenAI response to unified format
+func (a *AzureProvider) TranslateResponse(ctx context.Context, resp *ProviderResponse, deployment *models.Deployment) (*UnifiedResponse, error) {
+	if resp.StatusCode != http.StatusOK {
+		return nil, newStatusError("azure", resp.StatusCode, resp.Headers, openAIErrorMessage(resp.Body))
+	}
+
+	unifiedResp, err := parseOpenAIResponse(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	unifiedResp.Metadata["deployment_id"] = deployment.ID
+	unifiedResp.Metadata["provider"] = string(deployment.Provider)
+	unifiedResp.Metadata["provider_model"] = deployment.ProviderModelID
+	unifiedResp.Metadata["azure_deployment"] = azureDeploymentName(deployment)
+
+	return unifiedResp, nil
+}
+
+// Stream handles streaming responses from Azure OpenAI
+func (a *AzureProvider) Stream(ctx context.Context, req *ProviderRequest, stream chan<- StreamChunk) error {
+	defer close(stream)
+
+	if body, ok := req.Body.(map[string]interface{}); ok {
+		body["stream"] = true
+	}
+
+	httpReq, err := newHTTPRequest(ctx, req)
+	if err != nil {
+		stream <- StreamChunk{Error: err}
+		return err
+	}
+
+	resp, err := a.client.Do(httpReq)
+	if err != nil {
+		err = newTransportError(err)
+		stream <- StreamChunk{Error: err}
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		raw, _ := io.ReadAll(resp.Body)
+		err := newStatusError("azure", resp.StatusCode, flattenHeaders(resp.Header), openAIErrorMessage(raw))
+		stream <- StreamChunk{Error: err}
+		return err
+	}
+
+	return readOpenAIStream(resp.Body, stream)
+}
+
+// ValidateConfig validates Azure deployment configuration
+func (a *AzureProvider) ValidateConfig(deployment *models.Deployment) error {
+	if deployment.Endpoint.BaseURL == "" {
+		return fmt.Errorf("base URL is required (https://<resource>.openai.azure.com)")
+	}
+
+	if azureDeploymentName(deployment) == "" {
+		return fmt.Errorf("deployment name is required")
+	}
+
+	switch deployment.Endpoint.Auth.Type {
+	case models.AuthAzureAD:
+		creds := deployment.Endpoint.Auth.AzureCredentials
+		if creds == nil || creds.TenantID == "" || creds.ClientID == "" || creds.ClientSecret == "" {
+			return fmt.Errorf("azure_ad auth requires tenant_id, client_id and client_secret")
+		}
+	case models.AuthAPIKey:
+		if deployment.Endpoint.Auth.APIKey == "" {
+			return fmt.Errorf("API key is required but not provided")
+		}
+	}
+
+	return nil
+}
+
+// HealthCheck performs a health check on the Azure deployment
+func (a *AzureProvider) HealthCheck(ctx context.Context, deployment *models.Deployment) error {
+	req := &UnifiedRequest{
+		Model: deployment.ProviderModelID,
+		Messages: []Message{
+			{Role: "user", Content: "Hi"},
+		},
+		MaxTokens:   10,
+		Temperature: 0,
+	}
+
+	healthCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	providerReq, err := a.TranslateRequest(healthCtx, req, deployment)
+	if err != nil {
+		return fmt.Errorf("health check translation failed: %w", err)
+	}
+
+	resp, err := a.Execute(healthCtx, providerReq)
+	if err != nil {
+		return fmt.Errorf("health check request failed: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("health check returned status %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+// GetInfo returns provider information
+func (a *AzureProvider) GetInfo() ProviderInfo {
+	return ProviderInfo{
+		Name:           "Azure OpenAI",
+		Version:        azureDefaultAPIVersion,
+		SupportsStream: true,
+		RequiresAuth:   true,
+		MaxRequestSize: 4 * 1024 * 1024, // 4MB
+		RateLimits: map[string]int{
+			"requests_per_minute": 300,
+			"tokens_per_minute":   300000,
+		},
+	}
+}
+
+// getToken returns a cached Azure AD token, requesting a new one when it is
+// missing or about to expire
+func (a *AzureProvider) getToken(ctx context.Context, creds *models.AzureAuth) (string, error) {
+	if creds == nil {
+		return "", fmt.Errorf("azure_ad credentials not configured")
+	}
+
+	key := creds.TenantID + "/" + creds.ClientID
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if token, ok := a.tokens[key]; ok && time.Until(token.expiresAt) > azureTokenRefreshSkew {
+		return token.value, nil
+	}
+
+	token, err := a.requestToken(ctx, creds)
+	if err != nil {
+		return "", err
+	}
+	a.tokens[key] = token
+
+	return token.value, nil
+}
+
+// requestToken performs the OAuth2 client-credentials grant against Azure AD
+func (a *AzureProvider) requestToken(ctx context.Context, creds *models.AzureAuth) (azureToken, error) {
+	tokenURL := strings.TrimSuffix(a.AuthorityHost, "/") + "/" + url.PathEscape(creds.TenantID) + "/oauth2/v2.0/token"
+
+	form := url.Values{
+		"grant_type":    {"client_credentials"},
+		"client_id":     {creds.ClientID},
+		"client_secret": {creds.ClientSecret},
+		"scope":         {azureCognitiveScope},
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return azureToken{}, fmt.Errorf("failed to create token request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := a.client.Do(httpReq)
+	if err != nil {
+		return azureToken{}, fmt.Errorf("token request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var tokenResp struct {
+		AccessToken      string      `json:"access_token"`
+		ExpiresIn        json.Number `json:"expires_in"` // Sometimes sent as a string
+		Error            string      `json:"error"`
+		ErrorDescription string      `json:"error_description"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tokenResp); err != nil {
+		return azureToken{}, fmt.Errorf("failed to decode token response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK || tokenResp.AccessToken == "" {
+		return azureToken{}, newTokenError("azure", resp.StatusCode, strings.TrimSpace(tokenResp.Error+" "+tokenResp.ErrorDescription))
+	}
+
+	expiresIn, _ := strconv.Atoi(tokenResp.ExpiresIn.String())
+	if expiresIn <= 0 {
+		expiresIn = 3600
+	}
+
+	return azureToken{
+		value:     tokenResp.AccessToken,
+		expiresAt: time.Now().Add(time.Duration(expiresIn) * time.Second),
+	}, nil
+}
+
+// azureDeploymentName returns the Azure deployment name, defaulting to the provider model ID
+func azureDeploymentName(deployment *models.Deployment) string {
+	if deployment.Endpoint.DeploymentName != "" {
+		return deployment.Endpoint.DeploymentName
+	}
+	return deployment.ProviderModelID
+}
+
+// azureChatURL builds {base}/openai/deployments/{name}/chat/completions?api-version=...
+func azureChatURL(deployment *models.Deployment) string {
+	return azureURL(deployment, "chat/completions")
+}
+
+// azureURL builds the URL of an operation on the deployment
+func azureURL(deployment *models.Deployment, operation string) string {
+	apiVersion := deployment.Endpoint.APIVersion
+	if apiVersion == "" {
+		apiVersion = azureDefaultAPIVersion
+	}
+
+	return fmt.Sprintf("%s/openai/deployments/%s/%s?api-version=%s",
+		strings.TrimSuffix(deployment.Endpoint.BaseURL, "/"),
+		url.PathEscape(azureDeploymentName(deployment)),
+		operation,
+		url.QueryEscape(apiVersion))
+}
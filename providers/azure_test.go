@@ -0,0 +1,211 @@
+package providers_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"ch.at/models"
+	"ch.at/providers"
+)
+
+const azureCompletion = `{"id":"chatcmpl-1","object":"chat.completion","model":"gpt-4o","choices":[{"index":0,"message":{"role":"assistant","content":"hi there"},"finish_reason":"stop"}],"usage":{"prompt_tokens":3,"completion_tokens":2,"total_tokens":5}}`
+
+func newAzureDeployment(baseURL string, auth models.AuthConfig) *models.Deployment {
+	return &models.Deployment{
+		ID:              "test-azure",
+		ModelID:         "gpt-4o",
+		Provider:        models.ProviderAzure,
+		ProviderModelID: "gpt-4o",
+		Endpoint: models.EndpointConfig{
+			BaseURL:        baseURL,
+			DeploymentName: "prod-gpt4o",
+			APIVersion:     "2024-02-01",
+			Auth:           auth,
+		},
+	}
+}
+
+func azureChat(t *testing.T, provider *providers.AzureProvider, deployment *models.Deployment) *providers.UnifiedResponse {
+	t.Helper()
+
+	req := &providers.UnifiedRequest{Messages: []providers.Message{{Role: "user", Content: "Hi"}}}
+	providerReq, err := provider.TranslateRequest(context.Background(), req, deployment)
+	if err != nil {
+		t.Fatalf("TranslateRequest: %v", err)
+	}
+	resp, err := provider.Execute(context.Background(), providerReq)
+	if err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	unified, err := provider.TranslateResponse(context.Background(), resp, deployment)
+	if err != nil {
+		t.Fatalf("TranslateResponse: %v", err)
+	}
+	return unified
+}
+
+func TestAzureAPIKey(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/openai/deployments/prod-gpt4o/chat/completions" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		if got := r.URL.Query().Get("api-version"); got != "2024-02-01" {
+			t.Errorf("api-version = %q", got)
+		}
+		if got := r.Header.Get("api-key"); got != "azure-key" {
+			t.Errorf("api-key = %q", got)
+		}
+
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		if _, ok := body["model"]; ok {
+			t.Error("model should come from the deployment URL, not the body")
+		}
+
+		fmt.Fprint(w, azureCompletion)
+	}))
+	defer server.Close()
+
+	provider := providers.NewAzureProvider()
+	deployment := newAzureDeployment(server.URL, models.AuthConfig{Type: models.AuthAPIKey, APIKey: "azure-key"})
+
+	unified := azureChat(t, provider, deployment)
+	if got := unified.Choices[0].Message.Content; got != "hi there" {
+		t.Errorf("content = %q", got)
+	}
+	if unified.Metadata["azure_deployment"] != "prod-gpt4o" {
+		t.Errorf("metadata = %v", unified.Metadata)
+	}
+}
+
+func TestAzureADTokenCached(t *testing.T) {
+	var tokenRequests int32
+	tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&tokenRequests, 1)
+		if r.URL.Path != "/tenant-1/oauth2/v2.0/token" {
+			t.Errorf("unexpected token path %s", r.URL.Path)
+		}
+		r.ParseForm()
+		if r.Form.Get("grant_type") != "client_credentials" || r.Form.Get("client_id") != "client-1" || r.Form.Get("client_secret") != "secret-1" {
+			t.Errorf("unexpected token form %v", r.Form)
+		}
+		if r.Form.Get("scope") != "https://cognitiveservices.azure.com/.default" {
+			t.Errorf("scope = %q", r.Form.Get("scope"))
+		}
+		fmt.Fprint(w, `{"token_type":"Bearer","expires_in":3599,"access_token":"aad-token"}`)
+	}))
+	defer tokenServer.Close()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("Authorization"); got != "Bearer aad-token" {
+			t.Errorf("Authorization = %q", got)
+		}
+		if r.Header.Get("api-key") != "" {
+			t.Error("api-key header should not be sent with Azure AD auth")
+		}
+		fmt.Fprint(w, azureCompletion)
+	}))
+	defer server.Close()
+
+	provider := providers.NewAzureProvider()
+	provider.AuthorityHost = tokenServer.URL
+	deployment := newAzureDeployment(server.URL, models.AuthConfig{
+		Type: models.AuthAzureAD,
+		AzureCredentials: &models.AzureAuth{
+			TenantID:     "tenant-1",
+			ClientID:     "client-1",
+			ClientSecret: "secret-1",
+		},
+	})
+
+	if err := provider.ValidateConfig(deployment); err != nil {
+		t.Fatalf("ValidateConfig: %v", err)
+	}
+
+	azureChat(t, provider, deployment)
+	azureChat(t, provider, deployment)
+
+	if n := atomic.LoadInt32(&tokenRequests); n != 1 {
+		t.Errorf("expected the token to be cached, got %d token requests", n)
+	}
+}
+
+func TestAzureADTokenRefreshedNearExpiry(t *testing.T) {
+	var tokenRequests int32
+	tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&tokenRequests, 1)
+		// Expires inside the refresh window, so every call must fetch a new one
+		fmt.Fprintf(w, `{"expires_in":"60","access_token":"aad-token-%d"}`, n)
+	}))
+	defer tokenServer.Close()
+
+	var lastAuth string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lastAuth = r.Header.Get("Authorization")
+		fmt.Fprint(w, azureCompletion)
+	}))
+	defer server.Close()
+
+	provider := providers.NewAzureProvider()
+	provider.AuthorityHost = tokenServer.URL
+	deployment := newAzureDeployment(server.URL, models.AuthConfig{
+		Type:             models.AuthAzureAD,
+		AzureCredentials: &models.AzureAuth{TenantID: "t", ClientID: "c", ClientSecret: "s"},
+	})
+
+	azureChat(t, provider, deployment)
+	azureChat(t, provider, deployment)
+
+	if n := atomic.LoadInt32(&tokenRequests); n != 2 {
+		t.Errorf("expected a refresh for the short-lived token, got %d token requests", n)
+	}
+	if lastAuth != "Bearer aad-token-2" {
+		t.Errorf("Authorization = %q", lastAuth)
+	}
+}
+
+func TestAzureStream(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "data: {\"choices\":[]}\n\n")
+		fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{\"role\":\"assistant\",\"content\":\"Hel\"}}]}\n\n")
+		fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{\"content\":\"lo\"},\"finish_reason\":\"stop\"}]}\n\n")
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	defer server.Close()
+
+	provider := providers.NewAzureProvider()
+	deployment := newAzureDeployment(server.URL, models.AuthConfig{Type: models.AuthAPIKey, APIKey: "azure-key"})
+	req := &providers.UnifiedRequest{Messages: []providers.Message{{Role: "user", Content: "Hi"}}, Stream: true}
+
+	providerReq, err := provider.TranslateRequest(context.Background(), req, deployment)
+	if err != nil {
+		t.Fatalf("TranslateRequest: %v", err)
+	}
+
+	stream := make(chan providers.StreamChunk)
+	go provider.Stream(context.Background(), providerReq, stream)
+
+	var content, finish string
+	for chunk := range stream {
+		if chunk.Error != nil {
+			t.Fatalf("chunk error: %v", chunk.Error)
+		}
+		if chunk.Done {
+			break
+		}
+		content += chunk.Data
+		if chunk.FinishReason != "" {
+			finish = chunk.FinishReason
+		}
+	}
+
+	if content != "Hello" || finish != "stop" {
+		t.Errorf("content = %q, finish_reason = %q", content, finish)
+	}
+}
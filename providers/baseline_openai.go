@@ -1,11 +1,11 @@
 package providers
 
 import (
-	"bufio"
 	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"strings"
 	"time"
@@ -50,6 +50,15 @@ func (b *BaselineOpenAICompatibilityProvider) TranslateRequest(ctx context.Conte
 	if len(req.Stop) > 0 {
 		body["stop"] = req.Stop
 	}
+	if len(req.Tools) > 0 {
+		body["tools"] = req.Tools
+		if req.ToolChoice != nil {
+			body["tool_choice"] = req.ToolChoice
+		}
+	}
+	if req.ResponseFormat != nil {
+		body["response_format"] = req.ResponseFormat
+	}
 
 	// Build headers
 	headers := map[string]string{
@@ -74,53 +83,16 @@ func (b *BaselineOpenAICompatibilityProvider) TranslateRequest(ctx context.Conte
 
 // Execute sends the request to the API
 func (b *BaselineOpenAICompatibilityProvider) Execute(ctx context.Context, req *ProviderRequest) (*ProviderResponse, error) {
-	// Marshal body to JSON
-	jsonBody, err := json.Marshal(req.Body)
-	if err != nil {
-		return nil, fmt.Errorf("failed to marshal request body: %w", err)
-	}
-
-	// Create HTTP request
-	httpReq, err := http.NewRequestWithContext(ctx, req.Method, req.URL, bytes.NewBuffer(jsonBody))
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
-	}
-
-	// Set headers
-	for k, v := range req.Headers {
-		httpReq.Header.Set(k, v)
-	}
-
-	// Execute request
-	resp, err := b.client.Do(httpReq)
-	if err != nil {
-		return nil, fmt.Errorf("request failed: %w", err)
-	}
-	defer resp.Body.Close()
-
-	// Read response body
-	var body json.RawMessage
-	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
-		return nil, fmt.Errorf("failed to decode response: %w", err)
-	}
-
-	// Extract response headers
-	headers := make(map[string]string)
-	for k := range resp.Header {
-		headers[k] = resp.Header.Get(k)
-	}
-
-	return &ProviderResponse{
-		StatusCode: resp.StatusCode,
-		Headers:    headers,
-		Body:       body,
-	}, nil
+	// Gateways can return plain-text or HTML error pages, so the body is not assumed to be JSON
+	return executeRequest(ctx, b.client, req)
 }
 
 // TranslateResponse converts API response to unified format
 func (b *BaselineOpenAICompatibilityProvider) TranslateResponse(ctx context.Context, resp *ProviderResponse, deployment *models.Deployment) (*UnifiedResponse, error) {
-	// Process response
-	
+	if resp.StatusCode != http.StatusOK {
+		return nil, newStatusError("baseline", resp.StatusCode, resp.Headers, openAIErrorMessage(resp.Body))
+	}
+
 	// Parse OpenAI-compatible response format
 	var unifiedResp UnifiedResponse
 	if err := json.Unmarshal(resp.Body, &unifiedResp); err != nil {
@@ -167,57 +139,21 @@ func (b *BaselineOpenAICompatibilityProvider) Stream(ctx context.Context, req *P
 
 	resp, err := b.client.Do(httpReq)
 	if err != nil {
+		err = newTransportError(err)
 		stream <- StreamChunk{Error: err}
 		return err
 	}
 	defer resp.Body.Close()
 
-	// Parse SSE stream (Server-Sent Events format)
-	scanner := bufio.NewScanner(resp.Body)
-	for scanner.Scan() {
-		line := scanner.Text()
-		
-		// SSE lines start with "data: "
-		if strings.HasPrefix(line, "data: ") {
-			data := strings.TrimPrefix(line, "data: ")
-			
-			// Check for stream end
-			if data == "[DONE]" {
-				stream <- StreamChunk{Done: true}
-				return nil
-			}
-			
-			// Parse the JSON to extract content
-			var chunk map[string]interface{}
-			if err := json.Unmarshal([]byte(data), &chunk); err != nil {
-				// Skip malformed JSON
-				continue
-			}
-			
-			// Extract the actual content from the chunk
-			// Format: {"choices": [{"delta": {"content": "text"}}]}
-			if choices, ok := chunk["choices"].([]interface{}); ok && len(choices) > 0 {
-				if choice, ok := choices[0].(map[string]interface{}); ok {
-					if delta, ok := choice["delta"].(map[string]interface{}); ok {
-						if content, ok := delta["content"].(string); ok && content != "" {
-							// Send ONLY the actual text content
-							stream <- StreamChunk{
-								Data: content,
-								Done: false,
-							}
-						}
-					}
-				}
-			}
-		}
-	}
-	
-	if err := scanner.Err(); err != nil {
+	if resp.StatusCode != http.StatusOK {
+		raw, _ := io.ReadAll(resp.Body)
+		err := newStatusError("baseline", resp.StatusCode, flattenHeaders(resp.Header), openAIErrorMessage(raw))
 		stream <- StreamChunk{Error: err}
 		return err
 	}
-	
-	return nil
+
+	// Parse SSE stream (Server-Sent Events format)
+	return readOpenAIStream(resp.Body, stream)
 }
 
 // ValidateConfig validates deployment configuration
@@ -0,0 +1,534 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"ch.at/models"
+)
+
+const (
+	bedrockDefaultRegion = "us-east-1"
+	bedrockService       = "bedrock"
+)
+
+// BedrockProvider calls the AWS Bedrock Converse and ConverseStream APIs
+// directly, signing each request with SigV4
+type BedrockProvider struct {
+	client *http.Client
+}
+
+// NewBedrockProvider creates a new Bedrock provider
+func NewBedrockProvider() *BedrockProvider {
+	return &BedrockProvider{
+		client: &http.Client{
+			Timeout: 60 * time.Second,
+		},
+	}
+}
+
+// TranslateRequest converts unified request to a signed Converse call.
+// Requests are signed here, so the body is encoded to bytes up front and
+// Stream must not modify it; req.Stream selects /converse-stream instead.
+func (b *BedrockProvider) TranslateRequest(ctx context.Context, req *UnifiedRequest, deployment *models.Deployment) (*ProviderRequest, error) {
+	if err := inlineImagesOnly(req, "bedrock"); err != nil {
+		return nil, err
+	}
+	body, err := json.Marshal(buildBedrockBody(req))
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request body: %w", err)
+	}
+
+	action := "converse"
+	if req.Stream {
+		action = "converse-stream"
+	}
+
+	region := bedrockRegion(deployment)
+	url := fmt.Sprintf("%s/model/%s/%s", bedrockBaseURL(deployment, region), awsURIEncode(deployment.ProviderModelID), action)
+
+	headers := map[string]string{
+		"Content-Type": "application/json",
+	}
+	for k, v := range deployment.Endpoint.CustomHeaders {
+		headers[k] = v
+	}
+
+	if err := signSigV4("POST", url, headers, body, deployment.Endpoint.Auth.AWSCredentials, region, bedrockService, time.Now()); err != nil {
+		return nil, fmt.Errorf("failed to sign request: %w", err)
+	}
+
+	return &ProviderRequest{
+		URL:     url,
+		Method:  "POST",
+		Headers: headers,
+		Body:    body,
+		Timeout: deployment.Endpoint.Timeout,
+	}, nil
+}
+
+// Execute sends the request to Bedrock
+func (b *BedrockProvider) Execute(ctx context.Context, req *ProviderRequest) (*ProviderResponse, error) {
+	return executeRequest(ctx, b.client, req)
+}
+
+// TranslateResponse converts a Converse response to unified format
+func (b *BedrockProvider) TranslateResponse(ctx context.Context, resp *ProviderResponse, deployment *models.Deployment) (*UnifiedResponse, error) {
+	if resp.StatusCode != http.StatusOK {
+		return nil, newStatusError("bedrock", resp.StatusCode, resp.Headers, bedrockErrorMessage(resp.Body))
+	}
+
+	var converse struct {
+		Output struct {
+			Message struct {
+				Role    string `json:"role"`
+				Content []struct {
+					Text    string `json:"text"`
+					ToolUse *struct {
+						ToolUseID string          `json:"toolUseId"`
+						Name      string          `json:"name"`
+						Input     json.RawMessage `json:"input"`
+					} `json:"toolUse"`
+				} `json:"content"`
+			} `json:"message"`
+		} `json:"output"`
+		StopReason string       `json:"stopReason"`
+		Usage      bedrockUsage `json:"usage"`
+	}
+	if err := json.Unmarshal(resp.Body, &converse); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	var text strings.Builder
+	var toolCalls []ToolCall
+	for _, block := range converse.Output.Message.Content {
+		text.WriteString(block.Text)
+		if block.ToolUse != nil {
+			toolCalls = append(toolCalls, ToolCall{
+				ID:       block.ToolUse.ToolUseID,
+				Type:     "function",
+				Function: FunctionCall{Name: block.ToolUse.Name, Arguments: string(block.ToolUse.Input)},
+			})
+		}
+	}
+
+	id := resp.Headers["X-Amzn-Requestid"]
+	if id == "" {
+		id = fmt.Sprintf("bedrock-%d", time.Now().UnixNano())
+	}
+
+	return &UnifiedResponse{
+		ID:      id,
+		Object:  "chat.completion",
+		Created: time.Now().Unix(),
+		Model:   deployment.ProviderModelID,
+		Choices: []Choice{{
+			Index: 0,
+			Message: Message{
+				Role:      "assistant",
+				Content:   text.String(),
+				ToolCalls: toolCalls,
+			},
+			FinishReason: bedrockFinishReason(converse.StopReason),
+		}},
+		Usage: converse.Usage.unified(),
+		Metadata: map[string]interface{}{
+			"deployment_id":  deployment.ID,
+			"provider":       string(deployment.Provider),
+			"provider_model": deployment.ProviderModelID,
+		},
+	}, nil
+}
+
+// Stream decodes the ConverseStream event-stream into stream chunks
+func (b *BedrockProvider) Stream(ctx context.Context, req *ProviderRequest, stream chan<- StreamChunk) error {
+	defer close(stream)
+
+	if !strings.HasSuffix(req.URL, "/converse-stream") {
+		err := fmt.Errorf("bedrock stream requires a request translated with Stream set")
+		stream <- StreamChunk{Error: err}
+		return err
+	}
+
+	httpReq, err := newHTTPRequest(ctx, req)
+	if err != nil {
+		stream <- StreamChunk{Error: err}
+		return err
+	}
+
+	resp, err := b.client.Do(httpReq)
+	if err != nil {
+		err = newTransportError(err)
+		stream <- StreamChunk{Error: err}
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		raw, _ := io.ReadAll(resp.Body)
+		err := newStatusError("bedrock", resp.StatusCode, flattenHeaders(resp.Header), bedrockErrorMessage(raw))
+		stream <- StreamChunk{Error: err}
+		return err
+	}
+
+	return readBedrockStream(resp.Body, stream)
+}
+
+// ValidateConfig validates Bedrock deployment configuration
+func (b *BedrockProvider) ValidateConfig(deployment *models.Deployment) error {
+	if deployment.ProviderModelID == "" {
+		return fmt.Errorf("provider model ID is required")
+	}
+
+	creds := deployment.Endpoint.Auth.AWSCredentials
+	if creds == nil || creds.AccessKeyID == "" || creds.SecretAccessKey == "" {
+		return fmt.Errorf("AWS access key ID and secret access key are required")
+	}
+
+	return nil
+}
+
+// HealthCheck performs a minimal Converse call
+func (b *BedrockProvider) HealthCheck(ctx context.Context, deployment *models.Deployment) error {
+	req := &UnifiedRequest{
+		Model: deployment.ProviderModelID,
+		Messages: []Message{
+			{Role: "user", Content: "Hi"},
+		},
+		MaxTokens:   10,
+		Temperature: 0,
+	}
+
+	providerReq, err := b.TranslateRequest(ctx, req, deployment)
+	if err != nil {
+		return fmt.Errorf("health check translation failed: %w", err)
+	}
+
+	healthCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	resp, err := b.Execute(healthCtx, providerReq)
+	if err != nil {
+		return fmt.Errorf("health check request failed: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("health check returned status %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+// GetInfo returns provider information
+func (b *BedrockProvider) GetInfo() ProviderInfo {
+	return ProviderInfo{
+		Name:           "AWS Bedrock Converse",
+		Version:        "converse",
+		SupportsStream: true,
+		RequiresAuth:   true,
+		MaxRequestSize: 20 * 1024 * 1024, // 20MB
+		RateLimits: map[string]int{
+			"requests_per_minute": 50,
+			"tokens_per_minute":   200000,
+		},
+	}
+}
+
+// buildBedrockBody converts messages to the Converse shape: system prompts
+// move to the top-level "system" list and consecutive same-role turns are
+// merged, since Converse requires alternating user/assistant messages
+func buildBedrockBody(req *UnifiedRequest) map[string]interface{} {
+	var system []map[string]string
+	var messages []map[string]interface{}
+
+	for _, msg := range req.Messages {
+		if msg.Role == "system" {
+			if msg.Content != "" {
+				system = append(system, map[string]string{"text": msg.Content})
+			}
+			continue
+		}
+
+		role := msg.Role
+		if role != "assistant" {
+			role = "user"
+		}
+
+		var blocks []interface{}
+		switch {
+		case msg.Role == "tool":
+			blocks = append(blocks, map[string]interface{}{
+				"toolResult": map[string]interface{}{
+					"toolUseId": msg.ToolCallID,
+					"content":   []map[string]string{{"text": msg.Content}},
+				},
+			})
+		case len(msg.Parts) > 0:
+			for _, part := range msg.Parts {
+				switch part.Type {
+				case ContentTypeText:
+					if part.Text != "" {
+						blocks = append(blocks, map[string]string{"text": part.Text})
+					}
+				case ContentTypeImage:
+					// Checked by TranslateRequest, only data URLs get here
+					mediaType, data, _ := parseDataURL(part.ImageURL.URL)
+					blocks = append(blocks, map[string]interface{}{
+						"image": map[string]interface{}{
+							"format": strings.TrimPrefix(mediaType, "image/"),
+							"source": map[string]string{"bytes": data},
+						},
+					})
+				}
+			}
+			fallthrough
+		default:
+			// Converse rejects empty text blocks
+			if len(msg.Parts) == 0 && msg.Content != "" {
+				blocks = append(blocks, map[string]string{"text": msg.Content})
+			}
+			for _, call := range msg.ToolCalls {
+				blocks = append(blocks, map[string]interface{}{
+					"toolUse": map[string]interface{}{
+						"toolUseId": call.ID,
+						"name":      call.Function.Name,
+						"input":     toolArguments(call.Function.Arguments),
+					},
+				})
+			}
+		}
+		if len(blocks) == 0 {
+			// Nor does it take messages without content
+			continue
+		}
+
+		if n := len(messages); n > 0 && messages[n-1]["role"] == role {
+			messages[n-1]["content"] = append(messages[n-1]["content"].([]interface{}), blocks...)
+			continue
+		}
+
+		messages = append(messages, map[string]interface{}{
+			"role":    role,
+			"content": blocks,
+		})
+	}
+
+	body := map[string]interface{}{
+		"messages": messages,
+	}
+	if len(system) > 0 {
+		body["system"] = system
+	}
+
+	inference := map[string]interface{}{}
+	if req.MaxTokens > 0 {
+		inference["maxTokens"] = req.MaxTokens
+	}
+	if req.Temperature > 0 {
+		inference["temperature"] = req.Temperature
+	}
+	if req.TopP > 0 {
+		inference["topP"] = req.TopP
+	}
+	if len(req.Stop) > 0 {
+		inference["stopSequences"] = req.Stop
+	}
+	if len(inference) > 0 {
+		body["inferenceConfig"] = inference
+	}
+
+	// Converse has no "none" tool choice, so tools are left out instead
+	if mode, name := toolChoice(req.ToolChoice); req.HasTools() && mode != toolChoiceNone {
+		var tools []map[string]interface{}
+		for _, fn := range toolFunctions(req) {
+			tools = append(tools, map[string]interface{}{
+				"toolSpec": map[string]interface{}{
+					"name":        fn.Name,
+					"description": fn.Description,
+					"inputSchema": map[string]interface{}{"json": toolParameters(fn)},
+				},
+			})
+		}
+		toolConfig := map[string]interface{}{"tools": tools}
+
+		switch mode {
+		case toolChoiceRequired:
+			toolConfig["toolChoice"] = map[string]interface{}{"any": map[string]interface{}{}}
+		case toolChoiceFunction:
+			toolConfig["toolChoice"] = map[string]interface{}{"tool": map[string]string{"name": name}}
+		}
+		body["toolConfig"] = toolConfig
+	}
+
+	return body
+}
+
+// bedrockUsage is the Converse token accounting block
+type bedrockUsage struct {
+	InputTokens  int `json:"inputTokens"`
+	OutputTokens int `json:"outputTokens"`
+	TotalTokens  int `json:"totalTokens"`
+}
+
+func (u bedrockUsage) unified() Usage {
+	total := u.TotalTokens
+	if total == 0 {
+		total = u.InputTokens + u.OutputTokens
+	}
+	return Usage{
+		PromptTokens:     u.InputTokens,
+		CompletionTokens: u.OutputTokens,
+		TotalTokens:      total,
+	}
+}
+
+// readBedrockStream turns ConverseStream events into stream chunks.
+// messageStop carries the stop reason but usage only arrives in the trailing
+// metadata event, so the finish chunk is held until then.
+func readBedrockStream(r io.Reader, stream chan<- StreamChunk) error {
+	var finishReason string
+	finishSent := false
+	toolIndex := map[int]int{} // content block index -> tool call index
+
+	for {
+		msg, err := readEventStreamMessage(r)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			stream <- StreamChunk{Error: err}
+			return err
+		}
+
+		if msg.Headers[":message-type"] == "exception" || msg.Headers[":message-type"] == "error" {
+			kind := msg.Headers[":exception-type"]
+			if kind == "" {
+				kind = msg.Headers[":error-code"]
+			}
+			err := newStreamError("bedrock", kind, bedrockExceptionStatus(kind), bedrockErrorMessage(msg.Payload))
+			stream <- StreamChunk{Error: err}
+			return err
+		}
+
+		var event struct {
+			ContentBlockIndex int `json:"contentBlockIndex"`
+			Start             struct {
+				ToolUse *struct {
+					ToolUseID string `json:"toolUseId"`
+					Name      string `json:"name"`
+				} `json:"toolUse"`
+			} `json:"start"`
+			Delta struct {
+				Text    string `json:"text"`
+				ToolUse *struct {
+					Input string `json:"input"`
+				} `json:"toolUse"`
+			} `json:"delta"`
+			StopReason string       `json:"stopReason"`
+			Usage      bedrockUsage `json:"usage"`
+		}
+		if err := json.Unmarshal(msg.Payload, &event); err != nil {
+			// Skip malformed JSON
+			continue
+		}
+
+		switch msg.Headers[":event-type"] {
+		case "contentBlockStart":
+			if event.Start.ToolUse != nil {
+				index := len(toolIndex)
+				toolIndex[event.ContentBlockIndex] = index
+				stream <- StreamChunk{ToolCalls: []ToolCallDelta{{Index: index, ID: event.Start.ToolUse.ToolUseID, Name: event.Start.ToolUse.Name}}}
+			}
+		case "contentBlockDelta":
+			if event.Delta.Text != "" {
+				stream <- StreamChunk{Data: event.Delta.Text}
+			}
+			if event.Delta.ToolUse != nil && event.Delta.ToolUse.Input != "" {
+				stream <- StreamChunk{ToolCalls: []ToolCallDelta{{Index: toolIndex[event.ContentBlockIndex], Arguments: event.Delta.ToolUse.Input}}}
+			}
+		case "messageStop":
+			finishReason = bedrockFinishReason(event.StopReason)
+		case "metadata":
+			usage := event.Usage.unified()
+			stream <- StreamChunk{FinishReason: finishReason, Usage: &usage}
+			finishSent = true
+		}
+	}
+
+	if !finishSent && finishReason != "" {
+		stream <- StreamChunk{FinishReason: finishReason}
+	}
+	stream <- StreamChunk{Done: true}
+	return nil
+}
+
+// bedrockFinishReason maps Converse stop reasons to OpenAI finish reasons
+func bedrockFinishReason(stopReason string) string {
+	switch stopReason {
+	case "max_tokens":
+		return "length"
+	case "tool_use":
+		return "tool_calls"
+	case "guardrail_intervened", "content_filtered":
+		return "content_filter"
+	case "end_turn", "stop_sequence":
+		return "stop"
+	default:
+		return stopReason
+	}
+}
+
+// bedrockExceptionStatus maps a ConverseStream exception type to the HTTP
+// status the same error has on a plain Converse call
+func bedrockExceptionStatus(kind string) int {
+	switch kind {
+	case "throttlingException":
+		return http.StatusTooManyRequests
+	case "validationException":
+		return http.StatusBadRequest
+	case "accessDeniedException":
+		return http.StatusForbidden
+	case "modelTimeoutException":
+		return http.StatusRequestTimeout
+	case "serviceUnavailableException":
+		return http.StatusServiceUnavailable
+	default:
+		// internalServerException, modelStreamErrorException
+		return http.StatusInternalServerError
+	}
+}
+
+// bedrockErrorMessage extracts the message from a Bedrock error body
+func bedrockErrorMessage(body []byte) string {
+	var errResp struct {
+		Message string `json:"message"`
+	}
+	if err := json.Unmarshal(body, &errResp); err == nil && errResp.Message != "" {
+		return errResp.Message
+	}
+	return string(body)
+}
+
+// bedrockRegion picks the region from the endpoint, then the credentials
+func bedrockRegion(deployment *models.Deployment) string {
+	if deployment.Endpoint.Region != "" {
+		return deployment.Endpoint.Region
+	}
+	if creds := deployment.Endpoint.Auth.AWSCredentials; creds != nil && creds.Region != "" {
+		return creds.Region
+	}
+	return bedrockDefaultRegion
+}
+
+// bedrockBaseURL returns the configured endpoint or the regional runtime endpoint
+func bedrockBaseURL(deployment *models.Deployment, region string) string {
+	if deployment.Endpoint.BaseURL != "" {
+		return strings.TrimSuffix(deployment.Endpoint.BaseURL, "/")
+	}
+	return "https://bedrock-runtime." + region + ".amazonaws.com"
+}
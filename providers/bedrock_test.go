@@ -0,0 +1,248 @@
+package providers_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"ch.at/models"
+	"ch.at/providers"
+)
+
+func newBedrockDeployment(baseURL string) *models.Deployment {
+	return &models.Deployment{
+		ID:              "test-bedrock",
+		ModelID:         "claude-3.5-haiku",
+		Provider:        models.ProviderBedrock,
+		ProviderModelID: "anthropic.claude-3-5-haiku-20241022-v1:0",
+		Endpoint: models.EndpointConfig{
+			BaseURL: baseURL,
+			Region:  "us-west-2",
+			Auth: models.AuthConfig{
+				Type: models.AuthAWS,
+				AWSCredentials: &models.AWSAuth{
+					AccessKeyID:     "AKIDEXAMPLE",
+					SecretAccessKey: "secret",
+					SessionToken:    "session",
+				},
+			},
+		},
+	}
+}
+
+// encodeEventStreamFrame builds one binary event-stream frame with string headers
+func encodeEventStreamFrame(headers map[string]string, payload string) []byte {
+	var hdr bytes.Buffer
+	for name, value := range headers {
+		hdr.WriteByte(byte(len(name)))
+		hdr.WriteString(name)
+		hdr.WriteByte(7) // string
+		binary.Write(&hdr, binary.BigEndian, uint16(len(value)))
+		hdr.WriteString(value)
+	}
+
+	total := uint32(12 + hdr.Len() + len(payload) + 4)
+	var frame bytes.Buffer
+	binary.Write(&frame, binary.BigEndian, total)
+	binary.Write(&frame, binary.BigEndian, uint32(hdr.Len()))
+	binary.Write(&frame, binary.BigEndian, crc32.ChecksumIEEE(frame.Bytes()))
+	frame.Write(hdr.Bytes())
+	frame.WriteString(payload)
+	binary.Write(&frame, binary.BigEndian, crc32.ChecksumIEEE(frame.Bytes()))
+	return frame.Bytes()
+}
+
+func bedrockEvent(eventType, payload string) []byte {
+	return encodeEventStreamFrame(map[string]string{
+		":message-type": "event",
+		":event-type":   eventType,
+		":content-type": "application/json",
+	}, payload)
+}
+
+func TestBedrockConverseSigned(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The colon in the model ID must be percent-encoded on the wire
+		if r.RequestURI != "/model/anthropic.claude-3-5-haiku-20241022-v1%3A0/converse" {
+			t.Errorf("unexpected request URI %s", r.RequestURI)
+		}
+
+		auth := r.Header.Get("Authorization")
+		if !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/") ||
+			!strings.Contains(auth, "/us-west-2/bedrock/aws4_request") ||
+			!strings.Contains(auth, "SignedHeaders=content-type;host;x-amz-date;x-amz-security-token") {
+			t.Errorf("unexpected Authorization %q", auth)
+		}
+		if r.Header.Get("X-Amz-Date") == "" || r.Header.Get("X-Amz-Security-Token") != "session" {
+			t.Error("missing SigV4 date or session token header")
+		}
+
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		if system := body["system"].([]interface{}); len(system) != 1 {
+			t.Errorf("system = %v", body["system"])
+		}
+		if cfg := body["inferenceConfig"].(map[string]interface{}); cfg["maxTokens"] != float64(50) {
+			t.Errorf("inferenceConfig = %v", cfg)
+		}
+
+		w.Header().Set("x-amzn-RequestId", "req-123")
+		fmt.Fprint(w, `{"output":{"message":{"role":"assistant","content":[{"text":"hello"}]}},"stopReason":"end_turn","usage":{"inputTokens":4,"outputTokens":1,"totalTokens":5}}`)
+	}))
+	defer server.Close()
+
+	provider := providers.NewBedrockProvider()
+	deployment := newBedrockDeployment(server.URL)
+	req := &providers.UnifiedRequest{
+		Messages: []providers.Message{
+			{Role: "system", Content: "Be terse."},
+			{Role: "user", Content: "Hi"},
+		},
+		MaxTokens: 50,
+	}
+
+	providerReq, err := provider.TranslateRequest(context.Background(), req, deployment)
+	if err != nil {
+		t.Fatalf("TranslateRequest: %v", err)
+	}
+	resp, err := provider.Execute(context.Background(), providerReq)
+	if err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	unified, err := provider.TranslateResponse(context.Background(), resp, deployment)
+	if err != nil {
+		t.Fatalf("TranslateResponse: %v", err)
+	}
+
+	if unified.ID != "req-123" {
+		t.Errorf("id = %q", unified.ID)
+	}
+	if got := unified.Choices[0].Message.Content; got != "hello" {
+		t.Errorf("content = %q", got)
+	}
+	if unified.Choices[0].FinishReason != "stop" || unified.Usage.TotalTokens != 5 {
+		t.Errorf("finish_reason = %q, usage = %+v", unified.Choices[0].FinishReason, unified.Usage)
+	}
+}
+
+func TestBedrockConverseStream(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasSuffix(r.URL.Path, "/converse-stream") {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		w.Header().Set("Content-Type", "application/vnd.amazon.eventstream")
+		w.Write(bedrockEvent("messageStart", `{"role":"assistant"}`))
+		w.Write(bedrockEvent("contentBlockDelta", `{"contentBlockIndex":0,"delta":{"text":"Hel"}}`))
+		w.Write(bedrockEvent("contentBlockDelta", `{"contentBlockIndex":0,"delta":{"text":"lo"}}`))
+		w.Write(bedrockEvent("contentBlockStop", `{"contentBlockIndex":0}`))
+		w.Write(bedrockEvent("messageStop", `{"stopReason":"max_tokens"}`))
+		w.Write(bedrockEvent("metadata", `{"usage":{"inputTokens":3,"outputTokens":2,"totalTokens":5},"metrics":{"latencyMs":12}}`))
+	}))
+	defer server.Close()
+
+	provider := providers.NewBedrockProvider()
+	deployment := newBedrockDeployment(server.URL)
+	req := &providers.UnifiedRequest{Messages: []providers.Message{{Role: "user", Content: "Hi"}}, Stream: true}
+
+	providerReq, err := provider.TranslateRequest(context.Background(), req, deployment)
+	if err != nil {
+		t.Fatalf("TranslateRequest: %v", err)
+	}
+
+	stream := make(chan providers.StreamChunk)
+	go provider.Stream(context.Background(), providerReq, stream)
+
+	var content, finish string
+	var usage *providers.Usage
+	done := false
+	for chunk := range stream {
+		if chunk.Error != nil {
+			t.Fatalf("chunk error: %v", chunk.Error)
+		}
+		if chunk.Done {
+			done = true
+			break
+		}
+		content += chunk.Data
+		if chunk.FinishReason != "" {
+			finish = chunk.FinishReason
+			usage = chunk.Usage
+		}
+	}
+
+	if !done {
+		t.Error("stream ended without a Done chunk")
+	}
+	if content != "Hello" || finish != "length" {
+		t.Errorf("content = %q, finish_reason = %q", content, finish)
+	}
+	if usage == nil || usage.TotalTokens != 5 {
+		t.Errorf("usage = %+v", usage)
+	}
+}
+
+func TestBedrockStreamException(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(bedrockEvent("contentBlockDelta", `{"delta":{"text":"partial"}}`))
+		w.Write(encodeEventStreamFrame(map[string]string{
+			":message-type":   "exception",
+			":exception-type": "throttlingException",
+		}, `{"message":"Too many requests"}`))
+	}))
+	defer server.Close()
+
+	provider := providers.NewBedrockProvider()
+	req := &providers.UnifiedRequest{Messages: []providers.Message{{Role: "user", Content: "Hi"}}, Stream: true}
+	providerReq, err := provider.TranslateRequest(context.Background(), req, newBedrockDeployment(server.URL))
+	if err != nil {
+		t.Fatalf("TranslateRequest: %v", err)
+	}
+
+	stream := make(chan providers.StreamChunk)
+	go provider.Stream(context.Background(), providerReq, stream)
+
+	var streamErr error
+	for chunk := range stream {
+		if chunk.Error != nil {
+			streamErr = chunk.Error
+		}
+	}
+	if streamErr == nil || !strings.Contains(streamErr.Error(), "throttlingException") {
+		t.Errorf("expected throttling error, got %v", streamErr)
+	}
+}
+
+func TestBedrockSkipsEmptyText(t *testing.T) {
+	provider := providers.NewBedrockProvider()
+	req := &providers.UnifiedRequest{
+		Messages: []providers.Message{
+			{Role: "user", Content: "Hi"},
+			{Role: "assistant", Content: ""},
+			{Role: "user", Content: "Still there?"},
+		},
+	}
+	providerReq, err := provider.TranslateRequest(context.Background(), req, newBedrockDeployment("http://bedrock.invalid"))
+	if err != nil {
+		t.Fatalf("TranslateRequest: %v", err)
+	}
+
+	raw := providerReq.Body.([]byte)
+	if strings.Contains(string(raw), `"text":""`) {
+		t.Errorf("empty text block sent: %s", raw)
+	}
+	// With the empty turn gone, the user turns merge into one message
+	var body struct {
+		Messages []json.RawMessage `json:"messages"`
+	}
+	json.Unmarshal(raw, &body)
+	if len(body.Messages) != 1 {
+		t.Errorf("messages = %s", raw)
+	}
+}
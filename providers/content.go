@@ -0,0 +1,154 @@
+package providers
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"path"
+	"strings"
+)
+
+// Content part types, as in OpenAI content arrays
+const (
+	ContentTypeText  = "text"
+	ContentTypeImage = "image_url"
+)
+
+// ContentPart is one part of a multimodal message
+type ContentPart struct {
+	Type     string    `json:"type"`
+	Text     string    `json:"text,omitempty"`
+	ImageURL *ImageURL `json:"image_url,omitempty"`
+}
+
+// ImageURL points at an image, either an http(s) URL or a base64 data URL
+type ImageURL struct {
+	URL    string `json:"url"`
+	Detail string `json:"detail,omitempty"` // "auto", "low" or "high"; OpenAI only
+}
+
+// HasImages reports whether the message carries any image parts
+func (m Message) HasImages() bool {
+	for _, part := range m.Parts {
+		if part.Type == ContentTypeImage {
+			return true
+		}
+	}
+	return false
+}
+
+// HasImages reports whether any message in the request carries an image
+func (r *UnifiedRequest) HasImages() bool {
+	for _, msg := range r.Messages {
+		if msg.HasImages() {
+			return true
+		}
+	}
+	return false
+}
+
+// MarshalJSON writes content as a part array when the message has parts,
+// and as a plain string otherwise
+func (m Message) MarshalJSON() ([]byte, error) {
+	type plain Message
+	if len(m.Parts) == 0 {
+		return json.Marshal(plain(m))
+	}
+	return json.Marshal(struct {
+		plain
+		Content []ContentPart `json:"content"`
+	}{plain(m), m.Parts})
+}
+
+// UnmarshalJSON accepts content as a string, null, or a part array. For a
+// part array, Content is set to the text parts joined by newlines so that
+// text-only code paths still see the prompt.
+func (m *Message) UnmarshalJSON(data []byte) error {
+	type plain Message
+	var raw struct {
+		plain
+		Content json.RawMessage `json:"content"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	*m = Message(raw.plain)
+
+	content := strings.TrimSpace(string(raw.Content))
+	switch {
+	case content == "" || content == "null":
+		return nil
+	case content[0] == '"':
+		return json.Unmarshal(raw.Content, &m.Content)
+	}
+
+	if err := json.Unmarshal(raw.Content, &m.Parts); err != nil {
+		return fmt.Errorf("message content must be a string or an array of content parts")
+	}
+	var text []string
+	for _, part := range m.Parts {
+		switch part.Type {
+		case ContentTypeText:
+			text = append(text, part.Text)
+		case ContentTypeImage:
+			if part.ImageURL == nil || part.ImageURL.URL == "" {
+				return fmt.Errorf("image_url content part is missing its url")
+			}
+			if strings.HasPrefix(part.ImageURL.URL, "data:") {
+				if _, _, ok := parseDataURL(part.ImageURL.URL); !ok {
+					return fmt.Errorf("image data URLs must be base64 encoded, as data:<media type>;base64,<data>")
+				}
+			}
+		default:
+			return fmt.Errorf("unsupported content part type %q", part.Type)
+		}
+	}
+	m.Content = strings.Join(text, "\n")
+	return nil
+}
+
+// parseDataURL splits a base64 data URL into its media type and payload
+func parseDataURL(url string) (mediaType, data string, ok bool) {
+	rest, found := strings.CutPrefix(url, "data:")
+	if !found {
+		return "", "", false
+	}
+	header, data, found := strings.Cut(rest, ",")
+	if !found || !strings.HasSuffix(header, ";base64") {
+		return "", "", false
+	}
+	mediaType = strings.TrimSuffix(header, ";base64")
+	if mediaType == "" {
+		mediaType = "image/jpeg"
+	}
+	return mediaType, data, true
+}
+
+// imageMediaType guesses an image URL's media type from its extension
+func imageMediaType(url string) string {
+	if mediaType := mime.TypeByExtension(path.Ext(strings.SplitN(url, "?", 2)[0])); strings.HasPrefix(mediaType, "image/") {
+		return mediaType
+	}
+	return "image/jpeg"
+}
+
+// inlineImagesOnly rejects image URLs for providers that can only take
+// images inline, since fetching them here would make the gateway an open proxy.
+// Other deployments may take the URL, so the request falls back to them.
+func inlineImagesOnly(req *UnifiedRequest, provider string) error {
+	for _, msg := range req.Messages {
+		for _, part := range msg.Parts {
+			if part.Type != ContentTypeImage {
+				continue
+			}
+			if _, _, ok := parseDataURL(part.ImageURL.URL); !ok {
+				return &ProviderError{
+					Type:     ErrUnsupported,
+					Provider: provider,
+					Message:  provider + " only accepts images as base64 data URLs",
+				}
+			}
+		}
+	}
+	return nil
+}
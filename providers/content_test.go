@@ -0,0 +1,107 @@
+package providers_test
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"ch.at/providers"
+)
+
+const pixel = "data:image/png;base64,iVBORw0KGgo="
+
+func TestMessageContentParts(t *testing.T) {
+	var msg providers.Message
+	data := `{"role":"user","content":[{"type":"text","text":"What is this?"},{"type":"image_url","image_url":{"url":"` + pixel + `","detail":"low"}}]}`
+	if err := json.Unmarshal([]byte(data), &msg); err != nil {
+		t.Fatal(err)
+	}
+	if msg.Content != "What is this?" || len(msg.Parts) != 2 || !msg.HasImages() {
+		t.Fatalf("decoded %+v", msg)
+	}
+
+	// Parts survive a round trip for OpenAI-compatible upstreams
+	encoded, _ := json.Marshal(msg)
+	if !strings.Contains(string(encoded), `"content":[{"type":"text"`) || !strings.Contains(string(encoded), `"detail":"low"`) {
+		t.Errorf("encoded %s", encoded)
+	}
+
+	// Plain strings still work and stay strings
+	if err := json.Unmarshal([]byte(`{"role":"user","content":"hi"}`), &msg); err != nil || msg.Content != "hi" || msg.Parts != nil {
+		t.Errorf("decoded %+v, err = %v", msg, err)
+	}
+	encoded, _ = json.Marshal(msg)
+	if !strings.Contains(string(encoded), `"content":"hi"`) {
+		t.Errorf("encoded %s", encoded)
+	}
+
+	for _, bad := range []string{
+		`{"role":"user","content":[{"type":"audio","text":"x"}]}`,
+		`{"role":"user","content":[{"type":"image_url"}]}`,
+		`{"role":"user","content":[{"type":"image_url","image_url":{"url":"data:image/png,raw"}}]}`,
+		`{"role":"user","content":42}`,
+	} {
+		if err := json.Unmarshal([]byte(bad), &msg); err == nil {
+			t.Errorf("expected %s to be rejected", bad)
+		}
+	}
+}
+
+// requestJSON returns a translated request body as JSON; providers store
+// either the encoded bytes or the body map
+func requestJSON(req *providers.ProviderRequest) []byte {
+	if encoded, ok := req.Body.([]byte); ok {
+		return encoded
+	}
+	encoded, _ := json.Marshal(req.Body)
+	return encoded
+}
+
+func TestImagePartTranslation(t *testing.T) {
+	image := func(url string) *providers.UnifiedRequest {
+		return &providers.UnifiedRequest{Messages: []providers.Message{{
+			Role:    "user",
+			Content: "Describe",
+			Parts: []providers.ContentPart{
+				{Type: providers.ContentTypeText, Text: "Describe"},
+				{Type: providers.ContentTypeImage, ImageURL: &providers.ImageURL{URL: url}},
+			},
+		}}}
+	}
+
+	anthropic := newAnthropicDeployment("http://unused")
+	providerReq, err := providers.NewAnthropicProvider().TranslateRequest(context.Background(), image(pixel), anthropic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var body struct {
+		Messages []struct {
+			Content []struct {
+				Type   string            `json:"type"`
+				Source map[string]string `json:"source"`
+			} `json:"content"`
+		} `json:"messages"`
+	}
+	json.Unmarshal(requestJSON(providerReq), &body)
+	if blocks := body.Messages[0].Content; len(blocks) != 2 || blocks[1].Type != "image" ||
+		blocks[1].Source["media_type"] != "image/png" || blocks[1].Source["data"] != "iVBORw0KGgo=" {
+		t.Errorf("anthropic content = %+v", blocks)
+	}
+
+	bedrock := providers.NewBedrockProvider()
+	deployment := newBedrockDeployment("http://unused")
+	providerReq, err = bedrock.TranslateRequest(context.Background(), image(pixel), deployment)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(requestJSON(providerReq)), `"image":{"format":"png","source":{"bytes":"iVBORw0KGgo="}}`) {
+		t.Errorf("bedrock body = %s", requestJSON(providerReq))
+	}
+
+	// Bedrock cannot fetch URLs itself, but a fallback deployment may
+	_, err = bedrock.TranslateRequest(context.Background(), image("https://example.com/cat.png"), deployment)
+	if pe, ok := providers.AsProviderError(err); !ok || pe.Type != providers.ErrUnsupported || !pe.Fallback() || pe.Retryable() {
+		t.Errorf("image URL on bedrock: %v", err)
+	}
+}
@@ -0,0 +1,102 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"ch.at/models"
+)
+
+// Embedder is implemented by providers that can serve embedding models.
+// Embedding calls go through the provider's Execute like chat requests, so
+// transport errors, retries and circuit breakers behave the same.
+type Embedder interface {
+	// Translate embedding request to provider format
+	TranslateEmbeddingRequest(ctx context.Context, req *EmbeddingRequest, deployment *models.Deployment) (*ProviderRequest, error)
+
+	// Translate embedding response to unified format
+	TranslateEmbeddingResponse(ctx context.Context, resp *ProviderResponse, deployment *models.Deployment) (*EmbeddingResponse, error)
+
+	// Health check for deployments of embedding models, which can't
+	// answer the chat request HealthCheck sends
+	EmbeddingHealthCheck(ctx context.Context, deployment *models.Deployment) error
+}
+
+// EmbeddingRequest is the standard embeddings request
+type EmbeddingRequest struct {
+	Model      string   `json:"model"`
+	Input      []string `json:"input"`
+	Dimensions int      `json:"dimensions,omitempty"` // Shortened output, for models that support it
+	User       string   `json:"user,omitempty"`
+}
+
+// EmbeddingResponse is the standard embeddings response
+type EmbeddingResponse struct {
+	Model    string                 `json:"model"`
+	Data     []Embedding            `json:"data"`
+	Usage    Usage                  `json:"usage"`
+	Metadata map[string]interface{} `json:"metadata,omitempty"`
+}
+
+// Embedding is the vector for one input, in input order
+type Embedding struct {
+	Index     int       `json:"index"`
+	Embedding []float64 `json:"embedding"`
+}
+
+// buildOpenAIEmbeddingBody builds an OpenAI embeddings body without the model field.
+// Floats are always requested; base64 output is encoded by the gateway.
+func buildOpenAIEmbeddingBody(req *EmbeddingRequest) map[string]interface{} {
+	body := map[string]interface{}{
+		"input":           req.Input,
+		"encoding_format": "float",
+	}
+	if req.Dimensions > 0 {
+		body["dimensions"] = req.Dimensions
+	}
+	if req.User != "" {
+		body["user"] = req.User
+	}
+	return body
+}
+
+// parseOpenAIEmbeddingResponse decodes an OpenAI-compatible embeddings response
+func parseOpenAIEmbeddingResponse(body []byte) (*EmbeddingResponse, error) {
+	var resp EmbeddingResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal embeddings: %w", err)
+	}
+	resp.Metadata = make(map[string]interface{})
+	return &resp, nil
+}
+
+// setEmbeddingMetadata records which deployment served an embeddings request
+func setEmbeddingMetadata(resp *EmbeddingResponse, deployment *models.Deployment) {
+	resp.Metadata["deployment_id"] = deployment.ID
+	resp.Metadata["provider"] = string(deployment.Provider)
+	resp.Metadata["provider_model"] = deployment.ProviderModelID
+}
+
+// checkEmbeddings embeds a single word, for embedding health checks
+func checkEmbeddings(ctx context.Context, provider Provider, embedder Embedder, deployment *models.Deployment) error {
+	req := &EmbeddingRequest{Model: deployment.ProviderModelID, Input: []string{"Hi"}}
+	providerReq, err := embedder.TranslateEmbeddingRequest(ctx, req, deployment)
+	if err != nil {
+		return fmt.Errorf("health check translation failed: %w", err)
+	}
+
+	healthCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	resp, err := provider.Execute(healthCtx, providerReq)
+	if err != nil {
+		return fmt.Errorf("health check request failed: %w", err)
+	}
+
+	if _, err := embedder.TranslateEmbeddingResponse(healthCtx, resp, deployment); err != nil {
+		return fmt.Errorf("health check failed: %w", err)
+	}
+	return nil
+}
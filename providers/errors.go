@@ -0,0 +1,273 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrorType classifies upstream failures so the router can decide whether
+// to retry, fall back to another deployment, or fail fast
+type ErrorType string
+
+const (
+	ErrRateLimited           ErrorType = "rate_limited"
+	ErrAuthFailed            ErrorType = "auth_failed"
+	ErrContextLengthExceeded ErrorType = "context_length_exceeded"
+	ErrContentFiltered       ErrorType = "content_filtered"
+	ErrBadRequest            ErrorType = "bad_request"
+	ErrNotFound              ErrorType = "not_found"
+	ErrUnsupported           ErrorType = "unsupported" // The deployment can't take the request as sent
+	ErrUpstreamUnavailable   ErrorType = "upstream_unavailable"
+	ErrTimeout               ErrorType = "timeout"
+)
+
+// ProviderError is the typed error every provider returns for upstream failures
+type ProviderError struct {
+	Type       ErrorType
+	Provider   string        // Provider that produced the error, if known
+	StatusCode int           // Upstream HTTP status, 0 for transport and stream errors
+	Message    string        // Upstream error message
+	RetryAfter time.Duration // Upstream-requested delay before retrying, if any
+	Err        error         // Underlying transport error, if any
+}
+
+func (e *ProviderError) Error() string {
+	switch {
+	case e.StatusCode != 0:
+		return fmt.Sprintf("%s returned status %d: %s", e.Provider, e.StatusCode, e.Message)
+	case e.Err != nil:
+		return fmt.Sprintf("%s: %v", e.Message, e.Err)
+	default:
+		return e.Message
+	}
+}
+
+func (e *ProviderError) Unwrap() error {
+	return e.Err
+}
+
+// Retryable reports whether repeating the request on the same deployment may succeed
+func (e *ProviderError) Retryable() bool {
+	switch e.Type {
+	case ErrRateLimited, ErrUpstreamUnavailable, ErrTimeout:
+		return true
+	}
+	return false
+}
+
+// Fallback reports whether another deployment may succeed where this one failed.
+// Errors caused by the request itself (bad request, context length, content
+// filter) would fail the same way everywhere, so they fail fast instead.
+func (e *ProviderError) Fallback() bool {
+	switch e.Type {
+	case ErrRateLimited, ErrAuthFailed, ErrNotFound, ErrUnsupported, ErrUpstreamUnavailable, ErrTimeout:
+		return true
+	}
+	return false
+}
+
+// TripsBreaker reports whether the error says something about deployment health.
+// Rate limits are back-pressure, not an outage, and request errors are the caller's fault.
+func (e *ProviderError) TripsBreaker() bool {
+	switch e.Type {
+	case ErrAuthFailed, ErrNotFound, ErrUpstreamUnavailable, ErrTimeout:
+		return true
+	}
+	return false
+}
+
+// AsProviderError returns the ProviderError in err's chain, if any
+func AsProviderError(err error) (*ProviderError, bool) {
+	var pe *ProviderError
+	if errors.As(err, &pe) {
+		return pe, true
+	}
+	return nil, false
+}
+
+// newStatusError classifies a non-200 upstream response
+func newStatusError(provider string, status int, headers map[string]string, message string) *ProviderError {
+	errType := classifyStatus(status, message)
+	pe := &ProviderError{
+		Type:       errType,
+		Provider:   provider,
+		StatusCode: status,
+		Message:    message,
+	}
+	if errType == ErrRateLimited || errType == ErrUpstreamUnavailable {
+		pe.RetryAfter = parseRetryAfter(headers, time.Now())
+	}
+	return pe
+}
+
+// newStreamError classifies an error event received in the middle of a stream.
+// status is the HTTP status the same error would have had on a plain request.
+func newStreamError(provider, kind string, status int, message string) *ProviderError {
+	pe := &ProviderError{
+		Type:     classifyStatus(status, message),
+		Provider: provider,
+		Message:  fmt.Sprintf("%s stream error: %s", provider, message),
+	}
+	if kind != "" {
+		pe.Message = fmt.Sprintf("%s stream error (%s): %s", provider, kind, message)
+	}
+	return pe
+}
+
+// newTokenError classifies a failed credential exchange. Rejected credentials
+// are an auth failure whatever status the identity provider chose for them.
+func newTokenError(provider string, status int, message string) *ProviderError {
+	errType := ErrAuthFailed
+	if status == http.StatusTooManyRequests || status >= 500 {
+		errType = classifyStatus(status, message)
+	}
+	return &ProviderError{
+		Type:       errType,
+		Provider:   provider + " token endpoint",
+		StatusCode: status,
+		Message:    message,
+	}
+}
+
+// newTransportError classifies a failure to reach the upstream at all.
+// Cancellation by the caller is not an upstream failure and is returned unclassified.
+func newTransportError(err error) error {
+	if errors.Is(err, context.Canceled) {
+		return fmt.Errorf("request failed: %w", err)
+	}
+
+	errType := ErrUpstreamUnavailable
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		errType = ErrTimeout
+	}
+
+	return &ProviderError{Type: errType, Message: "request failed", Err: err}
+}
+
+// classifyStatus maps an upstream status and message to an error type.
+// Providers report context length and content filter errors as plain 400s,
+// so those are told apart by message.
+func classifyStatus(status int, message string) ErrorType {
+	switch {
+	case status == http.StatusTooManyRequests:
+		return ErrRateLimited
+	case status == http.StatusUnauthorized || status == http.StatusForbidden:
+		return ErrAuthFailed
+	case status == http.StatusRequestTimeout || status == http.StatusGatewayTimeout:
+		return ErrTimeout
+	case status == http.StatusRequestEntityTooLarge:
+		return ErrContextLengthExceeded
+	case status == http.StatusNotFound:
+		// The model or deployment is missing on this upstream. Asking again
+		// won't change that, but another deployment may have it.
+		return ErrNotFound
+	case status >= 400 && status < 500:
+		msg := strings.ToLower(message)
+		switch {
+		case containsAny(msg, contextLengthPhrases):
+			return ErrContextLengthExceeded
+		case containsAny(msg, contentFilterPhrases):
+			return ErrContentFiltered
+		}
+		return ErrBadRequest
+	default:
+		// 5xx, Anthropic's 529 overloaded, and anything unexpected
+		return ErrUpstreamUnavailable
+	}
+}
+
+var contextLengthPhrases = []string{
+	"context length",
+	"context_length",
+	"context window",
+	"maximum context",
+	"too many tokens",
+	"prompt is too long",
+	"input is too long",
+	"reduce the length",
+}
+
+var contentFilterPhrases = []string{
+	"content_filter",
+	"content filter",
+	"content management policy",
+	"responsibleaipolicyviolation",
+	"safety",
+}
+
+func containsAny(s string, phrases []string) bool {
+	for _, p := range phrases {
+		if strings.Contains(s, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseRetryAfter reads the delay an upstream asked for. Retry-After may be
+// seconds or an HTTP date; OpenAI-style x-ratelimit-reset-* headers are Go-like
+// durations ("1s", "6m0s"); a bare x-ratelimit-reset may be seconds or a Unix time.
+func parseRetryAfter(headers map[string]string, now time.Time) time.Duration {
+	if v := headerValue(headers, "Retry-After-Ms"); v != "" {
+		if ms, err := strconv.ParseFloat(v, 64); err == nil && ms > 0 {
+			return time.Duration(ms * float64(time.Millisecond))
+		}
+	}
+
+	if v := headerValue(headers, "Retry-After"); v != "" {
+		if secs, err := strconv.ParseFloat(v, 64); err == nil && secs > 0 {
+			return time.Duration(secs * float64(time.Second))
+		}
+		if t, err := http.ParseTime(v); err == nil && t.After(now) {
+			return t.Sub(now)
+		}
+	}
+
+	var longest time.Duration
+	for _, name := range []string{"X-Ratelimit-Reset-Requests", "X-Ratelimit-Reset-Tokens"} {
+		if d, err := time.ParseDuration(headerValue(headers, name)); err == nil && d > longest {
+			longest = d
+		}
+	}
+	if longest > 0 {
+		return longest
+	}
+
+	if v := headerValue(headers, "X-Ratelimit-Reset"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d > 0 {
+			return d
+		}
+		if secs, err := strconv.ParseFloat(v, 64); err == nil && secs > 0 {
+			// Values this large are timestamps rather than deltas
+			if secs > 1e9 {
+				if t := time.Unix(int64(secs), 0); t.After(now) {
+					return t.Sub(now)
+				}
+				return 0
+			}
+			return time.Duration(secs * float64(time.Second))
+		}
+	}
+
+	return 0
+}
+
+// headerValue looks up a header case-insensitively
+func headerValue(headers map[string]string, name string) string {
+	if v, ok := headers[name]; ok {
+		return v
+	}
+	for k, v := range headers {
+		if strings.EqualFold(k, name) {
+			return v
+		}
+	}
+	return ""
+}
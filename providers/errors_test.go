@@ -0,0 +1,148 @@
+package providers_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"ch.at/models"
+	"ch.at/providers"
+)
+
+// oneAPIError sends one non-streaming request to a OneAPI deployment at
+// baseURL and returns the error from whichever step failed
+func oneAPIError(baseURL string) error {
+	provider := providers.NewOneAPIProvider()
+	deployment := &models.Deployment{
+		ID:              "test-oneapi",
+		Provider:        models.ProviderOneAPI,
+		ProviderModelID: "llama-3-8b",
+		Endpoint:        models.EndpointConfig{BaseURL: baseURL},
+	}
+
+	req := &providers.UnifiedRequest{Messages: []providers.Message{{Role: "user", Content: "Hi"}}}
+	providerReq, err := provider.TranslateRequest(context.Background(), req, deployment)
+	if err != nil {
+		return err
+	}
+	resp, err := provider.Execute(context.Background(), providerReq)
+	if err != nil {
+		return err
+	}
+	_, err = provider.TranslateResponse(context.Background(), resp, deployment)
+	return err
+}
+
+func TestUpstreamErrorClassification(t *testing.T) {
+	cases := []struct {
+		name    string
+		status  int
+		headers map[string]string
+		body    string
+		want    providers.ErrorType
+		retry   time.Duration
+	}{
+		{"rate limit", 429, map[string]string{"Retry-After": "7"}, `{"error":{"message":"Rate limit reached"}}`, providers.ErrRateLimited, 7 * time.Second},
+		{"rate limit reset header", 429, map[string]string{"x-ratelimit-reset-requests": "1.5s"}, `{"error":{"message":"slow down"}}`, providers.ErrRateLimited, 1500 * time.Millisecond},
+		{"auth", 401, nil, `{"error":{"message":"Incorrect API key provided"}}`, providers.ErrAuthFailed, 0},
+		{"context length", 400, nil, `{"error":{"message":"This model's maximum context length is 8192 tokens"}}`, providers.ErrContextLengthExceeded, 0},
+		{"content filter", 400, nil, `{"error":{"code":"content_filter","message":"The response was filtered due to the prompt triggering Azure OpenAI's content management policy"}}`, providers.ErrContentFiltered, 0},
+		{"bad request", 400, nil, `{"error":{"message":"temperature must be between 0 and 2"}}`, providers.ErrBadRequest, 0},
+		{"model not found", 404, nil, `{"error":{"message":"The model does not exist"}}`, providers.ErrNotFound, 0},
+		{"gateway timeout", 504, nil, `upstream timed out`, providers.ErrTimeout, 0},
+		{"plain-text gateway error", 502, nil, `deployment not found`, providers.ErrUpstreamUnavailable, 0},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				for k, v := range tc.headers {
+					w.Header().Set(k, v)
+				}
+				w.WriteHeader(tc.status)
+				fmt.Fprint(w, tc.body)
+			}))
+			defer server.Close()
+
+			err := oneAPIError(server.URL)
+			pe, ok := providers.AsProviderError(err)
+			if !ok {
+				t.Fatalf("expected a ProviderError, got %v", err)
+			}
+			if pe.Type != tc.want || pe.StatusCode != tc.status {
+				t.Errorf("type = %s, status = %d", pe.Type, pe.StatusCode)
+			}
+			if pe.RetryAfter != tc.retry {
+				t.Errorf("retry after = %v, want %v", pe.RetryAfter, tc.retry)
+			}
+		})
+	}
+}
+
+func TestTransportErrorClassification(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.Close()
+
+	pe, ok := providers.AsProviderError(oneAPIError(server.URL))
+	if !ok || pe.Type != providers.ErrUpstreamUnavailable {
+		t.Errorf("connection refused classified as %+v", pe)
+	}
+
+	provider := providers.NewMockProvider()
+	deployment := newMockDeployment("slow", map[string]interface{}{"latency": 200})
+	req := &providers.UnifiedRequest{Messages: []providers.Message{{Role: "user", Content: "Hi"}}}
+	providerReq, _ := provider.TranslateRequest(context.Background(), req, deployment)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := provider.Execute(ctx, providerReq)
+	if pe, ok := providers.AsProviderError(err); !ok || pe.Type != providers.ErrTimeout {
+		t.Errorf("deadline classified as %v", err)
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	_, err = provider.Execute(ctx, providerReq)
+	if _, ok := providers.AsProviderError(err); ok || !errors.Is(err, context.Canceled) {
+		t.Errorf("cancellation should stay unclassified, got %v", err)
+	}
+}
+
+func TestAnthropicStreamErrorEvent(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "event: error\ndata: {\"type\":\"error\",\"error\":{\"type\":\"overloaded_error\",\"message\":\"Overloaded\"}}\n\n")
+	}))
+	defer server.Close()
+
+	provider := providers.NewAnthropicProvider()
+	deployment := &models.Deployment{
+		ID:              "test-anthropic",
+		Provider:        models.ProviderAnthropic,
+		ProviderModelID: "claude-3-5-haiku-20241022",
+		Endpoint:        models.EndpointConfig{BaseURL: server.URL},
+	}
+	req := &providers.UnifiedRequest{Messages: []providers.Message{{Role: "user", Content: "Hi"}}, Stream: true}
+	providerReq, err := provider.TranslateRequest(context.Background(), req, deployment)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stream := make(chan providers.StreamChunk)
+	go provider.Stream(context.Background(), providerReq, stream)
+
+	var streamErr error
+	for chunk := range stream {
+		if chunk.Error != nil {
+			streamErr = chunk.Error
+		}
+	}
+	pe, ok := providers.AsProviderError(streamErr)
+	if !ok || pe.Type != providers.ErrUpstreamUnavailable || !pe.TripsBreaker() {
+		t.Errorf("overloaded_error classified as %+v", pe)
+	}
+}
@@ -0,0 +1,113 @@
+package providers
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+// eventStreamMessage is one frame of the AWS binary event-stream encoding
+// (application/vnd.amazon.eventstream) used by Bedrock streaming APIs
+type eventStreamMessage struct {
+	Headers map[string]string
+	Payload []byte
+}
+
+// maxEventStreamMessage guards against allocating absurd frame sizes on corrupt input
+const maxEventStreamMessage = 16 * 1024 * 1024
+
+// readEventStreamMessage reads a single frame:
+//
+//	total length (4) | headers length (4) | prelude CRC (4) |
+//	headers | payload | message CRC (4)
+//
+// Only string-valued headers are kept; other header types are skipped.
+// Returns io.EOF when the stream ends cleanly between frames.
+func readEventStreamMessage(r io.Reader) (*eventStreamMessage, error) {
+	prelude := make([]byte, 12)
+	if _, err := io.ReadFull(r, prelude); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return nil, fmt.Errorf("truncated event-stream prelude")
+		}
+		return nil, err
+	}
+
+	totalLen := binary.BigEndian.Uint32(prelude[0:4])
+	headersLen := binary.BigEndian.Uint32(prelude[4:8])
+	if crc32.ChecksumIEEE(prelude[0:8]) != binary.BigEndian.Uint32(prelude[8:12]) {
+		return nil, fmt.Errorf("event-stream prelude checksum mismatch")
+	}
+	if totalLen < 16 || totalLen > maxEventStreamMessage || headersLen > totalLen-16 {
+		return nil, fmt.Errorf("invalid event-stream frame length %d", totalLen)
+	}
+
+	rest := make([]byte, totalLen-12)
+	if _, err := io.ReadFull(r, rest); err != nil {
+		return nil, fmt.Errorf("truncated event-stream frame: %w", err)
+	}
+
+	crc := crc32.NewIEEE()
+	crc.Write(prelude)
+	crc.Write(rest[:len(rest)-4])
+	if crc.Sum32() != binary.BigEndian.Uint32(rest[len(rest)-4:]) {
+		return nil, fmt.Errorf("event-stream message checksum mismatch")
+	}
+
+	headers, err := parseEventStreamHeaders(rest[:headersLen])
+	if err != nil {
+		return nil, err
+	}
+
+	return &eventStreamMessage{
+		Headers: headers,
+		Payload: rest[headersLen : len(rest)-4],
+	}, nil
+}
+
+// parseEventStreamHeaders decodes the header block of a frame
+func parseEventStreamHeaders(b []byte) (map[string]string, error) {
+	headers := make(map[string]string)
+	for len(b) > 0 {
+		nameLen := int(b[0])
+		if len(b) < 1+nameLen+1 {
+			return nil, fmt.Errorf("malformed event-stream header")
+		}
+		name := string(b[1 : 1+nameLen])
+		valueType := b[1+nameLen]
+		b = b[2+nameLen:]
+
+		// Fixed-size value types; 6 (bytes) and 7 (string) are length-prefixed
+		var size int
+		switch valueType {
+		case 0, 1: // bool true / false, no value bytes
+		case 2:
+			size = 1
+		case 3:
+			size = 2
+		case 4:
+			size = 4
+		case 5, 8: // int64, timestamp
+			size = 8
+		case 9: // uuid
+			size = 16
+		case 6, 7:
+			if len(b) < 2 {
+				return nil, fmt.Errorf("malformed event-stream header %q", name)
+			}
+			size = int(binary.BigEndian.Uint16(b[0:2]))
+			b = b[2:]
+		default:
+			return nil, fmt.Errorf("unknown event-stream header type %d", valueType)
+		}
+
+		if len(b) < size {
+			return nil, fmt.Errorf("malformed event-stream header %q", name)
+		}
+		if valueType == 7 {
+			headers[name] = string(b[:size])
+		}
+		b = b[size:]
+	}
+	return headers, nil
+}
@@ -41,7 +41,9 @@ type UnifiedRequest struct {
 	TopP           float64                `json:"top_p,omitempty"`
 	Stream         bool                   `json:"stream,omitempty"`
 	Stop           []string               `json:"stop,omitempty"`
-	Functions      []Function             `json:"functions,omitempty"`
+	Functions      []Function             `json:"functions,omitempty"` // Legacy form of Tools
+	Tools          []Tool                 `json:"tools,omitempty"`
+	ToolChoice     interface{}            `json:"tool_choice,omitempty"` // "auto", "none", "required" or {"type":"function","function":{"name":...}}
 	ResponseFormat *ResponseFormat        `json:"response_format,omitempty"`
 	User           string                 `json:"user,omitempty"`
 	Metadata       map[string]interface{} `json:"metadata,omitempty"`
@@ -49,9 +51,31 @@ type UnifiedRequest struct {
 
 // Message represents a chat message
 type Message struct {
-	Role    string `json:"role"`
-	Content string `json:"content"`
-	Name    string `json:"name,omitempty"`
+	Role       string        `json:"role"`
+	Content    string        `json:"content"`
+	Parts      []ContentPart `json:"-"` // Multimodal content; Content then holds just the text
+	Name       string        `json:"name,omitempty"`
+	ToolCalls  []ToolCall    `json:"tool_calls,omitempty"`   // Tool calls requested by an assistant turn
+	ToolCallID string        `json:"tool_call_id,omitempty"` // Call answered by a "tool" role message
+}
+
+// Tool is a tool the model may call. Only function tools are defined.
+type Tool struct {
+	Type     string   `json:"type"`
+	Function Function `json:"function"`
+}
+
+// ToolCall is a model's request to call a function tool
+type ToolCall struct {
+	ID       string       `json:"id"`
+	Type     string       `json:"type"`
+	Function FunctionCall `json:"function"`
+}
+
+// FunctionCall names the function to call and its JSON-encoded arguments
+type FunctionCall struct {
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
 }
 
 // Function represents a function that can be called
@@ -63,7 +87,16 @@ type Function struct {
 
 // ResponseFormat specifies the format of the response
 type ResponseFormat struct {
-	Type string `json:"type"` // "text" or "json_object"
+	Type       string      `json:"type"` // "text", "json_object" or "json_schema"
+	JSONSchema *JSONSchema `json:"json_schema,omitempty"`
+}
+
+// JSONSchema is a named schema for "json_schema" structured outputs
+type JSONSchema struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description,omitempty"`
+	Schema      map[string]interface{} `json:"schema,omitempty"`
+	Strict      bool                   `json:"strict,omitempty"`
 }
 
 // UnifiedResponse is the standard response format
@@ -113,6 +146,23 @@ type StreamChunk struct {
 	Data  string
 	Error error
 	Done  bool
+
+	// Set on the final chunks when the provider reports them
+	FinishReason string
+	Usage        *Usage
+
+	// Tool call fragments, in the order the provider sent them
+	ToolCalls []ToolCallDelta
+}
+
+// ToolCallDelta is a fragment of a streamed tool call. Index identifies the
+// call within the response; ID and Name arrive with its first fragment and
+// Arguments is appended to across fragments.
+type ToolCallDelta struct {
+	Index     int
+	ID        string
+	Name      string
+	Arguments string
 }
 
 // ProviderInfo contains provider metadata
@@ -0,0 +1,679 @@
+package providers
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"ch.at/models"
+)
+
+const (
+	localBackendOllama   = "ollama"
+	localBackendLlamaCpp = "llamacpp"
+
+	ollamaDefaultBaseURL   = "http://localhost:11434"
+	llamaCppDefaultBaseURL = "http://localhost:8080"
+)
+
+// LocalProvider talks to inference servers on the local machine.
+// The "backend" deployment tag selects Ollama (/api/chat, the default) or a
+// llama.cpp server (/completion). No authentication is used.
+type LocalProvider struct {
+	client *http.Client
+}
+
+// NewLocalProvider creates a new local inference provider
+func NewLocalProvider() *LocalProvider {
+	return &LocalProvider{
+		client: &http.Client{
+			// Local models on a laptop can be slow, especially on first load
+			Timeout: 5 * time.Minute,
+		},
+	}
+}
+
+// TranslateRequest converts unified request to an Ollama or llama.cpp call
+func (l *LocalProvider) TranslateRequest(ctx context.Context, req *UnifiedRequest, deployment *models.Deployment) (*ProviderRequest, error) {
+	var body map[string]interface{}
+	var path string
+
+	switch localBackend(deployment) {
+	case localBackendOllama:
+		if err := inlineImagesOnly(req, "local ollama"); err != nil {
+			return nil, err
+		}
+		body = buildOllamaChatBody(req)
+		body["model"] = deployment.ProviderModelID
+		path = "/api/chat"
+	case localBackendLlamaCpp:
+		if req.HasTools() {
+			return nil, &ProviderError{Type: ErrBadRequest, Provider: "local llamacpp", Message: "the llama.cpp /completion backend does not support tool calling"}
+		}
+		if req.HasImages() {
+			return nil, &ProviderError{Type: ErrBadRequest, Provider: "local llamacpp", Message: "the llama.cpp /completion backend does not support images"}
+		}
+		body = buildLlamaCppBody(req)
+		path = "/completion"
+	default:
+		return nil, fmt.Errorf("unknown local backend %q", deployment.Tags["backend"])
+	}
+
+	headers := map[string]string{
+		"Content-Type": "application/json",
+	}
+	for k, v := range deployment.Endpoint.CustomHeaders {
+		headers[k] = v
+	}
+
+	return &ProviderRequest{
+		URL:     localBaseURL(deployment) + path,
+		Method:  "POST",
+		Headers: headers,
+		Body:    body,
+		Timeout: deployment.Endpoint.Timeout,
+	}, nil
+}
+
+// Execute sends the request to the local server
+func (l *LocalProvider) Execute(ctx context.Context, req *ProviderRequest) (*ProviderResponse, error) {
+	return executeRequest(ctx, l.client, req)
+}
+
+// TranslateResponse converts an Ollama or llama.cpp response to unified format
+func (l *LocalProvider) TranslateResponse(ctx context.Context, resp *ProviderResponse, deployment *models.Deployment) (*UnifiedResponse, error) {
+	if resp.StatusCode != http.StatusOK {
+		return nil, newStatusError("local "+localBackend(deployment), resp.StatusCode, resp.Headers, localErrorMessage(resp.Body))
+	}
+
+	var content, finishReason string
+	var usage Usage
+	var toolCalls []ToolCall
+	id := fmt.Sprintf("local-%d", time.Now().UnixNano())
+
+	if localBackend(deployment) == localBackendLlamaCpp {
+		var completion llamaCppCompletion
+		if err := json.Unmarshal(resp.Body, &completion); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+		}
+		content = completion.Content
+		finishReason = completion.finishReason()
+		usage = completion.usage()
+	} else {
+		var chat ollamaChatResponse
+		if err := json.Unmarshal(resp.Body, &chat); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+		}
+		content = chat.Message.Content
+		finishReason = chat.finishReason()
+		usage = chat.usage()
+		toolCalls = chat.toolCalls(id, 0)
+	}
+
+	return &UnifiedResponse{
+		ID:      id,
+		Object:  "chat.completion",
+		Created: time.Now().Unix(),
+		Model:   deployment.ProviderModelID,
+		Choices: []Choice{{
+			Index: 0,
+			Message: Message{
+				Role:      "assistant",
+				Content:   content,
+				ToolCalls: toolCalls,
+			},
+			FinishReason: finishReason,
+		}},
+		Usage: usage,
+		Metadata: map[string]interface{}{
+			"deployment_id":  deployment.ID,
+			"provider":       string(deployment.Provider),
+			"provider_model": deployment.ProviderModelID,
+		},
+	}, nil
+}
+
+// TranslateEmbeddingRequest converts an embeddings request to an Ollama
+// /api/embed call, or llama.cpp's OpenAI-compatible /v1/embeddings
+func (l *LocalProvider) TranslateEmbeddingRequest(ctx context.Context, req *EmbeddingRequest, deployment *models.Deployment) (*ProviderRequest, error) {
+	var body map[string]interface{}
+	var path string
+
+	switch localBackend(deployment) {
+	case localBackendOllama:
+		body = map[string]interface{}{
+			"model": deployment.ProviderModelID,
+			"input": req.Input,
+		}
+		if req.Dimensions > 0 {
+			body["dimensions"] = req.Dimensions
+		}
+		path = "/api/embed"
+	case localBackendLlamaCpp:
+		body = buildOpenAIEmbeddingBody(req)
+		path = "/v1/embeddings"
+	default:
+		return nil, fmt.Errorf("unknown local backend %q", deployment.Tags["backend"])
+	}
+
+	headers := map[string]string{
+		"Content-Type": "application/json",
+	}
+	for k, v := range deployment.Endpoint.CustomHeaders {
+		headers[k] = v
+	}
+
+	return &ProviderRequest{
+		URL:     localBaseURL(deployment) + path,
+		Method:  "POST",
+		Headers: headers,
+		Body:    body,
+		Timeout: deployment.Endpoint.Timeout,
+	}, nil
+}
+
+// TranslateEmbeddingResponse converts an Ollama or llama.cpp embeddings response to unified format
+func (l *LocalProvider) TranslateEmbeddingResponse(ctx context.Context, resp *ProviderResponse, deployment *models.Deployment) (*EmbeddingResponse, error) {
+	if resp.StatusCode != http.StatusOK {
+		return nil, newStatusError("local "+localBackend(deployment), resp.StatusCode, resp.Headers, localErrorMessage(resp.Body))
+	}
+
+	if localBackend(deployment) == localBackendLlamaCpp {
+		embeddingResp, err := parseOpenAIEmbeddingResponse(resp.Body)
+		if err != nil {
+			return nil, err
+		}
+		setEmbeddingMetadata(embeddingResp, deployment)
+		return embeddingResp, nil
+	}
+
+	var embed struct {
+		Model           string      `json:"model"`
+		Embeddings      [][]float64 `json:"embeddings"`
+		PromptEvalCount int         `json:"prompt_eval_count"`
+	}
+	if err := json.Unmarshal(resp.Body, &embed); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal embeddings: %w", err)
+	}
+
+	embeddingResp := &EmbeddingResponse{
+		Model:    deployment.ProviderModelID,
+		Usage:    Usage{PromptTokens: embed.PromptEvalCount, TotalTokens: embed.PromptEvalCount},
+		Metadata: make(map[string]interface{}),
+	}
+	for i, vector := range embed.Embeddings {
+		embeddingResp.Data = append(embeddingResp.Data, Embedding{Index: i, Embedding: vector})
+	}
+	setEmbeddingMetadata(embeddingResp, deployment)
+	return embeddingResp, nil
+}
+
+// EmbeddingHealthCheck is the same as HealthCheck, which only checks the
+// model is loaded and so works for embedding models too
+func (l *LocalProvider) EmbeddingHealthCheck(ctx context.Context, deployment *models.Deployment) error {
+	return l.HealthCheck(ctx, deployment)
+}
+
+// Stream handles Ollama NDJSON and llama.cpp SSE streaming
+func (l *LocalProvider) Stream(ctx context.Context, req *ProviderRequest, stream chan<- StreamChunk) error {
+	defer close(stream)
+
+	if body, ok := req.Body.(map[string]interface{}); ok {
+		body["stream"] = true
+	}
+
+	httpReq, err := newHTTPRequest(ctx, req)
+	if err != nil {
+		stream <- StreamChunk{Error: err}
+		return err
+	}
+
+	resp, err := l.client.Do(httpReq)
+	if err != nil {
+		err = newTransportError(err)
+		stream <- StreamChunk{Error: err}
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		raw, _ := io.ReadAll(resp.Body)
+		err := newStatusError("local server", resp.StatusCode, flattenHeaders(resp.Header), localErrorMessage(raw))
+		stream <- StreamChunk{Error: err}
+		return err
+	}
+
+	if strings.HasSuffix(req.URL, "/completion") {
+		return readLlamaCppStream(resp.Body, stream)
+	}
+	return readOllamaStream(resp.Body, stream)
+}
+
+// ValidateConfig validates local deployment configuration
+func (l *LocalProvider) ValidateConfig(deployment *models.Deployment) error {
+	switch localBackend(deployment) {
+	case localBackendOllama:
+		if deployment.ProviderModelID == "" {
+			return fmt.Errorf("provider model ID is required for Ollama (e.g. \"llama3.1:8b\")")
+		}
+	case localBackendLlamaCpp:
+		// llama.cpp serves whatever model the server was started with
+	default:
+		return fmt.Errorf("unknown local backend %q (expected %q or %q)", deployment.Tags["backend"], localBackendOllama, localBackendLlamaCpp)
+	}
+
+	return nil
+}
+
+// HealthCheck checks the server without generating tokens: Ollama's
+// /api/tags must list the model, llama.cpp's /health must report ok
+func (l *LocalProvider) HealthCheck(ctx context.Context, deployment *models.Deployment) error {
+	healthCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	backend := localBackend(deployment)
+	path := "/api/tags"
+	if backend == localBackendLlamaCpp {
+		path = "/health"
+	}
+
+	httpReq, err := http.NewRequestWithContext(healthCtx, "GET", localBaseURL(deployment)+path, nil)
+	if err != nil {
+		return fmt.Errorf("health check request failed: %w", err)
+	}
+
+	resp, err := l.client.Do(httpReq)
+	if err != nil {
+		return fmt.Errorf("health check request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("health check returned status %d", resp.StatusCode)
+	}
+
+	if backend == localBackendLlamaCpp {
+		return nil
+	}
+
+	var tags struct {
+		Models []struct {
+			Name  string `json:"name"`
+			Model string `json:"model"`
+		} `json:"models"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tags); err != nil {
+		return fmt.Errorf("health check returned invalid tags: %w", err)
+	}
+
+	for _, m := range tags.Models {
+		if ollamaModelMatches(m.Name, deployment.ProviderModelID) || ollamaModelMatches(m.Model, deployment.ProviderModelID) {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("model %s is not pulled (run: ollama pull %s)", deployment.ProviderModelID, deployment.ProviderModelID)
+}
+
+// GetInfo returns provider information
+func (l *LocalProvider) GetInfo() ProviderInfo {
+	return ProviderInfo{
+		Name:           "Local Inference (Ollama / llama.cpp)",
+		Version:        "1.0",
+		SupportsStream: true,
+		RequiresAuth:   false,
+		MaxRequestSize: 10 * 1024 * 1024, // 10MB
+		RateLimits:     map[string]int{},
+	}
+}
+
+// localBackend returns the configured backend, defaulting to Ollama
+func localBackend(deployment *models.Deployment) string {
+	switch backend := strings.ToLower(deployment.Tags["backend"]); backend {
+	case "", localBackendOllama:
+		return localBackendOllama
+	case localBackendLlamaCpp, "llama.cpp", "llama-cpp":
+		return localBackendLlamaCpp
+	default:
+		return backend
+	}
+}
+
+// localBaseURL returns the configured server URL or the backend's default port
+func localBaseURL(deployment *models.Deployment) string {
+	if deployment.Endpoint.BaseURL != "" {
+		return strings.TrimSuffix(deployment.Endpoint.BaseURL, "/")
+	}
+	if localBackend(deployment) == localBackendLlamaCpp {
+		return llamaCppDefaultBaseURL
+	}
+	return ollamaDefaultBaseURL
+}
+
+// ollamaModelMatches compares model names, treating "llama3" and "llama3:latest" as equal
+func ollamaModelMatches(name, want string) bool {
+	if name == want {
+		return true
+	}
+	return !strings.Contains(want, ":") && name == want+":latest"
+}
+
+// buildOllamaChatBody builds an /api/chat body; sampling settings go in "options"
+func buildOllamaChatBody(req *UnifiedRequest) map[string]interface{} {
+	messages := make([]map[string]interface{}, 0, len(req.Messages))
+	for _, msg := range req.Messages {
+		message := map[string]interface{}{
+			"role":    msg.Role,
+			"content": msg.Content,
+		}
+		if msg.HasImages() {
+			// Ollama takes bare base64 images alongside the text
+			var images []string
+			for _, part := range msg.Parts {
+				if part.Type == ContentTypeImage {
+					_, data, _ := parseDataURL(part.ImageURL.URL)
+					images = append(images, data)
+				}
+			}
+			message["images"] = images
+		}
+		if len(msg.ToolCalls) > 0 {
+			// Ollama takes arguments as an object, not a JSON string
+			calls := make([]map[string]interface{}, len(msg.ToolCalls))
+			for i, call := range msg.ToolCalls {
+				calls[i] = map[string]interface{}{
+					"function": map[string]interface{}{
+						"name":      call.Function.Name,
+						"arguments": toolArguments(call.Function.Arguments),
+					},
+				}
+			}
+			message["tool_calls"] = calls
+		}
+		messages = append(messages, message)
+	}
+
+	options := map[string]interface{}{}
+	if req.Temperature > 0 {
+		options["temperature"] = req.Temperature
+	}
+	if req.MaxTokens > 0 {
+		options["num_predict"] = req.MaxTokens
+	}
+	if req.TopP > 0 {
+		options["top_p"] = req.TopP
+	}
+	if len(req.Stop) > 0 {
+		options["stop"] = req.Stop
+	}
+
+	body := map[string]interface{}{
+		"messages": messages,
+		"stream":   req.Stream,
+	}
+	if len(options) > 0 {
+		body["options"] = options
+	}
+	// "format" takes "json" or a JSON schema
+	if req.ResponseFormat.WantsJSON() {
+		body["format"] = "json"
+		if req.ResponseFormat.Type == ResponseFormatJSONSchema {
+			body["format"] = req.ResponseFormat.schema()
+		}
+	}
+
+	// Ollama has no tool_choice, so "none" is honored by not offering tools
+	if mode, _ := toolChoice(req.ToolChoice); req.HasTools() && mode != toolChoiceNone {
+		var tools []map[string]interface{}
+		for _, fn := range toolFunctions(req) {
+			tools = append(tools, map[string]interface{}{
+				"type": "function",
+				"function": map[string]interface{}{
+					"name":        fn.Name,
+					"description": fn.Description,
+					"parameters":  toolParameters(fn),
+				},
+			})
+		}
+		body["tools"] = tools
+	}
+
+	return body
+}
+
+// ollamaChatResponse is an /api/chat response or NDJSON stream line
+type ollamaChatResponse struct {
+	Message struct {
+		Role      string `json:"role"`
+		Content   string `json:"content"`
+		ToolCalls []struct {
+			Function struct {
+				Name      string                 `json:"name"`
+				Arguments map[string]interface{} `json:"arguments"`
+			} `json:"function"`
+		} `json:"tool_calls"`
+	} `json:"message"`
+	Done            bool   `json:"done"`
+	DoneReason      string `json:"done_reason"`
+	PromptEvalCount int    `json:"prompt_eval_count"`
+	EvalCount       int    `json:"eval_count"`
+	Error           string `json:"error"`
+}
+
+func (o *ollamaChatResponse) finishReason() string {
+	switch {
+	case o.DoneReason == "length":
+		return "length"
+	case len(o.Message.ToolCalls) > 0:
+		return "tool_calls"
+	}
+	return "stop"
+}
+
+// toolCalls converts the message's tool calls. Ollama does not assign call
+// IDs, so they are derived from idPrefix and firstIndex.
+func (o *ollamaChatResponse) toolCalls(idPrefix string, firstIndex int) []ToolCall {
+	var calls []ToolCall
+	for _, call := range o.Message.ToolCalls {
+		calls = append(calls, ToolCall{
+			ID:       syntheticToolCallID(idPrefix, firstIndex+len(calls)),
+			Type:     "function",
+			Function: FunctionCall{Name: call.Function.Name, Arguments: encodeToolArguments(call.Function.Arguments)},
+		})
+	}
+	return calls
+}
+
+func (o *ollamaChatResponse) usage() Usage {
+	return Usage{
+		PromptTokens:     o.PromptEvalCount,
+		CompletionTokens: o.EvalCount,
+		TotalTokens:      o.PromptEvalCount + o.EvalCount,
+	}
+}
+
+// readOllamaStream parses /api/chat NDJSON: one JSON object per line, the
+// last one has done=true and carries the token counts
+func readOllamaStream(r io.Reader, stream chan<- StreamChunk) error {
+	var toolCount int
+	streamID := fmt.Sprintf("local-%d", time.Now().UnixNano())
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		var chunk ollamaChatResponse
+		if err := json.Unmarshal([]byte(line), &chunk); err != nil {
+			// Skip malformed JSON
+			continue
+		}
+
+		if chunk.Error != "" {
+			err := newStreamError("ollama", "", http.StatusInternalServerError, chunk.Error)
+			stream <- StreamChunk{Error: err}
+			return err
+		}
+
+		if chunk.Message.Content != "" {
+			stream <- StreamChunk{Data: chunk.Message.Content}
+		}
+		// Tool calls arrive whole in a single line
+		if calls := chunk.toolCalls(streamID, toolCount); len(calls) > 0 {
+			stream <- StreamChunk{ToolCalls: toolCallDeltas(calls, toolCount)}
+			toolCount += len(calls)
+		}
+
+		if chunk.Done {
+			usage := chunk.usage()
+			finishReason := chunk.finishReason()
+			if toolCount > 0 && finishReason == "stop" {
+				finishReason = "tool_calls"
+			}
+			stream <- StreamChunk{FinishReason: finishReason, Usage: &usage}
+			stream <- StreamChunk{Done: true}
+			return nil
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		stream <- StreamChunk{Error: err}
+		return err
+	}
+
+	return nil
+}
+
+// buildLlamaCppBody builds a /completion body. That endpoint takes a raw
+// prompt, so the conversation is flattened into a simple role-prefixed
+// transcript ending with an open assistant turn.
+func buildLlamaCppBody(req *UnifiedRequest) map[string]interface{} {
+	var prompt strings.Builder
+	for _, msg := range req.Messages {
+		switch msg.Role {
+		case "system":
+			prompt.WriteString("System: ")
+		case "assistant":
+			prompt.WriteString("Assistant: ")
+		default:
+			prompt.WriteString("User: ")
+		}
+		prompt.WriteString(msg.Content)
+		prompt.WriteString("\n")
+	}
+	prompt.WriteString("Assistant:")
+
+	// Stop before the model starts writing the user's next turn
+	stop := append([]string{"\nUser:"}, req.Stop...)
+
+	body := map[string]interface{}{
+		"prompt":       prompt.String(),
+		"stream":       req.Stream,
+		"stop":         stop,
+		"cache_prompt": true,
+	}
+	// llama.cpp constrains generation with a grammar built from the schema
+	if req.ResponseFormat.WantsJSON() {
+		body["json_schema"] = req.ResponseFormat.schema()
+	}
+	if req.Temperature > 0 {
+		body["temperature"] = req.Temperature
+	}
+	if req.MaxTokens > 0 {
+		body["n_predict"] = req.MaxTokens
+	}
+	if req.TopP > 0 {
+		body["top_p"] = req.TopP
+	}
+
+	return body
+}
+
+// llamaCppCompletion is a /completion response or SSE stream event
+type llamaCppCompletion struct {
+	Content         string `json:"content"`
+	Stop            bool   `json:"stop"`
+	StoppedLimit    bool   `json:"stopped_limit"`
+	TokensPredicted int    `json:"tokens_predicted"`
+	TokensEvaluated int    `json:"tokens_evaluated"`
+}
+
+func (c *llamaCppCompletion) finishReason() string {
+	if c.StoppedLimit {
+		return "length"
+	}
+	return "stop"
+}
+
+func (c *llamaCppCompletion) usage() Usage {
+	return Usage{
+		PromptTokens:     c.TokensEvaluated,
+		CompletionTokens: c.TokensPredicted,
+		TotalTokens:      c.TokensEvaluated + c.TokensPredicted,
+	}
+}
+
+// readLlamaCppStream parses /completion SSE events; the final event has stop=true
+func readLlamaCppStream(r io.Reader, stream chan<- StreamChunk) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+
+		var chunk llamaCppCompletion
+		if err := json.Unmarshal([]byte(strings.TrimSpace(strings.TrimPrefix(line, "data:"))), &chunk); err != nil {
+			// Skip malformed JSON
+			continue
+		}
+
+		if chunk.Content != "" {
+			stream <- StreamChunk{Data: chunk.Content}
+		}
+
+		if chunk.Stop {
+			usage := chunk.usage()
+			stream <- StreamChunk{FinishReason: chunk.finishReason(), Usage: &usage}
+			stream <- StreamChunk{Done: true}
+			return nil
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		stream <- StreamChunk{Error: err}
+		return err
+	}
+
+	return nil
+}
+
+// localErrorMessage extracts the message from an Ollama or llama.cpp error body
+func localErrorMessage(body []byte) string {
+	var errResp struct {
+		Error json.RawMessage `json:"error"`
+	}
+	if err := json.Unmarshal(body, &errResp); err == nil && len(errResp.Error) > 0 {
+		// Ollama sends a string, llama.cpp an object with a message
+		var msg string
+		if json.Unmarshal(errResp.Error, &msg) == nil {
+			return msg
+		}
+		var obj struct {
+			Message string `json:"message"`
+		}
+		if json.Unmarshal(errResp.Error, &obj) == nil && obj.Message != "" {
+			return obj.Message
+		}
+	}
+	return string(body)
+}
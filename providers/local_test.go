@@ -0,0 +1,195 @@
+package providers_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"ch.at/models"
+	"ch.at/providers"
+)
+
+func newLocalDeployment(baseURL, backend, modelID string) *models.Deployment {
+	return &models.Deployment{
+		ID:              "test-local",
+		ModelID:         "llama-8b",
+		Provider:        models.ProviderLocal,
+		ProviderModelID: modelID,
+		Endpoint: models.EndpointConfig{
+			BaseURL: baseURL,
+			Auth:    models.AuthConfig{Type: models.AuthNone},
+		},
+		Tags: map[string]string{"backend": backend},
+	}
+}
+
+func collectStream(t *testing.T, stream <-chan providers.StreamChunk) (content, finish string, usage *providers.Usage) {
+	t.Helper()
+	for chunk := range stream {
+		if chunk.Error != nil {
+			t.Fatalf("chunk error: %v", chunk.Error)
+		}
+		if chunk.Done {
+			return
+		}
+		content += chunk.Data
+		if chunk.FinishReason != "" {
+			finish = chunk.FinishReason
+			usage = chunk.Usage
+		}
+	}
+	t.Error("stream ended without a Done chunk")
+	return
+}
+
+func TestLocalOllamaChatStream(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/chat" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		if body["model"] != "llama3.1:8b" || body["stream"] != true {
+			t.Errorf("body = %v", body)
+		}
+		if opts := body["options"].(map[string]interface{}); opts["num_predict"] != float64(64) {
+			t.Errorf("options = %v", opts)
+		}
+
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		fmt.Fprintln(w, `{"model":"llama3.1:8b","message":{"role":"assistant","content":"Hel"},"done":false}`)
+		fmt.Fprintln(w, `{"model":"llama3.1:8b","message":{"role":"assistant","content":"lo"},"done":false}`)
+		fmt.Fprintln(w, `{"model":"llama3.1:8b","message":{"role":"assistant","content":""},"done":true,"done_reason":"stop","prompt_eval_count":9,"eval_count":2}`)
+	}))
+	defer server.Close()
+
+	provider := providers.NewLocalProvider()
+	deployment := newLocalDeployment(server.URL, "ollama", "llama3.1:8b")
+	req := &providers.UnifiedRequest{Messages: []providers.Message{{Role: "user", Content: "Hi"}}, MaxTokens: 64, Stream: true}
+
+	providerReq, err := provider.TranslateRequest(context.Background(), req, deployment)
+	if err != nil {
+		t.Fatalf("TranslateRequest: %v", err)
+	}
+
+	stream := make(chan providers.StreamChunk)
+	go provider.Stream(context.Background(), providerReq, stream)
+
+	content, finish, usage := collectStream(t, stream)
+	if content != "Hello" || finish != "stop" {
+		t.Errorf("content = %q, finish_reason = %q", content, finish)
+	}
+	if usage == nil || usage.TotalTokens != 11 {
+		t.Errorf("usage = %+v", usage)
+	}
+}
+
+func TestLocalLlamaCppCompletion(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/completion" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		if body["prompt"] != "System: Be terse.\nUser: Hi\nAssistant:" {
+			t.Errorf("prompt = %q", body["prompt"])
+		}
+		fmt.Fprint(w, `{"content":" Hello.","stop":true,"stopped_limit":true,"tokens_predicted":3,"tokens_evaluated":12}`)
+	}))
+	defer server.Close()
+
+	provider := providers.NewLocalProvider()
+	deployment := newLocalDeployment(server.URL, "llamacpp", "")
+	req := &providers.UnifiedRequest{Messages: []providers.Message{
+		{Role: "system", Content: "Be terse."},
+		{Role: "user", Content: "Hi"},
+	}}
+
+	if err := provider.ValidateConfig(deployment); err != nil {
+		t.Fatalf("ValidateConfig: %v", err)
+	}
+
+	providerReq, err := provider.TranslateRequest(context.Background(), req, deployment)
+	if err != nil {
+		t.Fatalf("TranslateRequest: %v", err)
+	}
+	resp, err := provider.Execute(context.Background(), providerReq)
+	if err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	unified, err := provider.TranslateResponse(context.Background(), resp, deployment)
+	if err != nil {
+		t.Fatalf("TranslateResponse: %v", err)
+	}
+
+	if unified.Choices[0].Message.Content != " Hello." || unified.Choices[0].FinishReason != "length" {
+		t.Errorf("choice = %+v", unified.Choices[0])
+	}
+	if unified.Usage.TotalTokens != 15 {
+		t.Errorf("usage = %+v", unified.Usage)
+	}
+}
+
+func TestLocalHealthCheckUsesTags(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/tags" {
+			t.Errorf("health check should not generate tokens, hit %s", r.URL.Path)
+		}
+		fmt.Fprint(w, `{"models":[{"name":"llama3.1:8b","model":"llama3.1:8b"},{"name":"mistral:latest","model":"mistral:latest"}]}`)
+	}))
+	defer server.Close()
+
+	provider := providers.NewLocalProvider()
+
+	if err := provider.HealthCheck(context.Background(), newLocalDeployment(server.URL, "ollama", "llama3.1:8b")); err != nil {
+		t.Errorf("pulled model reported unhealthy: %v", err)
+	}
+	if err := provider.HealthCheck(context.Background(), newLocalDeployment(server.URL, "ollama", "mistral")); err != nil {
+		t.Errorf("implicit :latest tag not matched: %v", err)
+	}
+	if err := provider.HealthCheck(context.Background(), newLocalDeployment(server.URL, "ollama", "qwen2:7b")); err == nil {
+		t.Error("expected an error for a model that is not pulled")
+	}
+}
+
+func TestLocalOllamaEmbeddings(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Model string   `json:"model"`
+			Input []string `json:"input"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		if r.URL.Path != "/api/embed" || body.Model != "nomic-embed-text" || len(body.Input) != 2 {
+			t.Errorf("unexpected request %s %+v", r.URL.Path, body)
+		}
+		fmt.Fprint(w, `{"model":"nomic-embed-text","embeddings":[[0.1,0.2],[0.3,0.4]],"prompt_eval_count":5}`)
+	}))
+	defer server.Close()
+
+	provider := providers.NewLocalProvider()
+	deployment := newLocalDeployment(server.URL, "ollama", "nomic-embed-text")
+
+	req := &providers.EmbeddingRequest{Input: []string{"a", "b"}}
+	providerReq, err := provider.TranslateEmbeddingRequest(context.Background(), req, deployment)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := provider.Execute(context.Background(), providerReq)
+	if err != nil {
+		t.Fatal(err)
+	}
+	embeddingResp, err := provider.TranslateEmbeddingResponse(context.Background(), resp, deployment)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(embeddingResp.Data) != 2 || embeddingResp.Data[1].Index != 1 || embeddingResp.Data[1].Embedding[0] != 0.3 {
+		t.Errorf("embeddings = %+v", embeddingResp.Data)
+	}
+	if embeddingResp.Usage.PromptTokens != 5 || embeddingResp.Usage.TotalTokens != 5 {
+		t.Errorf("usage = %+v", embeddingResp.Usage)
+	}
+}
@@ -0,0 +1,665 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"math/rand"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"ch.at/models"
+)
+
+// MockProvider is a deterministic, in-process provider for hermetic tests
+// and demos. It never touches the network; behaviour comes from the
+// deployment's parameters in deployments.yaml:
+//
+//	parameters:
+//	  mode: "script"          # echo (default), fixed or script
+//	  response: "fallback"    # reply for fixed mode, or when no rule matches
+//	  script:                 # first matching regex wins; $1 expands groups
+//	    - match: "(?i)repeat verbatim the word (\\S+)"
+//	      response: "$1"
+//	  latency: 50ms           # delay before the first byte
+//	  token_delay: 10ms       # delay between streamed tokens
+//	  error_rate: 0.1         # fraction of calls that fail
+//	  error_status: 503
+//	  error_message: "mock upstream unavailable"
+//	  seed: 42                # seeds the error-rate RNG
+//	  healthy: true           # what HealthCheck reports
+//	  call_tools: true        # call the first offered tool instead of replying
+//	  tool_arguments: '{"city":"Paris"}'
+//	  dimensions: 64          # embedding size, unless the request asks for one
+//
+// With call_tools set, a request that offers tools gets a tool call back;
+// once the conversation ends with a tool result, the mock replies normally
+// using that result as its input. Embeddings are hashed bags of words, so
+// texts that share words get similar vectors.
+type MockProvider struct {
+	mu      sync.Mutex
+	configs map[string]*mockConfig // keyed by deployment ID
+	rngs    map[string]*rand.Rand  // per-deployment error injection RNGs
+	counter int64
+}
+
+// mockConfig is the parsed form of a mock deployment's parameters
+type mockConfig struct {
+	mode         string
+	response     string
+	script       []mockRule
+	latency      time.Duration
+	tokenDelay   time.Duration
+	errorRate    float64
+	errorStatus  int
+	errorMessage string
+	seed         int64
+	healthy      bool
+	callTools    bool
+	toolArgs     string
+	dimensions   int
+}
+
+// mockRule is one scripted regex → response entry
+type mockRule struct {
+	pattern  *regexp.Regexp
+	response string
+}
+
+// mockCall is the ProviderRequest body: the reply is decided at translate
+// time, failures and timing at execute time
+type mockCall struct {
+	DeploymentID string        `json:"deployment_id"`
+	Model        string        `json:"model"`
+	Reply        string        `json:"reply"`
+	PromptTokens int           `json:"prompt_tokens"`
+	MaxTokens    int           `json:"max_tokens"`
+	Latency      time.Duration `json:"latency"`
+	TokenDelay   time.Duration `json:"token_delay"`
+	ToolCall     *ToolCall     `json:"tool_call,omitempty"` // Returned instead of Reply
+}
+
+// mockEmbedCall is the ProviderRequest body of an embeddings request
+type mockEmbedCall struct {
+	DeploymentID string        `json:"deployment_id"`
+	Model        string        `json:"model"`
+	Input        []string      `json:"input"`
+	Dimensions   int           `json:"dimensions"`
+	Latency      time.Duration `json:"latency"`
+}
+
+// NewMockProvider creates a new mock provider
+func NewMockProvider() *MockProvider {
+	return &MockProvider{
+		configs: make(map[string]*mockConfig),
+		rngs:    make(map[string]*rand.Rand),
+	}
+}
+
+// TranslateRequest resolves the scripted reply for the conversation
+func (m *MockProvider) TranslateRequest(ctx context.Context, req *UnifiedRequest, deployment *models.Deployment) (*ProviderRequest, error) {
+	cfg, err := m.config(deployment)
+	if err != nil {
+		return nil, err
+	}
+
+	var prompt, lastUser string
+	for _, msg := range req.Messages {
+		prompt += msg.Content + "\n"
+		if msg.Role == "user" || msg.Role == "tool" {
+			lastUser = msg.Content
+		}
+	}
+
+	var toolCall *ToolCall
+	answeringTool := len(req.Messages) > 0 && req.Messages[len(req.Messages)-1].Role == "tool"
+	if mode, name := toolChoice(req.ToolChoice); cfg.callTools && req.HasTools() && !answeringTool && mode != toolChoiceNone {
+		if mode != toolChoiceFunction {
+			name = toolFunctions(req)[0].Name
+		}
+		toolCall = &ToolCall{
+			ID:       syntheticToolCallID(m.nextID(), 0),
+			Type:     "function",
+			Function: FunctionCall{Name: name, Arguments: cfg.toolArgs},
+		}
+	}
+
+	return &ProviderRequest{
+		URL:    "mock://" + deployment.ID,
+		Method: "POST",
+		Body: &mockCall{
+			DeploymentID: deployment.ID,
+			Model:        deployment.ProviderModelID,
+			Reply:        cfg.reply(lastUser),
+			PromptTokens: len(strings.Fields(prompt)),
+			MaxTokens:    req.MaxTokens,
+			Latency:      cfg.latency,
+			TokenDelay:   cfg.tokenDelay,
+			ToolCall:     toolCall,
+		},
+		Timeout: deployment.Endpoint.Timeout,
+	}, nil
+}
+
+// Execute simulates latency and injected failures, then returns an
+// OpenAI-format completion
+func (m *MockProvider) Execute(ctx context.Context, req *ProviderRequest) (*ProviderResponse, error) {
+	if call, ok := req.Body.(*mockEmbedCall); ok {
+		return m.executeEmbedding(ctx, call)
+	}
+
+	call, ok := req.Body.(*mockCall)
+	if !ok {
+		return nil, fmt.Errorf("mock provider received a non-mock request")
+	}
+
+	if err := sleepContext(ctx, call.Latency); err != nil {
+		return nil, newTransportError(err)
+	}
+
+	if status, body, failed := m.injectFailure(call.DeploymentID); failed {
+		return &ProviderResponse{StatusCode: status, Headers: map[string]string{}, Body: body}, nil
+	}
+
+	tokens := mockTokens(call.Reply, call.MaxTokens)
+	finishReason := "stop"
+	if len(tokens) < len(mockTokens(call.Reply, 0)) {
+		finishReason = "length"
+	}
+
+	message := map[string]interface{}{"role": "assistant", "content": strings.Join(tokens, "")}
+	if call.ToolCall != nil {
+		tokens = []string{call.ToolCall.Function.Arguments}
+		message = map[string]interface{}{"role": "assistant", "content": "", "tool_calls": []ToolCall{*call.ToolCall}}
+		finishReason = "tool_calls"
+	}
+
+	body, _ := json.Marshal(map[string]interface{}{
+		"id":      m.nextID(),
+		"object":  "chat.completion",
+		"created": time.Now().Unix(),
+		"model":   call.Model,
+		"choices": []map[string]interface{}{{
+			"index":         0,
+			"message":       message,
+			"finish_reason": finishReason,
+		}},
+		"usage": map[string]int{
+			"prompt_tokens":     call.PromptTokens,
+			"completion_tokens": len(tokens),
+			"total_tokens":      call.PromptTokens + len(tokens),
+		},
+	})
+
+	return &ProviderResponse{
+		StatusCode: http.StatusOK,
+		Headers:    map[string]string{"Content-Type": "application/json"},
+		Body:       body,
+	}, nil
+}
+
+// TranslateResponse converts the mock completion to unified format
+func (m *MockProvider) TranslateResponse(ctx context.Context, resp *ProviderResponse, deployment *models.Deployment) (*UnifiedResponse, error) {
+	if resp.StatusCode != http.StatusOK {
+		return nil, newStatusError("mock", resp.StatusCode, resp.Headers, openAIErrorMessage(resp.Body))
+	}
+
+	unifiedResp, err := parseOpenAIResponse(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	unifiedResp.Metadata["deployment_id"] = deployment.ID
+	unifiedResp.Metadata["provider"] = string(deployment.Provider)
+	unifiedResp.Metadata["provider_model"] = deployment.ProviderModelID
+
+	return unifiedResp, nil
+}
+
+// TranslateEmbeddingRequest captures the inputs and vector size
+func (m *MockProvider) TranslateEmbeddingRequest(ctx context.Context, req *EmbeddingRequest, deployment *models.Deployment) (*ProviderRequest, error) {
+	cfg, err := m.config(deployment)
+	if err != nil {
+		return nil, err
+	}
+
+	dimensions := req.Dimensions
+	if dimensions <= 0 {
+		dimensions = cfg.dimensions
+	}
+
+	return &ProviderRequest{
+		URL:    "mock://" + deployment.ID + "/embeddings",
+		Method: "POST",
+		Body: &mockEmbedCall{
+			DeploymentID: deployment.ID,
+			Model:        deployment.ProviderModelID,
+			Input:        req.Input,
+			Dimensions:   dimensions,
+			Latency:      cfg.latency,
+		},
+		Timeout: deployment.Endpoint.Timeout,
+	}, nil
+}
+
+// executeEmbedding returns an OpenAI-format embeddings response, subject
+// to the same latency and injected failures as completions
+func (m *MockProvider) executeEmbedding(ctx context.Context, call *mockEmbedCall) (*ProviderResponse, error) {
+	if err := sleepContext(ctx, call.Latency); err != nil {
+		return nil, newTransportError(err)
+	}
+
+	if status, body, failed := m.injectFailure(call.DeploymentID); failed {
+		return &ProviderResponse{StatusCode: status, Headers: map[string]string{}, Body: body}, nil
+	}
+
+	data := make([]map[string]interface{}, len(call.Input))
+	tokens := 0
+	for i, text := range call.Input {
+		data[i] = map[string]interface{}{
+			"object":    "embedding",
+			"index":     i,
+			"embedding": mockVector(text, call.Dimensions),
+		}
+		tokens += len(strings.Fields(text))
+	}
+
+	body, _ := json.Marshal(map[string]interface{}{
+		"object": "list",
+		"data":   data,
+		"model":  call.Model,
+		"usage": map[string]int{
+			"prompt_tokens": tokens,
+			"total_tokens":  tokens,
+		},
+	})
+
+	return &ProviderResponse{
+		StatusCode: http.StatusOK,
+		Headers:    map[string]string{"Content-Type": "application/json"},
+		Body:       body,
+	}, nil
+}
+
+// TranslateEmbeddingResponse converts the mock embeddings to unified format
+func (m *MockProvider) TranslateEmbeddingResponse(ctx context.Context, resp *ProviderResponse, deployment *models.Deployment) (*EmbeddingResponse, error) {
+	if resp.StatusCode != http.StatusOK {
+		return nil, newStatusError("mock", resp.StatusCode, resp.Headers, openAIErrorMessage(resp.Body))
+	}
+
+	embeddingResp, err := parseOpenAIEmbeddingResponse(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	setEmbeddingMetadata(embeddingResp, deployment)
+	return embeddingResp, nil
+}
+
+// Stream emits the reply one word-sized token at a time
+func (m *MockProvider) Stream(ctx context.Context, req *ProviderRequest, stream chan<- StreamChunk) error {
+	defer close(stream)
+
+	call, ok := req.Body.(*mockCall)
+	if !ok {
+		err := fmt.Errorf("mock provider received a non-mock request")
+		stream <- StreamChunk{Error: err}
+		return err
+	}
+
+	if err := sleepContext(ctx, call.Latency); err != nil {
+		err = newTransportError(err)
+		stream <- StreamChunk{Error: err}
+		return err
+	}
+
+	if status, body, failed := m.injectFailure(call.DeploymentID); failed {
+		err := newStatusError("mock", status, nil, openAIErrorMessage(body))
+		stream <- StreamChunk{Error: err}
+		return err
+	}
+
+	if call.ToolCall != nil {
+		stream <- StreamChunk{ToolCalls: toolCallDeltas([]ToolCall{*call.ToolCall}, 0)}
+		stream <- StreamChunk{
+			FinishReason: "tool_calls",
+			Usage:        &Usage{PromptTokens: call.PromptTokens, CompletionTokens: 1, TotalTokens: call.PromptTokens + 1},
+		}
+		stream <- StreamChunk{Done: true}
+		return nil
+	}
+
+	tokens := mockTokens(call.Reply, call.MaxTokens)
+	for i, token := range tokens {
+		if i > 0 {
+			if err := sleepContext(ctx, call.TokenDelay); err != nil {
+				stream <- StreamChunk{Error: err}
+				return err
+			}
+		}
+		stream <- StreamChunk{Data: token}
+	}
+
+	finishReason := "stop"
+	if len(tokens) < len(mockTokens(call.Reply, 0)) {
+		finishReason = "length"
+	}
+	stream <- StreamChunk{
+		FinishReason: finishReason,
+		Usage: &Usage{
+			PromptTokens:     call.PromptTokens,
+			CompletionTokens: len(tokens),
+			TotalTokens:      call.PromptTokens + len(tokens),
+		},
+	}
+	stream <- StreamChunk{Done: true}
+	return nil
+}
+
+// ValidateConfig parses the mock parameters, rejecting bad regexes or durations
+func (m *MockProvider) ValidateConfig(deployment *models.Deployment) error {
+	_, err := parseMockConfig(deployment.Parameters)
+	return err
+}
+
+// HealthCheck reports the configured health without any I/O
+func (m *MockProvider) HealthCheck(ctx context.Context, deployment *models.Deployment) error {
+	cfg, err := m.config(deployment)
+	if err != nil {
+		return err
+	}
+	if !cfg.healthy {
+		return fmt.Errorf("mock deployment configured unhealthy")
+	}
+	return nil
+}
+
+// EmbeddingHealthCheck is the same as HealthCheck; the mock doesn't make
+// calls to check
+func (m *MockProvider) EmbeddingHealthCheck(ctx context.Context, deployment *models.Deployment) error {
+	return m.HealthCheck(ctx, deployment)
+}
+
+// GetInfo returns provider information
+func (m *MockProvider) GetInfo() ProviderInfo {
+	return ProviderInfo{
+		Name:           "Mock Provider",
+		Version:        "1.0",
+		SupportsStream: true,
+		RequiresAuth:   false,
+		MaxRequestSize: 10 * 1024 * 1024, // 10MB
+		RateLimits:     map[string]int{},
+	}
+}
+
+// config returns the parsed parameters for a deployment, caching by ID
+func (m *MockProvider) config(deployment *models.Deployment) (*mockConfig, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if cfg, ok := m.configs[deployment.ID]; ok {
+		return cfg, nil
+	}
+
+	cfg, err := parseMockConfig(deployment.Parameters)
+	if err != nil {
+		return nil, fmt.Errorf("invalid mock parameters for %s: %w", deployment.ID, err)
+	}
+	m.configs[deployment.ID] = cfg
+	m.rngs[deployment.ID] = rand.New(rand.NewSource(cfg.seed))
+
+	return cfg, nil
+}
+
+// injectFailure rolls the deployment's error rate and builds an OpenAI-style error body
+func (m *MockProvider) injectFailure(deploymentID string) (int, []byte, bool) {
+	m.mu.Lock()
+	cfg := m.configs[deploymentID]
+	rng := m.rngs[deploymentID]
+	failed := cfg != nil && cfg.errorRate > 0 && rng.Float64() < cfg.errorRate
+	m.mu.Unlock()
+
+	if !failed {
+		return 0, nil, false
+	}
+
+	body, _ := json.Marshal(map[string]interface{}{
+		"error": map[string]string{
+			"message": cfg.errorMessage,
+			"type":    "mock_injected_error",
+		},
+	})
+	return cfg.errorStatus, body, true
+}
+
+// nextID returns a sequential, reproducible completion ID
+func (m *MockProvider) nextID() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.counter++
+	return fmt.Sprintf("chatcmpl-mock-%d", m.counter)
+}
+
+// reply picks the response for the last user message
+func (c *mockConfig) reply(input string) string {
+	switch c.mode {
+	case "fixed":
+		return c.response
+	case "script":
+		for _, rule := range c.script {
+			if match := rule.pattern.FindStringSubmatchIndex(input); match != nil {
+				return string(rule.pattern.ExpandString(nil, rule.response, input, match))
+			}
+		}
+		if c.response != "" {
+			return c.response
+		}
+	}
+	return input
+}
+
+// parseMockConfig reads deployment parameters into a mockConfig
+func parseMockConfig(params map[string]interface{}) (*mockConfig, error) {
+	cfg := &mockConfig{
+		mode:         "echo",
+		errorStatus:  http.StatusServiceUnavailable,
+		errorMessage: "mock injected failure",
+		healthy:      true,
+		toolArgs:     "{}",
+		dimensions:   64,
+	}
+
+	if v, ok := params["mode"].(string); ok && v != "" {
+		cfg.mode = strings.ToLower(v)
+	}
+	switch cfg.mode {
+	case "echo", "fixed", "script":
+	default:
+		return nil, fmt.Errorf("unknown mode %q (expected echo, fixed or script)", cfg.mode)
+	}
+
+	if v, ok := params["response"].(string); ok {
+		cfg.response = v
+	}
+	if v, ok := params["error_message"].(string); ok && v != "" {
+		cfg.errorMessage = v
+	}
+	if v, ok := params["healthy"].(bool); ok {
+		cfg.healthy = v
+	}
+	if v, ok := params["call_tools"].(bool); ok {
+		cfg.callTools = v
+	}
+	if v, ok := params["tool_arguments"].(string); ok && v != "" {
+		if !json.Valid([]byte(v)) {
+			return nil, fmt.Errorf("tool_arguments must be a JSON string, got %q", v)
+		}
+		cfg.toolArgs = v
+	}
+
+	var err error
+	if cfg.latency, err = mockDuration(params, "latency"); err != nil {
+		return nil, err
+	}
+	if cfg.tokenDelay, err = mockDuration(params, "token_delay"); err != nil {
+		return nil, err
+	}
+
+	if v, ok := mockNumber(params["error_rate"]); ok {
+		if v < 0 || v > 1 {
+			return nil, fmt.Errorf("error_rate must be between 0 and 1, got %v", v)
+		}
+		cfg.errorRate = v
+	}
+	if v, ok := mockNumber(params["error_status"]); ok {
+		cfg.errorStatus = int(v)
+	}
+	if v, ok := mockNumber(params["seed"]); ok {
+		cfg.seed = int64(v)
+	}
+	if v, ok := mockNumber(params["dimensions"]); ok {
+		if v < 1 {
+			return nil, fmt.Errorf("dimensions must be positive, got %v", v)
+		}
+		cfg.dimensions = int(v)
+	}
+
+	if raw, ok := params["script"]; ok {
+		rules, ok := raw.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("script must be a list of {match, response} entries")
+		}
+		for i, r := range rules {
+			entry, ok := r.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("script[%d] must be a {match, response} map", i)
+			}
+			match, _ := entry["match"].(string)
+			response, _ := entry["response"].(string)
+			pattern, err := regexp.Compile(match)
+			if err != nil {
+				return nil, fmt.Errorf("script[%d]: invalid regex: %w", i, err)
+			}
+			cfg.script = append(cfg.script, mockRule{pattern: pattern, response: response})
+		}
+	}
+
+	if cfg.mode == "script" && len(cfg.script) == 0 && cfg.response == "" {
+		return nil, fmt.Errorf("script mode needs script rules or a response")
+	}
+
+	return cfg, nil
+}
+
+// mockDuration reads a duration given as a string ("50ms") or a number of milliseconds
+func mockDuration(params map[string]interface{}, key string) (time.Duration, error) {
+	switch v := params[key].(type) {
+	case nil:
+		return 0, nil
+	case string:
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return 0, fmt.Errorf("invalid %s: %w", key, err)
+		}
+		return d, nil
+	default:
+		if ms, ok := mockNumber(v); ok {
+			return time.Duration(ms * float64(time.Millisecond)), nil
+		}
+		return 0, fmt.Errorf("invalid %s: %v", key, v)
+	}
+}
+
+// mockNumber accepts the numeric types YAML and JSON decoding produce
+func mockNumber(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case float64:
+		return n, true
+	default:
+		return 0, false
+	}
+}
+
+// mockTokens splits text into word-sized tokens that keep their trailing
+// whitespace, so joining them reproduces the text exactly. A positive limit
+// truncates the result.
+func mockTokens(text string, limit int) []string {
+	var tokens []string
+	start := 0
+	seenWord, prevSpace := false, false
+	for i, r := range text {
+		space := unicode.IsSpace(r)
+		if !space && prevSpace && seenWord {
+			// A new word starts: close the previous word and its trailing spaces
+			tokens = append(tokens, text[start:i])
+			start = i
+		}
+		if !space {
+			seenWord = true
+		}
+		prevSpace = space
+	}
+	if start < len(text) {
+		tokens = append(tokens, text[start:])
+	}
+
+	if limit > 0 && len(tokens) > limit {
+		tokens = tokens[:limit]
+	}
+	return tokens
+}
+
+// sleepContext waits for d or until the context is done
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// mockVector embeds text as a unit-length hashed bag of words: each
+// lowercased word adds ±1 to a bucket picked by its hash
+func mockVector(text string, dimensions int) []float64 {
+	vector := make([]float64, dimensions)
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for _, word := range words {
+		h := fnv.New32a()
+		h.Write([]byte(word))
+		sum := h.Sum32()
+		sign := 1.0
+		if sum&(1<<31) != 0 {
+			sign = -1
+		}
+		vector[int(sum%uint32(dimensions))] += sign
+	}
+
+	var norm float64
+	for _, v := range vector {
+		norm += v * v
+	}
+	if norm > 0 {
+		norm = math.Sqrt(norm)
+		for i := range vector {
+			vector[i] /= norm
+		}
+	}
+	return vector
+}
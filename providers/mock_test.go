@@ -0,0 +1,245 @@
+package providers_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"ch.at/models"
+	"ch.at/providers"
+)
+
+func newMockDeployment(id string, params map[string]interface{}) *models.Deployment {
+	return &models.Deployment{
+		ID:              id,
+		ModelID:         "llama-8b",
+		Provider:        models.ProviderMock,
+		ProviderModelID: "mock-llama",
+		Endpoint:        models.EndpointConfig{Auth: models.AuthConfig{Type: models.AuthNone}},
+		Parameters:      params,
+	}
+}
+
+func mockChat(provider *providers.MockProvider, deployment *models.Deployment, input string) (*providers.UnifiedResponse, error) {
+	req := &providers.UnifiedRequest{Messages: []providers.Message{{Role: "user", Content: input}}}
+	providerReq, err := provider.TranslateRequest(context.Background(), req, deployment)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := provider.Execute(context.Background(), providerReq)
+	if err != nil {
+		return nil, err
+	}
+	return provider.TranslateResponse(context.Background(), resp, deployment)
+}
+
+func TestMockEchoAndScript(t *testing.T) {
+	provider := providers.NewMockProvider()
+
+	echo := newMockDeployment("echo", nil)
+	resp, err := mockChat(provider, echo, "ping pong")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Choices[0].Message.Content != "ping pong" || resp.Usage.CompletionTokens != 2 {
+		t.Errorf("echo = %q, usage = %+v", resp.Choices[0].Message.Content, resp.Usage)
+	}
+
+	// Parameters as yaml.v3 decodes them
+	scripted := newMockDeployment("script", map[string]interface{}{
+		"mode": "script",
+		"script": []interface{}{
+			map[string]interface{}{"match": `(?i)repeat verbatim the word (\S+)`, "response": "$1"},
+		},
+		"response": "no match",
+	})
+	if err := provider.ValidateConfig(scripted); err != nil {
+		t.Fatalf("ValidateConfig: %v", err)
+	}
+
+	resp, err = mockChat(provider, scripted, "Please repeat verbatim the word pass")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := resp.Choices[0].Message.Content; got != "pass" {
+		t.Errorf("scripted reply = %q", got)
+	}
+
+	resp, _ = mockChat(provider, scripted, "something else")
+	if got := resp.Choices[0].Message.Content; got != "no match" {
+		t.Errorf("fallback reply = %q", got)
+	}
+}
+
+func TestMockStreamTokens(t *testing.T) {
+	provider := providers.NewMockProvider()
+	deployment := newMockDeployment("stream", map[string]interface{}{
+		"mode":        "fixed",
+		"response":    "one two  three",
+		"token_delay": "1ms",
+	})
+
+	req := &providers.UnifiedRequest{Messages: []providers.Message{{Role: "user", Content: "Hi"}}, Stream: true}
+	providerReq, err := provider.TranslateRequest(context.Background(), req, deployment)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stream := make(chan providers.StreamChunk)
+	go provider.Stream(context.Background(), providerReq, stream)
+
+	var tokens []string
+	var usage *providers.Usage
+	for chunk := range stream {
+		if chunk.Done {
+			break
+		}
+		if chunk.Data != "" {
+			tokens = append(tokens, chunk.Data)
+		}
+		if chunk.Usage != nil {
+			usage = chunk.Usage
+		}
+	}
+
+	if len(tokens) != 3 || tokens[0]+tokens[1]+tokens[2] != "one two  three" {
+		t.Errorf("tokens = %q", tokens)
+	}
+	if usage == nil || usage.CompletionTokens != 3 {
+		t.Errorf("usage = %+v", usage)
+	}
+}
+
+func TestMockErrorRateIsSeeded(t *testing.T) {
+	params := map[string]interface{}{
+		"error_rate":   0.5,
+		"error_status": 429,
+		"seed":         7,
+	}
+
+	outcomes := func() []bool {
+		provider := providers.NewMockProvider()
+		deployment := newMockDeployment("flaky", params)
+		var failed []bool
+		for i := 0; i < 20; i++ {
+			_, err := mockChat(provider, deployment, "hi")
+			failed = append(failed, err != nil)
+		}
+		return failed
+	}
+
+	first, second := outcomes(), outcomes()
+	failures := 0
+	for i := range first {
+		if first[i] != second[i] {
+			t.Fatalf("same seed produced different outcomes at call %d", i)
+		}
+		if first[i] {
+			failures++
+		}
+	}
+	if failures == 0 || failures == len(first) {
+		t.Errorf("expected a mix of failures, got %d/%d", failures, len(first))
+	}
+}
+
+func TestMockLatencyRespectsContext(t *testing.T) {
+	provider := providers.NewMockProvider()
+	deployment := newMockDeployment("slow", map[string]interface{}{"latency": 500})
+
+	req := &providers.UnifiedRequest{Messages: []providers.Message{{Role: "user", Content: "Hi"}}}
+	providerReq, err := provider.TranslateRequest(context.Background(), req, deployment)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	if _, err := provider.Execute(ctx, providerReq); err == nil {
+		t.Error("expected a timeout error")
+	}
+	if elapsed := time.Since(start); elapsed > 250*time.Millisecond {
+		t.Errorf("Execute ignored the context deadline (%v)", elapsed)
+	}
+}
+
+func TestMockToolCalls(t *testing.T) {
+	provider := providers.NewMockProvider()
+	deployment := newMockDeployment("tools", map[string]interface{}{"call_tools": true, "tool_arguments": `{"city":"Paris"}`})
+	tools := []providers.Tool{{Type: "function", Function: providers.Function{Name: "get_weather"}}}
+
+	chat := func(messages []providers.Message) *providers.UnifiedResponse {
+		req := &providers.UnifiedRequest{Messages: messages, Tools: tools}
+		providerReq, err := provider.TranslateRequest(context.Background(), req, deployment)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := provider.Execute(context.Background(), providerReq)
+		if err != nil {
+			t.Fatal(err)
+		}
+		unified, err := provider.TranslateResponse(context.Background(), resp, deployment)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return unified
+	}
+
+	messages := []providers.Message{{Role: "user", Content: "weather?"}}
+	resp := chat(messages)
+	calls := resp.Choices[0].Message.ToolCalls
+	if resp.Choices[0].FinishReason != "tool_calls" || len(calls) != 1 || calls[0].Function.Name != "get_weather" || calls[0].Function.Arguments != `{"city":"Paris"}` {
+		t.Fatalf("expected a get_weather call, got %+v", resp.Choices[0])
+	}
+
+	// Once the tool has answered the mock replies with the result
+	messages = append(messages,
+		providers.Message{Role: "assistant", ToolCalls: calls},
+		providers.Message{Role: "tool", ToolCallID: calls[0].ID, Content: "sunny"},
+	)
+	resp = chat(messages)
+	if resp.Choices[0].Message.Content != "sunny" || len(resp.Choices[0].Message.ToolCalls) != 0 {
+		t.Errorf("expected the tool result echoed back, got %+v", resp.Choices[0])
+	}
+}
+
+func TestMockEmbeddings(t *testing.T) {
+	provider := providers.NewMockProvider()
+	deployment := newMockDeployment("embed", map[string]interface{}{"dimensions": 16})
+
+	embed := func(req *providers.EmbeddingRequest) *providers.EmbeddingResponse {
+		t.Helper()
+		providerReq, err := provider.TranslateEmbeddingRequest(context.Background(), req, deployment)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := provider.Execute(context.Background(), providerReq)
+		if err != nil {
+			t.Fatal(err)
+		}
+		embeddingResp, err := provider.TranslateEmbeddingResponse(context.Background(), resp, deployment)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return embeddingResp
+	}
+
+	resp := embed(&providers.EmbeddingRequest{Input: []string{"red apple", "Red apple!", "blue sky"}})
+	if len(resp.Data) != 3 || len(resp.Data[0].Embedding) != 16 {
+		t.Fatalf("got %d embeddings of size %d", len(resp.Data), len(resp.Data[0].Embedding))
+	}
+	if resp.Usage.PromptTokens != 6 {
+		t.Errorf("prompt tokens = %d", resp.Usage.PromptTokens)
+	}
+	for i, v := range resp.Data[0].Embedding {
+		if v != resp.Data[1].Embedding[i] {
+			t.Fatal("case and punctuation should not change the embedding")
+		}
+	}
+
+	if resp := embed(&providers.EmbeddingRequest{Input: []string{"x"}, Dimensions: 8}); len(resp.Data[0].Embedding) != 8 {
+		t.Errorf("requested dimensions ignored: %d", len(resp.Data[0].Embedding))
+	}
+}
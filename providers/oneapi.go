@@ -1,11 +1,11 @@
 package providers
 
 import (
-	"bufio"
 	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"strings"
 	"time"
@@ -29,118 +29,89 @@ func NewOneAPIProvider() *OneAPIProvider {
 
 // TranslateRequest converts unified request to OneAPI format
 func (o *OneAPIProvider) TranslateRequest(ctx context.Context, req *UnifiedRequest, deployment *models.Deployment) (*ProviderRequest, error) {
-	// For one-api, use the provider:model format from ProviderModelID
-	modelName := deployment.ProviderModelID
-	
-	// Strip provider prefix if present (e.g., "openai:gpt-3.5-turbo" -> "gpt-3.5-turbo")
-	// The provider info is already encoded in the API key suffix
-	if colonIdx := strings.Index(modelName, ":"); colonIdx != -1 {
-		modelName = modelName[colonIdx+1:]
-	}
-
 	// Build OpenAI-compatible request body
-	body := map[string]interface{}{
-		"model":    modelName, // Now just the model name without provider prefix
-		"messages": req.Messages,
-		"stream":   req.Stream,
-	}
-
-	// Add optional parameters
-	if req.Temperature > 0 {
-		body["temperature"] = req.Temperature
-	}
-	if req.MaxTokens > 0 {
-		body["max_tokens"] = req.MaxTokens
-	}
-	if req.TopP > 0 {
-		body["top_p"] = req.TopP
-	}
-	if len(req.Stop) > 0 {
-		body["stop"] = req.Stop
-	}
-	if len(req.Functions) > 0 {
-		body["functions"] = req.Functions
-	}
-	if req.ResponseFormat != nil {
-		body["response_format"] = req.ResponseFormat
-	}
-	if req.User != "" {
-		body["user"] = req.User
-	}
-
-	// Build headers
-	headers := map[string]string{
-		"Content-Type": "application/json",
-	}
+	body := buildOpenAIBody(req)
+	body["model"] = oneAPIModelName(deployment) // Just the model name without provider prefix
 
-	// Add authentication if configured
-	if deployment.Endpoint.Auth.Type == models.AuthAPIKey && deployment.Endpoint.Auth.APIKey != "" {
-		headers["Authorization"] = "Bearer " + deployment.Endpoint.Auth.APIKey
-	}
+	return &ProviderRequest{
+		URL:     deployment.Endpoint.BaseURL + "/v1/chat/completions",
+		Method:  "POST",
+		Headers: oneAPIHeaders(deployment),
+		Body:    body,
+		Timeout: deployment.Endpoint.Timeout,
+	}, nil
+}
 
-	// Add custom headers
-	for k, v := range deployment.Endpoint.CustomHeaders {
-		headers[k] = v
-	}
+// TranslateEmbeddingRequest converts an embeddings request to OneAPI format
+func (o *OneAPIProvider) TranslateEmbeddingRequest(ctx context.Context, req *EmbeddingRequest, deployment *models.Deployment) (*ProviderRequest, error) {
+	body := buildOpenAIEmbeddingBody(req)
+	body["model"] = oneAPIModelName(deployment)
 
 	return &ProviderRequest{
-		URL:     deployment.Endpoint.BaseURL + "/v1/chat/completions",
+		URL:     deployment.Endpoint.BaseURL + "/v1/embeddings",
 		Method:  "POST",
-		Headers: headers,
+		Headers: oneAPIHeaders(deployment),
 		Body:    body,
 		Timeout: deployment.Endpoint.Timeout,
 	}, nil
 }
 
-// Execute sends the request to OneAPI
-func (o *OneAPIProvider) Execute(ctx context.Context, req *ProviderRequest) (*ProviderResponse, error) {
-	// Marshal body to JSON
-	jsonBody, err := json.Marshal(req.Body)
-	if err != nil {
-		return nil, fmt.Errorf("failed to marshal request body: %w", err)
+// TranslateEmbeddingResponse converts a OneAPI embeddings response to unified format
+func (o *OneAPIProvider) TranslateEmbeddingResponse(ctx context.Context, resp *ProviderResponse, deployment *models.Deployment) (*EmbeddingResponse, error) {
+	if resp.StatusCode != http.StatusOK {
+		return nil, newStatusError("oneapi", resp.StatusCode, resp.Headers, openAIErrorMessage(resp.Body))
 	}
 
-	// Create HTTP request
-	httpReq, err := http.NewRequestWithContext(ctx, req.Method, req.URL, bytes.NewBuffer(jsonBody))
+	embeddingResp, err := parseOpenAIEmbeddingResponse(resp.Body)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+		return nil, err
 	}
+	setEmbeddingMetadata(embeddingResp, deployment)
+	return embeddingResp, nil
+}
 
-	// Set headers
-	for k, v := range req.Headers {
-		httpReq.Header.Set(k, v)
-	}
+// EmbeddingHealthCheck performs a health check on OneAPI embedding models
+func (o *OneAPIProvider) EmbeddingHealthCheck(ctx context.Context, deployment *models.Deployment) error {
+	return checkEmbeddings(ctx, o, o, deployment)
+}
 
-	// Execute request
-	resp, err := o.client.Do(httpReq)
-	if err != nil {
-		return nil, fmt.Errorf("request failed: %w", err)
+// oneAPIModelName strips the provider prefix from ProviderModelID
+// (e.g., "openai:gpt-3.5-turbo" -> "gpt-3.5-turbo"). The provider info is
+// already encoded in the API key suffix.
+func oneAPIModelName(deployment *models.Deployment) string {
+	modelName := deployment.ProviderModelID
+	if colonIdx := strings.Index(modelName, ":"); colonIdx != -1 {
+		modelName = modelName[colonIdx+1:]
 	}
-	defer resp.Body.Close()
+	return modelName
+}
 
-	// Read response body
-	var body json.RawMessage
-	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
-		return nil, fmt.Errorf("failed to decode response: %w", err)
+// oneAPIHeaders builds the request headers, with authentication if configured
+func oneAPIHeaders(deployment *models.Deployment) map[string]string {
+	headers := map[string]string{
+		"Content-Type": "application/json",
 	}
-
-	// Extract response headers
-	headers := make(map[string]string)
-	for k := range resp.Header {
-		headers[k] = resp.Header.Get(k)
+	if deployment.Endpoint.Auth.Type == models.AuthAPIKey && deployment.Endpoint.Auth.APIKey != "" {
+		headers["Authorization"] = "Bearer " + deployment.Endpoint.Auth.APIKey
 	}
+	for k, v := range deployment.Endpoint.CustomHeaders {
+		headers[k] = v
+	}
+	return headers
+}
 
-	return &ProviderResponse{
-		StatusCode: resp.StatusCode,
-		Headers:    headers,
-		Body:       body,
-	}, nil
+// Execute sends the request to OneAPI
+func (o *OneAPIProvider) Execute(ctx context.Context, req *ProviderRequest) (*ProviderResponse, error) {
+	// Gateways can return plain-text or HTML error pages, so the body is not assumed to be JSON
+	return executeRequest(ctx, o.client, req)
 }
 
 // TranslateResponse converts OneAPI response to unified format
 func (o *OneAPIProvider) TranslateResponse(ctx context.Context, resp *ProviderResponse, deployment *models.Deployment) (*UnifiedResponse, error) {
-	// Process response
-	
+	if resp.StatusCode != http.StatusOK {
+		return nil, newStatusError("oneapi", resp.StatusCode, resp.Headers, openAIErrorMessage(resp.Body))
+	}
+
 	// OneAPI already returns OpenAI-compatible format
 	var unifiedResp UnifiedResponse
 	if err := json.Unmarshal(resp.Body, &unifiedResp); err != nil {
@@ -186,57 +157,21 @@ func (o *OneAPIProvider) Stream(ctx context.Context, req *ProviderRequest, strea
 
 	resp, err := o.client.Do(httpReq)
 	if err != nil {
+		err = newTransportError(err)
 		stream <- StreamChunk{Error: err}
 		return err
 	}
 	defer resp.Body.Close()
 
-	// Parse SSE stream (Server-Sent Events format)
-	scanner := bufio.NewScanner(resp.Body)
-	for scanner.Scan() {
-		line := scanner.Text()
-		
-		// SSE lines start with "data: "
-		if strings.HasPrefix(line, "data: ") {
-			data := strings.TrimPrefix(line, "data: ")
-			
-			// Check for stream end
-			if data == "[DONE]" {
-				stream <- StreamChunk{Done: true}
-				return nil
-			}
-			
-			// Parse the JSON to extract content
-			var chunk map[string]interface{}
-			if err := json.Unmarshal([]byte(data), &chunk); err != nil {
-				// Skip malformed JSON
-				continue
-			}
-			
-			// Extract the actual content from the chunk
-			// Format: {"choices": [{"delta": {"content": "text"}}]}
-			if choices, ok := chunk["choices"].([]interface{}); ok && len(choices) > 0 {
-				if choice, ok := choices[0].(map[string]interface{}); ok {
-					if delta, ok := choice["delta"].(map[string]interface{}); ok {
-						if content, ok := delta["content"].(string); ok && content != "" {
-							// Send ONLY the actual text content
-							stream <- StreamChunk{
-								Data: content,
-								Done: false,
-							}
-						}
-					}
-				}
-			}
-		}
-	}
-	
-	if err := scanner.Err(); err != nil {
+	if resp.StatusCode != http.StatusOK {
+		raw, _ := io.ReadAll(resp.Body)
+		err := newStatusError("oneapi", resp.StatusCode, flattenHeaders(resp.Header), openAIErrorMessage(raw))
 		stream <- StreamChunk{Error: err}
 		return err
 	}
-	
-	return nil
+
+	// Parse SSE stream (Server-Sent Events format)
+	return readOpenAIStream(resp.Body, stream)
 }
 
 // ValidateConfig validates OneAPI deployment configuration
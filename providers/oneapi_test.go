@@ -47,9 +47,9 @@ func TestOneAPIStreamingSSEFormat(t *testing.T) {
 		ModelID:         "llama-8b",
 		Provider:        models.ProviderOneAPI,
 		ProviderModelID: "llama-3-8b",
-		Endpoint: models.Endpoint{
+		Endpoint: models.EndpointConfig{
 			BaseURL: baseURL,
-			Auth: models.Auth{
+			Auth: models.AuthConfig{
 				Type:   models.AuthAPIKey,
 				APIKey: apiKey,
 			},
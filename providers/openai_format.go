@@ -0,0 +1,150 @@
+package providers
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// buildOpenAIBody builds an OpenAI chat completions body without the model field.
+// Callers add "model" when the endpoint expects it (Azure takes it from the URL).
+func buildOpenAIBody(req *UnifiedRequest) map[string]interface{} {
+	body := map[string]interface{}{
+		"messages": req.Messages,
+		"stream":   req.Stream,
+	}
+
+	if req.Temperature > 0 {
+		body["temperature"] = req.Temperature
+	}
+	if req.MaxTokens > 0 {
+		body["max_tokens"] = req.MaxTokens
+	}
+	if req.TopP > 0 {
+		body["top_p"] = req.TopP
+	}
+	if len(req.Stop) > 0 {
+		body["stop"] = req.Stop
+	}
+	if len(req.Functions) > 0 {
+		body["functions"] = req.Functions
+	}
+	if len(req.Tools) > 0 {
+		body["tools"] = req.Tools
+		if req.ToolChoice != nil {
+			body["tool_choice"] = req.ToolChoice
+		}
+	}
+	if req.ResponseFormat != nil {
+		body["response_format"] = req.ResponseFormat
+	}
+	if req.User != "" {
+		body["user"] = req.User
+	}
+
+	return body
+}
+
+// parseOpenAIResponse decodes an OpenAI-compatible chat completion
+func parseOpenAIResponse(body []byte) (*UnifiedResponse, error) {
+	var unifiedResp UnifiedResponse
+	if err := json.Unmarshal(body, &unifiedResp); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+	if unifiedResp.Metadata == nil {
+		unifiedResp.Metadata = make(map[string]interface{})
+	}
+	return &unifiedResp, nil
+}
+
+// openAIStreamChunk is a single chat.completion.chunk SSE payload
+type openAIStreamChunk struct {
+	Choices []struct {
+		Delta struct {
+			Content   string `json:"content"`
+			ToolCalls []struct {
+				Index    int    `json:"index"`
+				ID       string `json:"id"`
+				Function struct {
+					Name      string `json:"name"`
+					Arguments string `json:"arguments"`
+				} `json:"function"`
+			} `json:"tool_calls"`
+		} `json:"delta"`
+		FinishReason *string `json:"finish_reason"`
+	} `json:"choices"`
+	Usage *Usage `json:"usage"`
+}
+
+// readOpenAIStream parses an OpenAI-style SSE stream into stream chunks
+func readOpenAIStream(r io.Reader, stream chan<- StreamChunk) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+		data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+
+		if data == "[DONE]" {
+			stream <- StreamChunk{Done: true}
+			return nil
+		}
+
+		var chunk openAIStreamChunk
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			// Skip malformed JSON
+			continue
+		}
+
+		if len(chunk.Choices) > 0 {
+			choice := chunk.Choices[0]
+			if choice.Delta.Content != "" {
+				stream <- StreamChunk{Data: choice.Delta.Content}
+			}
+			if len(choice.Delta.ToolCalls) > 0 {
+				deltas := make([]ToolCallDelta, len(choice.Delta.ToolCalls))
+				for i, call := range choice.Delta.ToolCalls {
+					deltas[i] = ToolCallDelta{
+						Index:     call.Index,
+						ID:        call.ID,
+						Name:      call.Function.Name,
+						Arguments: call.Function.Arguments,
+					}
+				}
+				stream <- StreamChunk{ToolCalls: deltas}
+			}
+			if choice.FinishReason != nil && *choice.FinishReason != "" {
+				stream <- StreamChunk{FinishReason: *choice.FinishReason}
+			}
+		}
+
+		// Usage arrives in a trailing chunk with no choices when requested
+		if chunk.Usage != nil {
+			stream <- StreamChunk{Usage: chunk.Usage}
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		stream <- StreamChunk{Error: err}
+		return err
+	}
+
+	return nil
+}
+
+// openAIErrorMessage extracts the message from an OpenAI-style error body
+func openAIErrorMessage(body []byte) string {
+	var errResp struct {
+		Error struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(body, &errResp); err == nil && errResp.Error.Message != "" {
+		return errResp.Error.Message
+	}
+	return string(body)
+}
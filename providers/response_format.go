@@ -0,0 +1,315 @@
+package providers
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Response format types
+const (
+	ResponseFormatText       = "text"
+	ResponseFormatJSONObject = "json_object"
+	ResponseFormatJSONSchema = "json_schema"
+)
+
+// OutputValidationError reports model output that does not match the
+// requested response format
+type OutputValidationError struct {
+	Format string // Response format type that was requested
+	Path   string // Location of the first violation, "$" for the root
+	Reason string
+	Output string // The rejected output
+}
+
+func (e *OutputValidationError) Error() string {
+	return fmt.Sprintf("model output does not match response_format %s at %s: %s", e.Format, e.Path, e.Reason)
+}
+
+// WantsJSON reports whether the format asks for JSON output
+func (f *ResponseFormat) WantsJSON() bool {
+	return f != nil && (f.Type == ResponseFormatJSONObject || f.Type == ResponseFormatJSONSchema)
+}
+
+// Validate checks the response format itself, as sent by the client
+func (f *ResponseFormat) Validate() error {
+	if f == nil {
+		return nil
+	}
+	switch f.Type {
+	case ResponseFormatText, ResponseFormatJSONObject:
+		return nil
+	case ResponseFormatJSONSchema:
+		if f.JSONSchema == nil || f.JSONSchema.Name == "" {
+			return fmt.Errorf("response_format json_schema requires json_schema.name")
+		}
+		return nil
+	}
+	return fmt.Errorf("unsupported response_format type %q", f.Type)
+}
+
+// schema returns the schema output must match; json_object only needs an object
+func (f *ResponseFormat) schema() map[string]interface{} {
+	if f.Type == ResponseFormatJSONSchema && f.JSONSchema.Schema != nil {
+		return f.JSONSchema.Schema
+	}
+	return map[string]interface{}{"type": "object"}
+}
+
+// Instructions describes the format for models without native JSON support
+func (f *ResponseFormat) Instructions() string {
+	if f.Type != ResponseFormatJSONSchema {
+		return "Respond with a single valid JSON object and nothing else: no prose and no code fences."
+	}
+	schema, _ := json.Marshal(f.schema())
+	instructions := "Respond with a single JSON value that matches the JSON Schema below and nothing else: no prose and no code fences."
+	if f.JSONSchema.Description != "" {
+		instructions += "\n" + f.JSONSchema.Description
+	}
+	return instructions + "\n\nSchema " + f.JSONSchema.Name + ":\n" + string(schema)
+}
+
+// Check validates model output against the format and returns it as bare
+// JSON. Code fences around the JSON are tolerated and stripped, since
+// models without a native JSON mode add them despite instructions.
+func (f *ResponseFormat) Check(output string) (string, error) {
+	text := strings.TrimSpace(output)
+	if strings.HasPrefix(text, "```") {
+		text = strings.TrimPrefix(text, "```")
+		text = strings.TrimPrefix(text, "json")
+		text = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(text), "```"))
+	}
+
+	fail := func(path, reason string) (string, error) {
+		return "", &OutputValidationError{Format: f.Type, Path: path, Reason: reason, Output: output}
+	}
+
+	decoder := json.NewDecoder(strings.NewReader(text))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return fail("$", "invalid JSON: "+err.Error())
+	}
+	if decoder.More() {
+		return fail("$", "unexpected content after the JSON value")
+	}
+	if path, reason := validateSchema(value, f.schema(), "$"); reason != "" {
+		return fail(path, reason)
+	}
+	return text, nil
+}
+
+// validateSchema checks value against a JSON Schema and returns the path and
+// reason of the first violation. It covers the keywords structured output
+// schemas use in practice: type, enum, const, properties, required,
+// additionalProperties, items, the combinators, and the common bounds.
+// Unknown keywords are ignored.
+func validateSchema(value interface{}, schema map[string]interface{}, path string) (string, string) {
+	if t, ok := schema["type"]; ok && !matchesType(value, t) {
+		return path, fmt.Sprintf("expected %v, got %s", t, jsonType(value))
+	}
+	if enum, ok := schema["enum"].([]interface{}); ok {
+		found := false
+		for _, candidate := range enum {
+			if jsonEqual(value, candidate) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return path, fmt.Sprintf("value is not one of %v", enum)
+		}
+	}
+	if c, ok := schema["const"]; ok && !jsonEqual(value, c) {
+		return path, fmt.Sprintf("value must be %v", c)
+	}
+
+	for _, key := range []string{"allOf", "anyOf", "oneOf"} {
+		subs, ok := schema[key].([]interface{})
+		if !ok {
+			continue
+		}
+		matched := 0
+		var firstPath, firstReason string
+		for _, sub := range subs {
+			subSchema, _ := sub.(map[string]interface{})
+			p, reason := validateSchema(value, subSchema, path)
+			if reason == "" {
+				matched++
+			} else if firstReason == "" {
+				firstPath, firstReason = p, reason
+			}
+		}
+		switch {
+		case key == "allOf" && matched < len(subs):
+			return firstPath, firstReason
+		case key == "anyOf" && matched == 0:
+			return path, "value matches none of anyOf: " + firstReason
+		case key == "oneOf" && matched != 1:
+			return path, fmt.Sprintf("value matches %d of oneOf, want exactly 1", matched)
+		}
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return validateObject(v, schema, path)
+	case []interface{}:
+		if n, ok := schemaNumber(schema, "minItems"); ok && float64(len(v)) < n {
+			return path, fmt.Sprintf("expected at least %v items", n)
+		}
+		if n, ok := schemaNumber(schema, "maxItems"); ok && float64(len(v)) > n {
+			return path, fmt.Sprintf("expected at most %v items", n)
+		}
+		if items, ok := schema["items"].(map[string]interface{}); ok {
+			for i, item := range v {
+				if p, reason := validateSchema(item, items, fmt.Sprintf("%s[%d]", path, i)); reason != "" {
+					return p, reason
+				}
+			}
+		}
+	case string:
+		length := float64(utf8.RuneCountInString(v))
+		if n, ok := schemaNumber(schema, "minLength"); ok && length < n {
+			return path, fmt.Sprintf("expected at least %v characters", n)
+		}
+		if n, ok := schemaNumber(schema, "maxLength"); ok && length > n {
+			return path, fmt.Sprintf("expected at most %v characters", n)
+		}
+		if pattern, ok := schema["pattern"].(string); ok {
+			if re, err := regexp.Compile(pattern); err == nil && !re.MatchString(v) {
+				return path, fmt.Sprintf("value does not match pattern %s", pattern)
+			}
+		}
+	case json.Number:
+		f, _ := v.Float64()
+		if n, ok := schemaNumber(schema, "minimum"); ok && f < n {
+			return path, fmt.Sprintf("value must be >= %v", n)
+		}
+		if n, ok := schemaNumber(schema, "maximum"); ok && f > n {
+			return path, fmt.Sprintf("value must be <= %v", n)
+		}
+		if n, ok := schemaNumber(schema, "exclusiveMinimum"); ok && f <= n {
+			return path, fmt.Sprintf("value must be > %v", n)
+		}
+		if n, ok := schemaNumber(schema, "exclusiveMaximum"); ok && f >= n {
+			return path, fmt.Sprintf("value must be < %v", n)
+		}
+	}
+	return path, ""
+}
+
+func validateObject(obj map[string]interface{}, schema map[string]interface{}, path string) (string, string) {
+	if required, ok := schema["required"].([]interface{}); ok {
+		for _, name := range required {
+			if key, ok := name.(string); ok {
+				if _, present := obj[key]; !present {
+					return path, fmt.Sprintf("missing required property %q", key)
+				}
+			}
+		}
+	}
+
+	properties, _ := schema["properties"].(map[string]interface{})
+	keys := make([]string, 0, len(obj))
+	for key := range obj {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		childPath := path + "." + key
+		if propSchema, ok := properties[key].(map[string]interface{}); ok {
+			if p, reason := validateSchema(obj[key], propSchema, childPath); reason != "" {
+				return p, reason
+			}
+			continue
+		}
+		switch extra := schema["additionalProperties"].(type) {
+		case bool:
+			if !extra {
+				return childPath, "additional property not allowed"
+			}
+		case map[string]interface{}:
+			if p, reason := validateSchema(obj[key], extra, childPath); reason != "" {
+				return p, reason
+			}
+		}
+	}
+	return path, ""
+}
+
+// matchesType checks a value against a "type" keyword, a name or a list of names
+func matchesType(value interface{}, t interface{}) bool {
+	switch t := t.(type) {
+	case string:
+		actual := jsonType(value)
+		return actual == t || (t == "number" && actual == "integer")
+	case []interface{}:
+		for _, name := range t {
+			if matchesType(value, name) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// jsonType names a decoded value's JSON Schema type
+func jsonType(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	case json.Number:
+		if f, err := v.Float64(); err == nil && f == math.Trunc(f) {
+			return "integer"
+		}
+		return "number"
+	}
+	return "unknown"
+}
+
+// jsonEqual compares decoded JSON values; numbers compare by value
+func jsonEqual(a, b interface{}) bool {
+	na, aNum := a.(json.Number)
+	if aNum {
+		fa, _ := na.Float64()
+		switch nb := b.(type) {
+		case float64:
+			return fa == nb
+		case json.Number:
+			fb, _ := nb.Float64()
+			return fa == fb
+		}
+		return false
+	}
+	ea, _ := json.Marshal(a)
+	eb, _ := json.Marshal(b)
+	return string(ea) == string(eb)
+}
+
+// schemaNumber reads a numeric keyword from a schema
+func schemaNumber(schema map[string]interface{}, key string) (float64, bool) {
+	switch n := schema[key].(type) {
+	case float64:
+		return n, true
+	case int:
+		return float64(n), true
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	}
+	return 0, false
+}
@@ -0,0 +1,75 @@
+package providers_test
+
+import (
+	"testing"
+
+	"ch.at/providers"
+)
+
+func TestResponseFormatCheck(t *testing.T) {
+	schema := &providers.ResponseFormat{
+		Type: providers.ResponseFormatJSONSchema,
+		JSONSchema: &providers.JSONSchema{
+			Name: "weather",
+			Schema: map[string]interface{}{
+				"type":     "object",
+				"required": []interface{}{"city", "temp"},
+				"properties": map[string]interface{}{
+					"city":  map[string]interface{}{"type": "string", "minLength": float64(1)},
+					"temp":  map[string]interface{}{"type": "number"},
+					"sky":   map[string]interface{}{"enum": []interface{}{"clear", "cloudy"}},
+					"hours": map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "integer"}},
+				},
+				"additionalProperties": false,
+			},
+		},
+	}
+
+	cases := []struct {
+		format *providers.ResponseFormat
+		output string
+		want   string // Bare JSON on success
+		path   string // Failing path otherwise
+	}{
+		{schema, `{"city":"Oslo","temp":4.5,"sky":"clear","hours":[1,2]}`, `{"city":"Oslo","temp":4.5,"sky":"clear","hours":[1,2]}`, ""},
+		{schema, "```json\n{\"city\":\"Oslo\",\"temp\":4}\n```", `{"city":"Oslo","temp":4}`, ""},
+		{schema, `{"city":"Oslo"}`, "", "$"},
+		{schema, `{"city":"Oslo","temp":"warm"}`, "", "$.temp"},
+		{schema, `{"city":"Oslo","temp":4,"sky":"rain"}`, "", "$.sky"},
+		{schema, `{"city":"Oslo","temp":4,"hours":[1,2.5]}`, "", "$.hours[1]"},
+		{schema, `{"city":"Oslo","temp":4,"wind":3}`, "", "$.wind"},
+		{schema, `Sure! {"city":"Oslo","temp":4}`, "", "$"},
+		{&providers.ResponseFormat{Type: providers.ResponseFormatJSONObject}, ` {"ok":true} `, `{"ok":true}`, ""},
+		{&providers.ResponseFormat{Type: providers.ResponseFormatJSONObject}, `[1,2]`, "", "$"},
+		{&providers.ResponseFormat{Type: providers.ResponseFormatJSONObject}, `{"a":1} {"b":2}`, "", "$"},
+	}
+
+	for _, tc := range cases {
+		got, err := tc.format.Check(tc.output)
+		if tc.path == "" {
+			if err != nil || got != tc.want {
+				t.Errorf("%s: got %q, %v", tc.output, got, err)
+			}
+			continue
+		}
+		verr, ok := err.(*providers.OutputValidationError)
+		if !ok {
+			t.Errorf("%s: expected a validation error, got %v", tc.output, err)
+			continue
+		}
+		if verr.Path != tc.path || verr.Output != tc.output {
+			t.Errorf("%s: path = %s (%s)", tc.output, verr.Path, verr.Reason)
+		}
+	}
+}
+
+func TestResponseFormatValidate(t *testing.T) {
+	for _, format := range []*providers.ResponseFormat{
+		{Type: "xml"},
+		{Type: providers.ResponseFormatJSONSchema},
+	} {
+		if err := format.Validate(); err == nil {
+			t.Errorf("expected %+v to be rejected", format)
+		}
+	}
+}
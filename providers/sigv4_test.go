@@ -0,0 +1,40 @@
+package providers
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"ch.at/models"
+)
+
+// get-vanilla vector from the AWS SigV4 test suite
+func TestSignSigV4Vector(t *testing.T) {
+	creds := &models.AWSAuth{
+		AccessKeyID:     "AKIDEXAMPLE",
+		SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+	}
+	now := time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC)
+
+	headers := map[string]string{}
+	if err := signSigV4("GET", "https://example.amazonaws.com/", headers, nil, creds, "us-east-1", "service", now); err != nil {
+		t.Fatal(err)
+	}
+	want := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, SignedHeaders=host;x-amz-date, Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31"
+	if headers["Authorization"] != want {
+		t.Errorf("get-vanilla Authorization =\n%s\nwant\n%s", headers["Authorization"], want)
+	}
+	if headers["X-Amz-Date"] != "20150830T123600Z" {
+		t.Errorf("X-Amz-Date = %q", headers["X-Amz-Date"])
+	}
+}
+
+func TestSigV4CanonicalURIDoubleEncodes(t *testing.T) {
+	u, err := url.Parse("https://bedrock-runtime.us-east-1.amazonaws.com/model/" + awsURIEncode("meta.llama3-8b-instruct-v1:0") + "/converse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := sigV4CanonicalURI(u); got != "/model/meta.llama3-8b-instruct-v1%253A0/converse" {
+		t.Errorf("canonical URI = %s", got)
+	}
+}
@@ -0,0 +1,117 @@
+package providers
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Tool choice modes after normalizing the OpenAI tool_choice forms
+const (
+	toolChoiceAuto     = "auto"
+	toolChoiceNone     = "none"
+	toolChoiceRequired = "required"
+	toolChoiceFunction = "function" // A specific function, named separately
+)
+
+// HasTools reports whether the request offers the model any tools
+func (r *UnifiedRequest) HasTools() bool {
+	return len(r.Tools) > 0 || len(r.Functions) > 0
+}
+
+// toolFunctions returns the functions offered by the request, merging
+// the legacy Functions field into Tools
+func toolFunctions(req *UnifiedRequest) []Function {
+	functions := make([]Function, 0, len(req.Tools)+len(req.Functions))
+	for _, tool := range req.Tools {
+		if tool.Type == "" || tool.Type == "function" {
+			functions = append(functions, tool.Function)
+		}
+	}
+	return append(functions, req.Functions...)
+}
+
+// toolChoice normalizes tool_choice to a mode and, for toolChoiceFunction,
+// the function name. Unset or unrecognized values mean auto.
+func toolChoice(choice interface{}) (mode, name string) {
+	switch v := choice.(type) {
+	case string:
+		switch v {
+		case toolChoiceNone, toolChoiceRequired:
+			return v, ""
+		case "any":
+			return toolChoiceRequired, ""
+		}
+	case map[string]interface{}:
+		if fn, ok := v["function"].(map[string]interface{}); ok {
+			if n, ok := fn["name"].(string); ok && n != "" {
+				return toolChoiceFunction, n
+			}
+		}
+		// Legacy function_call form: {"name": "..."}
+		if n, ok := v["name"].(string); ok && n != "" {
+			return toolChoiceFunction, n
+		}
+	}
+	return toolChoiceAuto, ""
+}
+
+// toolParameters returns a function's JSON schema, defaulting to an empty object schema
+func toolParameters(fn Function) map[string]interface{} {
+	if fn.Parameters != nil {
+		return fn.Parameters
+	}
+	return map[string]interface{}{"type": "object", "properties": map[string]interface{}{}}
+}
+
+// toolArguments decodes JSON-encoded call arguments for providers that take
+// them as an object. Empty or malformed arguments become an empty object.
+func toolArguments(arguments string) map[string]interface{} {
+	args := map[string]interface{}{}
+	if arguments != "" {
+		json.Unmarshal([]byte(arguments), &args)
+	}
+	return args
+}
+
+// encodeToolArguments is the inverse of toolArguments
+func encodeToolArguments(args interface{}) string {
+	if args == nil {
+		return "{}"
+	}
+	encoded, err := json.Marshal(args)
+	if err != nil {
+		return "{}"
+	}
+	return string(encoded)
+}
+
+// toolCallNames maps tool call IDs in the conversation to function names,
+// for providers that identify tool results by name rather than ID
+func toolCallNames(messages []Message) map[string]string {
+	names := make(map[string]string)
+	for _, msg := range messages {
+		for _, call := range msg.ToolCalls {
+			names[call.ID] = call.Function.Name
+		}
+	}
+	return names
+}
+
+// toolCallDeltas streams complete tool calls as single fragments, numbered from firstIndex
+func toolCallDeltas(calls []ToolCall, firstIndex int) []ToolCallDelta {
+	deltas := make([]ToolCallDelta, len(calls))
+	for i, call := range calls {
+		deltas[i] = ToolCallDelta{
+			Index:     firstIndex + i,
+			ID:        call.ID,
+			Name:      call.Function.Name,
+			Arguments: call.Function.Arguments,
+		}
+	}
+	return deltas
+}
+
+// syntheticToolCallID gives an ID to tool calls from providers that do not assign them
+func syntheticToolCallID(responseID string, index int) string {
+	return fmt.Sprintf("call_%s_%d", responseID, index)
+}
@@ -0,0 +1,81 @@
+package providers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// newHTTPRequest builds an HTTP request from a provider request.
+// Bodies that are already raw bytes are sent as-is, everything else is JSON encoded.
+func newHTTPRequest(ctx context.Context, req *ProviderRequest) (*http.Request, error) {
+	var body io.Reader
+	switch b := req.Body.(type) {
+	case nil:
+		// No body (e.g. GET requests)
+	case []byte:
+		body = bytes.NewReader(b)
+	default:
+		jsonBody, err := json.Marshal(b)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal request body: %w", err)
+		}
+		body = bytes.NewReader(jsonBody)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, req.Method, req.URL, body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	for k, v := range req.Headers {
+		httpReq.Header.Set(k, v)
+	}
+
+	return httpReq, nil
+}
+
+// executeRequest sends a provider request and reads the complete response.
+// Non-JSON bodies (plain-text gateway errors, HTML error pages) are wrapped
+// as a JSON string so ProviderResponse.Body is always valid JSON.
+func executeRequest(ctx context.Context, client *http.Client, req *ProviderRequest) (*ProviderResponse, error) {
+	httpReq, err := newHTTPRequest(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		return nil, newTransportError(err)
+	}
+	defer resp.Body.Close()
+
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	body := json.RawMessage(raw)
+	if !json.Valid(raw) {
+		quoted, _ := json.Marshal(string(raw))
+		body = quoted
+	}
+
+	return &ProviderResponse{
+		StatusCode: resp.StatusCode,
+		Headers:    flattenHeaders(resp.Header),
+		Body:       body,
+	}, nil
+}
+
+// flattenHeaders converts HTTP headers to the single-value map used by ProviderResponse
+func flattenHeaders(h http.Header) map[string]string {
+	headers := make(map[string]string, len(h))
+	for k := range h {
+		headers[k] = h.Get(k)
+	}
+	return headers
+}
@@ -0,0 +1,795 @@
+package providers
+
+import (
+	"bufio"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"ch.at/models"
+)
+
+const (
+	vertexDefaultRegion      = "us-central1"
+	vertexDefaultTokenURL    = "https://oauth2.googleapis.com/token"
+	vertexScope              = "https://www.googleapis.com/auth/cloud-platform"
+	vertexAnthropicVersion   = "vertex-2023-10-16"
+	vertexTokenLifetime      = time.Hour
+	vertexTokenRefreshSkew   = 5 * time.Minute
+	vertexJWTBearerGrantType = "urn:ietf:params:oauth:grant-type:jwt-bearer"
+)
+
+// VertexProvider calls Google Vertex AI directly: Gemini models through
+// generateContent/streamGenerateContent and Claude models through the
+// Anthropic rawPredict/streamRawPredict endpoints. Access tokens are minted
+// from a service-account JWT and cached until shortly before expiry.
+type VertexProvider struct {
+	client *http.Client
+
+	// TokenURL overrides the OAuth2 token endpoint for every service account.
+	// Defaults to VERTEX_TOKEN_URL, then the key file's token_uri.
+	TokenURL string
+
+	mu     sync.Mutex
+	tokens map[string]vertexToken // keyed by service account email
+}
+
+// vertexToken is a cached Google OAuth2 access token
+type vertexToken struct {
+	value     string
+	expiresAt time.Time
+}
+
+// vertexServiceAccount is the subset of a service-account key file we need
+type vertexServiceAccount struct {
+	ClientEmail  string `json:"client_email"`
+	PrivateKey   string `json:"private_key"`
+	PrivateKeyID string `json:"private_key_id"`
+	TokenURI     string `json:"token_uri"`
+}
+
+// NewVertexProvider creates a new Vertex AI provider
+func NewVertexProvider() *VertexProvider {
+	return &VertexProvider{
+		client: &http.Client{
+			Timeout: 60 * time.Second,
+		},
+		TokenURL: os.Getenv("VERTEX_TOKEN_URL"),
+		tokens:   make(map[string]vertexToken),
+	}
+}
+
+// TranslateRequest converts unified request to a Gemini or Anthropic-on-Vertex call.
+// req.Stream selects the streaming endpoint, since Vertex uses a different method for it.
+func (v *VertexProvider) TranslateRequest(ctx context.Context, req *UnifiedRequest, deployment *models.Deployment) (*ProviderRequest, error) {
+	var body map[string]interface{}
+	var method string
+
+	if isVertexAnthropicModel(deployment.ProviderModelID) {
+		body = buildAnthropicBody(req)
+		body["anthropic_version"] = vertexAnthropicVersion
+		method = "rawPredict"
+		if req.Stream {
+			method = "streamRawPredict"
+		}
+	} else {
+		body = buildGeminiBody(req)
+		method = "generateContent"
+		if req.Stream {
+			method = "streamGenerateContent?alt=sse"
+		}
+	}
+
+	headers := map[string]string{
+		"Content-Type": "application/json",
+	}
+
+	if deployment.Endpoint.Auth.Type != models.AuthNone {
+		token, err := v.getToken(ctx, deployment.Endpoint.Auth.GCPCredentials)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get GCP access token: %w", err)
+		}
+		headers["Authorization"] = "Bearer " + token
+	}
+
+	for k, val := range deployment.Endpoint.CustomHeaders {
+		headers[k] = val
+	}
+
+	return &ProviderRequest{
+		URL:     vertexModelURL(deployment) + ":" + method,
+		Method:  "POST",
+		Headers: headers,
+		Body:    body,
+		Timeout: deployment.Endpoint.Timeout,
+	}, nil
+}
+
+// Execute sends the request to Vertex AI
+func (v *VertexProvider) Execute(ctx context.Context, req *ProviderRequest) (*ProviderResponse, error) {
+	return executeRequest(ctx, v.client, req)
+}
+
+// TranslateResponse converts a Gemini or Anthropic response to unified format
+func (v *VertexProvider) TranslateResponse(ctx context.Context, resp *ProviderResponse, deployment *models.Deployment) (*UnifiedResponse, error) {
+	anthropic := isVertexAnthropicModel(deployment.ProviderModelID)
+
+	if resp.StatusCode != http.StatusOK {
+		msg := vertexErrorMessage(resp.Body)
+		if anthropic {
+			msg = anthropicErrorMessage(resp.Body)
+		}
+		return nil, newStatusError("vertex", resp.StatusCode, resp.Headers, msg)
+	}
+
+	var unifiedResp *UnifiedResponse
+	var err error
+	if anthropic {
+		unifiedResp, err = parseAnthropicResponse(resp.Body)
+	} else {
+		unifiedResp, err = parseGeminiResponse(resp.Body)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if unifiedResp.Model == "" {
+		unifiedResp.Model = deployment.ProviderModelID
+	}
+	unifiedResp.Metadata["deployment_id"] = deployment.ID
+	unifiedResp.Metadata["provider"] = string(deployment.Provider)
+	unifiedResp.Metadata["provider_model"] = deployment.ProviderModelID
+
+	return unifiedResp, nil
+}
+
+// Stream handles streamGenerateContent (SSE) and streamRawPredict (Anthropic SSE)
+func (v *VertexProvider) Stream(ctx context.Context, req *ProviderRequest, stream chan<- StreamChunk) error {
+	defer close(stream)
+
+	anthropic := strings.HasSuffix(req.URL, ":streamRawPredict")
+	if !anthropic && !strings.HasSuffix(req.URL, ":streamGenerateContent?alt=sse") {
+		err := fmt.Errorf("vertex stream requires a request translated with Stream set")
+		stream <- StreamChunk{Error: err}
+		return err
+	}
+
+	httpReq, err := newHTTPRequest(ctx, req)
+	if err != nil {
+		stream <- StreamChunk{Error: err}
+		return err
+	}
+
+	resp, err := v.client.Do(httpReq)
+	if err != nil {
+		err = newTransportError(err)
+		stream <- StreamChunk{Error: err}
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		raw, _ := io.ReadAll(resp.Body)
+		err := newStatusError("vertex", resp.StatusCode, flattenHeaders(resp.Header), vertexErrorMessage(raw))
+		stream <- StreamChunk{Error: err}
+		return err
+	}
+
+	if anthropic {
+		return readAnthropicStream(resp.Body, stream)
+	}
+	return readGeminiStream(resp.Body, stream)
+}
+
+// ValidateConfig validates Vertex deployment configuration
+func (v *VertexProvider) ValidateConfig(deployment *models.Deployment) error {
+	if deployment.ProviderModelID == "" {
+		return fmt.Errorf("provider model ID is required")
+	}
+
+	if deployment.Endpoint.ProjectID == "" {
+		return fmt.Errorf("project ID is required")
+	}
+
+	if deployment.Endpoint.Auth.Type != models.AuthNone {
+		creds := deployment.Endpoint.Auth.GCPCredentials
+		if creds == nil || creds.ServiceAccountJSON == "" {
+			return fmt.Errorf("service account JSON is required for gcp_oauth auth")
+		}
+		if _, err := parseVertexServiceAccount(creds.ServiceAccountJSON); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// HealthCheck performs a minimal completion against the model endpoint
+func (v *VertexProvider) HealthCheck(ctx context.Context, deployment *models.Deployment) error {
+	req := &UnifiedRequest{
+		Model: deployment.ProviderModelID,
+		Messages: []Message{
+			{Role: "user", Content: "Hi"},
+		},
+		MaxTokens:   10,
+		Temperature: 0,
+	}
+
+	healthCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	providerReq, err := v.TranslateRequest(healthCtx, req, deployment)
+	if err != nil {
+		return fmt.Errorf("health check translation failed: %w", err)
+	}
+
+	resp, err := v.Execute(healthCtx, providerReq)
+	if err != nil {
+		return fmt.Errorf("health check request failed: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("health check returned status %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+// GetInfo returns provider information
+func (v *VertexProvider) GetInfo() ProviderInfo {
+	return ProviderInfo{
+		Name:           "Google Vertex AI",
+		Version:        "v1",
+		SupportsStream: true,
+		RequiresAuth:   true,
+		MaxRequestSize: 20 * 1024 * 1024, // 20MB
+		RateLimits: map[string]int{
+			"requests_per_minute": 60,
+			"tokens_per_minute":   400000,
+		},
+	}
+}
+
+// getToken returns a cached access token for the service account, minting a
+// new one from a signed JWT when it is missing or about to expire
+func (v *VertexProvider) getToken(ctx context.Context, creds *models.GCPAuth) (string, error) {
+	if creds == nil || creds.ServiceAccountJSON == "" {
+		return "", fmt.Errorf("service account credentials not configured")
+	}
+
+	sa, err := parseVertexServiceAccount(creds.ServiceAccountJSON)
+	if err != nil {
+		return "", err
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if token, ok := v.tokens[sa.ClientEmail]; ok && time.Until(token.expiresAt) > vertexTokenRefreshSkew {
+		return token.value, nil
+	}
+
+	token, err := v.requestToken(ctx, sa)
+	if err != nil {
+		return "", err
+	}
+	v.tokens[sa.ClientEmail] = token
+
+	return token.value, nil
+}
+
+// requestToken exchanges a self-signed JWT assertion for an access token
+func (v *VertexProvider) requestToken(ctx context.Context, sa *vertexServiceAccount) (vertexToken, error) {
+	tokenURL := v.TokenURL
+	if tokenURL == "" {
+		tokenURL = sa.TokenURI
+	}
+	if tokenURL == "" {
+		tokenURL = vertexDefaultTokenURL
+	}
+
+	assertion, err := signVertexJWT(sa, tokenURL, time.Now())
+	if err != nil {
+		return vertexToken{}, err
+	}
+
+	form := url.Values{
+		"grant_type": {vertexJWTBearerGrantType},
+		"assertion":  {assertion},
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return vertexToken{}, fmt.Errorf("failed to create token request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := v.client.Do(httpReq)
+	if err != nil {
+		return vertexToken{}, fmt.Errorf("token request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var tokenResp struct {
+		AccessToken      string `json:"access_token"`
+		ExpiresIn        int    `json:"expires_in"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tokenResp); err != nil {
+		return vertexToken{}, fmt.Errorf("failed to decode token response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK || tokenResp.AccessToken == "" {
+		return vertexToken{}, newTokenError("vertex", resp.StatusCode, strings.TrimSpace(tokenResp.Error+" "+tokenResp.ErrorDescription))
+	}
+
+	lifetime := time.Duration(tokenResp.ExpiresIn) * time.Second
+	if lifetime <= 0 {
+		lifetime = vertexTokenLifetime
+	}
+
+	return vertexToken{
+		value:     tokenResp.AccessToken,
+		expiresAt: time.Now().Add(lifetime),
+	}, nil
+}
+
+// parseVertexServiceAccount decodes a service-account key file
+func parseVertexServiceAccount(raw string) (*vertexServiceAccount, error) {
+	var sa vertexServiceAccount
+	if err := json.Unmarshal([]byte(raw), &sa); err != nil {
+		return nil, fmt.Errorf("invalid service account JSON: %w", err)
+	}
+	if sa.ClientEmail == "" || sa.PrivateKey == "" {
+		return nil, fmt.Errorf("service account JSON is missing client_email or private_key")
+	}
+	return &sa, nil
+}
+
+// signVertexJWT builds the RS256 JWT assertion for the OAuth2 JWT bearer grant
+func signVertexJWT(sa *vertexServiceAccount, audience string, now time.Time) (string, error) {
+	block, _ := pem.Decode([]byte(sa.PrivateKey))
+	if block == nil {
+		return "", fmt.Errorf("service account private key is not PEM encoded")
+	}
+
+	var key *rsa.PrivateKey
+	if parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes); err == nil {
+		rsaKey, ok := parsed.(*rsa.PrivateKey)
+		if !ok {
+			return "", fmt.Errorf("service account private key is not an RSA key")
+		}
+		key = rsaKey
+	} else if rsaKey, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		key = rsaKey
+	} else {
+		return "", fmt.Errorf("failed to parse service account private key: %w", err)
+	}
+
+	header := map[string]string{"alg": "RS256", "typ": "JWT"}
+	if sa.PrivateKeyID != "" {
+		header["kid"] = sa.PrivateKeyID
+	}
+	claims := map[string]interface{}{
+		"iss":   sa.ClientEmail,
+		"scope": vertexScope,
+		"aud":   audience,
+		"iat":   now.Unix(),
+		"exp":   now.Add(vertexTokenLifetime).Unix(),
+	}
+
+	headerJSON, _ := json.Marshal(header)
+	claimsJSON, _ := json.Marshal(claims)
+	signingInput := base64.RawURLEncoding.EncodeToString(headerJSON) + "." + base64.RawURLEncoding.EncodeToString(claimsJSON)
+
+	digest := sha256.Sum256([]byte(signingInput))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("failed to sign JWT: %w", err)
+	}
+
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// isVertexAnthropicModel reports whether the model is served by the Anthropic publisher
+func isVertexAnthropicModel(modelID string) bool {
+	return strings.HasPrefix(modelID, "claude")
+}
+
+// vertexModelURL builds .../projects/{p}/locations/{r}/publishers/{pub}/models/{m}
+func vertexModelURL(deployment *models.Deployment) string {
+	region := deployment.Endpoint.Region
+	if region == "" {
+		region = vertexDefaultRegion
+	}
+
+	baseURL := strings.TrimSuffix(deployment.Endpoint.BaseURL, "/")
+	if baseURL == "" {
+		if region == "global" {
+			baseURL = "https://aiplatform.googleapis.com"
+		} else {
+			baseURL = "https://" + region + "-aiplatform.googleapis.com"
+		}
+	}
+
+	publisher := "google"
+	if isVertexAnthropicModel(deployment.ProviderModelID) {
+		publisher = "anthropic"
+	}
+
+	return fmt.Sprintf("%s/v1/projects/%s/locations/%s/publishers/%s/models/%s",
+		baseURL, url.PathEscape(deployment.Endpoint.ProjectID), url.PathEscape(region), publisher, url.PathEscape(deployment.ProviderModelID))
+}
+
+// buildGeminiBody converts messages to Gemini contents. System prompts become
+// systemInstruction and assistant turns use Gemini's "model" role.
+func buildGeminiBody(req *UnifiedRequest) map[string]interface{} {
+	var systemParts []map[string]string
+	var contents []map[string]interface{}
+
+	// Gemini identifies function results by name, not call ID
+	callNames := toolCallNames(req.Messages)
+
+	for _, msg := range req.Messages {
+		if msg.Role == "system" {
+			systemParts = append(systemParts, map[string]string{"text": msg.Content})
+			continue
+		}
+
+		role := "user"
+		if msg.Role == "assistant" {
+			role = "model"
+		}
+
+		var parts []interface{}
+		switch {
+		case msg.Role == "tool":
+			name := callNames[msg.ToolCallID]
+			if name == "" {
+				name = msg.Name
+			}
+			parts = append(parts, map[string]interface{}{
+				"functionResponse": map[string]interface{}{
+					"name":     name,
+					"response": geminiFunctionResponse(msg.Content),
+				},
+			})
+		case len(msg.Parts) > 0:
+			parts = append(parts, geminiParts(msg.Parts)...)
+			fallthrough
+		default:
+			if len(msg.Parts) == 0 && (msg.Content != "" || len(msg.ToolCalls) == 0) {
+				parts = append(parts, map[string]string{"text": msg.Content})
+			}
+			for _, call := range msg.ToolCalls {
+				parts = append(parts, map[string]interface{}{
+					"functionCall": map[string]interface{}{
+						"name": call.Function.Name,
+						"args": toolArguments(call.Function.Arguments),
+					},
+				})
+			}
+		}
+
+		if n := len(contents); n > 0 && contents[n-1]["role"] == role {
+			contents[n-1]["parts"] = append(contents[n-1]["parts"].([]interface{}), parts...)
+			continue
+		}
+
+		contents = append(contents, map[string]interface{}{
+			"role":  role,
+			"parts": parts,
+		})
+	}
+
+	body := map[string]interface{}{
+		"contents": contents,
+	}
+	if len(systemParts) > 0 {
+		body["systemInstruction"] = map[string]interface{}{"parts": systemParts}
+	}
+
+	generation := map[string]interface{}{}
+	if req.Temperature > 0 {
+		generation["temperature"] = req.Temperature
+	}
+	if req.MaxTokens > 0 {
+		generation["maxOutputTokens"] = req.MaxTokens
+	}
+	if req.TopP > 0 {
+		generation["topP"] = req.TopP
+	}
+	if len(req.Stop) > 0 {
+		generation["stopSequences"] = req.Stop
+	}
+	if req.ResponseFormat.WantsJSON() {
+		generation["responseMimeType"] = "application/json"
+		if req.ResponseFormat.Type == ResponseFormatJSONSchema {
+			generation["responseJsonSchema"] = req.ResponseFormat.schema()
+		}
+	}
+	if len(generation) > 0 {
+		body["generationConfig"] = generation
+	}
+
+	if req.HasTools() {
+		var declarations []map[string]interface{}
+		for _, fn := range toolFunctions(req) {
+			declarations = append(declarations, map[string]interface{}{
+				"name":        fn.Name,
+				"description": fn.Description,
+				"parameters":  toolParameters(fn),
+			})
+		}
+		body["tools"] = []map[string]interface{}{{"functionDeclarations": declarations}}
+
+		config := map[string]interface{}{"mode": "AUTO"}
+		switch mode, name := toolChoice(req.ToolChoice); mode {
+		case toolChoiceNone:
+			config["mode"] = "NONE"
+		case toolChoiceRequired:
+			config["mode"] = "ANY"
+		case toolChoiceFunction:
+			config["mode"] = "ANY"
+			config["allowedFunctionNames"] = []string{name}
+		}
+		body["toolConfig"] = map[string]interface{}{"functionCallingConfig": config}
+	}
+
+	return body
+}
+
+// geminiParts converts multimodal parts: data URLs are sent inline and
+// other URLs as file references for Gemini to fetch
+func geminiParts(contentParts []ContentPart) []interface{} {
+	var parts []interface{}
+	for _, part := range contentParts {
+		switch part.Type {
+		case ContentTypeText:
+			if part.Text != "" {
+				parts = append(parts, map[string]string{"text": part.Text})
+			}
+		case ContentTypeImage:
+			if mediaType, data, ok := parseDataURL(part.ImageURL.URL); ok {
+				parts = append(parts, map[string]interface{}{
+					"inlineData": map[string]string{"mimeType": mediaType, "data": data},
+				})
+			} else {
+				parts = append(parts, map[string]interface{}{
+					"fileData": map[string]string{"mimeType": imageMediaType(part.ImageURL.URL), "fileUri": part.ImageURL.URL},
+				})
+			}
+		}
+	}
+	return parts
+}
+
+// geminiFunctionResponse wraps a tool result as the object Gemini expects.
+// JSON object results are passed through, anything else becomes {"content": ...}.
+func geminiFunctionResponse(content string) map[string]interface{} {
+	var obj map[string]interface{}
+	if err := json.Unmarshal([]byte(content), &obj); err == nil && obj != nil {
+		return obj
+	}
+	return map[string]interface{}{"content": content}
+}
+
+// geminiResponse is a generateContent response (and each streamed chunk)
+type geminiResponse struct {
+	Candidates []struct {
+		Content struct {
+			Parts []struct {
+				Text         string `json:"text"`
+				FunctionCall *struct {
+					Name string          `json:"name"`
+					Args json.RawMessage `json:"args"`
+				} `json:"functionCall"`
+			} `json:"parts"`
+		} `json:"content"`
+		FinishReason string `json:"finishReason"`
+	} `json:"candidates"`
+	UsageMetadata *struct {
+		PromptTokenCount     int `json:"promptTokenCount"`
+		CandidatesTokenCount int `json:"candidatesTokenCount"`
+		TotalTokenCount      int `json:"totalTokenCount"`
+	} `json:"usageMetadata"`
+	ModelVersion string `json:"modelVersion"`
+	ResponseID   string `json:"responseId"`
+}
+
+// text concatenates the text parts of the first candidate
+func (g *geminiResponse) text() string {
+	if len(g.Candidates) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	for _, part := range g.Candidates[0].Content.Parts {
+		b.WriteString(part.Text)
+	}
+	return b.String()
+}
+
+// toolCalls returns the function calls of the first candidate. Gemini does
+// not assign call IDs, so they are derived from idPrefix and firstIndex.
+func (g *geminiResponse) toolCalls(idPrefix string, firstIndex int) []ToolCall {
+	if len(g.Candidates) == 0 {
+		return nil
+	}
+	var calls []ToolCall
+	for _, part := range g.Candidates[0].Content.Parts {
+		if part.FunctionCall == nil {
+			continue
+		}
+		args := string(part.FunctionCall.Args)
+		if args == "" {
+			args = "{}"
+		}
+		calls = append(calls, ToolCall{
+			ID:       syntheticToolCallID(idPrefix, firstIndex+len(calls)),
+			Type:     "function",
+			Function: FunctionCall{Name: part.FunctionCall.Name, Arguments: args},
+		})
+	}
+	return calls
+}
+
+// usage converts usageMetadata, returning nil when absent
+func (g *geminiResponse) usage() *Usage {
+	if g.UsageMetadata == nil {
+		return nil
+	}
+	return &Usage{
+		PromptTokens:     g.UsageMetadata.PromptTokenCount,
+		CompletionTokens: g.UsageMetadata.CandidatesTokenCount,
+		TotalTokens:      g.UsageMetadata.TotalTokenCount,
+	}
+}
+
+// parseGeminiResponse converts a generateContent response to unified format
+func parseGeminiResponse(body []byte) (*UnifiedResponse, error) {
+	var gemini geminiResponse
+	if err := json.Unmarshal(body, &gemini); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	finishReason := ""
+	if len(gemini.Candidates) > 0 {
+		finishReason = geminiFinishReason(gemini.Candidates[0].FinishReason)
+	}
+
+	var usage Usage
+	if u := gemini.usage(); u != nil {
+		usage = *u
+	}
+
+	id := gemini.ResponseID
+	if id == "" {
+		id = fmt.Sprintf("vertex-%d", time.Now().UnixNano())
+	}
+
+	// Gemini reports STOP even when it stopped to call functions
+	toolCalls := gemini.toolCalls(id, 0)
+	if len(toolCalls) > 0 && finishReason == "stop" {
+		finishReason = "tool_calls"
+	}
+
+	return &UnifiedResponse{
+		ID:      id,
+		Object:  "chat.completion",
+		Created: time.Now().Unix(),
+		Model:   gemini.ModelVersion,
+		Choices: []Choice{{
+			Index: 0,
+			Message: Message{
+				Role:      "assistant",
+				Content:   gemini.text(),
+				ToolCalls: toolCalls,
+			},
+			FinishReason: finishReason,
+		}},
+		Usage:    usage,
+		Metadata: make(map[string]interface{}),
+	}, nil
+}
+
+// readGeminiStream parses streamGenerateContent?alt=sse. Each event is a full
+// response fragment; usage is cumulative, so the latest value is reported
+// with the finish reason.
+func readGeminiStream(r io.Reader, stream chan<- StreamChunk) error {
+	var usage *Usage
+	var finishReason string
+	var toolCount int
+	streamID := fmt.Sprintf("vertex-%d", time.Now().UnixNano())
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+
+		var chunk geminiResponse
+		if err := json.Unmarshal([]byte(strings.TrimSpace(strings.TrimPrefix(line, "data:"))), &chunk); err != nil {
+			// Skip malformed JSON
+			continue
+		}
+
+		if text := chunk.text(); text != "" {
+			stream <- StreamChunk{Data: text}
+		}
+		// Function calls arrive whole rather than as argument fragments
+		if calls := chunk.toolCalls(streamID, toolCount); len(calls) > 0 {
+			stream <- StreamChunk{ToolCalls: toolCallDeltas(calls, toolCount)}
+			toolCount += len(calls)
+		}
+		if u := chunk.usage(); u != nil {
+			usage = u
+		}
+		if len(chunk.Candidates) > 0 && chunk.Candidates[0].FinishReason != "" {
+			finishReason = geminiFinishReason(chunk.Candidates[0].FinishReason)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		stream <- StreamChunk{Error: err}
+		return err
+	}
+
+	if toolCount > 0 && finishReason == "stop" {
+		finishReason = "tool_calls"
+	}
+	if finishReason != "" || usage != nil {
+		stream <- StreamChunk{FinishReason: finishReason, Usage: usage}
+	}
+	stream <- StreamChunk{Done: true}
+	return nil
+}
+
+// geminiFinishReason maps Gemini finish reasons to OpenAI finish reasons
+func geminiFinishReason(reason string) string {
+	switch reason {
+	case "STOP":
+		return "stop"
+	case "MAX_TOKENS":
+		return "length"
+	case "SAFETY", "RECITATION", "BLOCKLIST", "PROHIBITED_CONTENT", "SPII":
+		return "content_filter"
+	case "":
+		return ""
+	default:
+		return strings.ToLower(reason)
+	}
+}
+
+// vertexErrorMessage extracts the message from a Google API error body
+func vertexErrorMessage(body []byte) string {
+	var errResp struct {
+		Error struct {
+			Status  string `json:"status"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(body, &errResp); err == nil && errResp.Error.Message != "" {
+		if errResp.Error.Status != "" {
+			return errResp.Error.Status + ": " + errResp.Error.Message
+		}
+		return errResp.Error.Message
+	}
+	return string(body)
+}
@@ -0,0 +1,278 @@
+package providers_test
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"ch.at/models"
+	"ch.at/providers"
+)
+
+// newVertexTokenServer returns a token endpoint that verifies the JWT
+// assertion against key and counts how many tokens it issued
+func newVertexTokenServer(t *testing.T, key *rsa.PrivateKey, issued *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if r.Form.Get("grant_type") != "urn:ietf:params:oauth:grant-type:jwt-bearer" {
+			t.Errorf("grant_type = %q", r.Form.Get("grant_type"))
+		}
+
+		parts := strings.Split(r.Form.Get("assertion"), ".")
+		if len(parts) != 3 {
+			t.Fatalf("malformed JWT assertion")
+		}
+		digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+		sig, _ := base64.RawURLEncoding.DecodeString(parts[2])
+		if err := rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, digest[:], sig); err != nil {
+			t.Errorf("JWT signature does not verify: %v", err)
+		}
+
+		claimsJSON, _ := base64.RawURLEncoding.DecodeString(parts[1])
+		var claims map[string]interface{}
+		json.Unmarshal(claimsJSON, &claims)
+		if claims["iss"] != "svc@test-project.iam.gserviceaccount.com" {
+			t.Errorf("iss = %v", claims["iss"])
+		}
+		if claims["scope"] != "https://www.googleapis.com/auth/cloud-platform" {
+			t.Errorf("scope = %v", claims["scope"])
+		}
+
+		n := atomic.AddInt32(issued, 1)
+		fmt.Fprintf(w, `{"access_token":"ya29.token-%d","expires_in":3599,"token_type":"Bearer"}`, n)
+	}))
+}
+
+func newVertexDeployment(t *testing.T, baseURL, modelID string) (*models.Deployment, *rsa.PrivateKey) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, _ := x509.MarshalPKCS8PrivateKey(key)
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+
+	saJSON, _ := json.Marshal(map[string]string{
+		"type":           "service_account",
+		"client_email":   "svc@test-project.iam.gserviceaccount.com",
+		"private_key":    string(keyPEM),
+		"private_key_id": "key-1",
+		"token_uri":      "https://oauth2.googleapis.com/token",
+	})
+
+	return &models.Deployment{
+		ID:              "test-vertex",
+		ModelID:         modelID,
+		Provider:        models.ProviderVertex,
+		ProviderModelID: modelID,
+		Endpoint: models.EndpointConfig{
+			BaseURL:   baseURL,
+			ProjectID: "test-project",
+			Region:    "us-east5",
+			Auth: models.AuthConfig{
+				Type:           models.AuthGCP,
+				GCPCredentials: &models.GCPAuth{ServiceAccountJSON: string(saJSON)},
+			},
+		},
+	}, key
+}
+
+func TestVertexGeminiGenerateContent(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		want := "/v1/projects/test-project/locations/us-east5/publishers/google/models/gemini-2.5-flash:generateContent"
+		if r.URL.Path != want {
+			t.Errorf("path = %s", r.URL.Path)
+		}
+		if got := r.Header.Get("Authorization"); got != "Bearer ya29.token-1" {
+			t.Errorf("Authorization = %q", got)
+		}
+
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		if _, ok := body["systemInstruction"]; !ok {
+			t.Error("system message should become systemInstruction")
+		}
+		contents := body["contents"].([]interface{})
+		if last := contents[len(contents)-1].(map[string]interface{}); last["role"] != "user" {
+			t.Errorf("last role = %v", last["role"])
+		}
+		if contents[1].(map[string]interface{})["role"] != "model" {
+			t.Error("assistant turns should use the model role")
+		}
+
+		fmt.Fprint(w, `{"candidates":[{"content":{"role":"model","parts":[{"text":"hi "},{"text":"there"}]},"finishReason":"STOP"}],"usageMetadata":{"promptTokenCount":6,"candidatesTokenCount":2,"totalTokenCount":8},"modelVersion":"gemini-2.5-flash"}`)
+	}))
+	defer server.Close()
+
+	deployment, key := newVertexDeployment(t, server.URL, "gemini-2.5-flash")
+	var issued int32
+	tokenServer := newVertexTokenServer(t, key, &issued)
+	defer tokenServer.Close()
+
+	provider := providers.NewVertexProvider()
+	provider.TokenURL = tokenServer.URL
+
+	if err := provider.ValidateConfig(deployment); err != nil {
+		t.Fatalf("ValidateConfig: %v", err)
+	}
+
+	req := &providers.UnifiedRequest{
+		Messages: []providers.Message{
+			{Role: "system", Content: "Be terse."},
+			{Role: "user", Content: "Hi"},
+			{Role: "assistant", Content: "Hello"},
+			{Role: "user", Content: "Again"},
+		},
+	}
+
+	for i := 0; i < 2; i++ {
+		providerReq, err := provider.TranslateRequest(context.Background(), req, deployment)
+		if err != nil {
+			t.Fatalf("TranslateRequest: %v", err)
+		}
+		resp, err := provider.Execute(context.Background(), providerReq)
+		if err != nil {
+			t.Fatalf("Execute: %v", err)
+		}
+		unified, err := provider.TranslateResponse(context.Background(), resp, deployment)
+		if err != nil {
+			t.Fatalf("TranslateResponse: %v", err)
+		}
+		if got := unified.Choices[0].Message.Content; got != "hi there" {
+			t.Errorf("content = %q", got)
+		}
+		if unified.Choices[0].FinishReason != "stop" || unified.Usage.TotalTokens != 8 {
+			t.Errorf("finish_reason = %q, usage = %+v", unified.Choices[0].FinishReason, unified.Usage)
+		}
+	}
+
+	if n := atomic.LoadInt32(&issued); n != 1 {
+		t.Errorf("expected the access token to be cached, got %d token requests", n)
+	}
+}
+
+func TestVertexGeminiStream(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasSuffix(r.URL.Path, ":streamGenerateContent") || r.URL.Query().Get("alt") != "sse" {
+			t.Errorf("unexpected URL %s", r.URL)
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "data: {\"candidates\":[{\"content\":{\"parts\":[{\"text\":\"Hel\"}]}}]}\r\n\r\n")
+		fmt.Fprint(w, "data: {\"candidates\":[{\"content\":{\"parts\":[{\"text\":\"lo\"}]},\"finishReason\":\"MAX_TOKENS\"}],\"usageMetadata\":{\"promptTokenCount\":3,\"candidatesTokenCount\":2,\"totalTokenCount\":5}}\r\n\r\n")
+	}))
+	defer server.Close()
+
+	deployment, key := newVertexDeployment(t, server.URL, "gemini-2.5-flash")
+	var issued int32
+	tokenServer := newVertexTokenServer(t, key, &issued)
+	defer tokenServer.Close()
+
+	provider := providers.NewVertexProvider()
+	provider.TokenURL = tokenServer.URL
+
+	req := &providers.UnifiedRequest{Messages: []providers.Message{{Role: "user", Content: "Hi"}}, Stream: true}
+	providerReq, err := provider.TranslateRequest(context.Background(), req, deployment)
+	if err != nil {
+		t.Fatalf("TranslateRequest: %v", err)
+	}
+
+	stream := make(chan providers.StreamChunk)
+	go provider.Stream(context.Background(), providerReq, stream)
+
+	var content, finish string
+	var usage *providers.Usage
+	for chunk := range stream {
+		if chunk.Error != nil {
+			t.Fatalf("chunk error: %v", chunk.Error)
+		}
+		if chunk.Done {
+			break
+		}
+		content += chunk.Data
+		if chunk.FinishReason != "" {
+			finish = chunk.FinishReason
+			usage = chunk.Usage
+		}
+	}
+
+	if content != "Hello" || finish != "length" {
+		t.Errorf("content = %q, finish_reason = %q", content, finish)
+	}
+	if usage == nil || usage.TotalTokens != 5 {
+		t.Errorf("usage = %+v", usage)
+	}
+}
+
+func TestVertexAnthropicStreamRawPredict(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		want := "/v1/projects/test-project/locations/us-east5/publishers/anthropic/models/claude-3-5-sonnet-v2@20241022:streamRawPredict"
+		if r.URL.Path != want {
+			t.Errorf("path = %s", r.URL.Path)
+		}
+
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		if body["anthropic_version"] != "vertex-2023-10-16" {
+			t.Errorf("anthropic_version = %v", body["anthropic_version"])
+		}
+		if _, ok := body["model"]; ok {
+			t.Error("model belongs in the URL for rawPredict")
+		}
+		if body["stream"] != true {
+			t.Error("stream flag not set")
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "event: message_start\ndata: {\"type\":\"message_start\",\"message\":{\"usage\":{\"input_tokens\":4}}}\n\n")
+		fmt.Fprint(w, "event: content_block_delta\ndata: {\"type\":\"content_block_delta\",\"delta\":{\"type\":\"text_delta\",\"text\":\"Hi!\"}}\n\n")
+		fmt.Fprint(w, "event: message_delta\ndata: {\"type\":\"message_delta\",\"delta\":{\"stop_reason\":\"end_turn\"},\"usage\":{\"output_tokens\":2}}\n\n")
+		fmt.Fprint(w, "event: message_stop\ndata: {\"type\":\"message_stop\"}\n\n")
+	}))
+	defer server.Close()
+
+	deployment, key := newVertexDeployment(t, server.URL, "claude-3-5-sonnet-v2@20241022")
+	var issued int32
+	tokenServer := newVertexTokenServer(t, key, &issued)
+	defer tokenServer.Close()
+
+	provider := providers.NewVertexProvider()
+	provider.TokenURL = tokenServer.URL
+
+	req := &providers.UnifiedRequest{Messages: []providers.Message{{Role: "user", Content: "Hi"}}, Stream: true}
+	providerReq, err := provider.TranslateRequest(context.Background(), req, deployment)
+	if err != nil {
+		t.Fatalf("TranslateRequest: %v", err)
+	}
+
+	stream := make(chan providers.StreamChunk)
+	go provider.Stream(context.Background(), providerReq, stream)
+
+	var content, finish string
+	for chunk := range stream {
+		if chunk.Error != nil {
+			t.Fatalf("chunk error: %v", chunk.Error)
+		}
+		if chunk.Done {
+			break
+		}
+		content += chunk.Data
+		if chunk.FinishReason != "" {
+			finish = chunk.FinishReason
+		}
+	}
+
+	if content != "Hi!" || finish != "stop" {
+		t.Errorf("content = %q, finish_reason = %q", content, finish)
+	}
+}
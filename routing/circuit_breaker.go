@@ -1,6 +1,8 @@
 package routing
 
 import (
+	"encoding/json"
+	"fmt"
 	"sync"
 	"time"
 )
@@ -14,104 +16,378 @@ const (
 	StateHalfOpen
 )
 
+func (s CircuitBreakerState) String() string {
+	switch s {
+	case StateClosed:
+		return "closed"
+	case StateOpen:
+		return "open"
+	case StateHalfOpen:
+		return "half_open"
+	}
+	return "unknown"
+}
+
+// MarshalText renders the state by name in JSON
+func (s CircuitBreakerState) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// CircuitBreakerConfig configures a circuit breaker. The circuit opens
+// when the error rate over the last Window reaches ErrorThreshold, once at
+// least MinRequests have been seen. After Timeout it turns half-open and
+// lets up to HalfOpenRequests probes through at a time; SuccessThreshold
+// probe successes close it again and any probe failure reopens it.
+type CircuitBreakerConfig struct {
+	Enabled          bool          `json:"enabled"`
+	ErrorThreshold   float64       `json:"error_threshold"`
+	MinRequests      int           `json:"min_requests"`
+	Window           time.Duration `json:"window"`
+	SuccessThreshold int           `json:"success_threshold"`
+	Timeout          time.Duration `json:"timeout"`
+	HalfOpenRequests int           `json:"half_open_requests"`
+}
+
+// MarshalJSON renders Window and Timeout as duration strings, e.g. "1m0s"
+func (c CircuitBreakerConfig) MarshalJSON() ([]byte, error) {
+	type plain CircuitBreakerConfig
+	return json.Marshal(struct {
+		plain
+		Window  string `json:"window"`
+		Timeout string `json:"timeout"`
+	}{plain(c), c.Window.String(), c.Timeout.String()})
+}
+
+// DefaultCircuitBreakerConfig is used for deployments without configuration
+func DefaultCircuitBreakerConfig() CircuitBreakerConfig {
+	return CircuitBreakerConfig{
+		Enabled:          true,
+		ErrorThreshold:   0.5,
+		MinRequests:      5,
+		Window:           time.Minute,
+		SuccessThreshold: 3,
+		Timeout:          60 * time.Second,
+		HalfOpenRequests: 1,
+	}
+}
+
+// withDefaults fills unset fields from DefaultCircuitBreakerConfig
+func (c CircuitBreakerConfig) withDefaults() CircuitBreakerConfig {
+	d := DefaultCircuitBreakerConfig()
+	if c.ErrorThreshold <= 0 {
+		c.ErrorThreshold = d.ErrorThreshold
+	}
+	if c.MinRequests <= 0 {
+		c.MinRequests = d.MinRequests
+	}
+	if c.Window <= 0 {
+		c.Window = d.Window
+	}
+	if c.SuccessThreshold <= 0 {
+		c.SuccessThreshold = d.SuccessThreshold
+	}
+	if c.Timeout <= 0 {
+		c.Timeout = d.Timeout
+	}
+	if c.HalfOpenRequests <= 0 {
+		c.HalfOpenRequests = d.HalfOpenRequests
+	}
+	return c
+}
+
+// CircuitTransition records a circuit breaker changing state
+type CircuitTransition struct {
+	Deployment string              `json:"deployment"`
+	From       CircuitBreakerState `json:"from"`
+	To         CircuitBreakerState `json:"to"`
+	Reason     string              `json:"reason"`
+	ErrorRate  float64             `json:"error_rate"`
+	Requests   int                 `json:"requests"` // In the window when the transition happened
+	Time       time.Time           `json:"time"`
+}
+
+// CircuitBreakerStatus is a snapshot of a circuit breaker
+type CircuitBreakerStatus struct {
+	State       CircuitBreakerState  `json:"state"`
+	ErrorRate   float64              `json:"error_rate"`
+	Requests    int                  `json:"requests"`
+	Failures    int                  `json:"failures"`
+	OpenedAt    *time.Time           `json:"opened_at,omitempty"`
+	Probes      int                  `json:"half_open_probes"`
+	Successes   int                  `json:"half_open_successes"`
+	Config      CircuitBreakerConfig `json:"config"`
+	Transitions []CircuitTransition  `json:"transitions"` // Most recent last
+}
+
+// The window is kept as windowBuckets counters, so the error rate slides
+// in steps of Window/windowBuckets
+const windowBuckets = 10
+
+// maxTransitions bounds the transition history kept per breaker
+const maxTransitions = 20
+
+type windowBucket struct {
+	start     time.Time
+	successes int
+	failures  int
+}
+
 // CircuitBreaker implements circuit breaker pattern for deployments
 type CircuitBreaker struct {
-	name          string
-	maxFailures   int
-	resetTimeout  time.Duration
-	
-	mu            sync.RWMutex
-	state         CircuitBreakerState
-	failures      int
-	lastFailTime  time.Time
-	successCount  int
+	name   string
+	config CircuitBreakerConfig
+
+	// onTransition is called after each state change, outside the lock
+	onTransition func(CircuitTransition)
+
+	mu          sync.Mutex
+	state       CircuitBreakerState
+	buckets     [windowBuckets]windowBucket
+	openedAt    time.Time
+	probes      int // Half-open requests in flight
+	successes   int // Half-open successes since the circuit last opened
+	transitions []CircuitTransition
 }
 
 // NewCircuitBreaker creates a new circuit breaker
-func NewCircuitBreaker(name string, maxFailures int, resetTimeout time.Duration) *CircuitBreaker {
+func NewCircuitBreaker(name string, config CircuitBreakerConfig) *CircuitBreaker {
 	return &CircuitBreaker{
-		name:         name,
-		maxFailures:  maxFailures,
-		resetTimeout: resetTimeout,
-		state:        StateClosed,
+		name:   name,
+		config: config.withDefaults(),
+		state:  StateClosed,
 	}
 }
 
-// Allow checks if request is allowed
+// Allow reports whether a request could be sent now, without taking a
+// half-open probe slot
 func (cb *CircuitBreaker) Allow() bool {
-	cb.mu.RLock()
-	defer cb.mu.RUnlock()
+	cb.mu.Lock()
+	t := cb.advance(time.Now())
+	allowed := cb.allowed()
+	cb.mu.Unlock()
 
-	switch cb.state {
-	case StateClosed:
-		return true
-	case StateOpen:
-		// Check if we should transition to half-open
-		if time.Since(cb.lastFailTime) > cb.resetTimeout {
-			cb.mu.RUnlock()
-			cb.mu.Lock()
-			cb.state = StateHalfOpen
-			cb.successCount = 0
-			cb.mu.Unlock()
-			cb.mu.RLock()
-			return true
-		}
-		return false
-	case StateHalfOpen:
-		return true
-	default:
-		return false
+	cb.notify(t)
+	return allowed
+}
+
+// Acquire admits a request about to be sent, taking a probe slot when the
+// circuit is half-open. Every admitted request must be followed by exactly
+// one of RecordSuccess, RecordFailure or Release.
+func (cb *CircuitBreaker) Acquire() bool {
+	cb.mu.Lock()
+	t := cb.advance(time.Now())
+	allowed := cb.allowed()
+	if allowed && cb.config.Enabled && cb.state == StateHalfOpen {
+		cb.probes++
 	}
+	cb.mu.Unlock()
+
+	cb.notify(t)
+	return allowed
 }
 
-// RecordSuccess records a successful request
-func (cb *CircuitBreaker) RecordSuccess() {
+// Release gives back an admitted request's probe slot without counting
+// its outcome, for failures that say nothing about the deployment
+func (cb *CircuitBreaker) Release() {
 	cb.mu.Lock()
 	defer cb.mu.Unlock()
+	cb.releaseProbe()
+}
 
-	switch cb.state {
-	case StateHalfOpen:
-		cb.successCount++
-		if cb.successCount >= 3 { // Require 3 successes to close
-			cb.state = StateClosed
-			cb.failures = 0
+// RecordSuccess records a successful request
+func (cb *CircuitBreaker) RecordSuccess() {
+	if !cb.config.Enabled {
+		return
+	}
+	now := time.Now()
+
+	cb.mu.Lock()
+	cb.bucket(now).successes++
+	var t *CircuitTransition
+	if cb.state == StateHalfOpen {
+		cb.releaseProbe()
+		cb.successes++
+		if cb.successes >= cb.config.SuccessThreshold {
+			t = cb.transition(StateClosed, now, fmt.Sprintf("%d half-open requests succeeded", cb.successes))
+			cb.buckets = [windowBuckets]windowBucket{}
 		}
-	case StateClosed:
-		cb.failures = 0
 	}
+	cb.mu.Unlock()
+
+	cb.notify(t)
 }
 
 // RecordFailure records a failed request
 func (cb *CircuitBreaker) RecordFailure() {
-	cb.mu.Lock()
-	defer cb.mu.Unlock()
-
-	cb.failures++
-	cb.lastFailTime = time.Now()
+	if !cb.config.Enabled {
+		return
+	}
+	now := time.Now()
 
+	cb.mu.Lock()
+	cb.bucket(now).failures++
+	var t *CircuitTransition
 	switch cb.state {
 	case StateClosed:
-		if cb.failures >= cb.maxFailures {
-			cb.state = StateOpen
+		requests, failures := cb.counts(now)
+		if requests >= cb.config.MinRequests && float64(failures)/float64(requests) >= cb.config.ErrorThreshold {
+			t = cb.transition(StateOpen, now, fmt.Sprintf("%d of %d requests failed in %s", failures, requests, cb.config.Window))
 		}
 	case StateHalfOpen:
-		cb.state = StateOpen
+		cb.releaseProbe()
+		t = cb.transition(StateOpen, now, "half-open request failed")
 	}
+	cb.mu.Unlock()
+
+	cb.notify(t)
 }
 
 // GetState returns current state
 func (cb *CircuitBreaker) GetState() CircuitBreakerState {
-	cb.mu.RLock()
-	defer cb.mu.RUnlock()
-	return cb.state
+	cb.mu.Lock()
+	t := cb.advance(time.Now())
+	state := cb.state
+	cb.mu.Unlock()
+
+	cb.notify(t)
+	return state
+}
+
+// Status returns a snapshot of the breaker and its recent transitions
+func (cb *CircuitBreaker) Status() CircuitBreakerStatus {
+	now := time.Now()
+
+	cb.mu.Lock()
+	t := cb.advance(now)
+	requests, failures := cb.counts(now)
+	status := CircuitBreakerStatus{
+		State:       cb.state,
+		ErrorRate:   errorRate(requests, failures),
+		Requests:    requests,
+		Failures:    failures,
+		Probes:      cb.probes,
+		Successes:   cb.successes,
+		Config:      cb.config,
+		Transitions: append([]CircuitTransition{}, cb.transitions...),
+	}
+	if cb.state != StateClosed {
+		openedAt := cb.openedAt
+		status.OpenedAt = &openedAt
+	}
+	cb.mu.Unlock()
+
+	cb.notify(t)
+	return status
 }
 
 // Reset resets the circuit breaker
 func (cb *CircuitBreaker) Reset() {
 	cb.mu.Lock()
-	defer cb.mu.Unlock()
-	
-	cb.state = StateClosed
-	cb.failures = 0
-	cb.successCount = 0
-}
\ No newline at end of file
+	t := cb.transition(StateClosed, time.Now(), "reset")
+	cb.buckets = [windowBuckets]windowBucket{}
+	cb.mu.Unlock()
+
+	cb.notify(t)
+}
+
+// allowed reports whether the current state admits a request
+func (cb *CircuitBreaker) allowed() bool {
+	if !cb.config.Enabled {
+		return true
+	}
+	switch cb.state {
+	case StateClosed:
+		return true
+	case StateHalfOpen:
+		return cb.probes < cb.config.HalfOpenRequests
+	}
+	return false
+}
+
+// advance turns an open circuit half-open once its timeout has passed
+func (cb *CircuitBreaker) advance(now time.Time) *CircuitTransition {
+	if cb.state != StateOpen || now.Sub(cb.openedAt) < cb.config.Timeout {
+		return nil
+	}
+	return cb.transition(StateHalfOpen, now, fmt.Sprintf("open for %s", cb.config.Timeout))
+}
+
+// transition changes state and records it. It returns nil when the state
+// is unchanged.
+func (cb *CircuitBreaker) transition(to CircuitBreakerState, now time.Time, reason string) *CircuitTransition {
+	if cb.state == to {
+		return nil
+	}
+	requests, failures := cb.counts(now)
+	t := CircuitTransition{
+		Deployment: cb.name,
+		From:       cb.state,
+		To:         to,
+		Reason:     reason,
+		ErrorRate:  errorRate(requests, failures),
+		Requests:   requests,
+		Time:       now,
+	}
+
+	cb.state = to
+	cb.probes = 0
+	cb.successes = 0
+	if to == StateOpen {
+		cb.openedAt = now
+	}
+
+	cb.transitions = append(cb.transitions, t)
+	if len(cb.transitions) > maxTransitions {
+		cb.transitions = cb.transitions[len(cb.transitions)-maxTransitions:]
+	}
+	return &t
+}
+
+func (cb *CircuitBreaker) notify(t *CircuitTransition) {
+	if t != nil && cb.onTransition != nil {
+		cb.onTransition(*t)
+	}
+}
+
+func (cb *CircuitBreaker) releaseProbe() {
+	if cb.state == StateHalfOpen && cb.probes > 0 {
+		cb.probes--
+	}
+}
+
+// bucket returns the window bucket for now, clearing it if it last held
+// an older slice of time
+func (cb *CircuitBreaker) bucket(now time.Time) *windowBucket {
+	width := cb.bucketWidth()
+	start := now.Truncate(width)
+	b := &cb.buckets[(start.UnixNano()/int64(width))%windowBuckets]
+	if !b.start.Equal(start) {
+		*b = windowBucket{start: start}
+	}
+	return b
+}
+
+// counts returns the requests and failures in the window ending at now
+func (cb *CircuitBreaker) counts(now time.Time) (requests, failures int) {
+	for _, b := range cb.buckets {
+		if !b.start.IsZero() && now.Sub(b.start) < cb.config.Window {
+			requests += b.successes + b.failures
+			failures += b.failures
+		}
+	}
+	return requests, failures
+}
+
+func (cb *CircuitBreaker) bucketWidth() time.Duration {
+	if width := cb.config.Window / windowBuckets; width > 0 {
+		return width
+	}
+	return 1
+}
+
+func errorRate(requests, failures int) float64 {
+	if requests == 0 {
+		return 0
+	}
+	return float64(failures) / float64(requests)
+}
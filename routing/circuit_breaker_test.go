@@ -0,0 +1,135 @@
+package routing
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"ch.at/providers"
+)
+
+func TestCircuitBreakerErrorRate(t *testing.T) {
+	cb := NewCircuitBreaker("d", CircuitBreakerConfig{Enabled: true, ErrorThreshold: 0.5, MinRequests: 4})
+	var got []CircuitTransition
+	cb.onTransition = func(tr CircuitTransition) { got = append(got, tr) }
+
+	// Failures below min_requests don't count, however bad the rate
+	cb.RecordFailure()
+	cb.RecordFailure()
+	if cb.GetState() != StateClosed {
+		t.Fatal("opened before min_requests")
+	}
+
+	// Successes between failures don't reset the window, unlike a
+	// consecutive failure count
+	cb.RecordSuccess()
+	cb.RecordFailure()
+	if cb.GetState() != StateOpen || cb.Allow() {
+		t.Fatalf("3 of 4 failed: state %s", cb.GetState())
+	}
+	if len(got) != 1 || got[0].To != StateOpen || got[0].Requests != 4 || got[0].ErrorRate != 0.75 {
+		t.Errorf("transitions = %+v", got)
+	}
+}
+
+func TestCircuitBreakerHalfOpen(t *testing.T) {
+	cb := NewCircuitBreaker("d", CircuitBreakerConfig{
+		Enabled:          true,
+		MinRequests:      1,
+		Timeout:          time.Millisecond,
+		SuccessThreshold: 2,
+		HalfOpenRequests: 1,
+	})
+	cb.RecordFailure()
+	time.Sleep(2 * time.Millisecond)
+
+	// One probe at a time
+	if !cb.Acquire() || cb.GetState() != StateHalfOpen {
+		t.Fatalf("no probe after the timeout: state %s", cb.GetState())
+	}
+	if cb.Allow() || cb.Acquire() {
+		t.Error("second probe admitted")
+	}
+	cb.RecordSuccess()
+	if !cb.Acquire() {
+		t.Fatal("probe slot not returned")
+	}
+	cb.RecordSuccess()
+	if cb.GetState() != StateClosed {
+		t.Fatalf("2 probe successes: state %s", cb.GetState())
+	}
+
+	// A failed probe reopens the circuit
+	cb.RecordFailure()
+	time.Sleep(2 * time.Millisecond)
+	cb.Acquire()
+	cb.RecordFailure()
+	if cb.GetState() != StateOpen {
+		t.Errorf("failed probe: state %s", cb.GetState())
+	}
+
+	status := cb.Status()
+	want := []CircuitBreakerState{StateOpen, StateHalfOpen, StateClosed, StateOpen, StateHalfOpen, StateOpen}
+	if len(status.Transitions) != len(want) {
+		t.Fatalf("transitions = %+v", status.Transitions)
+	}
+	for i, tr := range status.Transitions {
+		if tr.To != want[i] {
+			t.Errorf("transition %d to %s, want %s", i, tr.To, want[i])
+		}
+	}
+}
+
+func TestCircuitBreakerDisabled(t *testing.T) {
+	cb := NewCircuitBreaker("d", CircuitBreakerConfig{Enabled: false, MinRequests: 1})
+	for i := 0; i < 10; i++ {
+		cb.RecordFailure()
+	}
+	if !cb.Allow() || cb.GetState() != StateClosed {
+		t.Error("disabled breaker opened")
+	}
+}
+
+func TestCircuitBreakerConfigJSON(t *testing.T) {
+	data, err := json.Marshal(DefaultCircuitBreakerConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"window":"1m0s"`) || !strings.Contains(string(data), `"timeout":"1m0s"`) ||
+		!strings.Contains(string(data), `"min_requests":5`) {
+		t.Errorf("config = %s", data)
+	}
+}
+
+func TestRouterCircuitBreakerConfig(t *testing.T) {
+	router, decision := newMockRouter(map[string]interface{}{"error_rate": 1.0, "error_status": 503})
+	router.ConfigureCircuitBreaker("primary", CircuitBreakerConfig{Enabled: true, MinRequests: 2, Timeout: time.Hour})
+	var got []CircuitTransition
+	router.OnCircuitTransition(func(tr CircuitTransition) { got = append(got, tr) })
+
+	req := &providers.UnifiedRequest{Messages: []providers.Message{{Role: "user", Content: "hello"}}}
+	for i := 0; i < 3; i++ {
+		if _, err := router.ExecuteRequest(context.Background(), req, decision); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The open primary is skipped without another attempt
+	if n := router.deployments["primary"].Metrics.TotalRequests; n != 2 {
+		t.Errorf("primary tried %d times", n)
+	}
+	status, ok := router.CircuitBreakerStatus("primary")
+	if !ok || status.State != StateOpen || status.Config.MinRequests != 2 {
+		t.Errorf("status = %+v", status)
+	}
+	if len(got) != 1 || got[0].Deployment != "primary" {
+		t.Errorf("transitions = %+v", got)
+	}
+
+	// Other deployments keep the defaults
+	if status, _ := router.CircuitBreakerStatus("fallback"); status.Config != DefaultCircuitBreakerConfig() {
+		t.Errorf("fallback config = %+v", status.Config)
+	}
+}
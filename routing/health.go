@@ -2,11 +2,13 @@ package routing
 
 import (
 	"context"
+	"fmt"
 	"log"
 	"sync"
 	"time"
 
 	"ch.at/models"
+	"ch.at/providers"
 )
 
 // HealthChecker monitors deployment health
@@ -111,6 +113,7 @@ func (hc *HealthChecker) checkDeployment(deployment *models.Deployment) {
 	// Get provider
 	hc.router.mu.RLock()
 	provider, exists := hc.router.Providers[deployment.Provider]
+	model := hc.router.models[deployment.ModelID]
 	hc.router.mu.RUnlock()
 
 	if !exists {
@@ -120,7 +123,7 @@ func (hc *HealthChecker) checkDeployment(deployment *models.Deployment) {
 
 	// Perform health check
 	start := time.Now()
-	err := provider.HealthCheck(ctx, deployment)
+	err := hc.probe(ctx, provider, model, deployment)
 	responseTime := time.Since(start)
 
 	if err != nil {
@@ -136,6 +139,19 @@ func (hc *HealthChecker) checkDeployment(deployment *models.Deployment) {
 	}
 }
 
+// probe runs the provider's health check. Embedding models can't answer
+// a chat request, so their deployments are checked with an embedding.
+func (hc *HealthChecker) probe(ctx context.Context, provider providers.Provider, model *models.Model, deployment *models.Deployment) error {
+	if model == nil || !model.Capabilities.SupportsEmbeddings {
+		return provider.HealthCheck(ctx, deployment)
+	}
+	embedder, ok := provider.(providers.Embedder)
+	if !ok {
+		return fmt.Errorf("provider %s does not support embeddings", deployment.Provider)
+	}
+	return embedder.EmbeddingHealthCheck(ctx, deployment)
+}
+
 // updateDeploymentHealth updates deployment health status
 func (hc *HealthChecker) updateDeploymentHealth(deployment *models.Deployment, healthy bool, errorMsg string) {
 	hc.router.mu.Lock()
@@ -2,11 +2,14 @@ package routing
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"log"
 	"math/rand"
 	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"ch.at/models"
@@ -25,15 +28,28 @@ type Router struct {
 
 	// Runtime state
 	mu              sync.RWMutex
-	roundRobinIndex map[string]int
-	lastIndex       int // For tier-based round-robin
 	healthChecker   *HealthChecker
 	healthCheckers  map[string]*HealthChecker
 
+	// Round-robin positions, which advance while routing holds only the
+	// read lock, so they have a lock of their own
+	indexMu         sync.Mutex
+	roundRobinIndex map[string]int
+	lastIndex       int // For tier-based round-robin
+
 	// Circuit breakers
-	circuitBreakers map[string]*CircuitBreaker
+	circuitBreakers     map[string]*CircuitBreaker
+	breakerDefaults     CircuitBreakerConfig
+	onCircuitTransition atomic.Pointer[func(CircuitTransition)]
 }
 
+// Retry backoff bounds. Upstreams asking for a longer wait than
+// retryMaxDelay are treated as unavailable and the request falls back.
+const (
+	retryBaseDelay = 250 * time.Millisecond
+	retryMaxDelay  = 10 * time.Second
+)
+
 // RoutingStrategy defines how to select deployments
 type RoutingStrategy string
 
@@ -54,6 +70,7 @@ func NewRouter(strategy RoutingStrategy) *Router {
 		strategy:        strategy,
 		roundRobinIndex: make(map[string]int),
 		circuitBreakers: make(map[string]*CircuitBreaker),
+		breakerDefaults: DefaultCircuitBreakerConfig(),
 	}
 }
 
@@ -76,7 +93,72 @@ func (r *Router) RegisterDeployment(deployment *models.Deployment) {
 	}
 	
 	// Initialize circuit breaker for this deployment
-	r.circuitBreakers[deployment.ID] = NewCircuitBreaker(deployment.ID, 5, 60*time.Second)
+	r.circuitBreakers[deployment.ID] = r.newCircuitBreaker(deployment.ID, r.breakerDefaults)
+}
+
+// SetCircuitBreakerDefaults sets the circuit breaker configuration for
+// deployments registered from now on
+func (r *Router) SetCircuitBreakerDefaults(config CircuitBreakerConfig) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.breakerDefaults = config
+}
+
+// ConfigureCircuitBreaker replaces a registered deployment's circuit
+// breaker with one using config
+func (r *Router) ConfigureCircuitBreaker(deploymentID string, config CircuitBreakerConfig) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, exists := r.deployments[deploymentID]; exists {
+		r.circuitBreakers[deploymentID] = r.newCircuitBreaker(deploymentID, config)
+	}
+}
+
+// OnCircuitTransition sets a function called on every circuit breaker
+// state change. It may be called with the router locked, so it must not
+// call back into the router.
+func (r *Router) OnCircuitTransition(fn func(CircuitTransition)) {
+	r.onCircuitTransition.Store(&fn)
+}
+
+// CircuitBreakerStatus returns a deployment's circuit breaker state and
+// recent transitions
+func (r *Router) CircuitBreakerStatus(deploymentID string) (CircuitBreakerStatus, bool) {
+	r.mu.RLock()
+	cb, exists := r.circuitBreakers[deploymentID]
+	r.mu.RUnlock()
+	if !exists {
+		return CircuitBreakerStatus{}, false
+	}
+	return cb.Status(), true
+}
+
+func (r *Router) newCircuitBreaker(deploymentID string, config CircuitBreakerConfig) *CircuitBreaker {
+	cb := NewCircuitBreaker(deploymentID, config)
+	cb.onTransition = func(t CircuitTransition) {
+		log.Printf("Circuit breaker for %s: %s -> %s (%s)", t.Deployment, t.From, t.To, t.Reason)
+		if fn := r.onCircuitTransition.Load(); fn != nil {
+			(*fn)(t)
+		}
+	}
+	return cb
+}
+
+// admit takes a request slot on a deployment's circuit breaker, which may
+// have opened, or run out of half-open probes, since the request was routed
+func (r *Router) admit(deployment *models.Deployment) error {
+	r.mu.RLock()
+	cb, exists := r.circuitBreakers[deployment.ID]
+	r.mu.RUnlock()
+
+	if exists && !cb.Acquire() {
+		return &providers.ProviderError{
+			Type:     providers.ErrUpstreamUnavailable,
+			Provider: string(deployment.Provider),
+			Message:  fmt.Sprintf("circuit breaker for %s is open", deployment.ID),
+		}
+	}
+	return nil
 }
 
 // RegisterProvider registers a provider
@@ -98,26 +180,24 @@ func (r *Router) RouteRequest(ctx context.Context, modelID string, reqCtx *Reque
 	}
 
 	// Get model
-	model, exists := r.models[modelID]
-	if !exists {
-		// Try to find a deployment with this ID as provider model
-		for _, deployment := range r.deployments {
-			if deployment.ProviderModelID == modelID {
-				model = r.models[deployment.ModelID]
-				if model != nil {
-					break
-				}
-			}
-		}
-		if model == nil {
-			return nil, fmt.Errorf("model not found: %s", modelID)
-		}
+	model := r.findModel(modelID)
+	if model == nil {
+		return nil, fmt.Errorf("%w: %s", ErrModelNotFound, modelID)
 	}
 
 	// Get available deployments
-	availableDeployments := r.getAvailableDeployments(model.Deployments)
+	availableDeployments, missing := r.getAvailableDeployments(model.Deployments, reqCtx)
+	if missing != "" {
+		return nil, &CapabilityError{ModelID: modelID, Capability: missing}
+	}
 	if len(availableDeployments) == 0 {
-		return nil, fmt.Errorf("no available deployments for model %s", modelID)
+		return nil, fmt.Errorf("%w for model %s", ErrNoDeployments, modelID)
+	}
+
+	// Drop deployments whose context window is too small for the request
+	availableDeployments, err := r.filterContextWindow(modelID, availableDeployments, reqCtx)
+	if err != nil {
+		return nil, err
 	}
 
 	// Apply routing strategy
@@ -143,43 +223,59 @@ func (r *Router) RouteRequest(ctx context.Context, modelID string, reqCtx *Reque
 	}, nil
 }
 
-// routeByTier routes a request based on tier preference
-func (r *Router) routeByTier(ctx context.Context, tier string, reqCtx *RequestContext) (*RoutingDecision, error) {
-	// Find all deployments with the requested tier
-	var tierDeployments []*models.Deployment
+// findModel looks a model up by ID, or by the provider model ID of one
+// of its deployments
+func (r *Router) findModel(modelID string) *models.Model {
+	if model, exists := r.models[modelID]; exists {
+		return model
+	}
 	for _, deployment := range r.deployments {
-		if deployment.Tags != nil && deployment.Tags["tier"] == tier {
-			// Check if deployment is healthy
-			if cb, exists := r.circuitBreakers[deployment.ID]; exists && !cb.Allow() {
-				continue
-			}
-			// Check deployment health status
-			if !deployment.Status.Available || deployment.Status.ConsecutiveFails >= 3 {
-				continue
+		if deployment.ProviderModelID == modelID {
+			if model := r.models[deployment.ModelID]; model != nil {
+				return model
 			}
-			tierDeployments = append(tierDeployments, deployment)
 		}
 	}
+	return nil
+}
 
+// routeByTier routes a request based on tier preference
+func (r *Router) routeByTier(ctx context.Context, tier string, reqCtx *RequestContext) (*RoutingDecision, error) {
+	tierDeployments, missing := r.tierDeployments(tier, reqCtx)
+	if missing != "" {
+		return nil, &CapabilityError{ModelID: "tier:" + tier, Capability: missing}
+	}
 	if len(tierDeployments) == 0 {
-		return nil, fmt.Errorf("no available deployments for tier: %s", tier)
+		return nil, fmt.Errorf("%w for tier: %s", ErrNoDeployments, tier)
+	}
+
+	// Prefer the tier's models that can hold the whole request
+	tierDeployments, err := r.filterContextWindow("tier:"+tier, tierDeployments, reqCtx)
+	if err != nil {
+		return nil, err
 	}
 
 	// Select deployment based on strategy (default to round-robin for tier selection)
 	var selected *models.Deployment
 	
 	// Simple round-robin selection
+	r.indexMu.Lock()
 	if r.lastIndex >= len(tierDeployments) {
 		r.lastIndex = 0
 	}
 	selected = tierDeployments[r.lastIndex]
 	r.lastIndex++
+	r.indexMu.Unlock()
+
+	// The rest of the tier backs it up
+	fallbacks := r.selectFallbacks(tierDeployments, selected, reqCtx)
 
 	// Create routing decision
 	return &RoutingDecision{
 		RequestID: reqCtx.RequestID,
 		ModelID:   "tier:" + tier,
 		Primary:   selected,
+		Fallbacks: fallbacks,
 		Strategy:  r.strategy,
 		Timestamp: time.Now(),
 		Metadata: map[string]interface{}{
@@ -189,9 +285,139 @@ func (r *Router) routeByTier(ctx context.Context, tier string, reqCtx *RequestCo
 	}, nil
 }
 
-// getAvailableDeployments returns healthy deployments
-func (r *Router) getAvailableDeployments(deploymentIDs []string) []*models.Deployment {
+// tierDeployments returns the healthy deployments of a tier that can
+// serve the request, as getAvailableDeployments does for a model
+func (r *Router) tierDeployments(tier string, reqCtx *RequestContext) ([]*models.Deployment, string) {
+	// Find all deployments with the requested tier, in a stable order so
+	// that round-robin visits each in turn
+	var ids []string
+	for _, deployment := range r.deployments {
+		if deployment.Tags != nil && deployment.Tags["tier"] == tier {
+			ids = append(ids, deployment.ID)
+		}
+	}
+	sort.Strings(ids)
+	return r.getAvailableDeployments(ids, reqCtx)
+}
+
+// Capabilities returns what a deployment can serve: its model's
+// capabilities, with any of max_tokens, context_window and the supports_*
+// flags in the deployment's parameters taking precedence. A deployment may
+// serve a model through a provider or region that lacks some of its
+// features, or caps its limits lower.
+func (r *Router) Capabilities(deployment *models.Deployment) models.ModelCapabilities {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.capabilities(deployment)
+}
+
+func (r *Router) capabilities(deployment *models.Deployment) models.ModelCapabilities {
+	var caps models.ModelCapabilities
+	if model := r.models[deployment.ModelID]; model != nil {
+		caps = model.Capabilities
+	}
+
+	params := deployment.Parameters
+	if v, ok := intParameter(params, "max_tokens"); ok {
+		caps.MaxTokens = v
+	}
+	if v, ok := intParameter(params, "context_window"); ok {
+		caps.ContextWindow = v
+	}
+	for key, flag := range map[string]*bool{
+		"supports_vision":     &caps.SupportsVision,
+		"supports_functions":  &caps.SupportsFunctions,
+		"supports_streaming":  &caps.SupportsStreaming,
+		"supports_json":       &caps.SupportsJSON,
+		"supports_embeddings": &caps.SupportsEmbeddings,
+	} {
+		if v, ok := params[key].(bool); ok {
+			*flag = v
+		}
+	}
+	return caps
+}
+
+// contextWindow returns a deployment's context window in tokens. Zero
+// means unknown, and is treated as large enough for any request.
+func (r *Router) contextWindow(deployment *models.Deployment) int {
+	return r.capabilities(deployment).ContextWindow
+}
+
+// filterContextWindow drops the deployments too small for the request's
+// ContextTokens. When none is large enough it returns a ContextWindowError
+// naming the largest window on offer.
+func (r *Router) filterContextWindow(modelID string, deployments []*models.Deployment, reqCtx *RequestContext) ([]*models.Deployment, error) {
+	if reqCtx.ContextTokens <= 0 {
+		return deployments, nil
+	}
+
+	var fit []*models.Deployment
+	largest := 0
+	for _, d := range deployments {
+		window := r.contextWindow(d)
+		if window <= 0 || window >= reqCtx.ContextTokens {
+			fit = append(fit, d)
+		}
+		if window > largest {
+			largest = window
+		}
+	}
+	if len(fit) == 0 {
+		return nil, &ContextWindowError{ModelID: modelID, Tokens: reqCtx.ContextTokens, Largest: largest}
+	}
+	return fit, nil
+}
+
+// LargestContextWindow returns the largest context window among the
+// deployments a request for modelID could be routed to, so callers can fit
+// a request to it before routing. It returns 0 when any of them has an
+// unknown window, or when the request can't be routed at all.
+func (r *Router) LargestContextWindow(modelID string, reqCtx *RequestContext) int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var candidates []*models.Deployment
+	if tier, ok := strings.CutPrefix(modelID, "tier:"); ok {
+		candidates, _ = r.tierDeployments(tier, reqCtx)
+	} else if model := r.findModel(modelID); model != nil {
+		candidates, _ = r.getAvailableDeployments(model.Deployments, reqCtx)
+	}
+
+	largest := 0
+	for _, d := range candidates {
+		window := r.contextWindow(d)
+		if window <= 0 {
+			return 0
+		}
+		if window > largest {
+			largest = window
+		}
+	}
+	return largest
+}
+
+// intParameter reads a numeric deployment parameter, which YAML may
+// decode as an int or a float
+func intParameter(params map[string]interface{}, key string) (int, bool) {
+	switch v := params[key].(type) {
+	case int:
+		return v, true
+	case int64:
+		return int(v), true
+	case float64:
+		return int(v), true
+	}
+	return 0, false
+}
+
+// getAvailableDeployments returns healthy deployments that can serve the
+// request. When none of the deployments has the capabilities the request
+// needs, it names the missing one instead.
+func (r *Router) getAvailableDeployments(deploymentIDs []string, reqCtx *RequestContext) ([]*models.Deployment, string) {
 	var available []*models.Deployment
+	missing := ""
+	capable := 0
 	
 	for _, id := range deploymentIDs {
 		deployment, exists := r.deployments[id]
@@ -199,6 +425,15 @@ func (r *Router) getAvailableDeployments(deploymentIDs []string) []*models.Deplo
 			continue
 		}
 
+		// Skip deployments that cannot serve the request, healthy or not
+		if m := missingCapability(r.capabilities(deployment), reqCtx); m != "" {
+			if missing == "" {
+				missing = m
+			}
+			continue
+		}
+		capable++
+
 		// Check circuit breaker
 		if cb, exists := r.circuitBreakers[id]; exists && !cb.Allow() {
 			continue
@@ -209,8 +444,25 @@ func (r *Router) getAvailableDeployments(deploymentIDs []string) []*models.Deplo
 			available = append(available, deployment)
 		}
 	}
+	if capable == 0 && missing != "" {
+		return nil, missing
+	}
+
+	// JSON is validated by the gateway for deployments without a native
+	// JSON mode, so those serve JSON requests only when nothing else can
+	if reqCtx.RequiresJSON {
+		var native []*models.Deployment
+		for _, deployment := range available {
+			if r.capabilities(deployment).SupportsJSON {
+				native = append(native, deployment)
+			}
+		}
+		if len(native) > 0 {
+			available = native
+		}
+	}
 
-	return available
+	return available, ""
 }
 
 // selectDeployment selects a deployment based on routing strategy
@@ -242,8 +494,10 @@ func (r *Router) selectRoundRobin(deployments []*models.Deployment, reqCtx *Requ
 	}
 
 	key := reqCtx.ModelID
+	r.indexMu.Lock()
 	index := r.roundRobinIndex[key] % len(deployments)
 	r.roundRobinIndex[key] = index + 1
+	r.indexMu.Unlock()
 	
 	return deployments[index]
 }
@@ -353,29 +607,299 @@ func (r *Router) selectFallbacks(deployments []*models.Deployment, primary *mode
 
 // ExecuteRequest executes a request with routing and fallback
 func (r *Router) ExecuteRequest(ctx context.Context, req *providers.UnifiedRequest, decision *RoutingDecision) (*providers.UnifiedResponse, error) {
-	// Try primary deployment
-	resp, err := r.tryDeployment(ctx, req, decision.Primary)
-	if err == nil {
-		return resp, nil
+	candidates := append([]*models.Deployment{decision.Primary}, decision.Fallbacks...)
+
+	var lastErr error
+	for _, deployment := range candidates {
+		release, err := decision.admit(deployment)
+		if err != nil {
+			return nil, err
+		}
+		if err := r.admit(deployment); err != nil {
+			release()
+			lastErr = err
+			continue
+		}
+		resp, err := r.tryDeployment(ctx, req, deployment)
+		release()
+		if err == nil {
+			return resp, nil
+		}
+		lastErr = err
+
+		if !r.handleFailure(ctx, deployment.ID, err) {
+			return nil, err
+		}
 	}
 
-	// Record failure
-	r.recordFailure(decision.Primary.ID)
+	return nil, fmt.Errorf("all deployments failed: %w", lastErr)
+}
+
+// ExecuteEmbedding executes an embeddings request with the same retries,
+// fallbacks and circuit breakers as ExecuteRequest
+func (r *Router) ExecuteEmbedding(ctx context.Context, req *providers.EmbeddingRequest, decision *RoutingDecision) (*providers.EmbeddingResponse, error) {
+	candidates := append([]*models.Deployment{decision.Primary}, decision.Fallbacks...)
 
-	// Try fallbacks
-	for _, fallback := range decision.Fallbacks {
-		resp, err = r.tryDeployment(ctx, req, fallback)
+	var lastErr error
+	for _, deployment := range candidates {
+		release, err := decision.admit(deployment)
+		if err != nil {
+			return nil, err
+		}
+		if err := r.admit(deployment); err != nil {
+			release()
+			lastErr = err
+			continue
+		}
+		var resp *providers.EmbeddingResponse
+		err = r.withRetries(ctx, deployment, func() (bool, error) {
+			var err error
+			resp, err = r.attemptEmbedding(ctx, req, deployment)
+			return true, err
+		})
+		release()
 		if err == nil {
 			return resp, nil
 		}
-		r.recordFailure(fallback.ID)
+		lastErr = err
+
+		if !r.handleFailure(ctx, deployment.ID, err) {
+			return nil, err
+		}
+	}
+
+	return nil, fmt.Errorf("all deployments failed: %w", lastErr)
+}
+
+// attemptEmbedding makes a single embeddings request to a deployment
+func (r *Router) attemptEmbedding(ctx context.Context, req *providers.EmbeddingRequest, deployment *models.Deployment) (*providers.EmbeddingResponse, error) {
+	provider, exists := r.Providers[deployment.Provider]
+	if !exists {
+		return nil, fmt.Errorf("provider not found: %s", deployment.Provider)
+	}
+	embedder, ok := provider.(providers.Embedder)
+	if !ok {
+		return nil, fmt.Errorf("provider %s does not support embeddings", deployment.Provider)
+	}
+
+	providerReq, err := embedder.TranslateEmbeddingRequest(ctx, req, deployment)
+	if err != nil {
+		return nil, fmt.Errorf("failed to translate request: %w", err)
+	}
+
+	providerResp, err := provider.Execute(ctx, providerReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute request: %w", err)
+	}
+
+	embeddingResp, err := embedder.TranslateEmbeddingResponse(ctx, providerResp, deployment)
+	if err != nil {
+		return nil, fmt.Errorf("failed to translate response: %w", err)
+	}
+
+	// A short or reordered answer would misalign vectors with inputs
+	if len(embeddingResp.Data) != len(req.Input) {
+		return nil, &providers.ProviderError{
+			Type:     providers.ErrUpstreamUnavailable,
+			Provider: string(deployment.Provider),
+			Message:  fmt.Sprintf("got %d embeddings for %d inputs", len(embeddingResp.Data), len(req.Input)),
+		}
+	}
+	sort.Slice(embeddingResp.Data, func(i, j int) bool {
+		return embeddingResp.Data[i].Index < embeddingResp.Data[j].Index
+	})
+
+	r.recordSuccess(deployment.ID)
+	return embeddingResp, nil
+}
+
+// ExecuteStream streams a request through the same fallback chain as
+// ExecuteRequest. Deployments are tried in order until one emits output;
+// once a chunk with content has been passed to emit, switching deployments
+// would splice two different answers, so a later failure ends the stream
+// with that error instead. It returns the deployment that served the stream.
+func (r *Router) ExecuteStream(ctx context.Context, req *providers.UnifiedRequest, decision *RoutingDecision, emit func(providers.StreamChunk)) (*models.Deployment, error) {
+	candidates := append([]*models.Deployment{decision.Primary}, decision.Fallbacks...)
+
+	var lastErr error
+	for _, deployment := range candidates {
+		release, err := decision.admit(deployment)
+		if err != nil {
+			return nil, err
+		}
+		if err := r.admit(deployment); err != nil {
+			release()
+			lastErr = err
+			continue
+		}
+		var started bool
+		err = r.withRetries(ctx, deployment, func() (bool, error) {
+			var err error
+			started, err = r.attemptStream(ctx, req, deployment, emit)
+			return !started, err
+		})
+		release()
+		if err == nil {
+			return deployment, nil
+		}
+		lastErr = err
+
+		if !r.handleFailure(ctx, deployment.ID, err) || started {
+			return deployment, err
+		}
 	}
 
-	return nil, fmt.Errorf("all deployments failed")
+	return nil, fmt.Errorf("all deployments failed: %w", lastErr)
 }
 
-// tryDeployment attempts to execute request on a deployment
+// attemptStream streams from a single deployment and reports whether any
+// content reached emit before it finished or failed
+func (r *Router) attemptStream(ctx context.Context, req *providers.UnifiedRequest, deployment *models.Deployment, emit func(providers.StreamChunk)) (bool, error) {
+	provider, exists := r.Providers[deployment.Provider]
+	if !exists {
+		return false, fmt.Errorf("provider not found: %s", deployment.Provider)
+	}
+
+	providerReq, err := provider.TranslateRequest(ctx, req, deployment)
+	if err != nil {
+		return false, fmt.Errorf("failed to translate request: %w", err)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	chunks := make(chan providers.StreamChunk)
+	go provider.Stream(ctx, providerReq, chunks)
+	defer func() {
+		// Stop the upstream and let the provider goroutine finish sending
+		cancel()
+		go func() {
+			for range chunks {
+			}
+		}()
+	}()
+
+	started, done := false, false
+	for chunk := range chunks {
+		if chunk.Error != nil {
+			return started, chunk.Error
+		}
+		if chunk.Done {
+			done = true
+			break
+		}
+		if chunk.Data != "" || len(chunk.ToolCalls) > 0 {
+			started = true
+		}
+		emit(chunk)
+	}
+
+	// A stream that closes with neither output nor a Done marker was cut off
+	if !started && !done {
+		return false, &providers.ProviderError{
+			Type:     providers.ErrUpstreamUnavailable,
+			Provider: string(deployment.Provider),
+			Message:  "stream ended before any output",
+		}
+	}
+
+	r.recordSuccess(deployment.ID)
+	return started, nil
+}
+
+// handleFailure records a failed attempt and reports whether the next
+// deployment should be tried. Only errors that reflect on deployment health
+// count against the circuit breaker; errors caused by the request itself
+// fail fast since every fallback would reject it the same way.
+func (r *Router) handleFailure(ctx context.Context, deploymentID string, err error) bool {
+	if errors.Is(err, context.Canceled) {
+		// The caller went away, that says nothing about the deployment
+		r.recordCanceled(deploymentID)
+		return false
+	}
+
+	pe, typed := providers.AsProviderError(err)
+	if !typed || pe.TripsBreaker() {
+		r.recordFailure(deploymentID)
+	} else {
+		r.recordRejected(deploymentID)
+	}
+
+	if ctx.Err() != nil {
+		return false
+	}
+	return !typed || pe.Fallback()
+}
+
+// tryDeployment sends the request to one deployment, retrying retryable
+// errors up to Endpoint.MaxRetries times
 func (r *Router) tryDeployment(ctx context.Context, req *providers.UnifiedRequest, deployment *models.Deployment) (*providers.UnifiedResponse, error) {
+	var resp *providers.UnifiedResponse
+	err := r.withRetries(ctx, deployment, func() (bool, error) {
+		var err error
+		resp, err = r.attemptDeployment(ctx, req, deployment)
+		return true, err
+	})
+	return resp, err
+}
+
+// withRetries runs attempt until it succeeds or fails with an error that
+// should not be retried, backing off exponentially between attempts. attempt
+// reports whether its failure may be retried at all. A retry is skipped when
+// its delay would not fit inside the caller's deadline, leaving the remaining
+// time for fallback deployments.
+func (r *Router) withRetries(ctx context.Context, deployment *models.Deployment, attempt func() (bool, error)) error {
+	for n := 0; ; n++ {
+		canRetry, err := attempt()
+		if err == nil {
+			return nil
+		}
+
+		pe, typed := providers.AsProviderError(err)
+		if !canRetry || !typed || !pe.Retryable() || n >= deployment.Endpoint.MaxRetries {
+			return err
+		}
+
+		delay, ok := retryDelay(ctx, n, pe.RetryAfter)
+		if !ok {
+			return err
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		}
+
+		r.recordRetry(deployment.ID)
+	}
+}
+
+// retryDelay returns how long to wait before retry number attempt+1: full
+// jitter exponential backoff, but never sooner than the upstream asked for.
+// It reports false when the wait would exceed retryMaxDelay or the deadline.
+func retryDelay(ctx context.Context, attempt int, retryAfter time.Duration) (time.Duration, bool) {
+	if retryAfter > retryMaxDelay {
+		return 0, false
+	}
+
+	backoff := retryBaseDelay << attempt
+	if backoff > retryMaxDelay {
+		backoff = retryMaxDelay
+	}
+	delay := backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+	if retryAfter > delay {
+		delay = retryAfter
+	}
+
+	if deadline, ok := ctx.Deadline(); ok && time.Now().Add(delay).After(deadline) {
+		return 0, false
+	}
+	return delay, true
+}
+
+// attemptDeployment makes a single request to a deployment
+func (r *Router) attemptDeployment(ctx context.Context, req *providers.UnifiedRequest, deployment *models.Deployment) (*providers.UnifiedResponse, error) {
 	// Get provider
 	provider, exists := r.Providers[deployment.Provider]
 	if !exists {
@@ -439,6 +963,43 @@ func (r *Router) recordFailure(deploymentID string) {
 	}
 }
 
+// recordRetry counts a retry of a failed attempt
+func (r *Router) recordRetry(deploymentID string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if deployment, exists := r.deployments[deploymentID]; exists {
+		deployment.Metrics.Retries++
+	}
+}
+
+// recordRejected counts a failed request without touching the circuit breaker
+// or the consecutive failure count, for rate limits and invalid requests
+func (r *Router) recordRejected(deploymentID string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if deployment, exists := r.deployments[deploymentID]; exists {
+		deployment.Metrics.FailedRequests++
+		deployment.Metrics.TotalRequests++
+	}
+
+	if cb, exists := r.circuitBreakers[deploymentID]; exists {
+		cb.Release()
+	}
+}
+
+// recordCanceled releases the circuit breaker slot of a request whose
+// caller went away
+func (r *Router) recordCanceled(deploymentID string) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if cb, exists := r.circuitBreakers[deploymentID]; exists {
+		cb.Release()
+	}
+}
+
 // RoutingDecision represents a routing choice with fallbacks
 type RoutingDecision struct {
 	RequestID string                 `json:"request_id"`
@@ -448,6 +1009,19 @@ type RoutingDecision struct {
 	Strategy  RoutingStrategy        `json:"strategy"`
 	Timestamp time.Time              `json:"timestamp"`
 	Metadata  map[string]interface{} `json:"metadata"`
+
+	// Admit, when set, is called before each deployment is tried, fallbacks
+	// included, and may block to bound concurrency per deployment. The
+	// returned release func is called once that deployment is done with.
+	Admit func(deploymentID string) (release func(), err error) `json:"-"`
+}
+
+// admit calls the decision's Admit hook for deployment, if it has one
+func (d *RoutingDecision) admit(deployment *models.Deployment) (func(), error) {
+	if d.Admit == nil {
+		return func() {}, nil
+	}
+	return d.Admit(deployment.ID)
 }
 
 // RequestContext provides context for routing decisions
@@ -461,4 +1035,78 @@ type RequestContext struct {
 	MaxCost        float64
 	Region         string
 	UserPreference map[string]interface{}
+
+	// Capabilities the request needs; deployments lacking them are not
+	// routed to. NewRequestContext derives them from a request.
+	RequiresFunctions  bool
+	RequiresVision     bool
+	RequiresStreaming  bool
+	RequiresEmbeddings bool // An embeddings request rather than a chat request
+	RequiresJSON       bool // Prefers native JSON mode; others are validated by the gateway
+	MaxTokens          int  // Completion tokens; deployments with a lower max_tokens are not routed to
+
+	// Prompt plus completion tokens; deployments with a smaller context
+	// window are not routed to
+	ContextTokens int
+}
+
+// Routing failures callers may want to tell apart
+var (
+	ErrModelNotFound = errors.New("model not found")
+	ErrNoDeployments = errors.New("no available deployments")
+)
+
+// CapabilityError reports that the requested model cannot serve a request
+type CapabilityError struct {
+	ModelID    string
+	Capability string
+}
+
+func (e *CapabilityError) Error() string {
+	return fmt.Sprintf("model %s does not support %s", e.ModelID, e.Capability)
+}
+
+// ContextWindowError reports that no deployment of the requested model
+// has a context window large enough for the request
+type ContextWindowError struct {
+	ModelID string
+	Tokens  int // Needed by the request
+	Largest int // Largest context window available
+}
+
+func (e *ContextWindowError) Error() string {
+	return fmt.Sprintf("request needs %d tokens but the largest context window of %s is %d", e.Tokens, e.ModelID, e.Largest)
+}
+
+// NewRequestContext returns a request context with the capabilities req needs
+func NewRequestContext(requestID string, req *providers.UnifiedRequest) *RequestContext {
+	return &RequestContext{
+		RequestID:         requestID,
+		ModelID:           req.Model,
+		RequiresFunctions: req.HasTools(),
+		RequiresVision:    req.HasImages(),
+		RequiresStreaming: req.Stream,
+		RequiresJSON:      req.ResponseFormat.WantsJSON(),
+		MaxTokens:         req.MaxTokens,
+	}
+}
+
+// missingCapability names the first capability the request needs that
+// a deployment with caps lacks, or returns "" when it can serve the request
+func missingCapability(caps models.ModelCapabilities, reqCtx *RequestContext) string {
+	switch {
+	case reqCtx.RequiresEmbeddings && !caps.SupportsEmbeddings:
+		return "embeddings"
+	case !reqCtx.RequiresEmbeddings && caps.SupportsEmbeddings:
+		return "chat completions"
+	case reqCtx.RequiresFunctions && !caps.SupportsFunctions:
+		return "function calling"
+	case reqCtx.RequiresVision && !caps.SupportsVision:
+		return "image inputs"
+	case reqCtx.RequiresStreaming && !caps.SupportsStreaming:
+		return "streaming"
+	case caps.MaxTokens > 0 && reqCtx.MaxTokens > caps.MaxTokens:
+		return fmt.Sprintf("%d output tokens (at most %d)", reqCtx.MaxTokens, caps.MaxTokens)
+	}
+	return ""
 }
\ No newline at end of file
@@ -0,0 +1,432 @@
+package routing
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"ch.at/models"
+	"ch.at/providers"
+)
+
+func newMockRouter(primaryParams map[string]interface{}) (*Router, *RoutingDecision) {
+	router := NewRouter(StrategyPriority)
+	router.RegisterProvider(models.ProviderMock, providers.NewMockProvider())
+
+	primary := &models.Deployment{ID: "primary", ModelID: "llama-8b", Provider: models.ProviderMock, Parameters: primaryParams}
+	fallback := &models.Deployment{ID: "fallback", ModelID: "llama-8b", Provider: models.ProviderMock}
+	router.RegisterDeployment(primary)
+	router.RegisterDeployment(fallback)
+
+	return router, &RoutingDecision{Primary: primary, Fallbacks: []*models.Deployment{fallback}}
+}
+
+func TestExecuteRequestErrorTypes(t *testing.T) {
+	req := &providers.UnifiedRequest{Messages: []providers.Message{{Role: "user", Content: "hello"}}}
+
+	cases := []struct {
+		status       int
+		wantFallback bool
+		wantTrip     bool
+	}{
+		{429, true, false},  // rate limited: fall back, breaker untouched
+		{400, false, false}, // bad request: fail fast
+		{503, true, true},   // upstream unavailable: fall back and count against the breaker
+		{404, true, true},   // model missing on this upstream: fall back and count against the breaker
+	}
+
+	for _, tc := range cases {
+		router, decision := newMockRouter(map[string]interface{}{"error_rate": 1.0, "error_status": tc.status})
+
+		resp, err := router.ExecuteRequest(context.Background(), req, decision)
+		if tc.wantFallback {
+			if err != nil || resp.Metadata["deployment_id"] != "fallback" {
+				t.Errorf("status %d: expected the fallback to answer, got %v", tc.status, err)
+			}
+		} else {
+			if err == nil {
+				t.Fatalf("status %d: expected an error", tc.status)
+			}
+			if pe, ok := providers.AsProviderError(err); !ok || pe.Type != providers.ErrBadRequest {
+				t.Errorf("status %d: error lost its type: %v", tc.status, err)
+			}
+			if router.deployments["fallback"].Metrics.TotalRequests != 0 {
+				t.Errorf("status %d: fallback should not have been tried", tc.status)
+			}
+		}
+
+		primary := router.deployments["primary"]
+		if primary.Metrics.FailedRequests != 1 {
+			t.Errorf("status %d: failed requests = %d", tc.status, primary.Metrics.FailedRequests)
+		}
+		if tripped := primary.Status.ConsecutiveFails > 0; tripped != tc.wantTrip {
+			t.Errorf("status %d: consecutive fails = %d", tc.status, primary.Status.ConsecutiveFails)
+		}
+	}
+}
+
+// scriptedProvider fails with the given errors in order, then behaves like the mock provider
+type scriptedProvider struct {
+	*providers.MockProvider
+	errs    []error
+	partial string // Streamed before the error
+	calls   int
+}
+
+func (p *scriptedProvider) Execute(ctx context.Context, req *providers.ProviderRequest) (*providers.ProviderResponse, error) {
+	p.calls++
+	if p.calls <= len(p.errs) {
+		return nil, p.errs[p.calls-1]
+	}
+	return p.MockProvider.Execute(ctx, req)
+}
+
+func TestExecuteRequestRetries(t *testing.T) {
+	req := &providers.UnifiedRequest{Messages: []providers.Message{{Role: "user", Content: "hello"}}}
+
+	router, decision := newMockRouter(nil)
+	decision.Primary.Endpoint.MaxRetries = 2
+	provider := &scriptedProvider{
+		MockProvider: providers.NewMockProvider(),
+		errs: []error{
+			&providers.ProviderError{Type: providers.ErrUpstreamUnavailable, Message: "overloaded"},
+			&providers.ProviderError{Type: providers.ErrRateLimited, Message: "slow down", RetryAfter: 30 * time.Millisecond},
+		},
+	}
+	router.RegisterProvider(models.ProviderMock, provider)
+
+	start := time.Now()
+	resp, err := router.ExecuteRequest(context.Background(), req, decision)
+	if err != nil || resp.Metadata["deployment_id"] != "primary" {
+		t.Fatalf("expected the primary to succeed on its third attempt, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 30*time.Millisecond {
+		t.Errorf("Retry-After not honored, finished in %v", elapsed)
+	}
+	if m := decision.Primary.Metrics; m.Retries != 2 || m.SuccessRequests != 1 || m.FailedRequests != 0 {
+		t.Errorf("metrics = %+v", m)
+	}
+
+	// A Retry-After past the deadline falls back straight away instead of waiting
+	router, decision = newMockRouter(nil)
+	decision.Primary.Endpoint.MaxRetries = 2
+	provider = &scriptedProvider{
+		MockProvider: providers.NewMockProvider(),
+		errs:         []error{&providers.ProviderError{Type: providers.ErrRateLimited, Message: "slow down", RetryAfter: 2 * time.Second}},
+	}
+	router.RegisterProvider(models.ProviderMock, provider)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	start = time.Now()
+	resp, err = router.ExecuteRequest(ctx, req, decision)
+	if err != nil || resp.Metadata["deployment_id"] != "fallback" {
+		t.Fatalf("expected the fallback to answer, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("waited %v for a retry that could not fit the deadline", elapsed)
+	}
+	if decision.Primary.Metrics.Retries != 0 {
+		t.Errorf("retries = %d", decision.Primary.Metrics.Retries)
+	}
+
+	// A missing model falls back without retrying the same deployment
+	router, decision = newMockRouter(nil)
+	decision.Primary.Endpoint.MaxRetries = 2
+	provider = &scriptedProvider{
+		MockProvider: providers.NewMockProvider(),
+		errs:         []error{&providers.ProviderError{Type: providers.ErrNotFound, Message: "model not found"}},
+	}
+	router.RegisterProvider(models.ProviderMock, provider)
+
+	resp, err = router.ExecuteRequest(context.Background(), req, decision)
+	if err != nil || resp.Metadata["deployment_id"] != "fallback" {
+		t.Fatalf("expected the fallback to answer, got %v", err)
+	}
+	if decision.Primary.Metrics.Retries != 0 {
+		t.Errorf("retries = %d", decision.Primary.Metrics.Retries)
+	}
+}
+
+func (p *scriptedProvider) Stream(ctx context.Context, req *providers.ProviderRequest, stream chan<- providers.StreamChunk) error {
+	p.calls++
+	if p.calls > len(p.errs) {
+		return p.MockProvider.Stream(ctx, req, stream)
+	}
+	defer close(stream)
+	if p.partial != "" {
+		stream <- providers.StreamChunk{Data: p.partial}
+	}
+	err := p.errs[p.calls-1]
+	stream <- providers.StreamChunk{Error: err}
+	return err
+}
+
+func collect(router *Router, decision *RoutingDecision) (string, *models.Deployment, error) {
+	req := &providers.UnifiedRequest{Messages: []providers.Message{{Role: "user", Content: "hello world"}}, Stream: true}
+	var out string
+	served, err := router.ExecuteStream(context.Background(), req, decision, func(chunk providers.StreamChunk) {
+		out += chunk.Data
+	})
+	return out, served, err
+}
+
+func TestExecuteStreamFailover(t *testing.T) {
+	unavailable := &providers.ProviderError{Type: providers.ErrUpstreamUnavailable, Message: "connection refused"}
+
+	// Failure before the first byte fails over transparently
+	router, decision := newMockRouter(nil)
+	router.RegisterProvider(models.ProviderMock, &scriptedProvider{MockProvider: providers.NewMockProvider(), errs: []error{unavailable}})
+
+	out, served, err := collect(router, decision)
+	if err != nil || served.ID != "fallback" || out != "hello world" {
+		t.Fatalf("served by %v, out = %q, err = %v", served, out, err)
+	}
+	if decision.Primary.Status.ConsecutiveFails != 1 || decision.Fallbacks[0].Metrics.SuccessRequests != 1 {
+		t.Errorf("primary status = %+v, fallback metrics = %+v", decision.Primary.Status, decision.Fallbacks[0].Metrics)
+	}
+
+	// Once output has started the error ends the stream instead
+	router, decision = newMockRouter(nil)
+	router.RegisterProvider(models.ProviderMock, &scriptedProvider{MockProvider: providers.NewMockProvider(), errs: []error{unavailable}, partial: "hel"})
+
+	out, served, err = collect(router, decision)
+	if err == nil || served.ID != "primary" || out != "hel" {
+		t.Fatalf("served by %v, out = %q, err = %v", served, out, err)
+	}
+	if decision.Fallbacks[0].Metrics.TotalRequests != 0 {
+		t.Error("fallback should not be tried after output started")
+	}
+}
+
+func TestRouteRequestTier(t *testing.T) {
+	router, decision := newMockRouter(nil)
+	router.strategy = StrategyRoundRobin
+	router.RegisterModel(&models.Model{ID: "llama-8b", Deployments: []string{"primary", "fallback"}})
+	for _, d := range []*models.Deployment{decision.Primary, decision.Fallbacks[0]} {
+		d.Status.Available = true
+		d.Tags = map[string]string{"tier": "fast"}
+	}
+
+	// Routing takes only the read lock, so round-robin state must be safe
+	// to advance concurrently (run with -race)
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			router.RouteRequest(context.Background(), "tier:fast", &RequestContext{})
+			router.RouteRequest(context.Background(), "llama-8b", &RequestContext{ModelID: "llama-8b"})
+		}()
+	}
+	wg.Wait()
+
+	got, err := router.RouteRequest(context.Background(), "tier:fast", &RequestContext{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Fallbacks) != 1 || got.Fallbacks[0] == got.Primary {
+		t.Errorf("primary %s, fallbacks %v", got.Primary.ID, got.Fallbacks)
+	}
+}
+
+func TestRouteRequestCapabilities(t *testing.T) {
+	router, decision := newMockRouter(nil)
+	router.RegisterModel(&models.Model{ID: "llama-8b", Deployments: []string{"primary", "fallback"}})
+	decision.Primary.Status.Available = true
+
+	for _, reqCtx := range []*RequestContext{
+		{RequestID: "tools", RequiresFunctions: true},
+		{RequestID: "images", RequiresVision: true},
+	} {
+		_, err := router.RouteRequest(context.Background(), "llama-8b", reqCtx)
+		if _, ok := err.(*CapabilityError); !ok {
+			t.Errorf("%s: expected a capability error, got %v", reqCtx.RequestID, err)
+		}
+	}
+
+	router.models["llama-8b"].Capabilities.SupportsFunctions = true
+	router.models["llama-8b"].Capabilities.SupportsVision = true
+	reqCtx := &RequestContext{RequestID: "both", RequiresFunctions: true, RequiresVision: true}
+	got, err := router.RouteRequest(context.Background(), "llama-8b", reqCtx)
+	if err != nil || got.Primary != decision.Primary {
+		t.Errorf("decision = %+v, err = %v", got, err)
+	}
+}
+
+func TestExecuteRequestAdmitsEachDeployment(t *testing.T) {
+	req := &providers.UnifiedRequest{Messages: []providers.Message{{Role: "user", Content: "hello"}}}
+
+	router, decision := newMockRouter(map[string]interface{}{"error_rate": 1.0, "error_status": 503})
+	var admitted []string
+	held := 0
+	decision.Admit = func(deploymentID string) (func(), error) {
+		admitted = append(admitted, deploymentID)
+		held++
+		return func() { held-- }, nil
+	}
+
+	if _, err := router.ExecuteRequest(context.Background(), req, decision); err != nil {
+		t.Fatal(err)
+	}
+	if len(admitted) != 2 || admitted[0] != "primary" || admitted[1] != "fallback" || held != 0 {
+		t.Errorf("admitted %v, %d still held", admitted, held)
+	}
+
+	// A refused admission ends the request without trying the deployment
+	router, decision = newMockRouter(nil)
+	decision.Admit = func(string) (func(), error) { return nil, context.Canceled }
+	if _, err := router.ExecuteRequest(context.Background(), req, decision); !errors.Is(err, context.Canceled) {
+		t.Errorf("err = %v", err)
+	}
+	if n := router.deployments["primary"].Metrics.TotalRequests; n != 0 {
+		t.Errorf("primary tried %d times", n)
+	}
+}
+
+func TestRouteRequestErrors(t *testing.T) {
+	router, decision := newMockRouter(nil)
+	router.RegisterModel(&models.Model{ID: "llama-8b", Deployments: []string{"primary", "fallback"}})
+
+	if _, err := router.RouteRequest(context.Background(), "no-such-model", &RequestContext{}); !errors.Is(err, ErrModelNotFound) {
+		t.Errorf("unknown model: %v", err)
+	}
+
+	// Known model, but every deployment is down
+	decision.Primary.Status.Available = false
+	decision.Fallbacks[0].Status.Available = false
+	if _, err := router.RouteRequest(context.Background(), "llama-8b", &RequestContext{}); !errors.Is(err, ErrNoDeployments) {
+		t.Errorf("no deployments: %v", err)
+	}
+}
+
+func TestExecuteEmbedding(t *testing.T) {
+	router, decision := newMockRouter(map[string]interface{}{"error_rate": 1.0, "error_status": 503})
+
+	req := &providers.EmbeddingRequest{Input: []string{"one", "two"}}
+	resp, err := router.ExecuteEmbedding(context.Background(), req, decision)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Metadata["deployment_id"] != "fallback" || len(resp.Data) != 2 || resp.Data[1].Index != 1 {
+		t.Errorf("response = %+v", resp)
+	}
+	if router.deployments["primary"].Status.ConsecutiveFails != 1 {
+		t.Error("failed embedding should count against the primary")
+	}
+}
+
+func TestRouteRequestEmbeddingModels(t *testing.T) {
+	router, decision := newMockRouter(nil)
+	router.RegisterModel(&models.Model{
+		ID:           "llama-8b",
+		Capabilities: models.ModelCapabilities{SupportsEmbeddings: true},
+		Deployments:  []string{"primary", "fallback"},
+	})
+	decision.Primary.Status.Available = true
+
+	if _, err := router.RouteRequest(context.Background(), "llama-8b", &RequestContext{}); err == nil {
+		t.Error("chat request routed to an embedding model")
+	}
+	if _, err := router.RouteRequest(context.Background(), "llama-8b", &RequestContext{RequiresEmbeddings: true}); err != nil {
+		t.Errorf("embeddings request: %v", err)
+	}
+
+	router.models["llama-8b"].Capabilities.SupportsEmbeddings = false
+	_, err := router.RouteRequest(context.Background(), "llama-8b", &RequestContext{RequiresEmbeddings: true})
+	if ce, ok := err.(*CapabilityError); !ok || ce.Capability != "embeddings" {
+		t.Errorf("expected a capability error, got %v", err)
+	}
+}
+
+func TestRouteRequestContextWindow(t *testing.T) {
+	router, decision := newMockRouter(map[string]interface{}{"context_window": 4000})
+	router.RegisterModel(&models.Model{
+		ID:           "llama-8b",
+		Capabilities: models.ModelCapabilities{ContextWindow: 8000},
+		Deployments:  []string{"primary", "fallback"},
+	})
+	decision.Primary.Status.Available = true
+	decision.Fallbacks[0].Status.Available = true
+
+	// The primary's own window is too small, so the fallback is chosen
+	got, err := router.RouteRequest(context.Background(), "llama-8b", &RequestContext{ContextTokens: 6000})
+	if err != nil || got.Primary.ID != "fallback" {
+		t.Errorf("decision = %+v, err = %v", got, err)
+	}
+	if largest := router.LargestContextWindow("llama-8b", &RequestContext{}); largest != 8000 {
+		t.Errorf("largest window = %d", largest)
+	}
+
+	_, err = router.RouteRequest(context.Background(), "llama-8b", &RequestContext{ContextTokens: 9000})
+	var we *ContextWindowError
+	if !errors.As(err, &we) || we.Largest != 8000 || we.Tokens != 9000 {
+		t.Errorf("expected a context window error, got %v", err)
+	}
+}
+
+func TestRouteRequestDeploymentCapabilities(t *testing.T) {
+	// The primary serves the model through a provider without vision, and
+	// with a lower output limit
+	router, decision := newMockRouter(map[string]interface{}{"supports_vision": false, "max_tokens": 1024})
+	router.RegisterModel(&models.Model{
+		ID:           "llama-8b",
+		Capabilities: models.ModelCapabilities{SupportsVision: true, SupportsStreaming: true, MaxTokens: 4096},
+		Deployments:  []string{"primary", "fallback"},
+	})
+	decision.Primary.Status.Available = true
+	decision.Fallbacks[0].Status.Available = true
+	decision.Primary.Tags = map[string]string{"tier": "fast"}
+
+	for _, reqCtx := range []*RequestContext{
+		{RequestID: "images", RequiresVision: true},
+		{RequestID: "long", MaxTokens: 2000},
+	} {
+		got, err := router.RouteRequest(context.Background(), "llama-8b", reqCtx)
+		if err != nil || got.Primary.ID != "fallback" || len(got.Fallbacks) != 0 {
+			t.Errorf("%s: decision = %+v, err = %v", reqCtx.RequestID, got, err)
+		}
+	}
+
+	cases := []struct {
+		model   string
+		reqCtx  *RequestContext
+		missing string
+	}{
+		{"llama-8b", &RequestContext{MaxTokens: 8000}, "8000 output tokens (at most 1024)"},
+		{"tier:fast", &RequestContext{RequiresVision: true}, "image inputs"},
+	}
+	for _, tc := range cases {
+		_, err := router.RouteRequest(context.Background(), tc.model, tc.reqCtx)
+		if ce, ok := err.(*CapabilityError); !ok || ce.Capability != tc.missing {
+			t.Errorf("%s: expected %q to be missing, got %v", tc.model, tc.missing, err)
+		}
+	}
+
+	router.models["llama-8b"].Capabilities.SupportsStreaming = false
+	_, err := router.RouteRequest(context.Background(), "llama-8b", &RequestContext{RequiresStreaming: true})
+	if ce, ok := err.(*CapabilityError); !ok || ce.Capability != "streaming" {
+		t.Errorf("expected streaming to be missing, got %v", err)
+	}
+}
+
+func TestRouteRequestPrefersNativeJSON(t *testing.T) {
+	router, decision := newMockRouter(map[string]interface{}{"supports_json": true})
+	router.RegisterModel(&models.Model{ID: "llama-8b", Deployments: []string{"primary", "fallback"}})
+	decision.Primary.Priority = 2
+	decision.Primary.Status.Available = true
+	decision.Fallbacks[0].Status.Available = true
+
+	got, err := router.RouteRequest(context.Background(), "llama-8b", &RequestContext{RequiresJSON: true})
+	if err != nil || got.Primary.ID != "primary" {
+		t.Errorf("decision = %+v, err = %v", got, err)
+	}
+
+	// Without a native JSON deployment, the gateway validates instead
+	decision.Primary.Status.Available = false
+	if _, err := router.RouteRequest(context.Background(), "llama-8b", &RequestContext{RequiresJSON: true}); err != nil {
+		t.Errorf("JSON request: %v", err)
+	}
+}
@@ -0,0 +1,327 @@
+// Package tenants stores API keys and the tenants they belong to, along
+// with each tenant's quotas and usage. Keys are only ever stored as
+// SHA-256 hashes; the plaintext is shown once, when the key is created.
+package tenants
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+	"golang.org/x/time/rate"
+)
+
+// KeyPrefix starts every API key so leaked keys are easy to recognize
+const KeyPrefix = "chat_"
+
+// ErrNotFound is returned for unknown tenants and keys
+var ErrNotFound = errors.New("not found")
+
+// Tenant is a customer or team sharing quotas across its API keys.
+// Zero limits mean unlimited.
+type Tenant struct {
+	ID            string
+	Name          string
+	AllowedModels []string // Model IDs or glob patterns; empty allows every model
+	RPM           int      // Requests per minute
+	TokensPerDay  int64    // Input plus output tokens per UTC day
+	SpendCap      float64  // USD per calendar month (UTC)
+	CreatedAt     time.Time
+}
+
+// AllowsModel reports whether the tenant may use the model
+func (t *Tenant) AllowsModel(model string) bool {
+	if len(t.AllowedModels) == 0 {
+		return true
+	}
+	for _, pattern := range t.AllowedModels {
+		if ok, _ := path.Match(pattern, model); ok || pattern == model {
+			return true
+		}
+	}
+	return false
+}
+
+// KeyInfo describes a stored key without revealing it
+type KeyInfo struct {
+	ID        int64
+	TenantID  string
+	Prefix    string // First characters of the key, for identification
+	CreatedAt time.Time
+	RevokedAt *time.Time
+	LastUsed  *time.Time
+}
+
+// Usage is a tenant's consumption in the current quota windows
+type Usage struct {
+	TokensToday    int64
+	SpendThisMonth float64
+}
+
+// Store is a SQLite-backed tenant and key store
+type Store struct {
+	db *sql.DB
+
+	mu       sync.Mutex
+	limiters map[string]*rate.Limiter // Per-tenant RPM limiters, in memory only
+}
+
+const schema = `
+CREATE TABLE IF NOT EXISTS tenants (
+	id TEXT PRIMARY KEY,
+	name TEXT NOT NULL DEFAULT '',
+	allowed_models TEXT NOT NULL DEFAULT '',
+	rpm INTEGER NOT NULL DEFAULT 0,
+	tokens_per_day INTEGER NOT NULL DEFAULT 0,
+	spend_cap REAL NOT NULL DEFAULT 0,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS api_keys (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	tenant_id TEXT NOT NULL REFERENCES tenants(id),
+	key_hash TEXT NOT NULL UNIQUE,
+	prefix TEXT NOT NULL,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	revoked_at DATETIME,
+	last_used DATETIME
+);
+
+CREATE TABLE IF NOT EXISTS tenant_usage (
+	tenant_id TEXT NOT NULL,
+	day TEXT NOT NULL,
+	requests INTEGER NOT NULL DEFAULT 0,
+	tokens INTEGER NOT NULL DEFAULT 0,
+	spend REAL NOT NULL DEFAULT 0,
+	PRIMARY KEY (tenant_id, day)
+);
+
+CREATE INDEX IF NOT EXISTS idx_api_keys_tenant ON api_keys(tenant_id);
+`
+
+// Open opens or creates the store at path
+func Open(path string) (*Store, error) {
+	db, err := sql.Open("sqlite3", path+"?_busy_timeout=5000")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open tenant database: %w", err)
+	}
+	if _, err := db.Exec(schema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create tenant schema: %w", err)
+	}
+	return &Store{db: db, limiters: make(map[string]*rate.Limiter)}, nil
+}
+
+// Close closes the database
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// SaveTenant creates a tenant or updates an existing one's settings
+func (s *Store) SaveTenant(t *Tenant) error {
+	if t.ID == "" {
+		return fmt.Errorf("tenant ID is required")
+	}
+	_, err := s.db.Exec(`
+		INSERT INTO tenants (id, name, allowed_models, rpm, tokens_per_day, spend_cap)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT(id) DO UPDATE SET
+			name = excluded.name,
+			allowed_models = excluded.allowed_models,
+			rpm = excluded.rpm,
+			tokens_per_day = excluded.tokens_per_day,
+			spend_cap = excluded.spend_cap`,
+		t.ID, t.Name, strings.Join(t.AllowedModels, ","), t.RPM, t.TokensPerDay, t.SpendCap)
+	if err != nil {
+		return err
+	}
+
+	// Pick up a changed RPM on the next request
+	s.mu.Lock()
+	delete(s.limiters, t.ID)
+	s.mu.Unlock()
+	return nil
+}
+
+const tenantColumns = `id, name, allowed_models, rpm, tokens_per_day, spend_cap, created_at`
+
+func scanTenant(row interface{ Scan(...interface{}) error }) (*Tenant, error) {
+	var t Tenant
+	var models string
+	if err := row.Scan(&t.ID, &t.Name, &models, &t.RPM, &t.TokensPerDay, &t.SpendCap, &t.CreatedAt); err != nil {
+		return nil, err
+	}
+	if models != "" {
+		t.AllowedModels = strings.Split(models, ",")
+	}
+	return &t, nil
+}
+
+// Tenant returns a tenant by ID
+func (s *Store) Tenant(id string) (*Tenant, error) {
+	t, err := scanTenant(s.db.QueryRow(`SELECT `+tenantColumns+` FROM tenants WHERE id = ?`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return t, err
+}
+
+// Tenants lists every tenant
+func (s *Store) Tenants() ([]*Tenant, error) {
+	rows, err := s.db.Query(`SELECT ` + tenantColumns + ` FROM tenants ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tenants []*Tenant
+	for rows.Next() {
+		t, err := scanTenant(rows)
+		if err != nil {
+			return nil, err
+		}
+		tenants = append(tenants, t)
+	}
+	return tenants, rows.Err()
+}
+
+// CreateKey issues a new key for a tenant and returns it in plaintext.
+// This is the only time the plaintext is available.
+func (s *Store) CreateKey(tenantID string) (string, error) {
+	if _, err := s.Tenant(tenantID); err != nil {
+		return "", fmt.Errorf("tenant %s: %w", tenantID, err)
+	}
+
+	secret := make([]byte, 24)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	key := KeyPrefix + hex.EncodeToString(secret)
+
+	_, err := s.db.Exec(`INSERT INTO api_keys (tenant_id, key_hash, prefix) VALUES (?, ?, ?)`,
+		tenantID, hashKey(key), key[:len(KeyPrefix)+8])
+	if err != nil {
+		return "", err
+	}
+	return key, nil
+}
+
+// Keys lists the keys of a tenant, or of every tenant when tenantID is empty
+func (s *Store) Keys(tenantID string) ([]KeyInfo, error) {
+	query := `SELECT id, tenant_id, prefix, created_at, revoked_at, last_used FROM api_keys`
+	var args []interface{}
+	if tenantID != "" {
+		query += ` WHERE tenant_id = ?`
+		args = append(args, tenantID)
+	}
+	rows, err := s.db.Query(query+` ORDER BY id`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []KeyInfo
+	for rows.Next() {
+		var k KeyInfo
+		var revoked, used sql.NullTime
+		if err := rows.Scan(&k.ID, &k.TenantID, &k.Prefix, &k.CreatedAt, &revoked, &used); err != nil {
+			return nil, err
+		}
+		if revoked.Valid {
+			k.RevokedAt = &revoked.Time
+		}
+		if used.Valid {
+			k.LastUsed = &used.Time
+		}
+		keys = append(keys, k)
+	}
+	return keys, rows.Err()
+}
+
+// RevokeKey revokes a key by its ID
+func (s *Store) RevokeKey(id int64) error {
+	res, err := s.db.Exec(`UPDATE api_keys SET revoked_at = CURRENT_TIMESTAMP WHERE id = ? AND revoked_at IS NULL`, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Authenticate returns the tenant owning a key. Unknown and revoked keys
+// return ErrNotFound.
+func (s *Store) Authenticate(key string) (*Tenant, error) {
+	hash := hashKey(key)
+	t, err := scanTenant(s.db.QueryRow(`
+		SELECT t.id, t.name, t.allowed_models, t.rpm, t.tokens_per_day, t.spend_cap, t.created_at
+		FROM api_keys k JOIN tenants t ON t.id = k.tenant_id
+		WHERE k.key_hash = ? AND k.revoked_at IS NULL`, hash))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	s.db.Exec(`UPDATE api_keys SET last_used = CURRENT_TIMESTAMP WHERE key_hash = ?`, hash)
+	return t, nil
+}
+
+// AllowRequest applies the tenant's requests-per-minute limit
+func (s *Store) AllowRequest(t *Tenant) bool {
+	if t.RPM <= 0 {
+		return true
+	}
+	s.mu.Lock()
+	// The burst is the RPM the limiter was built for. Rebuild it when the
+	// tenant's RPM was changed by another process (ch.at keys), since t is
+	// loaded fresh on every request.
+	limiter, ok := s.limiters[t.ID]
+	if !ok || limiter.Burst() != t.RPM {
+		limiter = rate.NewLimiter(rate.Limit(float64(t.RPM)/60), t.RPM)
+		s.limiters[t.ID] = limiter
+	}
+	s.mu.Unlock()
+	return limiter.Allow()
+}
+
+// Usage returns the tenant's tokens used today and spend this month
+func (s *Store) Usage(tenantID string, now time.Time) (Usage, error) {
+	var u Usage
+	now = now.UTC()
+	err := s.db.QueryRow(`
+		SELECT
+			COALESCE(SUM(CASE WHEN day = ? THEN tokens END), 0),
+			COALESCE(SUM(spend), 0)
+		FROM tenant_usage WHERE tenant_id = ? AND day >= ?`,
+		now.Format("2006-01-02"), tenantID, now.Format("2006-01")+"-01").Scan(&u.TokensToday, &u.SpendThisMonth)
+	return u, err
+}
+
+// RecordUsage adds a completed request's tokens and cost to today's totals
+func (s *Store) RecordUsage(tenantID string, tokens int, cost float64, now time.Time) error {
+	_, err := s.db.Exec(`
+		INSERT INTO tenant_usage (tenant_id, day, requests, tokens, spend) VALUES (?, ?, 1, ?, ?)
+		ON CONFLICT(tenant_id, day) DO UPDATE SET
+			requests = requests + 1,
+			tokens = tokens + excluded.tokens,
+			spend = spend + excluded.spend`,
+		tenantID, now.UTC().Format("2006-01-02"), tokens, cost)
+	return err
+}
+
+// hashKey hashes a key for storage. Keys carry 192 bits of randomness, so
+// a fast unsalted hash is enough and keeps lookups a single index probe.
+func hashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
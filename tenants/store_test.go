@@ -0,0 +1,92 @@
+package tenants
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func openTestStore(t *testing.T) *Store {
+	store, err := Open(filepath.Join(t.TempDir(), "tenants.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+func TestKeyLifecycle(t *testing.T) {
+	store := openTestStore(t)
+	if err := store.SaveTenant(&Tenant{ID: "acme", AllowedModels: []string{"llama-*", "gpt-4o"}, RPM: 2}); err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := store.CreateKey("acme")
+	if err != nil || !strings.HasPrefix(key, KeyPrefix) {
+		t.Fatalf("key = %q, err = %v", key, err)
+	}
+	if _, err := store.CreateKey("nobody"); err == nil {
+		t.Error("created a key for an unknown tenant")
+	}
+
+	tenant, err := store.Authenticate(key)
+	if err != nil || tenant.ID != "acme" {
+		t.Fatalf("tenant = %+v, err = %v", tenant, err)
+	}
+	if !tenant.AllowsModel("llama-8b") || !tenant.AllowsModel("gpt-4o") || tenant.AllowsModel("claude-4-opus") {
+		t.Errorf("allowlist %v applied wrongly", tenant.AllowedModels)
+	}
+	if _, err := store.Authenticate(key + "x"); err != ErrNotFound {
+		t.Errorf("wrong key: %v", err)
+	}
+
+	// Only the hash is stored
+	var stored string
+	store.db.QueryRow(`SELECT key_hash FROM api_keys`).Scan(&stored)
+	if stored == key || strings.Contains(stored, key[len(KeyPrefix):]) {
+		t.Error("key stored in plaintext")
+	}
+
+	keys, _ := store.Keys("acme")
+	if len(keys) != 1 || keys[0].LastUsed == nil {
+		t.Fatalf("keys = %+v", keys)
+	}
+	if err := store.RevokeKey(keys[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Authenticate(key); err != ErrNotFound {
+		t.Errorf("revoked key still works: %v", err)
+	}
+}
+
+func TestQuotas(t *testing.T) {
+	store := openTestStore(t)
+	tenant := &Tenant{ID: "acme", RPM: 2}
+	store.SaveTenant(tenant)
+
+	if !store.AllowRequest(tenant) || !store.AllowRequest(tenant) || store.AllowRequest(tenant) {
+		t.Error("RPM limit not applied")
+	}
+
+	// An RPM changed elsewhere (the ch.at keys CLI) arrives on a freshly
+	// loaded tenant, without SaveTenant running in this process
+	raised := &Tenant{ID: "acme", RPM: 3}
+	if !store.AllowRequest(raised) || !store.AllowRequest(raised) || !store.AllowRequest(raised) || store.AllowRequest(raised) {
+		t.Error("changed RPM limit not applied")
+	}
+
+	now := time.Date(2025, 3, 15, 12, 0, 0, 0, time.UTC)
+	store.RecordUsage("acme", 100, 0.25, now)
+	store.RecordUsage("acme", 50, 0.25, now)
+	store.RecordUsage("acme", 1000, 1.0, now.AddDate(0, 0, -1)) // Earlier this month
+	store.RecordUsage("acme", 1000, 5.0, now.AddDate(0, -1, 0)) // Last month
+
+	usage, err := store.Usage("acme", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if usage.TokensToday != 150 || usage.SpendThisMonth != 1.5 {
+		t.Errorf("usage = %+v", usage)
+	}
+}
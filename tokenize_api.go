@@ -0,0 +1,162 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"ch.at/providers"
+	"ch.at/tokenizer"
+)
+
+// Per-message framing tokens, as OpenAI counts chat prompts: each message
+// is wrapped in start, role and end tokens, and the reply is primed with
+// an assistant header
+const (
+	tokensPerMessage = 3
+	tokensPerReply   = 3
+)
+
+// modelTokenizer returns the tokenizer named by a model's tokenizer_type.
+// Tiers and unknown models are estimated.
+func modelTokenizer(model string) tokenizer.Tokenizer {
+	if modelRegistry != nil {
+		if m, ok := modelRegistry.Get(model); ok {
+			return tokenizer.Get(m.Capabilities.TokenizerType)
+		}
+	}
+	return tokenizer.Estimator()
+}
+
+// preloadTokenizers loads the configured models' tokenizers in the
+// background, so the first requests don't wait on a vocabulary
+func preloadTokenizers() {
+	if modelRegistry == nil {
+		return
+	}
+	seen := make(map[string]bool)
+	for _, m := range modelRegistry.List() {
+		if t := m.Capabilities.TokenizerType; t != "" && !seen[t] {
+			seen[t] = true
+			tokenizer.Preload(t)
+		}
+	}
+}
+
+// countTokens counts text with the model's tokenizer
+func countTokens(text string, model string) int {
+	return modelTokenizer(model).Count(text)
+}
+
+// countMessageTokens counts a chat prompt with the model's tokenizer.
+// Image parts aren't counted, as their cost depends on the provider.
+func countMessageTokens(messages []providers.Message, model string) int {
+	tok := modelTokenizer(model)
+	tokens := tokensPerReply
+	for _, m := range messages {
+		tokens += tokensPerMessage + tok.Count(m.Role) + tok.Count(m.Content)
+		if m.Name != "" {
+			tokens += tok.Count(m.Name) + 1
+		}
+		for _, call := range m.ToolCalls {
+			tokens += tok.Count(call.Function.Name) + tok.Count(call.Function.Arguments)
+		}
+	}
+	return tokens
+}
+
+// checkContextWindow rejects a prompt that leaves no room for max_tokens
+// in a context window of window tokens; 0 means unknown
+func checkContextWindow(window, promptTokens, maxTokens int) error {
+	if window <= 0 || promptTokens+maxTokens <= window {
+		return nil
+	}
+	return &providers.ProviderError{
+		Type: providers.ErrContextLengthExceeded,
+		Message: fmt.Sprintf("This model's maximum context length is %d tokens. However, you requested %d tokens (%d in the messages, %d in the completion). Please reduce the length of the messages or completion.",
+			window, promptTokens+maxTokens, promptTokens, maxTokens),
+	}
+}
+
+// TokenizeRequest asks for the tokens of input, or the prompt size of messages
+type TokenizeRequest struct {
+	Model    string              `json:"model"`
+	Input    *string             `json:"input,omitempty"`
+	Messages []providers.Message `json:"messages,omitempty"`
+}
+
+// TokenizeResponse reports a token count. Tokens holds the token IDs of
+// input when the tokenizer is exact.
+type TokenizeResponse struct {
+	Object        string `json:"object"`
+	Model         string `json:"model"`
+	Tokenizer     string `json:"tokenizer"`
+	Exact         bool   `json:"exact"`
+	Count         int    `json:"count"`
+	Tokens        []int  `json:"tokens,omitempty"`
+	ContextWindow int    `json:"context_window,omitempty"`
+}
+
+// handleTokenize handles POST /v1/tokenize
+func handleTokenize(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if tenantFrom(r) == nil && !rateLimitAllow(r.RemoteAddr) {
+		writeAPIError(w, rateLimited("Rate limit exceeded", time.Second))
+		return
+	}
+	if r.Method != "POST" {
+		methodNotAllowed(w, "POST, OPTIONS")
+		return
+	}
+
+	var req TokenizeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeAPIError(w, invalidRequest("invalid_json", "", "Invalid JSON: "+err.Error()))
+		return
+	}
+	if req.Model == "" {
+		writeAPIError(w, invalidRequest("missing_required_parameter", "model", "model is required"))
+		return
+	}
+	if (req.Input == nil) == (len(req.Messages) == 0) {
+		writeAPIError(w, invalidRequest("invalid_value", "input", "Send exactly one of input or messages"))
+		return
+	}
+	if modelRegistry == nil {
+		writeAPIError(w, newAPIError(http.StatusServiceUnavailable, errTypeServer, "", "", "Model registry not initialized"))
+		return
+	}
+	m, ok := modelRegistry.Get(req.Model)
+	if !ok {
+		writeAPIError(w, newAPIError(http.StatusNotFound, errTypeInvalidRequest, "model_not_found", "model",
+			fmt.Sprintf("The model '%s' does not exist", req.Model)))
+		return
+	}
+
+	tok := modelTokenizer(req.Model)
+	resp := TokenizeResponse{
+		Object:        "tokenize",
+		Model:         req.Model,
+		Tokenizer:     tok.Name(),
+		Exact:         tok.Exact(),
+		ContextWindow: m.Capabilities.ContextWindow,
+	}
+	switch {
+	case req.Input != nil && tok.Exact():
+		resp.Tokens = tok.Encode(*req.Input)
+		resp.Count = len(resp.Tokens)
+	case req.Input != nil:
+		resp.Count = tok.Count(*req.Input)
+	default:
+		resp.Count = countMessageTokens(req.Messages, req.Model)
+	}
+	writeJSON(w, resp)
+}
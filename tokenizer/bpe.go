@@ -0,0 +1,143 @@
+package tokenizer
+
+import (
+	"embed"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/pkoukk/tiktoken-go"
+)
+
+// Vocabularies are BPE rank files in tiktoken format, one base64 token and
+// its rank per line. cl100k and o200k are embedded from tokenizer/vocab at
+// build time; others are read from TOKENIZER_VOCAB_DIR. The Llama 3
+// vocabulary is licensed by Meta and not checked in, so it is only available
+// when llama3.tiktoken (Meta's tokenizer.model) is placed there.
+//
+//go:embed vocab
+var embeddedVocab embed.FS
+
+func init() {
+	tiktoken.SetBpeLoader(vocabLoader{})
+}
+
+// vocabLoader feeds tiktoken's encodings from the vocabularies above
+type vocabLoader struct{}
+
+func (vocabLoader) LoadTiktokenBpe(url string) (map[string]int, error) {
+	data, err := readVocab(path.Base(url))
+	if err != nil {
+		return nil, err
+	}
+	return parseRanks(data)
+}
+
+// readVocab returns the named vocabulary file
+func readVocab(name string) ([]byte, error) {
+	if data, err := embeddedVocab.ReadFile("vocab/" + name); err == nil {
+		return data, nil
+	}
+
+	if dir := os.Getenv("TOKENIZER_VOCAB_DIR"); dir != "" {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err == nil {
+			return data, nil
+		}
+		if !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+	return nil, fmt.Errorf("vocabulary %s not found", name)
+}
+
+// parseRanks parses a tiktoken-format vocabulary
+func parseRanks(data []byte) (map[string]int, error) {
+	ranks := make(map[string]int)
+	for n, line := range strings.Split(string(data), "\n") {
+		if line == "" {
+			continue
+		}
+		token, rank, ok := strings.Cut(line, " ")
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected token and rank", n+1)
+		}
+		b, err := base64.StdEncoding.DecodeString(token)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n+1, err)
+		}
+		r, err := strconv.Atoi(strings.TrimSpace(rank))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n+1, err)
+		}
+		ranks[string(b)] = r
+	}
+	return ranks, nil
+}
+
+// bpe is an exact tokenizer backed by a tiktoken encoding
+type bpe struct {
+	name     string
+	encoding *tiktoken.Tiktoken
+}
+
+func (b *bpe) Name() string { return b.name }
+
+func (b *bpe) Exact() bool { return true }
+
+// Encode treats special tokens in text as plain text, so user input can't
+// inject them
+func (b *bpe) Encode(text string) []int { return b.encoding.EncodeOrdinary(text) }
+
+func (b *bpe) Count(text string) int { return len(b.Encode(text)) }
+
+// loadTiktoken loads one of tiktoken's built-in encodings
+func loadTiktoken(name, encoding string) (Tokenizer, error) {
+	enc, err := tiktoken.GetEncoding(encoding)
+	if err != nil {
+		return nil, err
+	}
+	return &bpe{name: name, encoding: enc}, nil
+}
+
+// Llama 3 uses cl100k's split pattern with its own 128k vocabulary
+const llama3Pattern = `(?i:'s|'t|'re|'ve|'m|'ll|'d)|[^\r\n\p{L}\p{N}]?\p{L}+|\p{N}{1,3}| ?[^\s\p{L}\p{N}]+[\r\n]*|\s*[\r\n]+|\s+(?!\S)|\s+`
+
+var llama3Special = map[string]int{
+	"<|begin_of_text|>":   128000,
+	"<|end_of_text|>":     128001,
+	"<|start_header_id|>": 128006,
+	"<|end_header_id|>":   128007,
+	"<|eot_id|>":          128009,
+}
+
+// loadLlama loads the Llama 3 vocabulary, shared by the Llama 3.x models
+func loadLlama() (Tokenizer, error) {
+	data, err := readVocab("llama3.tiktoken")
+	if err != nil {
+		return nil, err
+	}
+	ranks, err := parseRanks(data)
+	if err != nil {
+		return nil, fmt.Errorf("llama3.tiktoken: %w", err)
+	}
+	return newBPE("llama", ranks, llama3Special, llama3Pattern)
+}
+
+// newBPE builds a tokenizer from a vocabulary and split pattern
+func newBPE(name string, ranks, special map[string]int, pattern string) (Tokenizer, error) {
+	core, err := tiktoken.NewCoreBPE(ranks, special, pattern)
+	if err != nil {
+		return nil, err
+	}
+	specialSet := make(map[string]any, len(special))
+	for token := range special {
+		specialSet[token] = true
+	}
+	encoding := &tiktoken.Encoding{Name: name, PatStr: pattern, MergeableRanks: ranks, SpecialTokens: special}
+	return &bpe{name: name, encoding: tiktoken.NewTiktoken(core, encoding, specialSet)}, nil
+}
@@ -0,0 +1,60 @@
+package tokenizer
+
+import (
+	"unicode"
+)
+
+// estimator approximates BPE token counts for models without an exact
+// tokenizer (Claude, Gemini, Mistral) and when a vocabulary is missing:
+//
+//   - a run of letters or digits costs one token per 4 characters,
+//     rounded up, as common English words are a single token
+//   - Chinese, Japanese and Korean characters cost one token each
+//   - any other non-space character, such as punctuation, costs one token
+//   - whitespace is free, being merged into the following word
+//
+// It is usually within 10-20% of the real count for English text and
+// prose in other Latin scripts, and errs high for code.
+var estimator Tokenizer = estimate{}
+
+// Estimator returns the fallback estimator
+func Estimator() Tokenizer {
+	return estimator
+}
+
+type estimate struct{}
+
+func (estimate) Name() string { return "estimate" }
+
+func (estimate) Exact() bool { return false }
+
+func (estimate) Encode(text string) []int { return nil }
+
+func (estimate) Count(text string) int {
+	tokens, word := 0, 0
+	flush := func() {
+		tokens += (word + 3) / 4
+		word = 0
+	}
+
+	for _, r := range text {
+		switch {
+		case isCJK(r):
+			flush()
+			tokens++
+		case unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.IsMark(r):
+			word++
+		case unicode.IsSpace(r):
+			flush()
+		default:
+			flush()
+			tokens++
+		}
+	}
+	flush()
+	return tokens
+}
+
+func isCJK(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul)
+}
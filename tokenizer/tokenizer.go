@@ -0,0 +1,107 @@
+// Package tokenizer counts tokens the way each model family does. Models
+// name their tokenizer with tokenizer_type in models.yaml; the registry maps
+// that name to a BPE tokenizer, or to an estimator when the type has no
+// exact tokenizer or its vocabulary can't be loaded.
+package tokenizer
+
+import (
+	"log"
+	"sync"
+)
+
+// Tokenizer turns text into tokens
+type Tokenizer interface {
+	// Name is the tokenizer type, or "estimate" for the fallback estimator
+	Name() string
+
+	// Exact reports whether counts are the model's real token counts
+	Exact() bool
+
+	// Encode returns the token IDs of text, or nil when not Exact
+	Encode(text string) []int
+
+	// Count returns the number of tokens in text
+	Count(text string) int
+}
+
+// Loader builds a tokenizer. It is called once, on first use.
+type Loader func() (Tokenizer, error)
+
+// Registry maps tokenizer types to tokenizers, loading each on first use
+type Registry struct {
+	mu      sync.Mutex
+	loaders map[string]Loader
+	loaded  map[string]*entry
+}
+
+type entry struct {
+	once      sync.Once
+	tokenizer Tokenizer
+}
+
+// NewRegistry creates an empty registry; every type resolves to the estimator
+func NewRegistry() *Registry {
+	return &Registry{
+		loaders: make(map[string]Loader),
+		loaded:  make(map[string]*entry),
+	}
+}
+
+// Register sets the loader for a tokenizer type
+func (r *Registry) Register(tokenizerType string, load Loader) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.loaders[tokenizerType] = load
+	delete(r.loaded, tokenizerType)
+}
+
+// Get returns the tokenizer for a type. Unknown types, and types whose
+// loader fails, get the estimator; a failed load is logged once and not
+// retried.
+func (r *Registry) Get(tokenizerType string) Tokenizer {
+	r.mu.Lock()
+	load, ok := r.loaders[tokenizerType]
+	if !ok {
+		r.mu.Unlock()
+		return estimator
+	}
+	e, ok := r.loaded[tokenizerType]
+	if !ok {
+		e = &entry{}
+		r.loaded[tokenizerType] = e
+	}
+	r.mu.Unlock()
+
+	e.once.Do(func() {
+		tokenizer, err := load()
+		if err != nil {
+			log.Printf("[Tokenizer] %s unavailable, estimating instead: %v", tokenizerType, err)
+			tokenizer = estimator
+		}
+		e.tokenizer = tokenizer
+	})
+	return e.tokenizer
+}
+
+// Default holds the built-in tokenizers: cl100k and o200k (OpenAI) and
+// llama (Llama 3)
+var Default = NewRegistry()
+
+func init() {
+	Default.Register("cl100k", func() (Tokenizer, error) { return loadTiktoken("cl100k", "cl100k_base") })
+	Default.Register("o200k", func() (Tokenizer, error) { return loadTiktoken("o200k", "o200k_base") })
+	Default.Register("llama", loadLlama)
+}
+
+// Get returns the tokenizer for a type from the Default registry
+func Get(tokenizerType string) Tokenizer {
+	return Default.Get(tokenizerType)
+}
+
+// Preload loads the given types in the background, so the first request
+// doesn't wait for a vocabulary to load
+func Preload(tokenizerTypes ...string) {
+	for _, t := range tokenizerTypes {
+		go Default.Get(t)
+	}
+}
@@ -0,0 +1,119 @@
+package tokenizer
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestEstimate(t *testing.T) {
+	cases := []struct {
+		text string
+		want int
+	}{
+		{"", 0},
+		{"hello world", 4},          // 5 letters each: 2 tokens
+		{"Hi, you!", 4},             // Hi , you !
+		{"internationalization", 5}, // 20 letters
+		{"日本語", 3},
+	}
+	for _, tc := range cases {
+		if got := Estimator().Count(tc.text); got != tc.want {
+			t.Errorf("Count(%q) = %d, want %d", tc.text, got, tc.want)
+		}
+	}
+}
+
+func TestRegistryFallsBack(t *testing.T) {
+	r := NewRegistry()
+	calls := 0
+	r.Register("broken", func() (Tokenizer, error) {
+		calls++
+		return nil, errors.New("no vocabulary")
+	})
+
+	for i := 0; i < 2; i++ {
+		if got := r.Get("broken"); got.Name() != "estimate" {
+			t.Errorf("broken tokenizer: got %s", got.Name())
+		}
+	}
+	if calls != 1 {
+		t.Errorf("failed load retried: %d calls", calls)
+	}
+	if got := r.Get("claude"); got.Exact() {
+		t.Error("unknown type should be estimated")
+	}
+}
+
+// writeVocab writes a vocabulary of every byte plus the given merges
+func writeVocab(t *testing.T, name string, merges ...string) string {
+	dir := t.TempDir()
+	var b strings.Builder
+	for i := 0; i < 256; i++ {
+		fmt.Fprintf(&b, "%s %d\n", base64.StdEncoding.EncodeToString([]byte{byte(i)}), i)
+	}
+	for i, m := range merges {
+		fmt.Fprintf(&b, "%s %d\n", base64.StdEncoding.EncodeToString([]byte(m)), 256+i)
+	}
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(b.String()), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestLlamaFromVocabDir(t *testing.T) {
+	t.Setenv("TOKENIZER_VOCAB_DIR", writeVocab(t, "llama3.tiktoken", "he", "ll", "hell", "hello", " w", " wo"))
+
+	tok, err := loadLlama()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !tok.Exact() || tok.Name() != "llama" {
+		t.Fatalf("got %s, exact %v", tok.Name(), tok.Exact())
+	}
+
+	// "hello" merges fully; " world" splits into " wo", "r", "l", "d"
+	if got := tok.Encode("hello world"); fmt.Sprint(got) != fmt.Sprint([]int{259, 261, 'r', 'l', 'd'}) {
+		t.Errorf("Encode = %v", got)
+	}
+	// Special tokens in input are plain text
+	if got := tok.Count("<|eot_id|>"); got <= 1 {
+		t.Errorf("special token was not escaped: %d tokens", got)
+	}
+}
+
+func TestEmbeddedVocabularies(t *testing.T) {
+	t.Setenv("TOKENIZER_VOCAB_DIR", t.TempDir())
+
+	// Known token ids for "Hello world" in each vocabulary
+	cases := []struct {
+		name string
+		load Loader
+		want []int
+	}{
+		{"cl100k", func() (Tokenizer, error) { return loadTiktoken("cl100k", "cl100k_base") }, []int{9906, 1917}},
+		{"o200k", func() (Tokenizer, error) { return loadTiktoken("o200k", "o200k_base") }, []int{13225, 2375}},
+	}
+	for _, tc := range cases {
+		tok, err := tc.load()
+		if err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+			continue
+		}
+		if got := tok.Encode("Hello world"); fmt.Sprint(got) != fmt.Sprint(tc.want) {
+			t.Errorf("%s: Encode = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestMissingVocabulary(t *testing.T) {
+	t.Setenv("TOKENIZER_VOCAB_DIR", t.TempDir())
+
+	if _, err := loadLlama(); err == nil {
+		t.Error("expected an error without llama3.tiktoken")
+	}
+}
@@ -0,0 +1,346 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"ch.at/providers"
+	"golang.org/x/net/websocket"
+)
+
+// /v1/ws carries several chat conversations over one WebSocket. Every
+// frame is a JSON text message with a "type"; the protocol is described in
+// documentation/WEBSOCKET_PROTOCOL.md. The server keeps each
+// conversation's history, so a turn only sends its new messages. Each turn
+// goes through the router like /v1/chat/completions and streams back as
+// delta frames; a cancel frame aborts the upstream call.
+
+const (
+	wsMaxFrameBytes    = 4 << 20 // Images can make messages large
+	wsMaxConversations = 32      // Per connection
+	wsWriteTimeout     = 10 * time.Second
+)
+
+// wsHeartbeatInterval is how often the server sends heartbeat frames,
+// WS_HEARTBEAT_INTERVAL, default 15s
+var wsHeartbeatInterval = 15 * time.Second
+
+func init() {
+	if interval, err := time.ParseDuration(os.Getenv("WS_HEARTBEAT_INTERVAL")); err == nil && interval > 0 {
+		wsHeartbeatInterval = interval
+	}
+}
+
+// WSClientFrame is a frame sent by the client. Chat frames carry the
+// chat completion fields; model and parameters apply to that turn and
+// default to the conversation's previous turn.
+type WSClientFrame struct {
+	Type         string `json:"type"` // chat, cancel, end or ping
+	Conversation string `json:"conversation,omitempty"`
+	ChatRequest
+}
+
+// WSServerFrame is a frame sent by the server
+type WSServerFrame struct {
+	Type              string    `json:"type"` // ready, start, delta, done, cancelled, error, heartbeat or pong
+	Conversation      string    `json:"conversation,omitempty"`
+	ID                string    `json:"id,omitempty"` // Completion ID of the turn
+	Model             string    `json:"model,omitempty"`
+	Content           string    `json:"content,omitempty"`
+	Message           *Message  `json:"message,omitempty"`
+	FinishReason      string    `json:"finish_reason,omitempty"`
+	Usage             *Usage    `json:"usage,omitempty"`
+	Error             *APIError `json:"error,omitempty"`
+	Time              int64     `json:"time,omitempty"`
+	HeartbeatInterval int       `json:"heartbeat_interval,omitempty"` // Seconds
+	ContextPolicy     string    `json:"context_policy,omitempty"`     // How the history was fitted, as in X-Context-Policy
+}
+
+// wsConversation is one conversation's history and its running turn
+type wsConversation struct {
+	messages []providers.Message
+	model    string
+	cancel   context.CancelFunc // Set while a turn is running
+}
+
+// wsSession is one WebSocket connection
+type wsSession struct {
+	ws  *websocket.Conn
+	r   *http.Request // The upgrade request, for tenant and rate limits
+	ctx context.Context
+
+	writeMu sync.Mutex
+
+	mu            sync.Mutex
+	conversations map[string]*wsConversation
+	turns         sync.WaitGroup
+}
+
+// handleWebSocket handles /v1/ws. Origins aren't checked, matching the
+// "Access-Control-Allow-Origin: *" of the HTTP endpoints.
+func handleWebSocket(w http.ResponseWriter, r *http.Request) {
+	if tenantFrom(r) == nil && !rateLimitAllow(r.RemoteAddr) {
+		writeAPIError(w, rateLimited("Rate limit exceeded", time.Second))
+		return
+	}
+	server := websocket.Server{
+		Handshake: func(*websocket.Config, *http.Request) error { return nil },
+		Handler: func(ws *websocket.Conn) {
+			ws.MaxPayloadBytes = wsMaxFrameBytes
+			serveWebSocket(ws, r)
+		},
+	}
+	server.ServeHTTP(w, r)
+}
+
+func serveWebSocket(ws *websocket.Conn, r *http.Request) {
+	ctx, cancel := context.WithCancel(r.Context())
+	s := &wsSession{ws: ws, r: r, ctx: ctx, conversations: make(map[string]*wsConversation)}
+	defer func() {
+		// Closing the connection aborts every running turn
+		cancel()
+		s.turns.Wait()
+		ws.Close()
+	}()
+
+	beacon("ws_connect", map[string]interface{}{
+		"authenticated": tenantFrom(r) != nil,
+	})
+	s.send(WSServerFrame{Type: "ready", HeartbeatInterval: int(wsHeartbeatInterval / time.Second)})
+	go s.heartbeat()
+
+	for {
+		var frame WSClientFrame
+		if err := websocket.JSON.Receive(ws, &frame); err != nil {
+			var syntaxErr *json.SyntaxError
+			var typeErr *json.UnmarshalTypeError
+			if errors.As(err, &syntaxErr) || errors.As(err, &typeErr) {
+				s.send(WSServerFrame{Type: "error", Error: invalidRequest("invalid_json", "", "Invalid JSON: "+err.Error())})
+				continue
+			}
+			if errors.Is(err, websocket.ErrFrameTooLarge) {
+				s.send(WSServerFrame{Type: "error", Error: invalidRequest("frame_too_large", "",
+					fmt.Sprintf("Frames are limited to %d bytes", wsMaxFrameBytes))})
+				continue
+			}
+			return // Closed by the client, or unreadable
+		}
+
+		switch frame.Type {
+		case "chat":
+			s.startTurn(frame)
+		case "cancel":
+			s.cancelTurn(frame.Conversation)
+		case "end":
+			s.endConversation(frame.Conversation)
+		case "ping":
+			s.send(WSServerFrame{Type: "pong", Time: time.Now().Unix()})
+		default:
+			s.send(WSServerFrame{Type: "error", Conversation: frame.Conversation,
+				Error: invalidRequest("invalid_value", "type", fmt.Sprintf("Unknown frame type '%s'", frame.Type))})
+		}
+	}
+}
+
+// send writes one frame; frames from concurrent turns are serialized
+func (s *wsSession) send(frame WSServerFrame) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	s.ws.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+	return websocket.JSON.Send(s.ws, frame)
+}
+
+// heartbeat keeps idle connections open through proxies and lets clients
+// detect a dead link. A failed write closes the connection.
+func (s *wsSession) heartbeat() {
+	ticker := time.NewTicker(wsHeartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := s.send(WSServerFrame{Type: "heartbeat", Time: time.Now().Unix()}); err != nil {
+				s.ws.Close()
+				return
+			}
+		case <-s.ctx.Done():
+			return
+		}
+	}
+}
+
+// fail reports an error for a conversation
+func (s *wsSession) fail(conversation, id string, apiErr *APIError) {
+	s.send(WSServerFrame{Type: "error", Conversation: conversation, ID: id, Error: apiErr})
+}
+
+// startTurn validates a chat frame and runs the turn in the background
+func (s *wsSession) startTurn(frame WSClientFrame) {
+	if frame.Conversation == "" {
+		s.fail("", "", invalidRequest("missing_required_parameter", "conversation", "conversation is required"))
+		return
+	}
+
+	s.mu.Lock()
+	conv, exists := s.conversations[frame.Conversation]
+	switch {
+	case exists && conv.cancel != nil:
+		s.mu.Unlock()
+		s.fail(frame.Conversation, "", invalidRequest("conversation_busy", "conversation",
+			"A turn is already running in this conversation; wait for it or cancel it"))
+		return
+	case !exists && len(s.conversations) >= wsMaxConversations:
+		s.mu.Unlock()
+		s.fail(frame.Conversation, "", invalidRequest("too_many_conversations", "conversation",
+			fmt.Sprintf("At most %d conversations per connection; end one first", wsMaxConversations)))
+		return
+	}
+	req := frame.ChatRequest
+	if req.Model == "" && exists {
+		req.Model = conv.model
+	}
+	s.mu.Unlock()
+
+	if apiErr := req.normalize(); apiErr != nil {
+		s.fail(frame.Conversation, "", apiErr)
+		return
+	}
+	if apiErr := s.admitTurn(req.Model); apiErr != nil {
+		s.fail(frame.Conversation, "", apiErr)
+		return
+	}
+
+	// Frames are read one at a time, so the conversation can't have
+	// changed since it was checked
+	ctx, cancel := context.WithCancel(s.ctx)
+	s.mu.Lock()
+	if !exists {
+		conv = &wsConversation{}
+		s.conversations[frame.Conversation] = conv
+	}
+	conv.cancel = cancel
+	conv.model = req.Model
+	history := append(append([]providers.Message{}, conv.messages...), req.Messages...)
+	s.mu.Unlock()
+
+	s.turns.Add(1)
+	go func() {
+		defer s.turns.Done()
+		defer cancel()
+		s.runTurn(ctx, frame.Conversation, conv, history, req)
+	}()
+}
+
+// admitTurn applies the per-request checks of the HTTP endpoints to a turn
+func (s *wsSession) admitTurn(model string) *APIError {
+	tenant := tenantFrom(s.r)
+	if tenant == nil && !rateLimitAllow(s.r.RemoteAddr) {
+		return rateLimited("Rate limit exceeded", time.Second)
+	}
+	if tenant != nil {
+		if apiErr := checkTenantQuota(tenant, time.Now()); apiErr != nil {
+			return apiErr
+		}
+	}
+	if apiErr := checkModelAllowed(s.r, model); apiErr != nil {
+		return apiErr
+	}
+	if modelRouter == nil {
+		return newAPIError(http.StatusServiceUnavailable, errTypeServer, "", "", "Model router not initialized")
+	}
+	return nil
+}
+
+// runTurn streams one completion and, if it succeeds, adds the turn to
+// the conversation's history. Failed and cancelled turns leave the history
+// as it was, so the client can retry.
+//
+// The client can't trim a history the server holds, so it is fitted to the
+// model with WS_CONTEXT_POLICY first, and a successful turn keeps the fitted
+// history.
+func (s *wsSession) runTurn(ctx context.Context, conversation string, conv *wsConversation, history []providers.Message, req ChatRequest) {
+	id := "chatcmpl-" + generateRequestID()
+	params := req.routerParams()
+	params.Context = ctx
+	history, fit := fitContext(ctx, history, req.Model, params, getServiceContextPolicy("WS"))
+	s.send(WSServerFrame{Type: "start", Conversation: conversation, ID: id, Model: req.Model, ContextPolicy: fit.String()})
+
+	ch := make(chan string)
+	type result struct {
+		resp *LLMResponse
+		err  error
+	}
+	done := make(chan result, 1)
+	go func() {
+		resp, err := LLMWithRouterConv(history, req.Model, "ws_"+conversation, params, ch)
+		done <- result{resp, err}
+	}()
+
+	for text := range ch {
+		s.send(WSServerFrame{Type: "delta", Conversation: conversation, ID: id, Content: text})
+	}
+	res := <-done
+
+	s.mu.Lock()
+	conv.cancel = nil
+	if res.err == nil {
+		conv.messages = append(history, providers.Message{
+			Role:      "assistant",
+			Content:   res.resp.Content,
+			ToolCalls: res.resp.ToolCalls,
+		})
+	}
+	s.mu.Unlock()
+
+	switch {
+	case res.err == nil:
+		chargeTenant(tenantFrom(s.r), req.Model, res.resp)
+		s.send(WSServerFrame{
+			Type:          "done",
+			Conversation:  conversation,
+			ID:            id,
+			Model:         req.Model,
+			Message:       &Message{Role: "assistant", Content: res.resp.Content, ToolCalls: res.resp.ToolCalls},
+			FinishReason:  finishReasonOf(res.resp),
+			Usage:         usageOf(res.resp),
+			ContextPolicy: fit.String(),
+		})
+	case ctx.Err() != nil:
+		// Charge whatever the upstream generated before it was cut off
+		if res.resp != nil {
+			chargeTenant(tenantFrom(s.r), req.Model, res.resp)
+		}
+		s.send(WSServerFrame{Type: "cancelled", Conversation: conversation, ID: id})
+	default:
+		s.fail(conversation, id, apiErrorFor(res.err, req.Model))
+	}
+}
+
+// cancelTurn aborts a conversation's running turn, if any
+func (s *wsSession) cancelTurn(conversation string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if conv, ok := s.conversations[conversation]; ok && conv.cancel != nil {
+		conv.cancel()
+		log.Printf("[WebSocket] Cancelled turn in conversation %s", conversation)
+	}
+}
+
+// endConversation cancels a conversation's turn and forgets its history
+func (s *wsSession) endConversation(conversation string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if conv, ok := s.conversations[conversation]; ok {
+		if conv.cancel != nil {
+			conv.cancel()
+		}
+		delete(s.conversations, conversation)
+	}
+}